@@ -25,6 +25,21 @@ type Server struct {
 
 	nodeActionsMu sync.Mutex
 	nodeActions   map[string][]Action
+
+	// 公平份额的用量与课题组缓存（按 fair_share.cache_seconds 刷新）
+	fairShareMu     sync.Mutex
+	fairShareAt     time.Time
+	fairShareUsage  map[string]float64
+	fairShareGroups map[string]string
+
+	// 排队等待估算所用的型号统计缓存
+	waitStatsMu sync.Mutex
+	waitStatsAt time.Time
+	waitStats   []GPUModelStats
+
+	// 已为普通排队项抢占的卡数（排队项 ID -> 卡数），避免多台节点重复抢占
+	preemptMu      sync.Mutex
+	preemptCredits map[int64]int
 }
 
 const (
@@ -40,6 +55,8 @@ func NewServer(cfg Config, store *Store) *Server {
 		queue:       NewQueue(),
 		metr:        &controllerMetrics{},
 		nodeActions: make(map[string][]Action),
+
+		preemptCredits: make(map[int64]int),
 	}
 }
 
@@ -89,9 +106,21 @@ func (s *Server) Router() *gin.Engine {
 
 	api.POST("/metrics", s.authAgent(), s.handleMetrics)
 	api.GET("/node/actions", s.authAgent(), s.handleNodeActions)
-
-	api.GET("/users/:username/balance", s.handleBalance)
-	api.GET("/users/:username/usage", s.handleUserUsage)
+	api.POST("/node/kill-reports", s.authAgent(), s.handleNodeKillReport)
+	api.POST("/node/enforcement", s.authAgent(), s.handleNodeEnforcement)
+	api.POST("/node/enforcement/drift", s.authAgent(), s.handleNodeEnforcementDrift)
+
+	api.GET("/node/user/whoami", s.authAgent(), s.handleNodeUserWhoami)
+	api.GET("/node/user/balance", s.authAgent(), s.handleNodeUserBalance)
+	api.GET("/node/user/usage", s.authAgent(), s.handleNodeUserUsage)
+	api.GET("/node/user/queue", s.authAgent(), s.handleNodeUserQueue)
+	api.GET("/node/user/preemptions", s.authAgent(), s.handleNodeUserPreemptions)
+	api.POST("/node/user/gpu/request", s.authAgent(), s.handleNodeUserGPURequest)
+	api.DELETE("/node/user/gpu/queue/:id", s.authAgent(), s.handleNodeUserGPUCancel)
+	api.POST("/node/user/bind", s.authAgent(), s.handleNodeUserBind)
+
+	api.GET("/users/:username/balance", s.guardPublicUserQuery(), s.handleBalance)
+	api.GET("/users/:username/usage", s.guardPublicUserQuery(), s.handleUserUsage)
 	api.POST("/users/:username/recharge", s.authAdmin(), s.requireSuperAdmin(), s.handleRecharge)
 
 	user := api.Group("/user")
@@ -99,12 +128,31 @@ func (s *Server) Router() *gin.Engine {
 	user.GET("/me", s.handleUserMe)
 	user.GET("/me/balance", s.handleUserMyBalance)
 	user.GET("/me/usage", s.handleUserMyUsage)
+	user.GET("/me/usage/tags", s.handleUserMyUsageByTag)
 	user.PUT("/me/profile", s.handleUserMyProfileUpdate)
 	user.GET("/me/profile-change-requests", s.handleUserMyProfileChangeRequests)
 	user.GET("/accounts", s.handleUserAccountsList)
 	user.POST("/accounts", s.handleUserAccountsUpsert)
 	user.PUT("/accounts", s.handleUserAccountsUpdate)
 	user.DELETE("/accounts", s.handleUserAccountsDelete)
+	user.GET("/me/spend-caps", s.handleUserMySpendCaps)
+	user.GET("/me/kill-reports", s.handleUserMyKillReports)
+	user.GET("/me/jobs", s.handleUserMyJobs)
+	user.GET("/me/jobs/:id", s.handleUserMyJobDetail)
+	user.GET("/group", s.handleUserMyGroup)
+	user.GET("/projects", s.handleUserMyProjects)
+	user.GET("/me/idle-gpus", s.handleUserMyIdleGPUs)
+	user.GET("/me/preemptions", s.handleUserMyPreemptions)
+	user.GET("/maintenance", s.handleUserMaintenance)
+	user.GET("/reservations", s.handleUserMyReservations)
+	user.POST("/reservations", s.handleUserReservationCreate)
+	user.DELETE("/reservations/:id", s.handleUserReservationCancel)
+	user.GET("/reservations/calendar", s.handleReservationCalendar)
+	user.GET("/advisor/groups", s.handleUserAdvisorGroups)
+	user.GET("/advisor/groups/:id/spend", s.handleUserAdvisorGroupSpend)
+	user.POST("/gpu/request", s.handleUserGPURequest)
+	user.GET("/gpu/queue", s.handleUserGPUQueue)
+	user.DELETE("/gpu/queue/:id", s.handleUserGPUCancel)
 
 	// 用户注册/绑定与 SSH 登录校验
 	api.GET("/registry/resolve", s.handleRegistryResolve)
@@ -128,6 +176,17 @@ func (s *Server) Router() *gin.Engine {
 	admin.GET("/prices", s.requireSuperAdmin(), s.handleAdminPrices)
 	admin.POST("/prices", s.requireSuperAdmin(), s.handleAdminSetPrice)
 	admin.GET("/gpu/queue", s.requireSuperAdmin(), s.handleAdminGPUQueue)
+	admin.DELETE("/gpu/queue/:id", s.requireSuperAdmin(), s.handleAdminGPUCancel)
+	admin.GET("/preemptions", s.requireBoardPermission(), s.handleAdminPreemptions)
+	admin.GET("/maintenance", s.requireBoardPermission(), s.handleAdminMaintenanceList)
+	admin.POST("/maintenance", s.requireSuperAdmin(), s.handleAdminMaintenanceCreate)
+	admin.POST("/maintenance/:id/end", s.requireSuperAdmin(), s.handleAdminMaintenanceEnd)
+	admin.GET("/reservations", s.requireSuperAdmin(), s.handleAdminReservationsList)
+	admin.POST("/reservations", s.requireSuperAdmin(), s.handleAdminReservationCreate)
+	admin.GET("/reservations/calendar", s.requireBoardPermission(), s.handleReservationCalendar)
+	admin.POST("/reservations/:id/approve", s.requireSuperAdmin(), s.handleAdminReservationApprove)
+	admin.POST("/reservations/:id/reject", s.requireSuperAdmin(), s.handleAdminReservationReject)
+	admin.DELETE("/reservations/:id", s.requireSuperAdmin(), s.handleAdminReservationCancel)
 	admin.GET("/requests", s.requireReviewPermission(), s.handleAdminRequestsList)
 	admin.POST("/requests/:id/approve", s.requireReviewPermission(), s.handleAdminRequestApprove)
 	admin.POST("/requests/:id/reject", s.requireReviewPermission(), s.handleAdminRequestReject)
@@ -139,8 +198,17 @@ func (s *Server) Router() *gin.Engine {
 	admin.DELETE("/announcements/:id", s.requireSuperAdmin(), s.handleAnnouncementDelete)
 	admin.GET("/usage", s.requireSuperAdmin(), s.handleAdminUsage)
 	admin.GET("/nodes", s.requireNodesPermission(), s.handleAdminNodes)
+	admin.GET("/nodes/events", s.requireNodesPermission(), s.handleAdminNodeEvents)
+	admin.GET("/gpu-health", s.requireNodesPermission(), s.handleAdminGPUHealth)
+	admin.GET("/inventory", s.requireNodesPermission(), s.handleAdminInventory)
+	admin.GET("/inventory/changes", s.requireNodesPermission(), s.handleAdminInventoryChanges)
+	admin.POST("/gpu-health/:id/resolve", s.requireSuperAdmin(), s.handleAdminGPUHealthResolve)
 	admin.POST("/nodes/:id/ssh/disconnect-all", s.requireSuperAdmin(), s.handleAdminNodeDisconnectAllSSH)
 	admin.GET("/usage/export.csv", s.requireSuperAdmin(), s.handleAdminUsageExportCSV)
+	admin.GET("/kill-reports", s.requireSuperAdmin(), s.handleAdminKillReports)
+	admin.GET("/jobs", s.requireSuperAdmin(), s.handleAdminJobs)
+	admin.GET("/jobs/:id", s.requireSuperAdmin(), s.handleAdminJobDetail)
+	admin.GET("/enforcement/drift", s.requireSuperAdmin(), s.handleAdminEnforcementDrift)
 	admin.GET("/mail/settings", s.requireSuperAdmin(), s.handleAdminMailSettingsGet)
 	admin.POST("/mail/settings", s.requireSuperAdmin(), s.handleAdminMailSettingsSet)
 	admin.POST("/mail/test", s.requireSuperAdmin(), s.handleAdminMailTest)
@@ -161,11 +229,43 @@ func (s *Server) Router() *gin.Engine {
 	admin.POST("/power-users", s.requireSuperAdmin(), s.handleAdminPowerUsersCreate)
 	admin.PUT("/power-users/:username/permissions", s.requireSuperAdmin(), s.handleAdminPowerUsersUpdatePermissions)
 	admin.DELETE("/power-users/:username", s.requireSuperAdmin(), s.handleAdminPowerUsersDelete)
+	admin.GET("/groups", s.requireSuperAdmin(), s.handleAdminGroupsList)
+	admin.POST("/groups", s.requireSuperAdmin(), s.handleAdminGroupCreate)
+	admin.PUT("/groups/:id", s.requireSuperAdmin(), s.handleAdminGroupUpdate)
+	admin.DELETE("/groups/:id", s.requireSuperAdmin(), s.handleAdminGroupDelete)
+	admin.POST("/groups/:id/recharge", s.requireSuperAdmin(), s.handleAdminGroupRecharge)
+	admin.GET("/groups/:id/members", s.requireSuperAdmin(), s.handleAdminGroupMembersList)
+	admin.POST("/groups/:id/members", s.requireSuperAdmin(), s.handleAdminGroupMemberUpsert)
+	admin.DELETE("/groups/:id/members/:username", s.requireSuperAdmin(), s.handleAdminGroupMemberDelete)
+	admin.POST("/groups/:id/sync-members", s.requireSuperAdmin(), s.handleAdminGroupSyncMembers)
+	admin.GET("/groups/:id/spend", s.requireBoardPermission(), s.handleAdminGroupSpend)
+	admin.GET("/projects", s.requireSuperAdmin(), s.handleAdminProjectsList)
+	admin.POST("/projects", s.requireSuperAdmin(), s.handleAdminProjectCreate)
+	admin.PUT("/projects/:id", s.requireSuperAdmin(), s.handleAdminProjectUpdate)
+	admin.DELETE("/projects/:id", s.requireSuperAdmin(), s.handleAdminProjectDelete)
+	admin.GET("/projects/:id/members", s.requireSuperAdmin(), s.handleAdminProjectMembersList)
+	admin.POST("/projects/:id/members", s.requireSuperAdmin(), s.handleAdminProjectMemberAdd)
+	admin.DELETE("/projects/:id/members/:username", s.requireSuperAdmin(), s.handleAdminProjectMemberDelete)
+	admin.GET("/idle-gpus", s.requireBoardPermission(), s.handleAdminIdleGPUs)
+	admin.GET("/idle-gpu-exemptions", s.requireSuperAdmin(), s.handleAdminIdleGPUExemptionsList)
+	admin.POST("/idle-gpu-exemptions", s.requireSuperAdmin(), s.handleAdminIdleGPUExemptionUpsert)
+	admin.DELETE("/idle-gpu-exemptions", s.requireSuperAdmin(), s.handleAdminIdleGPUExemptionDelete)
+	admin.GET("/project-defaults", s.requireSuperAdmin(), s.handleAdminProjectDefaultsList)
+	admin.POST("/project-defaults", s.requireSuperAdmin(), s.handleAdminProjectDefaultUpsert)
+	admin.DELETE("/project-defaults", s.requireSuperAdmin(), s.handleAdminProjectDefaultDelete)
+	admin.GET("/spend-caps", s.requireSuperAdmin(), s.handleAdminSpendCapsList)
+	admin.POST("/spend-caps", s.requireSuperAdmin(), s.handleAdminSpendCapUpsert)
+	admin.DELETE("/spend-caps", s.requireSuperAdmin(), s.handleAdminSpendCapDelete)
+	admin.GET("/policies", s.requireSuperAdmin(), s.handleAdminPoliciesList)
+	admin.POST("/policies", s.requireSuperAdmin(), s.handleAdminPolicyUpsert)
+	admin.DELETE("/policies", s.requireSuperAdmin(), s.handleAdminPolicyDelete)
+	admin.GET("/policies/effective", s.requireSuperAdmin(), s.handleAdminPolicyEffective)
 	admin.GET("/stats/users", s.requireBoardPermission(), s.handleAdminStatsUsers)
 	admin.GET("/stats/platform-users", s.requireBoardPermission(), s.handleAdminStatsPlatformUsers)
 	admin.GET("/stats/platform-users/:username/nodes", s.requireBoardPermission(), s.handleAdminStatsPlatformUserNodes)
 	admin.GET("/stats/monthly", s.requireBoardPermission(), s.handleAdminStatsMonthly)
 	admin.GET("/stats/recharges", s.requireBoardPermission(), s.handleAdminStatsRecharges)
+	admin.GET("/stats/tags", s.requireBoardPermission(), s.handleAdminStatsTags)
 
 	s.maybeServeWeb(r)
 	return r
@@ -178,8 +278,14 @@ func (s *Server) authSession() gin.HandlerFunc {
 			return
 		}
 		secret := strings.TrimSpace(s.cfg.AuthSecret)
+		// 命令行客户端（gpuops）以 Authorization: Bearer <会话令牌> 携带登录时签发的令牌；
+		// 令牌不会被浏览器自动附带，因此不需要 CSRF 校验。
+		bearer := false
 		cookie, err := c.Cookie(sessionCookieName)
 		if err != nil || strings.TrimSpace(cookie) == "" {
+			cookie, bearer = sessionBearerToken(c)
+		}
+		if strings.TrimSpace(cookie) == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
 		}
@@ -193,7 +299,7 @@ func (s *Server) authSession() gin.HandlerFunc {
 		c.Set("auth_perms", p.Perms)
 		c.Set("csrf", p.Nonce)
 
-		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions {
+		if !bearer && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions {
 			want := p.Nonce
 			got := strings.TrimSpace(c.GetHeader("X-CSRF-Token"))
 			if want == "" || got == "" || want != got {
@@ -205,6 +311,16 @@ func (s *Server) authSession() gin.HandlerFunc {
 	}
 }
 
+func sessionBearerToken(c *gin.Context) (string, bool) {
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	const prefix = "Bearer "
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	tok := strings.TrimSpace(strings.TrimPrefix(auth, prefix))
+	return tok, tok != ""
+}
+
 func (s *Server) authAgent() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tok := strings.TrimSpace(c.GetHeader("X-Agent-Token"))
@@ -415,7 +531,11 @@ func (s *Server) handleRecharge(c *gin.Context) {
 	var res BalanceUpdateResult
 	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
 		var err error
-		res, err = s.store.RechargeTx(ctx, tx, username, req.Amount, req.Method, now, s.cfg)
+		policy, err := s.store.ResolveUserPolicyTx(ctx, tx, username, s.cfg)
+		if err != nil {
+			return err
+		}
+		res, err = s.store.RechargeTx(ctx, tx, username, req.Amount, req.Method, now, policy.ApplyTo(s.cfg))
 		return err
 	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -1242,7 +1362,8 @@ func (s *Server) handleAdminStatsUsers(c *gin.Context) {
 		return
 	}
 	limit := parseLimit(c.Query("limit"), 1000, 10000)
-	rows, err := s.store.ListUsageSummaryByUser(c.Request.Context(), from, to, limit)
+	byProject := strings.TrimSpace(c.Query("by")) == "project"
+	rows, err := s.store.ListUsageSummaryByUser(c.Request.Context(), from, to, limit, byProject)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1336,7 +1457,8 @@ func (s *Server) handleAdminStatsMonthly(c *gin.Context) {
 		return
 	}
 	limit := parseLimit(c.Query("limit"), 20000, 200000)
-	rows, err := s.store.ListUsageMonthlyByUser(c.Request.Context(), from, to, limit)
+	byProject := strings.TrimSpace(c.Query("by")) == "project"
+	rows, err := s.store.ListUsageMonthlyByUser(c.Request.Context(), from, to, limit, byProject)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1371,6 +1493,34 @@ func (s *Server) handleAdminNodes(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 附带未结束的维护窗口；drained 表示排空中且已没有用户进程，可以开始维护
+	windows, err := s.store.ListMaintenance(c.Request.Context(), "", false, time.Now(), 5000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	byNode := make(map[string]NodeMaintenance, len(windows))
+	for _, m := range windows {
+		if cur, ok := byNode[m.NodeID]; !ok || m.DrainAt.Before(cur.DrainAt) {
+			byNode[m.NodeID] = m
+		}
+	}
+	issues, err := s.store.ListGPUHealthIssues(c.Request.Context(), "", false, 5000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	issuesByNode := make(map[string][]GPUHealthIssue)
+	for _, it := range issues {
+		issuesByNode[it.NodeID] = append(issuesByNode[it.NodeID], it)
+	}
+	for i := range nodes {
+		nodes[i].HealthIssues = issuesByNode[nodes[i].NodeID]
+		if m, ok := byNode[nodes[i].NodeID]; ok {
+			nodes[i].Maintenance = &m
+			nodes[i].Drained = m.State != "scheduled" && nodes[i].GPUProcessCount == 0 && nodes[i].CPUProcessCount == 0
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"nodes": nodes})
 }
 
@@ -1409,6 +1559,7 @@ func (s *Server) handleAdminNodeDisconnectAllSSH(c *gin.Context) {
 
 func (s *Server) handleAdminUsageExportCSV(c *gin.Context) {
 	username := strings.TrimSpace(c.Query("username"))
+	project := strings.TrimSpace(c.Query("project"))
 	fromStr := strings.TrimSpace(c.Query("from"))
 	toStr := strings.TrimSpace(c.Query("to"))
 	limit := 20000
@@ -1440,7 +1591,7 @@ func (s *Server) handleAdminUsageExportCSV(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	rows, err := s.store.queryUsageRows(ctx, username, fromStr != "", from, toStr != "", to, limit)
+	rows, err := s.store.queryUsageRows(ctx, username, project, fromStr != "", from, toStr != "", to, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1452,14 +1603,14 @@ func (s *Server) handleAdminUsageExportCSV(c *gin.Context) {
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
 
 	w := csv.NewWriter(c.Writer)
-	_ = w.Write([]string{"timestamp", "node_id", "billing_username", "local_username", "cpu_percent", "memory_mb", "cost", "gpu_usage_json"})
+	_ = w.Write([]string{"timestamp", "node_id", "billing_username", "local_username", "cpu_percent", "memory_mb", "cost", "gpu_usage_json", "project"})
 
 	for rows.Next() {
-		var nodeID, user, localUsername string
+		var nodeID, user, localUsername, projectName string
 		var ts time.Time
 		var cpuPercent, memoryMB, cost float64
 		var gpuUsage string
-		if err := rows.Scan(&nodeID, &user, &ts, &cpuPercent, &memoryMB, &gpuUsage, &cost, &localUsername); err != nil {
+		if err := rows.Scan(&nodeID, &user, &ts, &cpuPercent, &memoryMB, &gpuUsage, &cost, &localUsername, &projectName); err != nil {
 			c.Status(http.StatusInternalServerError)
 			return
 		}
@@ -1472,6 +1623,7 @@ func (s *Server) handleAdminUsageExportCSV(c *gin.Context) {
 			fmt.Sprintf("%.4f", memoryMB),
 			fmt.Sprintf("%.4f", cost),
 			gpuUsage,
+			projectName,
 		})
 	}
 	w.Flush()
@@ -1570,9 +1722,10 @@ func (s *Server) handleNodeActions(c *gin.Context) {
 }
 
 type gpuRequestReq struct {
-	Username string `json:"username"`
-	GPUType  string `json:"gpu_type"`
-	Count    int    `json:"count"`
+	Username    string `json:"username"`
+	GPUType     string `json:"gpu_type"`
+	Count       int    `json:"count"`
+	Preemptible bool   `json:"preemptible"`
 }
 
 func (s *Server) handleGPURequest(c *gin.Context) {
@@ -1581,38 +1734,27 @@ func (s *Server) handleGPURequest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	req.Username = strings.TrimSpace(req.Username)
-	req.GPUType = strings.TrimSpace(req.GPUType)
-	if req.Username == "" || req.GPUType == "" || req.Count <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username/gpu_type/count 参数不合法"})
-		return
-	}
+	// 匿名接口的 username 未经认证：只排队，不为其抢占 scavenger 进程
+	s.enqueueGPURequest(c, req.Username, req.GPUType, req.Count, req.Preemptible, false)
+}
 
-	item := QueueItem{
-		Username:  req.Username,
-		GPUType:   req.GPUType,
-		Count:     req.Count,
-		Timestamp: time.Now(),
+func (s *Server) handleAdminGPUQueue(c *gin.Context) {
+	items, _, err := s.rankedQueue(c.Request.Context(), "")
+	resp := gin.H{"queue": items, "fair_share_enabled": s.cfg.FairShare.Enabled, "gpu_models": s.gpuModelStats(c.Request.Context())}
+	if err != nil {
+		resp["fair_share_error"] = err.Error()
 	}
-
-	pos := s.queue.Enqueue(item)
-	estimated := estimateWaitMinutes(pos)
-
-	c.JSON(http.StatusOK, gin.H{
-		"status":            "queued",
-		"position":          pos,
-		"estimated_minutes": estimated,
-		"message":           "当前无可用 GPU，已加入排队",
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
-func (s *Server) handleAdminGPUQueue(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"queue": s.queue.Snapshot()})
+// startedGPUJob 为本次上报中新出现的 GPU 作业，用于判断排队请求已取到卡。
+type startedGPUJob struct {
+	username string
+	gpuModel string
 }
 
 func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS time.Time) ([]Action, error) {
 	now := time.Now()
-	grace := time.Duration(s.cfg.KillGracePeriodSeconds) * time.Second
 	intervalSeconds := s.cfg.SampleIntervalSeconds
 	if data.IntervalSeconds > 0 && data.IntervalSeconds <= 600 {
 		intervalSeconds = data.IntervalSeconds
@@ -1626,8 +1768,9 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 		pids []int32
 	}
 	type billingAgg struct {
-		cost   float64
-		locals map[string]*localAgg // local_username -> pids
+		cost    float64
+		groupID int                  // >0 表示由课题组余额承担
+		locals  map[string]*localAgg // local_username -> pids
 	}
 	billingAggs := make(map[string]*billingAgg)
 	usageRecords := 0
@@ -1636,6 +1779,11 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 	costTotal := 0.0
 
 	var actions []Action
+	var capAlerts []spendCapAlert
+	var idleAlerts []idleGPUAlert
+	var startedGPUJobs []startedGPUJob
+	var nodeBack *NodeStatusEvent
+	var healthIssues []GPUHealthIssue
 	duplicate := false
 
 	err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
@@ -1658,8 +1806,26 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 			cpuPricePerCoreMinute = v
 		}
 
+		// 作业聚合：同一 (本地账号, 进程组/PID, 命令) 的进程在本次上报内先合计
+		type pendingUsage struct {
+			local   string
+			proc    UserProcess
+			cost    float64
+			groupID int
+			jobKey  string
+			project int
+		}
+		var pending []pendingUsage
+		jobSamples := make(map[string]*JobSample)
+		var jobOrder []string
+
 		// 同一台节点的映射在一次上报内复用，避免对每个进程重复查库
 		resolveCache := make(map[string]string) // local_username -> billing_username（未绑定时为自身）
+		groupCache := make(map[string]int)      // billing_username -> 承担费用的课题组（0 表示个人）
+		projectCache := make(map[string]int)    // local_username + 项目标签 -> 项目（0 表示未归属）
+		monthStart := startOfMonth(now)
+		projectCost := make(map[int]float64)
+		projectLocals := make(map[int]map[string]bool)
 
 		for _, proc := range data.Users {
 			localUsername := strings.TrimSpace(proc.Username)
@@ -1680,15 +1846,27 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 				}
 				resolveCache[localUsername] = billingUsername
 			}
+			groupID, ok := groupCache[billingUsername]
+			if !ok {
+				gid, useGroup, err := s.store.ResolveGroupBillingTx(ctx, tx, billingUsername, monthStart)
+				if err != nil {
+					return err
+				}
+				if useGroup {
+					groupID = gid
+				}
+				groupCache[billingUsername] = groupID
+			}
 
 			gpuCost := 0.0
 			if len(proc.GPUUsage) > 0 {
-				gpuCost = CalculateProcessCost(proc, priceIndex, s.cfg.DefaultPricePerMinute)
+				gpuCost = CalculateProcessCost(proc, priceIndex, s.cfg.DefaultPricePerMinute, s.cfg.Scavenger)
 			}
 			proc.Command = strings.TrimSpace(proc.Command)
 			if len(proc.Command) > 256 {
 				proc.Command = proc.Command[:256]
 			}
+			proc.Tags = SanitizeTags(proc.Tags)
 			cpuCost := (proc.CPUPercent / 100.0) * cpuPricePerCoreMinute * intervalMinutes
 			cost := round4(gpuCost + cpuCost)
 
@@ -1696,12 +1874,34 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 			if len(proc.GPUUsage) == 0 && proc.CPUPercent < 1.0 {
 				continue
 			}
-			// usage_records 归集到计费账号，便于按“中心账号”对账/查询
+			// usage_records 归集到计费账号，便于按“中心账号”对账/查询；先按作业合计，作业行写入后再落库
 			procForStore := proc
 			procForStore.Username = billingUsername
-			if err := s.store.InsertUsageRecordTx(ctx, tx, data.NodeID, localUsername, reportTS, procForStore, cost); err != nil {
-				return err
+			projectKey := localUsername + "\x00" + proc.Tags[projectTagKey]
+			projectID, ok := projectCache[projectKey]
+			if !ok {
+				projectID, err = s.store.ResolveProjectTx(ctx, tx, data.NodeID, localUsername, billingUsername, proc.Tags[projectTagKey])
+				if err != nil {
+					return err
+				}
+				projectCache[projectKey] = projectID
+			}
+			if projectID > 0 {
+				projectCost[projectID] += cost
+				if projectLocals[projectID] == nil {
+					projectLocals[projectID] = make(map[string]bool)
+				}
+				projectLocals[projectID][localUsername] = true
+			}
+			jk := localUsername + "\x00" + JobKey(proc) + "\x00" + proc.Command
+			js := jobSamples[jk]
+			if js == nil {
+				js = &JobSample{LocalUsername: localUsername, Username: billingUsername, JobKey: JobKey(proc), Command: proc.Command, GroupID: groupID, ProjectID: projectID}
+				jobSamples[jk] = js
+				jobOrder = append(jobOrder, jk)
 			}
+			js.Add(proc, cost, intervalMinutes)
+			pending = append(pending, pendingUsage{local: localUsername, proc: procForStore, cost: cost, groupID: groupID, jobKey: jk, project: projectID})
 			usageRecords++
 			costTotal += cost
 			if len(proc.GPUUsage) > 0 {
@@ -1712,7 +1912,7 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 
 			b := billingAggs[billingUsername]
 			if b == nil {
-				b = &billingAgg{locals: make(map[string]*localAgg)}
+				b = &billingAgg{groupID: groupID, locals: make(map[string]*localAgg)}
 				billingAggs[billingUsername] = b
 			}
 			b.cost += cost
@@ -1724,34 +1924,189 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 			la.pids = append(la.pids, proc.PID)
 		}
 
+		jobIDs := make(map[string]int64, len(jobOrder))
+		newJobs := make(map[string]bool)
+		gap := s.cfg.JobMergeGap(intervalSeconds)
+		for _, jk := range jobOrder {
+			id, created, err := s.store.UpsertJobSampleTx(ctx, tx, data.NodeID, reportTS, intervalSeconds, gap, *jobSamples[jk])
+			if err != nil {
+				return err
+			}
+			jobIDs[jk] = id
+			newJobs[jk] = created
+		}
+		for _, p := range pending {
+			if err := s.store.InsertUsageRecordTx(ctx, tx, data.NodeID, p.local, reportTS, p.proc, p.cost, p.groupID, jobIDs[p.jobKey], p.project); err != nil {
+				return err
+			}
+			if newJobs[p.jobKey] && len(p.proc.GPUUsage) > 0 {
+				// 新的 GPU 作业：提交后用于结束对应的排队项
+				newJobs[p.jobKey] = false
+				startedGPUJobs = append(startedGPUJobs, startedGPUJob{username: p.proc.Username, gpuModel: p.proc.GPUUsage[0].GPUModel})
+			}
+		}
+
+		gpuSamples := make([]gpuProcSample, 0, len(pending))
+		for _, p := range pending {
+			if len(p.proc.GPUUsage) > 0 {
+				gpuSamples = append(gpuSamples, gpuProcSample{local: p.local, proc: p.proc, cost: p.cost})
+			}
+		}
+		if s.cfg.IdleGPU.Enabled {
+			acts, alerts, err := s.detectIdleGPUsTx(ctx, tx, data.NodeID, data.GPUs, reportTS, now, gap, gpuSamples)
+			if err != nil {
+				return err
+			}
+			actions = append(actions, acts...)
+			idleAlerts = append(idleAlerts, alerts...)
+		}
+		// 节点维护：排空开始时通知在线用户，维护开始时按需断开 SSH
+		localUsers := make([]string, 0, len(data.SSHUsers)+len(data.Users))
+		seenLocal := make(map[string]bool)
+		for _, u := range data.SSHUsers {
+			if u = strings.TrimSpace(u); u != "" && !seenLocal[u] {
+				seenLocal[u] = true
+				localUsers = append(localUsers, u)
+			}
+		}
+		for _, p := range pending {
+			if !seenLocal[p.local] {
+				seenLocal[p.local] = true
+				localUsers = append(localUsers, p.local)
+			}
+		}
+		acts, draining, err := s.applyMaintenanceTx(ctx, tx, data.NodeID, now, localUsers)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, acts...)
+		// 预约保护：生效中的预约卡上只允许预约人（或预约课题组组员）的进程
+		acts, err = s.enforceReservationsTx(ctx, tx, data.NodeID, now, gpuSamples)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, acts...)
+		// scavenger 档：普通排队请求缺卡时抢占（排空中的节点不再分配，不抢占）
+		if !draining {
+			acts, err = s.preemptScavengersTx(ctx, tx, data.NodeID, data.GPUModel, now, gpuSamples)
+			if err != nil {
+				return err
+			}
+			actions = append(actions, acts...)
+		}
+
+		// 项目预算只做提醒：本次上报使项目本月费用越过预算时，通知本次参与该项目的本地账号
+		for projectID, cost := range projectCost {
+			name, budget, spend, err := s.store.GetProjectSpendTx(ctx, tx, projectID, monthStart)
+			if err != nil {
+				return err
+			}
+			if !ProjectBudgetCrossed(spend-cost, spend, budget) {
+				continue
+			}
+			msg := fmt.Sprintf("项目 %s 本月费用 %.2f 已达到预算 %.2f", name, spend, *budget)
+			for localUsername := range projectLocals[projectID] {
+				actions = append(actions, Action{Type: "notify", Username: localUsername, Message: msg})
+			}
+		}
+
 		for billingUsername, b := range billingAggs {
-			res, err := s.store.DeductBalanceTx(ctx, tx, billingUsername, b.cost, now, s.cfg)
+			// 用户/课题组可覆盖全局阈值、宽限期与 CPU 限制
+			policy, err := s.store.ResolveUserPolicyTx(ctx, tx, billingUsername, s.cfg)
+			if err != nil {
+				return err
+			}
+			ucfg := policy.ApplyTo(s.cfg)
+
+			// 消费上限：本次用量已写入 usage_records，统计值包含本次费用；触发后在扣费时按 limited 处理。
+			// 全局上限限制账号本身；单节点上限只叠加到本节点的动作上
+			capNotice := ""
+			prevNodeUntil, err := s.store.NodeSpendCapLimitTx(ctx, tx, billingUsername, data.NodeID)
+			if err != nil {
+				return err
+			}
+			breaches, err := s.store.CheckSpendCapsTx(ctx, tx, billingUsername, data.NodeID, now)
+			if err != nil {
+				return err
+			}
+			for _, breach := range breaches {
+				changed, err := s.store.MarkSpendCapLimitedTx(ctx, tx, billingUsername, breach, now, ucfg)
+				if err != nil {
+					return err
+				}
+				if changed {
+					capNotice = breach.Message()
+					capAlerts = append(capAlerts, spendCapAlert{username: billingUsername, breach: breach})
+				}
+			}
+			nodeUntil, err := s.store.NodeSpendCapLimitTx(ctx, tx, billingUsername, data.NodeID)
 			if err != nil {
 				return err
 			}
+			if nodeUntil != nil && !now.Before(*nodeUntil) {
+				if err := s.store.ClearNodeSpendCapLimitTx(ctx, tx, billingUsername, data.NodeID); err != nil {
+					return err
+				}
+				nodeUntil = nil
+			}
+
+			var res BalanceUpdateResult
+			if b.groupID > 0 {
+				// 课题组组员：费用从组余额扣除，限制状态也以组余额及课题组阈值为准
+				gp, err := s.store.ResolveGroupPolicyTx(ctx, tx, b.groupID, s.cfg)
+				if err != nil {
+					return err
+				}
+				if res, err = s.store.DeductGroupBalanceTx(ctx, tx, b.groupID, billingUsername, b.cost, now, gp.ApplyTo(s.cfg)); err != nil {
+					return err
+				}
+				policy = policy.WithBalanceThresholds(gp)
+			} else if res, err = s.store.DeductBalanceTx(ctx, tx, billingUsername, b.cost, now, ucfg); err != nil {
+				return err
+			}
 
 			// 注意：扣费与余额状态以“计费账号”为准；但下发动作必须针对“节点本地账号”，否则 Agent 无法生效。
+			prevStatus, nodeStatus := NodeCapStatuses(res.PrevStatus, res.User.Status, prevNodeUntil, nodeUntil, now)
 			for localUsername, la := range b.locals {
 				uLocal := res.User
 				uLocal.Username = localUsername
-				actions = append(actions, DecideActions(now, res.PrevStatus, uLocal, s.cfg.WarningThreshold, s.cfg.LimitedThreshold, grace, la.pids)...)
+				uLocal.Status = nodeStatus
+				acts := DecideActions(now, prevStatus, uLocal, policy.WarningThreshold, policy.LimitedThreshold, policy.KillGrace(), la.pids)
+				for i := range acts {
+					if acts[i].Type == "kill_process" {
+						acts[i].KillLadder = s.cfg.KillSignalLadder
+					}
+				}
+				if capNotice != "" {
+					for i := range acts {
+						if acts[i].Type == "block_user" {
+							acts[i].Reason = capNotice
+						}
+					}
+					acts = append(acts, Action{
+						Type:     "notify",
+						Username: localUsername,
+						Message:  capNotice,
+					})
+				}
+				actions = append(actions, acts...)
 
 				if s.cfg.EnableCPUControl {
-					if res.User.Status == "limited" {
+					if nodeStatus == "limited" {
 						actions = append(actions, Action{
 							Type:            "set_cpu_quota",
 							Username:        localUsername,
-							CPUQuotaPercent: s.cfg.CPULimitPercentLimited,
+							CPUQuotaPercent: policy.CPULimitPercentLimited,
 							Reason:          "余额不足，限制 CPU 使用",
 						})
-					} else if res.User.Status == "blocked" {
+					} else if nodeStatus == "blocked" {
 						actions = append(actions, Action{
 							Type:            "set_cpu_quota",
 							Username:        localUsername,
-							CPUQuotaPercent: s.cfg.CPULimitPercentBlocked,
+							CPUQuotaPercent: policy.CPULimitPercentBlocked,
 							Reason:          "已欠费，强限制 CPU 使用",
 						})
-					} else if res.PrevStatus == "limited" || res.PrevStatus == "blocked" {
+					} else if prevStatus == "limited" || prevStatus == "blocked" {
 						actions = append(actions, Action{
 							Type:            "set_cpu_quota",
 							Username:        localUsername,
@@ -1760,9 +2115,16 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 						})
 					}
 				}
+				if s.cfg.EnableResourceLimits {
+					actions = append(actions, DecideResourceLimitActions(localUsername, nodeStatus, prevStatus, s.cfg.ResourceLimitsLimited, s.cfg.ResourceLimitsBlocked)...)
+				}
 			}
 		}
 
+		// 离线检测判定离线的节点恢复上报：记录上线并在提交后告警
+		if nodeBack, err = s.store.MarkNodeOnlineTx(ctx, tx, data.NodeID, now, draining); err != nil {
+			return err
+		}
 		// 更新节点状态（用于运维查看在线/上报情况）
 		if err := s.store.UpsertNodeStatusTx(
 			ctx,
@@ -1786,6 +2148,16 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 		); err != nil {
 			return err
 		}
+		// 软硬件清单：Agent 按较长周期携带，字段变化写入变化记录
+		if data.Inventory != nil {
+			if _, err := s.store.UpdateNodeInventoryTx(ctx, tx, data.NodeID, *data.Inventory, now); err != nil {
+				return err
+			}
+		}
+		// 硬件健康：ECC / 退役页 / Xid / 掉卡，新问题在提交后告警
+		if healthIssues, err = s.syncGPUHealthTx(ctx, tx, data.NodeID, data.Health, now); err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -1796,6 +2168,29 @@ func (s *Server) processMetrics(ctx context.Context, data MetricsData, reportTS
 		s.metr.observeReport(now, true, 0, pending)
 		return pending, nil
 	}
+	for _, a := range capAlerts {
+		go s.sendSpendCapMail(a.username, a.breach)
+	}
+	for _, a := range idleAlerts {
+		go s.sendIdleGPUMail(a.username, a.message)
+	}
+	if len(healthIssues) > 0 {
+		s.metr.gpuHealthIssuesTotal.Add(int64(len(healthIssues)))
+		go s.sendGPUHealthAlert(data.NodeID, healthIssues)
+	}
+	if nodeBack != nil {
+		s.metr.observeNodeEvent(*nodeBack)
+		if !nodeBack.InMaintenance {
+			go s.sendNodeStatusAlert(*nodeBack)
+		}
+	} else {
+		s.metr.setNodeUp(data.NodeID, true)
+	}
+	for _, j := range startedGPUJobs {
+		if it, ok := s.queue.Fulfill(j.username, j.gpuModel); ok {
+			s.metr.observeQueueWait(it.predicted, now.Sub(it.Timestamp))
+		}
+	}
 	actions = append(actions, s.popNodeActions(data.NodeID)...)
 	s.metr.observeReport(now, false, usageRecords, actions)
 	return actions, nil
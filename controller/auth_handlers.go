@@ -66,6 +66,9 @@ func (s *Server) handleAuthMe(c *gin.Context) {
 	secret := strings.TrimSpace(s.cfg.AuthSecret)
 	cookie, err := c.Cookie(sessionCookieName)
 	if err != nil || strings.TrimSpace(cookie) == "" {
+		cookie, _ = sessionBearerToken(c)
+	}
+	if strings.TrimSpace(cookie) == "" {
 		c.JSON(http.StatusOK, gin.H{"authenticated": false})
 		return
 	}
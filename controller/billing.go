@@ -12,16 +12,25 @@ type PriceIndex struct {
 	// models 按长度倒序，避免 "RTX 30" 抢先匹配 "RTX 3090"
 	models []string
 	price  map[string]float64
+	// mig 为 MIG 规格单价（型号以规格结尾，如 "A100 1g.10gb"），同样按型号长度倒序
+	mig []migPrice
 }
 
 func NewPriceIndex(rows []PriceRow) PriceIndex {
 	price := make(map[string]float64, len(rows))
 	models := make([]string, 0, len(rows))
+	var mig []migPrice
 	for _, r := range rows {
 		m := strings.TrimSpace(r.Model)
 		if m == "" {
 			continue
 		}
+		fields := strings.Fields(m)
+		if profile := fields[len(fields)-1]; migProfileRe.MatchString(strings.ToLower(profile)) {
+			card := strings.TrimSpace(strings.TrimSuffix(m, profile))
+			mig = append(mig, migPrice{card: card, profile: strings.ToLower(profile), price: r.Price})
+			continue
+		}
 		price[m] = r.Price
 		models = append(models, m)
 	}
@@ -31,7 +40,8 @@ func NewPriceIndex(rows []PriceRow) PriceIndex {
 		}
 		return len(models[i]) > len(models[j])
 	})
-	return PriceIndex{models: models, price: price}
+	sort.Slice(mig, func(i, j int) bool { return len(mig[i].card) > len(mig[j].card) })
+	return PriceIndex{models: models, price: price, mig: mig}
 }
 
 func (pi PriceIndex) MatchPrice(gpuModel string) (float64, bool) {
@@ -43,15 +53,14 @@ func (pi PriceIndex) MatchPrice(gpuModel string) (float64, bool) {
 	return 0, false
 }
 
-// CalculateProcessCost 计算单个进程在一个采样周期（默认 1 分钟）内的费用。
-func CalculateProcessCost(proc UserProcess, prices PriceIndex, defaultPricePerMinute float64) float64 {
+// CalculateProcessCost 计算单个进程在一个采样周期（默认 1 分钟）内的费用；scavenger 档进程按折扣计价。
+func CalculateProcessCost(proc UserProcess, prices PriceIndex, defaultPricePerMinute float64, scavenger ScavengerConfig) float64 {
 	cost := 0.0
 	for _, g := range proc.GPUUsage {
-		if p, ok := prices.MatchPrice(g.GPUModel); ok {
-			cost += p
-		} else {
-			cost += defaultPricePerMinute
-		}
+		cost += prices.GPUPrice(g, defaultPricePerMinute)
+	}
+	if scavenger.Enabled && IsScavenger(proc) {
+		cost *= scavenger.priceFactor()
 	}
 	// 金额保留 4 位小数，便于后续聚合与对账
 	return math.Round(cost*10000) / 10000
@@ -108,6 +117,14 @@ func DecideActions(now time.Time, prevStatus string, user User, warningThreshold
 			})
 		}
 	case "blocked":
+		// 从 normal/warning 直接进入 blocked（单次扣费跨过 limited）时同样要限制新任务，与 DesiredEnforcement 一致
+		if prevStatus != "blocked" && prevStatus != "limited" {
+			actions = append(actions, Action{
+				Type:     "block_user",
+				Username: user.Username,
+				Reason:   formatBalanceMessage("已欠费，限制新 GPU 任务", user.Balance),
+			})
+		}
 		// 首次进入 blocked 先提醒，超过宽限期再 kill
 		if prevStatus != "blocked" {
 			actions = append(actions, Action{
@@ -130,6 +147,11 @@ func DecideActions(now time.Time, prevStatus string, user User, warningThreshold
 	return actions
 }
 
+// startOfMonth 返回 t 所在自然月的起点（本地时区），用于按月统计额度。
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
 func formatBalanceMessage(prefix string, balance float64) string {
 	return strings.TrimSpace(prefix) + "（当前余额：" + formatMoney(balance) + " 元）"
 }
@@ -19,7 +19,7 @@ func TestCalculateProcessCost_MatchAndDefault(t *testing.T) {
 		},
 	}
 
-	got := CalculateProcessCost(proc, pi, 0.1)
+	got := CalculateProcessCost(proc, pi, 0.1, ScavengerConfig{})
 	want := 0.6
 	if got != want {
 		t.Fatalf("cost=%v want=%v", got, want)
@@ -44,3 +44,23 @@ func TestStatusAndActions_GraceKill(t *testing.T) {
 		t.Fatalf("expected kill_process action")
 	}
 }
+
+func TestDecideActionsNormalToBlocked(t *testing.T) {
+	now := time.Date(2026, 2, 5, 16, 0, 0, 0, time.UTC)
+	u := User{Username: "alice", Balance: -3, Status: "blocked", BlockedAt: &now}
+	// 与 DesiredEnforcement 口径一致：blocked 必须限制 GPU
+	if want := DesiredEnforcement("alice", "alice", "blocked", BillingPolicy{}, Config{}); !want.GPUBlocked {
+		t.Fatalf("desired enforcement for blocked should block GPU: %+v", want)
+	}
+	for _, prev := range []string{"normal", "warning"} {
+		acts := DecideActions(now, prev, u, 100, 10, 10*time.Minute, []int32{123})
+		if len(acts) != 2 || acts[0].Type != "block_user" || acts[1].Type != "notify" {
+			t.Fatalf("%s -> blocked should block and notify: %+v", prev, acts)
+		}
+	}
+	// 已经在 limited 时 block_user 已下发过，不重复
+	acts := DecideActions(now, "limited", u, 100, 10, 10*time.Minute, nil)
+	if len(acts) != 1 || acts[0].Type != "notify" {
+		t.Fatalf("limited -> blocked should only notify: %+v", acts)
+	}
+}
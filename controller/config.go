@@ -27,15 +27,43 @@ type Config struct {
 
 	CPUPricePerCoreMinute float64 `yaml:"cpu_price_per_core_minute"`
 	SampleIntervalSeconds int     `yaml:"sample_interval_seconds"`
+	// JobMergeGapSeconds 为同一作业两次采样之间允许的最大间隔，超过则视为新作业；0 表示 2 个上报周期。
+	JobMergeGapSeconds int `yaml:"job_merge_gap_seconds"`
 
 	EnableCPUControl       bool    `yaml:"enable_cpu_control"`
 	CPULimitPercentLimited float64 `yaml:"cpu_limit_percent_limited"`
 	CPULimitPercentBlocked float64 `yaml:"cpu_limit_percent_blocked"`
 
+	// EnableResourceLimits 为 true 时，对 limited/blocked 用户的 user-<uid>.slice 下发内存与进程数限制
+	EnableResourceLimits  bool           `yaml:"enable_resource_limits"`
+	ResourceLimitsLimited ResourceLimits `yaml:"resource_limits_limited"`
+	ResourceLimitsBlocked ResourceLimits `yaml:"resource_limits_blocked"`
+
 	KillGracePeriodSeconds int `yaml:"kill_grace_period_seconds"`
+	// KillSignalLadder 为 kill_process 的信号阶梯（给训练任务留出保存 checkpoint 的时间）；为空时 Agent 按 SIGTERM → 5s → SIGKILL。
+	KillSignalLadder []KillStep `yaml:"kill_signal_ladder"`
+
+	// IdleGPU 为空闲占卡识别与回收配置（默认关闭）
+	IdleGPU IdleGPUConfig `yaml:"idle_gpu"`
+	// Reservations 为 GPU 预约配置
+	Reservations ReservationConfig `yaml:"reservations"`
+	// FairShare 为 GPU 排队的公平份额配置（默认关闭，按先来后到）
+	FairShare FairShareConfig `yaml:"fair_share"`
+	// Scavenger 为可抢占低价档配置（默认关闭）
+	Scavenger ScavengerConfig `yaml:"scavenger"`
+	// NodeWatch 为节点离线检测与告警配置
+	NodeWatch NodeWatchConfig `yaml:"node_watch"`
+	// GPUHealth 为 GPU 硬件健康判定配置（告警沿用 node_watch 的收件人）
+	GPUHealth GPUHealthConfig `yaml:"gpu_health"`
+	// Inventory 为驱动 / CUDA / 系统版本清单的基线配置
+	Inventory InventoryConfig `yaml:"inventory"`
 
 	DryRun bool `yaml:"dry_run"`
 
+	// LockPublicUserQuery 为 true 时，/api/users/:username/balance|usage 仅允许管理员或本人登录会话访问；
+	// 节点上的查询改由 Agent 本地 Unix socket（按 SO_PEERCRED 识别调用者）代理。
+	LockPublicUserQuery bool `yaml:"lock_public_user_query"`
+
 	DefaultBalance        float64 `yaml:"default_balance"`
 	DefaultPricePerMinute float64 `yaml:"default_price_per_minute"`
 
@@ -74,15 +102,48 @@ func (c *Config) Validate() error {
 	if c.SampleIntervalSeconds <= 0 || c.SampleIntervalSeconds > 600 {
 		return errors.New("sample_interval_seconds 必须在 (0, 600] 范围内")
 	}
+	if c.JobMergeGapSeconds < 0 || c.JobMergeGapSeconds > 86400 {
+		return errors.New("job_merge_gap_seconds 必须在 [0, 86400] 范围内")
+	}
 	if c.CPULimitPercentLimited < 1 || c.CPULimitPercentLimited > 100 {
 		return errors.New("cpu_limit_percent_limited 必须在 [1, 100] 范围内")
 	}
 	if c.CPULimitPercentBlocked < 1 || c.CPULimitPercentBlocked > 100 {
 		return errors.New("cpu_limit_percent_blocked 必须在 [1, 100] 范围内")
 	}
+	if err := c.ResourceLimitsLimited.Validate("resource_limits_limited"); err != nil {
+		return err
+	}
+	if err := c.ResourceLimitsBlocked.Validate("resource_limits_blocked"); err != nil {
+		return err
+	}
 	if c.KillGracePeriodSeconds < 0 {
 		return errors.New("kill_grace_period_seconds 不能为负数")
 	}
+	if err := validateKillLadder(c.KillSignalLadder); err != nil {
+		return err
+	}
+	if err := c.IdleGPU.Validate(); err != nil {
+		return err
+	}
+	if err := c.Reservations.Validate(); err != nil {
+		return err
+	}
+	if err := c.FairShare.Validate(); err != nil {
+		return err
+	}
+	if err := c.Scavenger.Validate(); err != nil {
+		return err
+	}
+	if err := c.NodeWatch.Validate(); err != nil {
+		return err
+	}
+	if err := c.GPUHealth.Validate(); err != nil {
+		return err
+	}
+	if err := c.Inventory.Validate(); err != nil {
+		return err
+	}
 	if c.DefaultBalance < 0 {
 		return errors.New("default_balance 不能为负数")
 	}
@@ -113,6 +174,37 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// killLadderSignals 为 kill_signal_ladder 允许使用的信号，需与 Agent 侧保持一致。
+var killLadderSignals = map[string]struct{}{
+	"SIGHUP": {}, "SIGINT": {}, "SIGQUIT": {}, "SIGUSR1": {}, "SIGUSR2": {}, "SIGTERM": {}, "SIGKILL": {},
+}
+
+func validateKillLadder(ladder []KillStep) error {
+	if len(ladder) == 0 {
+		return nil
+	}
+	if len(ladder) > 8 {
+		return errors.New("kill_signal_ladder 最多 8 步")
+	}
+	total := 0
+	for i, step := range ladder {
+		if _, ok := killLadderSignals[step.Signal]; !ok {
+			return fmt.Errorf("kill_signal_ladder[%d].signal 不支持：%s", i, step.Signal)
+		}
+		if step.WaitSeconds < 0 {
+			return fmt.Errorf("kill_signal_ladder[%d].wait_seconds 不能为负数", i)
+		}
+		total += step.WaitSeconds
+	}
+	if ladder[len(ladder)-1].Signal != "SIGKILL" {
+		return errors.New("kill_signal_ladder 最后一步必须为 SIGKILL")
+	}
+	if total > 3600 {
+		return errors.New("kill_signal_ladder 总等待时间不能超过 3600 秒")
+	}
+	return nil
+}
+
 type cliArgs struct {
 	configPath string
 }
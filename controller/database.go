@@ -244,11 +244,12 @@ func (s *Store) DeductBalanceTx(
 	var balance float64
 	var prevStatus string
 	var blockedAt *time.Time
+	var capLimitedUntil *time.Time
 	if err := tx.QueryRowContext(ctx, `
-SELECT balance, status, blocked_at
+SELECT balance, status, blocked_at, cap_limited_until
 FROM users
 WHERE username=$1
-FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt); err != nil {
+FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt, &capLimitedUntil); err != nil {
 		return BalanceUpdateResult{}, err
 	}
 
@@ -256,7 +257,7 @@ FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt); err != nil {
 	if !cfg.DryRun {
 		newBalance = balance - amount
 	}
-	newStatus := StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold)
+	newStatus := EffectiveStatus(StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold), capLimitedUntil, now)
 	newBlockedAt := blockedAt
 	if newStatus == "blocked" {
 		if newBlockedAt == nil {
@@ -300,16 +301,18 @@ func (s *Store) RechargeTx(ctx context.Context, tx *sql.Tx, username string, amo
 	var balance float64
 	var prevStatus string
 	var blockedAt *time.Time
+	var capLimitedUntil *time.Time
 	if err := tx.QueryRowContext(ctx, `
-SELECT balance, status, blocked_at
+SELECT balance, status, blocked_at, cap_limited_until
 FROM users
 WHERE username=$1
-FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt); err != nil {
+FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt, &capLimitedUntil); err != nil {
 		return BalanceUpdateResult{}, err
 	}
 
 	newBalance := balance + amount
-	newStatus := StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold)
+	// 充值不解除消费上限：上限在下一个自然日/自然月自动重置
+	newStatus := EffectiveStatus(StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold), capLimitedUntil, now)
 	var newBlockedAt *time.Time
 	if newStatus == "blocked" {
 		newBlockedAt = blockedAt
@@ -342,7 +345,9 @@ VALUES($1, $2, $3)`, username, amount, method); err != nil {
 	}, nil
 }
 
-func (s *Store) InsertUsageRecordTx(ctx context.Context, tx *sql.Tx, nodeID string, localUsername string, ts time.Time, proc UserProcess, cost float64) error {
+// InsertUsageRecordTx 写入一条用量记录；groupID>0 表示该费用由课题组承担，jobID 为所属作业（0 表示未聚合），
+// projectID 为费用归属的项目（0 表示未归属）。
+func (s *Store) InsertUsageRecordTx(ctx context.Context, tx *sql.Tx, nodeID string, localUsername string, ts time.Time, proc UserProcess, cost float64, groupID int, jobID int64, projectID int) error {
 	gpuUsage := proc.GPUUsage
 	if gpuUsage == nil {
 		// 保持 JSONB 非空且语义一致：CPU-only 记录也用空数组而非 null
@@ -352,14 +357,19 @@ func (s *Store) InsertUsageRecordTx(ctx context.Context, tx *sql.Tx, nodeID stri
 	if err != nil {
 		return err
 	}
+	tagsJSON, err := marshalTags(proc.Tags)
+	if err != nil {
+		return err
+	}
 	localUsername = strings.TrimSpace(localUsername)
 	if localUsername == "" {
 		localUsername = strings.TrimSpace(proc.Username)
 	}
 	_, err = tx.ExecContext(ctx, `
-INSERT INTO usage_records(node_id, local_username, username, timestamp, pid, cpu_percent, memory_mb, gpu_count, command, gpu_usage, cost)
-VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
-		nodeID, localUsername, proc.Username, ts, proc.PID, proc.CPUPercent, proc.MemoryMB, len(proc.GPUUsage), strings.TrimSpace(proc.Command), string(gpuJSON), cost)
+INSERT INTO usage_records(node_id, local_username, username, timestamp, pid, cpu_percent, memory_mb, gpu_count, command, gpu_usage, cost, group_id, process_user, attribution, job_id, tags, project_id)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)`,
+		nodeID, localUsername, proc.Username, ts, proc.PID, proc.CPUPercent, proc.MemoryMB, len(proc.GPUUsage), strings.TrimSpace(proc.Command), string(gpuJSON), cost, groupID,
+		truncateRunes(proc.ProcessUser, 50), truncateRunes(proc.Attribution, 32), jobID, tagsJSON, projectID)
 	return err
 }
 
@@ -464,7 +474,7 @@ SELECT ur.node_id,
          OR EXISTS(SELECT 1 FROM admin_accounts aa WHERE aa.username = ur.username)
          OR EXISTS(SELECT 1 FROM power_users pu WHERE pu.username = ur.username)
        ) AS registered,
-       ur.timestamp, ur.pid, ur.cpu_percent, ur.memory_mb, ur.gpu_count, ur.command, ur.gpu_usage, ur.cost
+       ur.timestamp, ur.pid, ur.cpu_percent, ur.memory_mb, ur.gpu_count, ur.command, ur.gpu_usage, ur.cost, ur.process_user, ur.attribution, ur.job_id, ur.tags
 FROM usage_records ur
 WHERE ur.username=$1
 ORDER BY timestamp DESC
@@ -477,9 +487,11 @@ LIMIT $2`, username, limit)
 	var out []UsageRecord
 	for rows.Next() {
 		var r UsageRecord
-		if err := rows.Scan(&r.NodeID, &r.LocalUser, &r.BillingUser, &r.Registered, &r.Timestamp, &r.PID, &r.CPUPercent, &r.MemoryMB, &r.GPUCount, &r.Command, &r.GPUUsage, &r.Cost); err != nil {
+		var tags []byte
+		if err := rows.Scan(&r.NodeID, &r.LocalUser, &r.BillingUser, &r.Registered, &r.Timestamp, &r.PID, &r.CPUPercent, &r.MemoryMB, &r.GPUCount, &r.Command, &r.GPUUsage, &r.Cost, &r.ProcessUser, &r.Attribution, &r.JobID, &tags, &r.ProjectID); err != nil {
 			return nil, err
 		}
+		r.Tags = unmarshalTags(tags)
 		r.Username = r.BillingUser
 		out = append(out, r)
 	}
@@ -531,7 +543,7 @@ SELECT ur.node_id,
          OR EXISTS(SELECT 1 FROM admin_accounts aa WHERE aa.username = ur.username)
          OR EXISTS(SELECT 1 FROM power_users pu WHERE pu.username = ur.username)
        ) AS registered,
-       ur.timestamp, ur.pid, ur.cpu_percent, ur.memory_mb, ur.gpu_count, ur.command, ur.gpu_usage, ur.cost
+       ur.timestamp, ur.pid, ur.cpu_percent, ur.memory_mb, ur.gpu_count, ur.command, ur.gpu_usage, ur.cost, ur.process_user, ur.attribution, ur.job_id, ur.tags
 FROM usage_records ur
 ` + where + `
 ORDER BY ur.timestamp DESC
@@ -545,9 +557,11 @@ LIMIT ` + addArg(limit)
 	var out []UsageRecord
 	for rows.Next() {
 		var r UsageRecord
-		if err := rows.Scan(&r.NodeID, &r.LocalUser, &r.BillingUser, &r.Registered, &r.Timestamp, &r.PID, &r.CPUPercent, &r.MemoryMB, &r.GPUCount, &r.Command, &r.GPUUsage, &r.Cost); err != nil {
+		var tags []byte
+		if err := rows.Scan(&r.NodeID, &r.LocalUser, &r.BillingUser, &r.Registered, &r.Timestamp, &r.PID, &r.CPUPercent, &r.MemoryMB, &r.GPUCount, &r.Command, &r.GPUUsage, &r.Cost, &r.ProcessUser, &r.Attribution, &r.JobID, &tags, &r.ProjectID); err != nil {
 			return nil, err
 		}
+		r.Tags = unmarshalTags(tags)
 		r.Username = r.BillingUser
 		out = append(out, r)
 	}
@@ -1545,7 +1559,7 @@ func (s *Store) ListNodes(ctx context.Context, limit int) ([]NodeStatus, error)
 	rows, err := s.db.QueryContext(ctx, `
 SELECT node_id, last_seen_at, last_report_id, last_report_ts, interval_seconds,
        cpu_model, cpu_count, gpu_model, gpu_count, net_rx_mb_month, net_tx_mb_month,
-       gpu_process_count, cpu_process_count, usage_records_count, ssh_active_count, cost_total, updated_at
+       gpu_process_count, cpu_process_count, usage_records_count, ssh_active_count, cost_total, updated_at, offline_since, health
 FROM nodes
 ORDER BY last_seen_at DESC
 LIMIT $1`, limit)
@@ -1557,6 +1571,8 @@ LIMIT $1`, limit)
 	var out []NodeStatus
 	for rows.Next() {
 		var n NodeStatus
+		var offlineSince sql.NullTime
+		var health []byte
 		if err := rows.Scan(
 			&n.NodeID,
 			&n.LastSeenAt,
@@ -1575,9 +1591,16 @@ LIMIT $1`, limit)
 			&n.SSHActiveCount,
 			&n.CostTotal,
 			&n.UpdatedAt,
+			&offlineSince,
+			&health,
 		); err != nil {
 			return nil, err
 		}
+		if offlineSince.Valid {
+			t := offlineSince.Time
+			n.OfflineSince = &t
+		}
+		n.Health = decodeNodeHealth(health)
 		out = append(out, n)
 	}
 	return out, rows.Err()
@@ -1589,10 +1612,12 @@ func (s *Store) GetNodeStatus(ctx context.Context, nodeID string) (NodeStatus, e
 		return NodeStatus{}, errors.New("node_id 不能为空")
 	}
 	var n NodeStatus
+	var offlineSince sql.NullTime
+	var health []byte
 	err := s.db.QueryRowContext(ctx, `
 SELECT node_id, last_seen_at, last_report_id, last_report_ts, interval_seconds,
        cpu_model, cpu_count, gpu_model, gpu_count, net_rx_mb_month, net_tx_mb_month,
-       gpu_process_count, cpu_process_count, usage_records_count, ssh_active_count, cost_total, updated_at
+       gpu_process_count, cpu_process_count, usage_records_count, ssh_active_count, cost_total, updated_at, offline_since, health
 FROM nodes
 WHERE node_id=$1`, nodeID).Scan(
 		&n.NodeID,
@@ -1612,7 +1637,14 @@ WHERE node_id=$1`, nodeID).Scan(
 		&n.SSHActiveCount,
 		&n.CostTotal,
 		&n.UpdatedAt,
+		&offlineSince,
+		&health,
 	)
+	if offlineSince.Valid {
+		t := offlineSince.Time
+		n.OfflineSince = &t
+	}
+	n.Health = decodeNodeHealth(health)
 	return n, err
 }
 
@@ -2122,12 +2154,24 @@ func (s *Store) GetUserEmailByUsername(ctx context.Context, username string) (st
 	return strings.TrimSpace(email), nil
 }
 
-func (s *Store) ListUsageSummaryByUser(ctx context.Context, from time.Time, to time.Time, limit int) ([]UsageUserSummary, error) {
+// usageProjectGrouping 返回按项目拆分时的项目列表达式与关联子句；不拆分时项目列为空串。
+func usageProjectGrouping(byProject bool) (string, string) {
+	if !byProject {
+		return "''", ""
+	}
+	return "COALESCE(p.project_name, '')", `
+LEFT JOIN projects p ON p.project_id = ur.project_id`
+}
+
+// ListUsageSummaryByUser 按计费账号汇总用量；byProject 时再按项目拆分（未归属项目的用量项目名为空）。
+func (s *Store) ListUsageSummaryByUser(ctx context.Context, from time.Time, to time.Time, limit int, byProject bool) ([]UsageUserSummary, error) {
 	if limit <= 0 || limit > 10000 {
 		limit = 1000
 	}
+	projectExpr, projectJoin := usageProjectGrouping(byProject)
 	rows, err := s.db.QueryContext(ctx, `
 SELECT COALESCE(una.billing_username, ur.username) AS username,
+       `+projectExpr+` AS project,
        COUNT(1) AS usage_records,
        SUM(CASE WHEN ur.gpu_count > 0 THEN 1 ELSE 0 END) AS gpu_process_records,
        SUM(CASE WHEN ur.gpu_count = 0 THEN 1 ELSE 0 END) AS cpu_process_records,
@@ -2137,9 +2181,9 @@ SELECT COALESCE(una.billing_username, ur.username) AS username,
 FROM usage_records ur
 LEFT JOIN user_node_accounts una
   ON una.node_id = ur.node_id
- AND una.local_username = ur.username
+ AND una.local_username = ur.username`+projectJoin+`
 WHERE ur.timestamp >= $1 AND ur.timestamp <= $2
-GROUP BY COALESCE(una.billing_username, ur.username)
+GROUP BY 1,2
 ORDER BY total_cost DESC
 LIMIT $3`, from, to, limit)
 	if err != nil {
@@ -2149,7 +2193,7 @@ LIMIT $3`, from, to, limit)
 	out := make([]UsageUserSummary, 0)
 	for rows.Next() {
 		var x UsageUserSummary
-		if err := rows.Scan(&x.Username, &x.UsageRecords, &x.GPUProcessRecords, &x.CPUProcessRecords, &x.TotalCPUPercent, &x.TotalMemoryMB, &x.TotalCost); err != nil {
+		if err := rows.Scan(&x.Username, &x.Project, &x.UsageRecords, &x.GPUProcessRecords, &x.CPUProcessRecords, &x.TotalCPUPercent, &x.TotalMemoryMB, &x.TotalCost); err != nil {
 			return nil, err
 		}
 		out = append(out, x)
@@ -2157,13 +2201,15 @@ LIMIT $3`, from, to, limit)
 	return out, rows.Err()
 }
 
-func (s *Store) ListUsageMonthlyByUser(ctx context.Context, from time.Time, to time.Time, limit int) ([]UsageMonthlySummary, error) {
+func (s *Store) ListUsageMonthlyByUser(ctx context.Context, from time.Time, to time.Time, limit int, byProject bool) ([]UsageMonthlySummary, error) {
 	if limit <= 0 || limit > 200000 {
 		limit = 20000
 	}
+	projectExpr, projectJoin := usageProjectGrouping(byProject)
 	rows, err := s.db.QueryContext(ctx, `
 SELECT to_char(date_trunc('month', ur.timestamp), 'YYYY-MM') AS month,
        COALESCE(una.billing_username, ur.username) AS username,
+       `+projectExpr+` AS project,
        COUNT(1) AS usage_records,
        SUM(CASE WHEN ur.gpu_count > 0 THEN 1 ELSE 0 END) AS gpu_process_records,
        SUM(CASE WHEN ur.gpu_count = 0 THEN 1 ELSE 0 END) AS cpu_process_records,
@@ -2173,9 +2219,9 @@ SELECT to_char(date_trunc('month', ur.timestamp), 'YYYY-MM') AS month,
 FROM usage_records ur
 LEFT JOIN user_node_accounts una
   ON una.node_id = ur.node_id
- AND una.local_username = ur.username
+ AND una.local_username = ur.username`+projectJoin+`
 WHERE ur.timestamp >= $1 AND ur.timestamp <= $2
-GROUP BY 1,2
+GROUP BY 1,2,3
 ORDER BY month DESC, total_cost DESC
 LIMIT $3`, from, to, limit)
 	if err != nil {
@@ -2185,7 +2231,7 @@ LIMIT $3`, from, to, limit)
 	out := make([]UsageMonthlySummary, 0)
 	for rows.Next() {
 		var x UsageMonthlySummary
-		if err := rows.Scan(&x.Month, &x.Username, &x.UsageRecords, &x.GPUProcessRecords, &x.CPUProcessRecords, &x.TotalCPUPercent, &x.TotalMemoryMB, &x.TotalCost); err != nil {
+		if err := rows.Scan(&x.Month, &x.Username, &x.Project, &x.UsageRecords, &x.GPUProcessRecords, &x.CPUProcessRecords, &x.TotalCPUPercent, &x.TotalMemoryMB, &x.TotalCost); err != nil {
 			return nil, err
 		}
 		out = append(out, x)
@@ -2589,6 +2635,12 @@ WHERE username=$1`, r.OldUsername, r.NewUsername, strings.ToLower(r.NewEmail), r
 			if _, err := tx.ExecContext(ctx, `UPDATE profile_change_requests SET billing_username=$2 WHERE billing_username=$1`, r.OldUsername, r.NewUsername); err != nil {
 				return ProfileChangeRequest{}, err
 			}
+			if _, err := tx.ExecContext(ctx, `UPDATE research_group_members SET username=$2 WHERE username=$1`, r.OldUsername, r.NewUsername); err != nil {
+				return ProfileChangeRequest{}, err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE research_groups SET advisor_username=$2 WHERE advisor_username=$1`, r.OldUsername, r.NewUsername); err != nil {
+				return ProfileChangeRequest{}, err
+			}
 		}
 	}
 
@@ -2729,9 +2781,11 @@ LIMIT $3`, from, to, limit)
 	return out, rows.Err()
 }
 
+// queryUsageRows 供 CSV 导出使用；project 非空时只导出归属该项目的用量。
 func (s *Store) queryUsageRows(
 	ctx context.Context,
 	username string,
+	project string,
 	hasFrom bool,
 	from time.Time,
 	hasTo bool,
@@ -2750,13 +2804,16 @@ func (s *Store) queryUsageRows(
 	}
 
 	if strings.TrimSpace(username) != "" {
-		conds = append(conds, "username="+argN(username))
+		conds = append(conds, "ur.username="+argN(username))
+	}
+	if strings.TrimSpace(project) != "" {
+		conds = append(conds, "p.project_name="+argN(strings.TrimSpace(project)))
 	}
 	if hasFrom {
-		conds = append(conds, "timestamp>="+argN(from))
+		conds = append(conds, "ur.timestamp>="+argN(from))
 	}
 	if hasTo {
-		conds = append(conds, "timestamp<="+argN(to))
+		conds = append(conds, "ur.timestamp<="+argN(to))
 	}
 
 	where := ""
@@ -2765,13 +2822,2995 @@ func (s *Store) queryUsageRows(
 	}
 
 	query := fmt.Sprintf(`
-SELECT node_id, username, timestamp, cpu_percent, memory_mb, gpu_usage::text, cost
-     , local_username
-FROM usage_records
+SELECT ur.node_id, ur.username, ur.timestamp, ur.cpu_percent, ur.memory_mb, ur.gpu_usage::text, ur.cost
+     , ur.local_username, COALESCE(p.project_name, '')
+FROM usage_records ur
+LEFT JOIN projects p ON p.project_id = ur.project_id
 %s
-ORDER BY timestamp ASC
+ORDER BY ur.timestamp ASC
 LIMIT %s
 `, where, argN(limit))
 
 	return s.db.QueryContext(ctx, query, args...)
 }
+
+// ResolveGroupBillingTx 判断计费账号本次费用是否由课题组承担。
+// 组员未设置 monthly_limit 时始终由组承担；设置后，本月组内消费达到额度即回落到个人余额。
+func (s *Store) ResolveGroupBillingTx(ctx context.Context, tx *sql.Tx, username string, monthStart time.Time) (int, bool, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, false, errors.New("username 不能为空")
+	}
+	var groupID int
+	var limit sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+SELECT group_id, monthly_limit
+FROM research_group_members
+WHERE username=$1`, username).Scan(&groupID, &limit)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	useGroup, err := s.groupBillingAllowedTx(ctx, tx, groupID, username, limit, monthStart)
+	if err != nil {
+		return 0, false, err
+	}
+	return groupID, useGroup, nil
+}
+
+func (s *Store) groupBillingAllowedTx(ctx context.Context, tx *sql.Tx, groupID int, username string, limit sql.NullFloat64, monthStart time.Time) (bool, error) {
+	if !limit.Valid {
+		return true, nil
+	}
+	var spent float64
+	if err := tx.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(cost), 0)
+FROM usage_records
+WHERE group_id=$1 AND username=$2 AND timestamp >= $3`, groupID, username, monthStart).Scan(&spent); err != nil {
+		return false, err
+	}
+	return GroupBillingAllowed(&limit.Float64, spent), nil
+}
+
+// DeductGroupBalanceTx 从课题组余额扣费，并把组余额对应的状态同步到组员自己的 users.status。
+// 状态变化按组员分别跟踪：同组多名组员分布在不同节点时，每人都能收到各自的 notify/block 动作。
+func (s *Store) DeductGroupBalanceTx(ctx context.Context, tx *sql.Tx, groupID int, username string, amount float64, now time.Time, cfg Config) (BalanceUpdateResult, error) {
+	if groupID <= 0 {
+		return BalanceUpdateResult{}, errors.New("group_id 不合法")
+	}
+	if _, err := s.EnsureUserTx(ctx, tx, username, cfg.DefaultBalance); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+
+	var balance float64
+	var blockedAt *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT balance, blocked_at
+FROM research_groups
+WHERE group_id=$1
+FOR UPDATE`, groupID).Scan(&balance, &blockedAt); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+
+	newBalance := balance
+	if !cfg.DryRun {
+		newBalance = balance - amount
+	}
+	newStatus := StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold)
+	newBlockedAt := blockedAt
+	if newStatus == "blocked" {
+		if newBlockedAt == nil {
+			newBlockedAt = &now
+		}
+	} else {
+		newBlockedAt = nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE research_groups
+SET balance=$2, status=$3, blocked_at=$4, updated_at=NOW()
+WHERE group_id=$1`, groupID, newBalance, newStatus, newBlockedAt); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+
+	var prevStatus string
+	var capLimitedUntil *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT status, cap_limited_until
+FROM users
+WHERE username=$1
+FOR UPDATE`, username).Scan(&prevStatus, &capLimitedUntil); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+	// 个人消费上限只限制该组员，不影响组状态
+	memberStatus := EffectiveStatus(newStatus, capLimitedUntil, now)
+	if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET status=$2, blocked_at=$3
+WHERE username=$1`, username, memberStatus, newBlockedAt); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+
+	return BalanceUpdateResult{
+		PrevStatus: prevStatus,
+		User: User{
+			Username:  username,
+			Balance:   newBalance,
+			Status:    memberStatus,
+			BlockedAt: newBlockedAt,
+		},
+	}, nil
+}
+
+// RechargeGroupTx 为课题组充值，并在同一事务内按新的组状态重算组员的 users.status：
+// 本月仍由课题组承担费用的组员状态跟随组余额（叠加个人消费上限），已回落到个人余额的组员不受影响。
+// 返回状态发生变化的组员，供调用方下发 unblock_user 等动作。
+func (s *Store) RechargeGroupTx(ctx context.Context, tx *sql.Tx, groupID int, amount float64, method string, now time.Time, cfg Config) (ResearchGroup, []BalanceUpdateResult, error) {
+	if groupID <= 0 {
+		return ResearchGroup{}, nil, errors.New("group_id 不合法")
+	}
+	if amount <= 0 {
+		return ResearchGroup{}, nil, errors.New("amount 必须为正数")
+	}
+	if strings.TrimSpace(method) == "" {
+		return ResearchGroup{}, nil, errors.New("method 不能为空")
+	}
+	var balance float64
+	var blockedAt *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT balance, blocked_at
+FROM research_groups
+WHERE group_id=$1
+FOR UPDATE`, groupID).Scan(&balance, &blockedAt); err != nil {
+		return ResearchGroup{}, nil, err
+	}
+	newBalance := balance + amount
+	newStatus := StatusForBalance(newBalance, cfg.WarningThreshold, cfg.LimitedThreshold)
+	var newBlockedAt *time.Time
+	if newStatus == "blocked" {
+		newBlockedAt = blockedAt
+		if newBlockedAt == nil {
+			newBlockedAt = &now
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE research_groups
+SET balance=$2, status=$3, blocked_at=$4, updated_at=NOW()
+WHERE group_id=$1`, groupID, newBalance, newStatus, newBlockedAt); err != nil {
+		return ResearchGroup{}, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO group_recharge_records(group_id, amount, method)
+VALUES($1,$2,$3)`, groupID, amount, method); err != nil {
+		return ResearchGroup{}, nil, err
+	}
+	changed, err := s.syncGroupMemberStatusTx(ctx, tx, groupID, newStatus, now)
+	if err != nil {
+		return ResearchGroup{}, nil, err
+	}
+	g, err := scanResearchGroup(tx.QueryRowContext(ctx, researchGroupColumns+`
+WHERE g.group_id=$1`, groupID))
+	if err != nil {
+		return ResearchGroup{}, nil, err
+	}
+	return g, changed, nil
+}
+
+// syncGroupMemberStatusTx 把组状态同步到本月仍由课题组承担费用的组员，返回状态发生变化的组员。
+func (s *Store) syncGroupMemberStatusTx(ctx context.Context, tx *sql.Tx, groupID int, groupStatus string, now time.Time) ([]BalanceUpdateResult, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT m.username, m.monthly_limit
+FROM research_group_members m
+WHERE m.group_id=$1
+ORDER BY m.username`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	type member struct {
+		username string
+		limit    sql.NullFloat64
+	}
+	var members []member
+	for rows.Next() {
+		var m member
+		if err := rows.Scan(&m.username, &m.limit); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	monthStart := startOfMonth(now)
+	var changed []BalanceUpdateResult
+	for _, m := range members {
+		useGroup, err := s.groupBillingAllowedTx(ctx, tx, groupID, m.username, m.limit, monthStart)
+		if err != nil {
+			return nil, err
+		}
+		if !useGroup {
+			continue
+		}
+		var prevStatus string
+		var blockedAt, capLimitedUntil *time.Time
+		err = tx.QueryRowContext(ctx, `
+SELECT status, blocked_at, cap_limited_until
+FROM users
+WHERE username=$1
+FOR UPDATE`, m.username).Scan(&prevStatus, &blockedAt, &capLimitedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		status := EffectiveStatus(groupStatus, capLimitedUntil, now)
+		if status == prevStatus {
+			continue
+		}
+		var newBlockedAt *time.Time
+		if status == "blocked" {
+			newBlockedAt = blockedAt
+			if newBlockedAt == nil {
+				newBlockedAt = &now
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET status=$2, blocked_at=$3
+WHERE username=$1`, m.username, status, newBlockedAt); err != nil {
+			return nil, err
+		}
+		changed = append(changed, BalanceUpdateResult{
+			PrevStatus: prevStatus,
+			User:       User{Username: m.username, Status: status, BlockedAt: newBlockedAt},
+		})
+	}
+	return changed, nil
+}
+
+const researchGroupColumns = `
+SELECT g.group_id, g.group_name, g.advisor_name, g.advisor_username, g.balance, g.status, g.blocked_at,
+       (SELECT COUNT(1) FROM research_group_members m WHERE m.group_id=g.group_id) AS member_count,
+       g.created_at, g.updated_at
+FROM research_groups g`
+
+func scanResearchGroup(sc interface{ Scan(dest ...any) error }) (ResearchGroup, error) {
+	var g ResearchGroup
+	err := sc.Scan(&g.GroupID, &g.GroupName, &g.AdvisorName, &g.AdvisorUsername, &g.Balance, &g.Status, &g.BlockedAt, &g.MemberCount, &g.CreatedAt, &g.UpdatedAt)
+	return g, err
+}
+
+func (s *Store) GetResearchGroup(ctx context.Context, groupID int) (ResearchGroup, error) {
+	return scanResearchGroup(s.db.QueryRowContext(ctx, researchGroupColumns+`
+WHERE g.group_id=$1`, groupID))
+}
+
+func (s *Store) ListResearchGroups(ctx context.Context, limit int) ([]ResearchGroup, error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	rows, err := s.db.QueryContext(ctx, researchGroupColumns+`
+ORDER BY g.group_name
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ResearchGroup, 0)
+	for rows.Next() {
+		g, err := scanResearchGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// ListResearchGroupsByAdvisor 返回某个平台账号作为导师负责的课题组。
+func (s *Store) ListResearchGroupsByAdvisor(ctx context.Context, advisorUsername string) ([]ResearchGroup, error) {
+	advisorUsername = strings.TrimSpace(advisorUsername)
+	if advisorUsername == "" {
+		return nil, errors.New("advisor_username 不能为空")
+	}
+	rows, err := s.db.QueryContext(ctx, researchGroupColumns+`
+WHERE g.advisor_username=$1
+ORDER BY g.group_name`, advisorUsername)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ResearchGroup, 0)
+	for rows.Next() {
+		g, err := scanResearchGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// GetResearchGroupByMember 返回用户所在课题组；用户不属于任何课题组时返回 sql.ErrNoRows。
+func (s *Store) GetResearchGroupByMember(ctx context.Context, username string) (ResearchGroup, ResearchGroupMember, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return ResearchGroup{}, ResearchGroupMember{}, errors.New("username 不能为空")
+	}
+	var m ResearchGroupMember
+	var limit sql.NullFloat64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT group_id, username, monthly_limit, created_by, created_at, updated_at
+FROM research_group_members
+WHERE username=$1`, username).Scan(&m.GroupID, &m.Username, &limit, &m.CreatedBy, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		return ResearchGroup{}, ResearchGroupMember{}, err
+	}
+	if limit.Valid {
+		v := limit.Float64
+		m.MonthlyLimit = &v
+	}
+	g, err := s.GetResearchGroup(ctx, m.GroupID)
+	return g, m, err
+}
+
+func (s *Store) CreateResearchGroup(ctx context.Context, name string, advisorName string, advisorUsername string) (int, error) {
+	name = strings.TrimSpace(name)
+	advisorName = strings.TrimSpace(advisorName)
+	advisorUsername = strings.TrimSpace(advisorUsername)
+	if name == "" {
+		return 0, errors.New("group_name 不能为空")
+	}
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+INSERT INTO research_groups(group_name, advisor_name, advisor_username)
+VALUES($1,$2,$3)
+ON CONFLICT (group_name) DO NOTHING
+RETURNING group_id`, name, advisorName, advisorUsername).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("课题组名称已存在")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) UpdateResearchGroup(ctx context.Context, groupID int, name string, advisorName string, advisorUsername string) error {
+	name = strings.TrimSpace(name)
+	advisorName = strings.TrimSpace(advisorName)
+	advisorUsername = strings.TrimSpace(advisorUsername)
+	if groupID <= 0 {
+		return errors.New("group_id 不合法")
+	}
+	if name == "" {
+		return errors.New("group_name 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `
+UPDATE research_groups
+SET group_name=$2, advisor_name=$3, advisor_username=$4, updated_at=NOW()
+WHERE group_id=$1`, groupID, name, advisorName, advisorUsername)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) DeleteResearchGroup(ctx context.Context, groupID int) error {
+	if groupID <= 0 {
+		return errors.New("group_id 不合法")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM research_groups WHERE group_id=$1`, groupID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListResearchGroupMembers(ctx context.Context, groupID int) ([]ResearchGroupMember, error) {
+	if groupID <= 0 {
+		return nil, errors.New("group_id 不合法")
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT group_id, username, monthly_limit, created_by, created_at, updated_at
+FROM research_group_members
+WHERE group_id=$1
+ORDER BY username`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ResearchGroupMember, 0)
+	for rows.Next() {
+		var m ResearchGroupMember
+		var limit sql.NullFloat64
+		if err := rows.Scan(&m.GroupID, &m.Username, &limit, &m.CreatedBy, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if limit.Valid {
+			v := limit.Float64
+			m.MonthlyLimit = &v
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// UpsertResearchGroupMember 把计费账号加入课题组（已在其他组时转入当前组）。
+func (s *Store) UpsertResearchGroupMember(ctx context.Context, groupID int, username string, monthlyLimit *float64, createdBy string) error {
+	username = strings.TrimSpace(username)
+	createdBy = strings.TrimSpace(createdBy)
+	if groupID <= 0 || username == "" {
+		return errors.New("group_id/username 不能为空")
+	}
+	if monthlyLimit != nil && *monthlyLimit < 0 {
+		return errors.New("monthly_limit 不能为负数")
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM research_groups WHERE group_id=$1)`, groupID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("课题组不存在")
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO research_group_members(username, group_id, monthly_limit, created_by)
+VALUES($1,$2,$3,$4)
+ON CONFLICT (username) DO UPDATE
+SET group_id=EXCLUDED.group_id,
+    monthly_limit=EXCLUDED.monthly_limit,
+    updated_at=NOW()`, username, groupID, monthlyLimit, createdBy)
+	return err
+}
+
+func (s *Store) DeleteResearchGroupMember(ctx context.Context, groupID int, username string) error {
+	username = strings.TrimSpace(username)
+	if groupID <= 0 || username == "" {
+		return errors.New("group_id/username 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM research_group_members
+WHERE group_id=$1 AND username=$2`, groupID, username)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SyncResearchGroupMembersByAdvisor 按 user_accounts.advisor 与课题组 advisor_name 匹配，
+// 把尚未加入任何课题组的用户批量加入；返回新增人数。
+func (s *Store) SyncResearchGroupMembersByAdvisor(ctx context.Context, groupID int, createdBy string) (int, error) {
+	if groupID <= 0 {
+		return 0, errors.New("group_id 不合法")
+	}
+	createdBy = strings.TrimSpace(createdBy)
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	res, err := s.db.ExecContext(ctx, `
+INSERT INTO research_group_members(username, group_id, created_by)
+SELECT ua.username, g.group_id, $2
+FROM user_accounts ua
+JOIN research_groups g ON g.group_id=$1
+WHERE g.advisor_name <> ''
+  AND TRIM(ua.advisor) = g.advisor_name
+ON CONFLICT (username) DO NOTHING`, groupID, createdBy)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// ListGroupMemberSpend 汇总课题组每个组员在 [from,to] 内的消费（区分组内承担与个人承担），
+// 以及自 monthStart 起已用的组内额度。
+func (s *Store) ListGroupMemberSpend(ctx context.Context, groupID int, from time.Time, to time.Time, monthStart time.Time) ([]GroupMemberSpend, error) {
+	if groupID <= 0 {
+		return nil, errors.New("group_id 不合法")
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT m.username,
+       COALESCE(ua.real_name, '') AS real_name,
+       m.monthly_limit,
+       COALESCE((
+         SELECT SUM(ur2.cost) FROM usage_records ur2
+         WHERE ur2.username=m.username AND ur2.group_id=m.group_id AND ur2.timestamp >= $4
+       ), 0) AS month_spent,
+       COUNT(ur.record_id) AS usage_records,
+       COALESCE(SUM(CASE WHEN ur.gpu_count > 0 THEN 1 ELSE 0 END), 0) AS gpu_process_records,
+       COALESCE(SUM(CASE WHEN ur.group_id = m.group_id THEN ur.cost ELSE 0 END), 0) AS group_cost,
+       COALESCE(SUM(CASE WHEN ur.group_id = 0 THEN ur.cost ELSE 0 END), 0) AS personal_cost
+FROM research_group_members m
+LEFT JOIN user_accounts ua ON ua.username=m.username
+LEFT JOIN usage_records ur
+  ON ur.username=m.username
+ AND ur.timestamp >= $2
+ AND ur.timestamp <= $3
+WHERE m.group_id=$1
+GROUP BY m.username, ua.real_name, m.monthly_limit, m.group_id
+ORDER BY group_cost DESC, m.username`, groupID, from, to, monthStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GroupMemberSpend, 0)
+	for rows.Next() {
+		var x GroupMemberSpend
+		var limit sql.NullFloat64
+		if err := rows.Scan(&x.Username, &x.RealName, &limit, &x.MonthSpent, &x.UsageRecords, &x.GPUProcessRecords, &x.GroupCost, &x.PersonalCost); err != nil {
+			return nil, err
+		}
+		if limit.Valid {
+			v := limit.Float64
+			x.MonthlyLimit = &v
+		}
+		out = append(out, x)
+	}
+	return out, rows.Err()
+}
+
+// ListSpendCapsForNodeTx 返回用户在指定节点上生效的上限配置（含 "*" 全局配置）。
+func (s *Store) ListSpendCapsForNodeTx(ctx context.Context, tx *sql.Tx, username string, nodeID string) ([]UserSpendCap, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT username, node_id, daily_limit, monthly_limit, created_by, created_at, updated_at
+FROM user_spend_caps
+WHERE username=$1 AND (node_id='*' OR node_id=$2)
+ORDER BY node_id`, username, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSpendCaps(rows)
+}
+
+func scanSpendCaps(rows *sql.Rows) ([]UserSpendCap, error) {
+	out := make([]UserSpendCap, 0)
+	for rows.Next() {
+		var c UserSpendCap
+		var daily, monthly sql.NullFloat64
+		if err := rows.Scan(&c.Username, &c.NodeID, &daily, &monthly, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if daily.Valid {
+			v := daily.Float64
+			c.DailyLimit = &v
+		}
+		if monthly.Valid {
+			v := monthly.Float64
+			c.MonthlyLimit = &v
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// sumUserSpend 统计计费账号自 from 起的消费；nodeID 为 "*" 时统计所有节点。
+func sumUserSpend(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, username string, nodeID string, from time.Time) (float64, error) {
+	var spent float64
+	err := q.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(cost), 0)
+FROM usage_records
+WHERE username=$1 AND ($2='*' OR node_id=$2) AND timestamp >= $3`, username, nodeID, from).Scan(&spent)
+	return spent, err
+}
+
+// CheckSpendCapsTx 检查用户在本节点上报后的消费是否触发上限，返回每条被触发的配置（全局与本节点分别返回）。
+// 需在本次用量写入 usage_records 之后调用，这样统计值包含本次费用。
+func (s *Store) CheckSpendCapsTx(ctx context.Context, tx *sql.Tx, username string, nodeID string, now time.Time) ([]SpendCapBreach, error) {
+	caps, err := s.ListSpendCapsForNodeTx(ctx, tx, username, nodeID)
+	if err != nil || len(caps) == 0 {
+		return nil, err
+	}
+	dayStart := startOfDay(now)
+	monthStart := startOfMonth(now)
+	var out []SpendCapBreach
+	for _, c := range caps {
+		daySpent, monthSpent := 0.0, 0.0
+		if c.DailyLimit != nil {
+			if daySpent, err = sumUserSpend(ctx, tx, username, c.NodeID, dayStart); err != nil {
+				return nil, err
+			}
+		}
+		if c.MonthlyLimit != nil {
+			if monthSpent, err = sumUserSpend(ctx, tx, username, c.NodeID, monthStart); err != nil {
+				return nil, err
+			}
+		}
+		if b := CheckSpendCap(c, daySpent, monthSpent, now); b != nil {
+			out = append(out, *b)
+		}
+	}
+	return out, nil
+}
+
+// MarkSpendCapLimitedTx 记录上限触发，返回限制是否有变化（新触发，或截止时间延后，例如日上限之后又触发月上限）。
+// 已处于同等或更晚的限制中时返回 false，避免每次上报重复提醒。
+// 全局上限（node_id='*'）记在 users.cap_limited_until，限制该账号在所有节点上的任务；
+// 单节点上限记在对应的 user_spend_caps 行上，只限制该节点（见 NodeSpendCapLimitTx）。
+func (s *Store) MarkSpendCapLimitedTx(ctx context.Context, tx *sql.Tx, username string, breach SpendCapBreach, now time.Time, cfg Config) (bool, error) {
+	if breach.NodeID != "" && breach.NodeID != "*" {
+		return s.markNodeSpendCapLimitedTx(ctx, tx, username, breach, now)
+	}
+	if _, err := s.EnsureUserTx(ctx, tx, username, cfg.DefaultBalance); err != nil {
+		return false, err
+	}
+	var until *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT cap_limited_until
+FROM users
+WHERE username=$1
+FOR UPDATE`, username).Scan(&until); err != nil {
+		return false, err
+	}
+	active := until != nil && now.Before(*until)
+	if active && !breach.Until.After(*until) {
+		return false, nil
+	}
+	reason := breach.Message()
+	if len(reason) > 200 {
+		reason = reason[:200]
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET cap_limited_until=$2, cap_reason=$3
+WHERE username=$1`, username, breach.Until, reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) markNodeSpendCapLimitedTx(ctx context.Context, tx *sql.Tx, username string, breach SpendCapBreach, now time.Time) (bool, error) {
+	var until *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT limited_until
+FROM user_spend_caps
+WHERE username=$1 AND node_id=$2
+FOR UPDATE`, username, breach.NodeID).Scan(&until); err != nil {
+		return false, err
+	}
+	if until != nil && now.Before(*until) && !breach.Until.After(*until) {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE user_spend_caps
+SET limited_until=$3, limited_reason=$4
+WHERE username=$1 AND node_id=$2`, username, breach.NodeID, breach.Until, truncateRunes(breach.Message(), 200)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NodeSpendCapLimitTx 返回用户在该节点上记录的单节点上限限制截止时间（可能已过期；未记录时为 nil）。
+// 过期的记录由 ClearNodeSpendCapLimitTx 在下一次上报时清除，以便从 limited 恢复时下发 unblock_user。
+func (s *Store) NodeSpendCapLimitTx(ctx context.Context, tx *sql.Tx, username string, nodeID string) (*time.Time, error) {
+	var until *time.Time
+	err := tx.QueryRowContext(ctx, `
+SELECT limited_until
+FROM user_spend_caps
+WHERE username=$1 AND node_id=$2 AND node_id <> '*'`, username, nodeID).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return until, err
+}
+
+func (s *Store) ClearNodeSpendCapLimitTx(ctx context.Context, tx *sql.Tx, username string, nodeID string) error {
+	_, err := tx.ExecContext(ctx, `
+UPDATE user_spend_caps
+SET limited_until=NULL, limited_reason=''
+WHERE username=$1 AND node_id=$2`, username, nodeID)
+	return err
+}
+
+// GetSpendCapState 返回用户当前的上限限制截止时间与原因（未受限时 until 为空）。
+func (s *Store) GetSpendCapState(ctx context.Context, username string, now time.Time) (*time.Time, string, error) {
+	var until *time.Time
+	var reason string
+	err := s.db.QueryRowContext(ctx, `
+SELECT cap_limited_until, cap_reason
+FROM users
+WHERE username=$1`, strings.TrimSpace(username)).Scan(&until, &reason)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if until == nil || !now.Before(*until) {
+		return nil, "", nil
+	}
+	return until, reason, nil
+}
+
+func (s *Store) ListSpendCaps(ctx context.Context, username string, limit int) ([]UserSpendCap, error) {
+	username = strings.TrimSpace(username)
+	rows, err := s.db.QueryContext(ctx, `
+SELECT username, node_id, daily_limit, monthly_limit, created_by, created_at, updated_at
+FROM user_spend_caps
+WHERE ($1='' OR username=$1)
+ORDER BY username, node_id
+LIMIT $2`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSpendCaps(rows)
+}
+
+// ListSpendCapStatus 返回用户的上限配置及当日/当月已消费金额。
+func (s *Store) ListSpendCapStatus(ctx context.Context, username string, now time.Time) ([]UserSpendCapStatus, error) {
+	caps, err := s.ListSpendCaps(ctx, username, 1000)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]UserSpendCapStatus, 0, len(caps))
+	for _, c := range caps {
+		st := UserSpendCapStatus{UserSpendCap: c}
+		if st.DaySpent, err = sumUserSpend(ctx, s.db, c.Username, c.NodeID, startOfDay(now)); err != nil {
+			return nil, err
+		}
+		if st.MonthSpent, err = sumUserSpend(ctx, s.db, c.Username, c.NodeID, startOfMonth(now)); err != nil {
+			return nil, err
+		}
+		st.DaySpent = round4(st.DaySpent)
+		st.MonthSpent = round4(st.MonthSpent)
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// UpsertSpendCap 新增或修改上限；修改后清除当前的上限限制，由下一次上报重新判定。
+func (s *Store) UpsertSpendCap(ctx context.Context, in UserSpendCap, createdBy string) error {
+	in.Username = strings.TrimSpace(in.Username)
+	in.NodeID = strings.TrimSpace(in.NodeID)
+	createdBy = strings.TrimSpace(createdBy)
+	if in.Username == "" {
+		return errors.New("username 不能为空")
+	}
+	if in.NodeID == "" {
+		in.NodeID = "*"
+	}
+	if in.DailyLimit == nil && in.MonthlyLimit == nil {
+		return errors.New("daily_limit/monthly_limit 至少填写一项")
+	}
+	if (in.DailyLimit != nil && *in.DailyLimit < 0) || (in.MonthlyLimit != nil && *in.MonthlyLimit < 0) {
+		return errors.New("上限不能为负数")
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	return s.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO user_spend_caps(username, node_id, daily_limit, monthly_limit, created_by)
+VALUES($1,$2,$3,$4,$5)
+ON CONFLICT (username, node_id) DO UPDATE
+SET daily_limit=EXCLUDED.daily_limit,
+    monthly_limit=EXCLUDED.monthly_limit,
+    updated_at=NOW()`, in.Username, in.NodeID, in.DailyLimit, in.MonthlyLimit, createdBy); err != nil {
+			return err
+		}
+		return clearSpendCapLimitTx(ctx, tx, in.Username)
+	})
+}
+
+func (s *Store) DeleteSpendCap(ctx context.Context, username string, nodeID string) error {
+	username = strings.TrimSpace(username)
+	nodeID = strings.TrimSpace(nodeID)
+	if username == "" {
+		return errors.New("username 不能为空")
+	}
+	if nodeID == "" {
+		nodeID = "*"
+	}
+	return s.WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+DELETE FROM user_spend_caps
+WHERE username=$1 AND node_id=$2`, username, nodeID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return clearSpendCapLimitTx(ctx, tx, username)
+	})
+}
+
+// RefreshUserStatusTx 按当前余额与消费上限重算 users.status，并清除已到期的全局上限限制。
+// 本月仍由课题组承担费用的组员以组状态为基础，其余按个人余额与其策略阈值。
+// 用于上限到期或被管理员修改/解除后立即恢复，不必等到下一次扣费或充值。
+func (s *Store) RefreshUserStatusTx(ctx context.Context, tx *sql.Tx, username string, now time.Time, cfg Config) (BalanceUpdateResult, error) {
+	var balance float64
+	var prevStatus string
+	var blockedAt, capLimitedUntil *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT balance, status, blocked_at, cap_limited_until
+FROM users
+WHERE username=$1
+FOR UPDATE`, username).Scan(&balance, &prevStatus, &blockedAt, &capLimitedUntil); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+
+	var base string
+	groupID, useGroup, err := s.ResolveGroupBillingTx(ctx, tx, username, startOfMonth(now))
+	if err != nil {
+		return BalanceUpdateResult{}, err
+	}
+	if useGroup {
+		if err := tx.QueryRowContext(ctx, `
+SELECT status
+FROM research_groups
+WHERE group_id=$1`, groupID).Scan(&base); err != nil {
+			return BalanceUpdateResult{}, err
+		}
+	} else {
+		policy, err := s.ResolveUserPolicyTx(ctx, tx, username, cfg)
+		if err != nil {
+			return BalanceUpdateResult{}, err
+		}
+		base = StatusForBalance(balance, policy.WarningThreshold, policy.LimitedThreshold)
+	}
+
+	status, capUntil := RefreshStatus(base, capLimitedUntil, now)
+	var newBlockedAt *time.Time
+	if status == "blocked" {
+		newBlockedAt = blockedAt
+		if newBlockedAt == nil {
+			newBlockedAt = &now
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET status=$2, blocked_at=$3, cap_limited_until=$4,
+    cap_reason=CASE WHEN $4::timestamp IS NULL THEN '' ELSE cap_reason END
+WHERE username=$1`, username, status, newBlockedAt, capUntil); err != nil {
+		return BalanceUpdateResult{}, err
+	}
+	return BalanceUpdateResult{
+		PrevStatus: prevStatus,
+		User: User{
+			Username:  username,
+			Balance:   balance,
+			Status:    status,
+			BlockedAt: newBlockedAt,
+		},
+	}, nil
+}
+
+// ExpireSpendCapLimits 处理全局上限限制已到期的用户：清除限制并重算状态，返回这些用户的状态变化。
+// 正在扣费（持有行锁）的用户跳过，由本次扣费自行按到期处理。
+func (s *Store) ExpireSpendCapLimits(ctx context.Context, now time.Time, cfg Config) ([]BalanceUpdateResult, error) {
+	var out []BalanceUpdateResult
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		out = nil
+		rows, err := tx.QueryContext(ctx, `
+SELECT username
+FROM users
+WHERE cap_limited_until IS NOT NULL AND cap_limited_until <= $1
+FOR UPDATE SKIP LOCKED`, now)
+		if err != nil {
+			return err
+		}
+		var usernames []string
+		for rows.Next() {
+			var u string
+			if err := rows.Scan(&u); err != nil {
+				rows.Close()
+				return err
+			}
+			usernames = append(usernames, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, u := range usernames {
+			res, err := s.RefreshUserStatusTx(ctx, tx, u, now, cfg)
+			if err != nil {
+				return err
+			}
+			out = append(out, res)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// RefreshUserStatus 在独立事务中重算用户状态（用于管理员修改/删除消费上限之后）。
+func (s *Store) RefreshUserStatus(ctx context.Context, username string, now time.Time, cfg Config) (BalanceUpdateResult, error) {
+	var res BalanceUpdateResult
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		res, err = s.RefreshUserStatusTx(ctx, tx, strings.TrimSpace(username), now, cfg)
+		return err
+	})
+	return res, err
+}
+
+// clearSpendCapLimitTx 解除用户的上限限制。单节点限制改为立即到期而不是置空，
+// 下一次上报时按“到期”处理并下发 unblock_user。
+func clearSpendCapLimitTx(ctx context.Context, tx *sql.Tx, username string) error {
+	if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET cap_limited_until=NULL, cap_reason=''
+WHERE username=$1`, username); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+UPDATE user_spend_caps
+SET limited_until=NOW(), limited_reason=''
+WHERE username=$1 AND limited_until > NOW()`, username)
+	return err
+}
+
+const policyOverrideColumns = `scope, target, warning_threshold, limited_threshold, kill_grace_period_seconds,
+       cpu_limit_percent_limited, cpu_limit_percent_blocked, idle_gpu_kill_minutes, note, created_by, created_at, updated_at`
+
+func scanPolicyOverrides(rows *sql.Rows) ([]PolicyOverride, error) {
+	out := make([]PolicyOverride, 0)
+	for rows.Next() {
+		var o PolicyOverride
+		var warning, limited, cpuLimited, cpuBlocked sql.NullFloat64
+		var grace, idleKill sql.NullInt64
+		if err := rows.Scan(&o.Scope, &o.Target, &warning, &limited, &grace, &cpuLimited, &cpuBlocked, &idleKill, &o.Note, &o.CreatedBy, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if warning.Valid {
+			v := warning.Float64
+			o.WarningThreshold = &v
+		}
+		if limited.Valid {
+			v := limited.Float64
+			o.LimitedThreshold = &v
+		}
+		if grace.Valid {
+			v := int(grace.Int64)
+			o.KillGracePeriodSeconds = &v
+		}
+		if cpuLimited.Valid {
+			v := cpuLimited.Float64
+			o.CPULimitPercentLimited = &v
+		}
+		if cpuBlocked.Valid {
+			v := cpuBlocked.Float64
+			o.CPULimitPercentBlocked = &v
+		}
+		if idleKill.Valid {
+			v := int(idleKill.Int64)
+			o.IdleGPUKillMinutes = &v
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// ResolveUserPolicyTx 计算计费账号最终生效的策略：全局配置 → 所在课题组覆盖 → 用户覆盖。
+func (s *Store) ResolveUserPolicyTx(ctx context.Context, tx *sql.Tx, username string, cfg Config) (BillingPolicy, error) {
+	policy := DefaultBillingPolicy(cfg)
+	rows, err := tx.QueryContext(ctx, `
+SELECT `+policyOverrideColumns+`
+FROM billing_policies
+WHERE (scope='user' AND target=$1)
+   OR (scope='group' AND target=(SELECT group_id::text FROM research_group_members WHERE username=$1))`, strings.TrimSpace(username))
+	if err != nil {
+		return policy, err
+	}
+	defer rows.Close()
+	overrides, err := scanPolicyOverrides(rows)
+	if err != nil {
+		return policy, err
+	}
+	// 先套课题组再套用户，用户覆盖优先
+	for _, scope := range []string{"group", "user"} {
+		for _, o := range overrides {
+			if o.Scope == scope {
+				policy = policy.Override(o)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// ResolveGroupPolicyTx 计算课题组自身的策略（用于组余额状态）：全局配置 → 课题组覆盖。
+func (s *Store) ResolveGroupPolicyTx(ctx context.Context, tx *sql.Tx, groupID int, cfg Config) (BillingPolicy, error) {
+	policy := DefaultBillingPolicy(cfg)
+	rows, err := tx.QueryContext(ctx, `
+SELECT `+policyOverrideColumns+`
+FROM billing_policies
+WHERE scope='group' AND target=$1`, strconv.Itoa(groupID))
+	if err != nil {
+		return policy, err
+	}
+	defer rows.Close()
+	overrides, err := scanPolicyOverrides(rows)
+	if err != nil {
+		return policy, err
+	}
+	for _, o := range overrides {
+		policy = policy.Override(o)
+	}
+	return policy, nil
+}
+
+func (s *Store) ListPolicyOverrides(ctx context.Context, scope string, limit int) ([]PolicyOverride, error) {
+	scope = strings.TrimSpace(scope)
+	rows, err := s.db.QueryContext(ctx, `
+SELECT `+policyOverrideColumns+`
+FROM billing_policies
+WHERE ($1='' OR scope=$1)
+ORDER BY scope, target
+LIMIT $2`, scope, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPolicyOverrides(rows)
+}
+
+// UpsertPolicyOverride 新增或修改策略覆盖；叠加到全局配置后必须合法，避免保存后被静默忽略。
+func (s *Store) UpsertPolicyOverride(ctx context.Context, in PolicyOverride, createdBy string, cfg Config) error {
+	in.Scope = strings.TrimSpace(in.Scope)
+	in.Target = strings.TrimSpace(in.Target)
+	in.Note = strings.TrimSpace(in.Note)
+	createdBy = strings.TrimSpace(createdBy)
+	if in.Target == "" {
+		return errors.New("target 不能为空")
+	}
+	switch in.Scope {
+	case "user":
+	case "group":
+		id, err := strconv.Atoi(in.Target)
+		if err != nil || id <= 0 {
+			return errors.New("scope=group 时 target 必须为 group_id")
+		}
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM research_groups WHERE group_id=$1)`, id).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("课题组不存在")
+		}
+	default:
+		return errors.New("scope 仅支持 user/group")
+	}
+	if err := DefaultBillingPolicy(cfg).merge(in).Validate(); err != nil {
+		return err
+	}
+	if len(in.Note) > 200 {
+		in.Note = in.Note[:200]
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO billing_policies(scope, target, warning_threshold, limited_threshold, kill_grace_period_seconds,
+                             cpu_limit_percent_limited, cpu_limit_percent_blocked, idle_gpu_kill_minutes, note, created_by)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+ON CONFLICT (scope, target) DO UPDATE
+SET warning_threshold=EXCLUDED.warning_threshold,
+    limited_threshold=EXCLUDED.limited_threshold,
+    kill_grace_period_seconds=EXCLUDED.kill_grace_period_seconds,
+    cpu_limit_percent_limited=EXCLUDED.cpu_limit_percent_limited,
+    cpu_limit_percent_blocked=EXCLUDED.cpu_limit_percent_blocked,
+    idle_gpu_kill_minutes=EXCLUDED.idle_gpu_kill_minutes,
+    note=EXCLUDED.note,
+    updated_at=NOW()`,
+		in.Scope, in.Target, in.WarningThreshold, in.LimitedThreshold, in.KillGracePeriodSeconds,
+		in.CPULimitPercentLimited, in.CPULimitPercentBlocked, in.IdleGPUKillMinutes, in.Note, createdBy)
+	return err
+}
+
+func (s *Store) DeletePolicyOverride(ctx context.Context, scope string, target string) error {
+	scope = strings.TrimSpace(scope)
+	target = strings.TrimSpace(target)
+	if scope == "" || target == "" {
+		return errors.New("scope/target 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM billing_policies
+WHERE scope=$1 AND target=$2`, scope, target)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertKillReport 保存 Agent 回报的 kill 结果，并按节点映射解析计费账号。
+func (s *Store) InsertKillReport(ctx context.Context, r KillReport) (int64, error) {
+	r.NodeID = strings.TrimSpace(r.NodeID)
+	r.LocalUsername = strings.TrimSpace(r.LocalUsername)
+	if r.NodeID == "" || r.LocalUsername == "" {
+		return 0, errors.New("node_id/local_username 不能为空")
+	}
+	fields := []any{r.RequestedPIDs, r.KilledPIDs, r.SurvivedPIDs, r.SkippedPIDs, r.Ladder, r.TreePIDs, r.Cgroups}
+	encoded := make([]string, len(fields))
+	for i, v := range fields {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return 0, err
+		}
+		// 保持 JSONB 非空：nil 切片按空数组存储
+		if string(b) == "null" {
+			b = []byte("[]")
+		}
+		encoded[i] = string(b)
+	}
+	var id int64
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		username := r.LocalUsername
+		mapped, found, err := s.ResolveBillingUsernameTx(ctx, tx, r.NodeID, r.LocalUsername)
+		if err != nil {
+			return err
+		}
+		if found && strings.TrimSpace(mapped) != "" {
+			username = mapped
+		}
+		return tx.QueryRowContext(ctx, `
+INSERT INTO kill_reports(node_id, local_username, username, reason, requested_pids, killed_pids, survived_pids, skipped_pids, ladder, tree_pids, cgroups, started_at, finished_at)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+RETURNING id`,
+			r.NodeID, r.LocalUsername, username, strings.TrimSpace(r.Reason),
+			encoded[0], encoded[1], encoded[2], encoded[3], encoded[4], encoded[5], encoded[6], r.StartedAt, r.FinishedAt).Scan(&id)
+	})
+	return id, err
+}
+
+// ListKillReports 按计费账号 / 节点过滤 kill 结果，条件为空表示不过滤。
+func (s *Store) ListKillReports(ctx context.Context, username string, nodeID string, limit int) ([]KillReport, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, node_id, local_username, username, reason, requested_pids, killed_pids, survived_pids, skipped_pids, ladder, tree_pids, cgroups, started_at, finished_at, created_at
+FROM kill_reports
+WHERE ($1='' OR username=$1) AND ($2='' OR node_id=$2)
+ORDER BY created_at DESC
+LIMIT $3`, strings.TrimSpace(username), strings.TrimSpace(nodeID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]KillReport, 0)
+	for rows.Next() {
+		var r KillReport
+		var requested, killed, survived, skipped, ladder, tree, cgroups []byte
+		if err := rows.Scan(&r.ID, &r.NodeID, &r.LocalUsername, &r.Username, &r.Reason, &requested, &killed, &survived, &skipped, &ladder, &tree, &cgroups, &r.StartedAt, &r.FinishedAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, f := range []struct {
+			raw []byte
+			dst any
+		}{
+			{requested, &r.RequestedPIDs},
+			{killed, &r.KilledPIDs},
+			{survived, &r.SurvivedPIDs},
+			{skipped, &r.SkippedPIDs},
+			{ladder, &r.Ladder},
+			{tree, &r.TreePIDs},
+			{cgroups, &r.Cgroups},
+		} {
+			if err := json.Unmarshal(f.raw, f.dst); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ListNodeEnforcement 计算节点上一批本地账号的期望限制状态；只返回 limited/blocked 的账号，其余视为不限制。
+func (s *Store) ListNodeEnforcement(ctx context.Context, nodeID string, localUsernames []string, cfg Config) ([]NodeEnforcement, error) {
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID == "" {
+		return nil, errors.New("node_id 不能为空")
+	}
+	out := make([]NodeEnforcement, 0)
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		for _, local := range localUsernames {
+			local = strings.TrimSpace(local)
+			if local == "" {
+				continue
+			}
+			billing, found, err := s.ResolveBillingUsernameTx(ctx, tx, nodeID, local)
+			if err != nil {
+				return err
+			}
+			if !found || strings.TrimSpace(billing) == "" {
+				billing = local
+			}
+			u, err := s.GetUserTx(ctx, tx, billing)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// 单节点消费上限只作用于本节点
+			nodeUntil, err := s.NodeSpendCapLimitTx(ctx, tx, billing, nodeID)
+			if err != nil {
+				return err
+			}
+			status := EffectiveStatus(u.Status, nodeUntil, time.Now())
+			if status != "limited" && status != "blocked" {
+				continue
+			}
+			policy, err := s.ResolveUserPolicyTx(ctx, tx, billing, cfg)
+			if err != nil {
+				return err
+			}
+			out = append(out, DesiredEnforcement(local, billing, status, policy, cfg))
+		}
+		return nil
+	})
+	return out, err
+}
+
+// InsertEnforcementDrift 记录 Agent 回报的限制偏差，返回写入条数。
+func (s *Store) InsertEnforcementDrift(ctx context.Context, nodeID string, items []EnforcementDrift) (int, error) {
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID == "" {
+		return 0, errors.New("node_id 不能为空")
+	}
+	n := 0
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		for _, d := range items {
+			local := strings.TrimSpace(d.LocalUsername)
+			item := strings.TrimSpace(d.Item)
+			if local == "" || item == "" {
+				return errors.New("local_username/item 不能为空")
+			}
+			username := local
+			mapped, found, err := s.ResolveBillingUsernameTx(ctx, tx, nodeID, local)
+			if err != nil {
+				return err
+			}
+			if found && strings.TrimSpace(mapped) != "" {
+				username = mapped
+			}
+			detected := d.DetectedAt
+			if detected.IsZero() {
+				detected = time.Now()
+			}
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO enforcement_drift(node_id, local_username, username, item, expected, actual, repaired, error, detected_at)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+				nodeID, local, username, item, truncateRunes(d.Expected, 200), truncateRunes(d.Actual, 200), d.Repaired, strings.TrimSpace(d.Error), detected); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// ListEnforcementDrift 按节点 / 计费账号过滤限制偏差记录，条件为空表示不过滤。
+func (s *Store) ListEnforcementDrift(ctx context.Context, nodeID string, username string, limit int) ([]EnforcementDrift, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, node_id, local_username, username, item, expected, actual, repaired, error, detected_at, created_at
+FROM enforcement_drift
+WHERE ($1='' OR node_id=$1) AND ($2='' OR username=$2)
+ORDER BY created_at DESC
+LIMIT $3`, strings.TrimSpace(nodeID), strings.TrimSpace(username), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]EnforcementDrift, 0)
+	for rows.Next() {
+		var d EnforcementDrift
+		if err := rows.Scan(&d.ID, &d.NodeID, &d.LocalUsername, &d.Username, &d.Item, &d.Expected, &d.Actual, &d.Repaired, &d.Error, &d.DetectedAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n])
+}
+
+// UpsertJobSampleTx 把一次上报内某作业的合计并入作业行：同一 (节点, 本地账号, 作业标识, 命令) 最近一次采样
+// 在 gap 内则延续该作业，否则新建作业（PID 复用或同一脚本重新运行）。返回作业 ID 及是否新建。
+func (s *Store) UpsertJobSampleTx(ctx context.Context, tx *sql.Tx, nodeID string, ts time.Time, intervalSeconds int, gap time.Duration, j JobSample) (int64, bool, error) {
+	tagsJSON, err := marshalTags(j.Tags)
+	if err != nil {
+		return 0, false, err
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+SELECT id FROM jobs
+WHERE node_id=$1 AND local_username=$2 AND job_key=$3 AND command=$4 AND ended_at >= $5 AND ended_at < $6
+ORDER BY ended_at DESC
+LIMIT 1
+FOR UPDATE`, nodeID, j.LocalUsername, j.JobKey, j.Command, ts.Add(-gap), ts).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+UPDATE jobs SET
+  username=$2, group_id=$3, ended_at=$4, samples=samples+1,
+  gpu_minutes=gpu_minutes+$5, cpu_core_minutes=cpu_core_minutes+$6,
+  peak_gpu_memory_mb=GREATEST(peak_gpu_memory_mb, $7), peak_gpu_count=GREATEST(peak_gpu_count, $8),
+  cost=cost+$9, tags=$10::jsonb || tags, updated_at=NOW()
+WHERE id=$1`, id, j.Username, j.GroupID, ts, j.GPUMinutes, j.CPUCoreMinutes, j.GPUMemoryMB, j.GPUCount, round4(j.Cost), tagsJSON)
+		return id, false, err
+	}
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO jobs(node_id, local_username, username, job_key, command, group_id, started_at, ended_at, samples,
+                 gpu_minutes, cpu_core_minutes, peak_gpu_memory_mb, peak_gpu_count, cost, tags, project_id)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,1,$9,$10,$11,$12,$13,$14,$15)
+RETURNING id`, nodeID, j.LocalUsername, j.Username, j.JobKey, j.Command, j.GroupID,
+		ts.Add(-time.Duration(intervalSeconds)*time.Second), ts,
+		j.GPUMinutes, j.CPUCoreMinutes, j.GPUMemoryMB, j.GPUCount, round4(j.Cost), tagsJSON, j.ProjectID).Scan(&id)
+	return id, err == nil, err
+}
+
+const jobColumns = `id, node_id, local_username, username, job_key, command, group_id, started_at, ended_at,
+       samples, gpu_minutes, cpu_core_minutes, peak_gpu_memory_mb, peak_gpu_count, cost, tags, project_id`
+
+func scanJob(row interface{ Scan(...any) error }) (Job, error) {
+	var j Job
+	var tags []byte
+	err := row.Scan(&j.ID, &j.NodeID, &j.LocalUsername, &j.Username, &j.JobKey, &j.Command, &j.GroupID, &j.StartedAt, &j.EndedAt,
+		&j.Samples, &j.GPUMinutes, &j.CPUCoreMinutes, &j.PeakGPUMemoryMB, &j.PeakGPUCount, &j.Cost, &tags, &j.ProjectID)
+	j.Tags = unmarshalTags(tags)
+	j.DurationSeconds = int64(j.EndedAt.Sub(j.StartedAt).Seconds())
+	return j, err
+}
+
+// ListJobs 按计费账号 / 节点过滤作业（条件为空表示不过滤），按开始时间倒序；gpuOnly 时只返回用过 GPU 的作业。
+func (s *Store) ListJobs(ctx context.Context, username string, nodeID string, gpuOnly bool, limit int) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT `+jobColumns+`
+FROM jobs
+WHERE ($1='' OR username=$1) AND ($2='' OR node_id=$2) AND (NOT $3 OR gpu_minutes > 0)
+ORDER BY started_at DESC
+LIMIT $4`, strings.TrimSpace(username), strings.TrimSpace(nodeID), gpuOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetJob(ctx context.Context, id int64) (Job, bool, error) {
+	j, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id=$1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return j, true, nil
+}
+
+// ListJobUsageRecords 返回作业包含的逐进程采样，按时间正序。
+func (s *Store) ListJobUsageRecords(ctx context.Context, jobID int64, limit int) ([]UsageRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT node_id, local_username, username, timestamp, pid, cpu_percent, memory_mb, gpu_count, command, gpu_usage, cost, process_user, attribution, job_id, tags, project_id
+FROM usage_records
+WHERE job_id=$1
+ORDER BY timestamp, pid
+LIMIT $2`, jobID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UsageRecord
+	for rows.Next() {
+		var r UsageRecord
+		var tags []byte
+		if err := rows.Scan(&r.NodeID, &r.LocalUser, &r.BillingUser, &r.Timestamp, &r.PID, &r.CPUPercent, &r.MemoryMB, &r.GPUCount, &r.Command, &r.GPUUsage, &r.Cost, &r.ProcessUser, &r.Attribution, &r.JobID, &tags, &r.ProjectID); err != nil {
+			return nil, err
+		}
+		r.Tags = unmarshalTags(tags)
+		r.Username = r.BillingUser
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func marshalTags(tags map[string]string) (string, error) {
+	if len(tags) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(tags)
+	return string(b), err
+}
+
+func unmarshalTags(b []byte) map[string]string {
+	var tags map[string]string
+	if len(b) == 0 || json.Unmarshal(b, &tags) != nil || len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// ListUsageByTag 按标签值汇总用量（例如同一 SLURM_JOB_ID / GPUOPS_PROJECT 的费用）；username 为空表示全部计费账号。
+func (s *Store) ListUsageByTag(ctx context.Context, tag string, username string, from time.Time, to time.Time, limit int) ([]UsageTagSummary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT ur.tags->>$1 AS value,
+       COUNT(DISTINCT ur.username) AS users,
+       COUNT(1) AS usage_records,
+       SUM(CASE WHEN ur.gpu_count > 0 THEN 1 ELSE 0 END) AS gpu_process_records,
+       COALESCE(SUM(ur.cost), 0) AS total_cost,
+       MIN(ur.timestamp), MAX(ur.timestamp)
+FROM usage_records ur
+WHERE ur.tags ? $1 AND ($2='' OR ur.username=$2) AND ur.timestamp >= $3 AND ur.timestamp <= $4
+GROUP BY ur.tags->>$1
+ORDER BY total_cost DESC
+LIMIT $5`, tag, strings.TrimSpace(username), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]UsageTagSummary, 0)
+	for rows.Next() {
+		x := UsageTagSummary{Tag: tag}
+		if err := rows.Scan(&x.Value, &x.Users, &x.UsageRecords, &x.GPUProcessRecords, &x.TotalCost, &x.FirstSeen, &x.LastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+	}
+	return out, rows.Err()
+}
+
+// ResolveProjectTx 确定进程费用归属的项目：优先使用进程标注的项目名（GPUOPS_PROJECT），
+// 其次使用节点本地账号的默认项目（精确节点优先于 '*'）；计费账号不是项目成员时不归属（返回 0）。
+func (s *Store) ResolveProjectTx(ctx context.Context, tx *sql.Tx, nodeID string, localUsername string, billingUsername string, projectName string) (int, error) {
+	var id int
+	projectName = strings.TrimSpace(projectName)
+	if projectName != "" {
+		err := tx.QueryRowContext(ctx, `
+SELECT p.project_id
+FROM projects p
+JOIN project_members m ON m.project_id = p.project_id
+WHERE p.project_name=$1 AND m.username=$2`, projectName, billingUsername).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+	err := tx.QueryRowContext(ctx, `
+SELECT d.project_id
+FROM project_defaults d
+JOIN project_members m ON m.project_id = d.project_id
+WHERE d.node_id IN ($1, '*') AND d.local_username=$2 AND m.username=$3
+ORDER BY CASE WHEN d.node_id = '*' THEN 1 ELSE 0 END
+LIMIT 1`, nodeID, localUsername, billingUsername).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// GetProjectSpendTx 返回项目名称、月度预算与自 monthStart 起的费用（含本次上报已写入的用量）。
+func (s *Store) GetProjectSpendTx(ctx context.Context, tx *sql.Tx, projectID int, monthStart time.Time) (string, *float64, float64, error) {
+	var name string
+	var budget sql.NullFloat64
+	var spend float64
+	err := tx.QueryRowContext(ctx, `
+SELECT p.project_name, p.monthly_budget,
+       COALESCE((SELECT SUM(cost) FROM usage_records WHERE project_id=p.project_id AND timestamp >= $2), 0)
+FROM projects p
+WHERE p.project_id=$1`, projectID, monthStart).Scan(&name, &budget, &spend)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if !budget.Valid {
+		return name, nil, spend, nil
+	}
+	v := budget.Float64
+	return name, &v, spend, nil
+}
+
+const projectColumns = `
+SELECT p.project_id, p.project_name, p.description, p.monthly_budget,
+       COALESCE((SELECT SUM(cost) FROM usage_records WHERE project_id=p.project_id AND timestamp >= $1), 0) AS month_spend,
+       (SELECT COUNT(1) FROM project_members WHERE project_id=p.project_id) AS members,
+       p.created_at, p.updated_at
+FROM projects p`
+
+func scanProject(sc interface{ Scan(dest ...any) error }) (Project, error) {
+	var p Project
+	var budget sql.NullFloat64
+	if err := sc.Scan(&p.ProjectID, &p.ProjectName, &p.Description, &budget, &p.MonthSpend, &p.Members, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return Project{}, err
+	}
+	if budget.Valid {
+		v := budget.Float64
+		p.MonthlyBudget = &v
+	}
+	p.MonthSpend = round4(p.MonthSpend)
+	return p, nil
+}
+
+func (s *Store) queryProjects(ctx context.Context, query string, args ...any) ([]Project, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Project, 0)
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListProjects 返回全部项目及自 monthStart 起的费用。
+func (s *Store) ListProjects(ctx context.Context, monthStart time.Time) ([]Project, error) {
+	return s.queryProjects(ctx, projectColumns+`
+ORDER BY p.project_name`, monthStart)
+}
+
+// ListProjectsByMember 返回计费账号所属的项目。
+func (s *Store) ListProjectsByMember(ctx context.Context, username string, monthStart time.Time) ([]Project, error) {
+	return s.queryProjects(ctx, projectColumns+`
+JOIN project_members pm ON pm.project_id = p.project_id
+WHERE pm.username=$2
+ORDER BY p.project_name`, monthStart, strings.TrimSpace(username))
+}
+
+func validateProject(name string, budget *float64) error {
+	if name == "" {
+		return errors.New("project_name 不能为空")
+	}
+	if !projectNamePattern.MatchString(name) {
+		return errors.New("project_name 只能包含字母、数字、点、下划线和连字符")
+	}
+	if budget != nil && *budget < 0 {
+		return errors.New("monthly_budget 不能为负数")
+	}
+	return nil
+}
+
+func (s *Store) CreateProject(ctx context.Context, name string, description string, budget *float64) (int, error) {
+	name = strings.TrimSpace(name)
+	if err := validateProject(name, budget); err != nil {
+		return 0, err
+	}
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+INSERT INTO projects(project_name, description, monthly_budget)
+VALUES($1,$2,$3)
+ON CONFLICT (project_name) DO NOTHING
+RETURNING project_id`, name, strings.TrimSpace(description), budget).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("项目名称已存在")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) UpdateProject(ctx context.Context, projectID int, name string, description string, budget *float64) error {
+	name = strings.TrimSpace(name)
+	if projectID <= 0 {
+		return errors.New("project_id 不合法")
+	}
+	if err := validateProject(name, budget); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `
+UPDATE projects
+SET project_name=$2, description=$3, monthly_budget=$4, updated_at=NOW()
+WHERE project_id=$1`, projectID, name, strings.TrimSpace(description), budget)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteProject 删除项目及其成员与默认项目配置；历史用量保留 project_id，汇总时显示为未归属。
+func (s *Store) DeleteProject(ctx context.Context, projectID int) error {
+	if projectID <= 0 {
+		return errors.New("project_id 不合法")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM projects WHERE project_id=$1`, projectID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListProjectMembers(ctx context.Context, projectID int) ([]ProjectMember, error) {
+	if projectID <= 0 {
+		return nil, errors.New("project_id 不合法")
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT project_id, username, created_by, created_at
+FROM project_members
+WHERE project_id=$1
+ORDER BY username`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ProjectMember, 0)
+	for rows.Next() {
+		var m ProjectMember
+		if err := rows.Scan(&m.ProjectID, &m.Username, &m.CreatedBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// AddProjectMember 把计费账号加入项目；与课题组不同，一个账号可同时属于多个项目。
+func (s *Store) AddProjectMember(ctx context.Context, projectID int, username string, createdBy string) error {
+	username = strings.TrimSpace(username)
+	createdBy = strings.TrimSpace(createdBy)
+	if projectID <= 0 || username == "" {
+		return errors.New("project_id/username 不能为空")
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO project_members(project_id, username, created_by)
+VALUES($1,$2,$3)
+ON CONFLICT (project_id, username) DO NOTHING`, projectID, username, createdBy)
+	return err
+}
+
+func (s *Store) RemoveProjectMember(ctx context.Context, projectID int, username string) error {
+	username = strings.TrimSpace(username)
+	if projectID <= 0 || username == "" {
+		return errors.New("project_id/username 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM project_members WHERE project_id=$1 AND username=$2`, projectID, username)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListProjectDefaults(ctx context.Context) ([]ProjectDefault, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT d.node_id, d.local_username, d.project_id, p.project_name, d.created_by, d.updated_at
+FROM project_defaults d
+JOIN projects p ON p.project_id = d.project_id
+ORDER BY d.node_id, d.local_username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ProjectDefault, 0)
+	for rows.Next() {
+		var d ProjectDefault
+		if err := rows.Scan(&d.NodeID, &d.LocalUsername, &d.ProjectID, &d.ProjectName, &d.CreatedBy, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// UpsertProjectDefault 设置节点本地账号的默认项目；nodeID 为 "*" 表示所有节点。
+func (s *Store) UpsertProjectDefault(ctx context.Context, nodeID string, localUsername string, projectID int, createdBy string) error {
+	nodeID = strings.TrimSpace(nodeID)
+	localUsername = strings.TrimSpace(localUsername)
+	createdBy = strings.TrimSpace(createdBy)
+	if nodeID == "" || localUsername == "" || projectID <= 0 {
+		return errors.New("node_id/local_username/project_id 不能为空")
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO project_defaults(node_id, local_username, project_id, created_by, updated_at)
+VALUES($1,$2,$3,$4,NOW())
+ON CONFLICT (node_id, local_username) DO UPDATE SET
+  project_id=EXCLUDED.project_id, created_by=EXCLUDED.created_by, updated_at=NOW()`, nodeID, localUsername, projectID, createdBy)
+	return err
+}
+
+func (s *Store) DeleteProjectDefault(ctx context.Context, nodeID string, localUsername string) error {
+	nodeID = strings.TrimSpace(nodeID)
+	localUsername = strings.TrimSpace(localUsername)
+	if nodeID == "" || localUsername == "" {
+		return errors.New("node_id/local_username 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM project_defaults WHERE node_id=$1 AND local_username=$2`, nodeID, localUsername)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpsertIdleGPUHolderTx 记录一次空闲采样：同一 (节点, PID) 命令不变且距上次采样不超过 gap 时延续空闲计时，
+// 否则（PID 复用、上报中断）从本次采样重新计时。返回更新后的记录（含已发送的提醒级别）。
+func (s *Store) UpsertIdleGPUHolderTx(ctx context.Context, tx *sql.Tx, h IdleGPUHolder, cost float64, gap time.Duration) (IdleGPUHolder, error) {
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM gpu_idle_holders
+WHERE node_id=$1 AND pid=$2 AND (command <> $3 OR last_seen < $4)`,
+		h.NodeID, h.PID, truncateRunes(h.Command, 256), h.LastSeen.Add(-gap)); err != nil {
+		return h, err
+	}
+	var notifiedAt, killAt sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+INSERT INTO gpu_idle_holders(node_id, pid, local_username, username, command, gpu_ids, memory_mb, utilization_percent,
+                             idle_since, last_seen, idle_cost)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$9,$10)
+ON CONFLICT (node_id, pid) DO UPDATE SET
+  local_username=EXCLUDED.local_username, username=EXCLUDED.username, gpu_ids=EXCLUDED.gpu_ids,
+  memory_mb=EXCLUDED.memory_mb, utilization_percent=EXCLUDED.utilization_percent,
+  last_seen=EXCLUDED.last_seen, idle_cost=gpu_idle_holders.idle_cost+EXCLUDED.idle_cost
+RETURNING idle_since, last_seen, idle_cost, notify_level, notified_at, kill_requested_at`,
+		h.NodeID, h.PID, h.LocalUsername, h.Username, truncateRunes(h.Command, 256), pq.Array(h.GPUIDs), h.MemoryMB, h.UtilizationPercent,
+		h.LastSeen, round4(cost)).Scan(&h.IdleSince, &h.LastSeen, &h.IdleCost, &h.NotifyLevel, &notifiedAt, &killAt)
+	if err != nil {
+		return h, err
+	}
+	if notifiedAt.Valid {
+		h.NotifiedAt = &notifiedAt.Time
+	}
+	if killAt.Valid {
+		h.KillRequestedAt = &killAt.Time
+	}
+	return h, nil
+}
+
+// ClearIdleGPUHoldersTx 删除本次上报中不再空闲（恢复计算或已退出）的记录。
+func (s *Store) ClearIdleGPUHoldersTx(ctx context.Context, tx *sql.Tx, nodeID string, ts time.Time) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM gpu_idle_holders WHERE node_id=$1 AND last_seen < $2`, nodeID, ts)
+	return err
+}
+
+// MarkIdleGPUHolderTx 记录已发送的提醒级别；killRequested 时同时记录回收时间，避免重复下发 kill。
+func (s *Store) MarkIdleGPUHolderTx(ctx context.Context, tx *sql.Tx, nodeID string, pid int32, level int, killRequested bool, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+UPDATE gpu_idle_holders
+SET notify_level=GREATEST(notify_level, $3),
+    notified_at=$4,
+    kill_requested_at=CASE WHEN $5 THEN $4 ELSE kill_requested_at END
+WHERE node_id=$1 AND pid=$2`, nodeID, pid, level, now, killRequested)
+	return err
+}
+
+// LoadIdleGPUExemptionsTx 返回当前节点是否整体豁免，以及豁免的计费账号集合（已过期的不算）。
+func (s *Store) LoadIdleGPUExemptionsTx(ctx context.Context, tx *sql.Tx, nodeID string, now time.Time) (bool, map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT scope, target
+FROM gpu_idle_exemptions
+WHERE (expires_at IS NULL OR expires_at > $2)
+  AND (scope='user' OR (scope='node' AND target=$1))`, nodeID, now)
+	if err != nil {
+		return false, nil, err
+	}
+	defer rows.Close()
+	nodeExempt := false
+	users := make(map[string]bool)
+	for rows.Next() {
+		var scope, target string
+		if err := rows.Scan(&scope, &target); err != nil {
+			return false, nil, err
+		}
+		if scope == "node" {
+			nodeExempt = true
+		} else {
+			users[target] = true
+		}
+	}
+	return nodeExempt, users, rows.Err()
+}
+
+// ListIdleGPUHolders 返回空闲时长不少于 minIdle 的进程，按空闲时长倒序；条件为空表示不过滤。
+func (s *Store) ListIdleGPUHolders(ctx context.Context, nodeID string, username string, minIdle time.Duration, now time.Time, limit int) ([]IdleGPUHolder, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT node_id, pid, local_username, username, command, gpu_ids, memory_mb, utilization_percent,
+       idle_since, last_seen, idle_cost, notify_level, notified_at, kill_requested_at
+FROM gpu_idle_holders
+WHERE ($1='' OR node_id=$1) AND ($2='' OR username=$2) AND idle_since <= $3
+ORDER BY idle_since ASC
+LIMIT $4`, strings.TrimSpace(nodeID), strings.TrimSpace(username), now.Add(-minIdle), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]IdleGPUHolder, 0)
+	for rows.Next() {
+		var h IdleGPUHolder
+		var notifiedAt, killAt sql.NullTime
+		if err := rows.Scan(&h.NodeID, &h.PID, &h.LocalUsername, &h.Username, &h.Command, pq.Array(&h.GPUIDs), &h.MemoryMB, &h.UtilizationPercent,
+			&h.IdleSince, &h.LastSeen, &h.IdleCost, &h.NotifyLevel, &notifiedAt, &killAt); err != nil {
+			return nil, err
+		}
+		if notifiedAt.Valid {
+			h.NotifiedAt = &notifiedAt.Time
+		}
+		if killAt.Valid {
+			h.KillRequestedAt = &killAt.Time
+		}
+		h.IdleMinutes = int(h.LastSeen.Sub(h.IdleSince) / time.Minute)
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListIdleGPUExemptions(ctx context.Context) ([]IdleGPUExemption, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT scope, target, reason, expires_at, created_by, created_at
+FROM gpu_idle_exemptions
+ORDER BY scope, target`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]IdleGPUExemption, 0)
+	for rows.Next() {
+		var e IdleGPUExemption
+		var expires sql.NullTime
+		if err := rows.Scan(&e.Scope, &e.Target, &e.Reason, &expires, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			e.ExpiresAt = &expires.Time
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// UpsertIdleGPUExemption 新增或修改豁免；新增豁免后，下一次上报即清除该用户 / 节点的空闲记录。
+func (s *Store) UpsertIdleGPUExemption(ctx context.Context, e IdleGPUExemption, createdBy string) error {
+	e.Scope = strings.TrimSpace(e.Scope)
+	e.Target = strings.TrimSpace(e.Target)
+	e.Reason = truncateRunes(e.Reason, 200)
+	createdBy = strings.TrimSpace(createdBy)
+	if e.Scope != "user" && e.Scope != "node" {
+		return errors.New("scope 仅支持 user/node")
+	}
+	if e.Target == "" {
+		return errors.New("target 不能为空")
+	}
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO gpu_idle_exemptions(scope, target, reason, expires_at, created_by)
+VALUES($1,$2,$3,$4,$5)
+ON CONFLICT (scope, target) DO UPDATE
+SET reason=EXCLUDED.reason, expires_at=EXCLUDED.expires_at, created_by=EXCLUDED.created_by`,
+		e.Scope, e.Target, e.Reason, e.ExpiresAt, createdBy)
+	return err
+}
+
+func (s *Store) DeleteIdleGPUExemption(ctx context.Context, scope string, target string) error {
+	scope = strings.TrimSpace(scope)
+	target = strings.TrimSpace(target)
+	if scope == "" || target == "" {
+		return errors.New("scope/target 不能为空")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM gpu_idle_exemptions WHERE scope=$1 AND target=$2`, scope, target)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const reservationColumns = `id, node_id, gpu_model, gpu_count, gpu_ids, username, group_id, start_at, end_at, purpose,
+       status, review_note, reviewed_by, reviewed_at, created_at, updated_at`
+
+func scanReservation(sc interface{ Scan(dest ...any) error }) (GPUReservation, error) {
+	var r GPUReservation
+	var reviewedAt sql.NullTime
+	if err := sc.Scan(&r.ID, &r.NodeID, &r.GPUModel, &r.GPUCount, pq.Array(&r.GPUIDs), &r.Username, &r.GroupID, &r.StartAt, &r.EndAt, &r.Purpose,
+		&r.Status, &r.ReviewNote, &r.ReviewedBy, &reviewedAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return GPUReservation{}, err
+	}
+	if reviewedAt.Valid {
+		r.ReviewedAt = &reviewedAt.Time
+	}
+	if r.GPUIDs == nil {
+		r.GPUIDs = []int64{}
+	}
+	return r, nil
+}
+
+func queryReservations(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, query string, args ...any) ([]GPUReservation, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GPUReservation, 0)
+	for rows.Next() {
+		r, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ReservationConflictError 表示预约与已有预约的卡号 / 时间段冲突。
+type ReservationConflictError struct {
+	Conflicts []GPUReservation
+}
+
+func (e *ReservationConflictError) Error() string {
+	parts := make([]string, 0, len(e.Conflicts))
+	for _, r := range e.Conflicts {
+		parts = append(parts, fmt.Sprintf("#%d（%s，%s ~ %s，卡 %s）", r.ID, r.Username,
+			r.StartAt.Format("01-02 15:04"), r.EndAt.Format("01-02 15:04"), formatGPUIDs(r.GPUIDs)))
+	}
+	return "与已有预约冲突：" + strings.Join(parts, "；")
+}
+
+func intersectGPUIDs(a []int64, b []int64) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlappingReservationsTx 锁定节点上与 [start, end) 重叠、状态在 statuses 中的其他预约。
+func overlappingReservationsTx(ctx context.Context, tx *sql.Tx, nodeID string, start time.Time, end time.Time, excludeID int64, statuses []string) ([]GPUReservation, error) {
+	return queryReservations(ctx, tx, `
+SELECT `+reservationColumns+`
+FROM gpu_reservations
+WHERE node_id=$1 AND start_at < $3 AND end_at > $2 AND id <> $4 AND status = ANY($5)
+ORDER BY start_at
+FOR UPDATE`, nodeID, start, end, excludeID, pq.Array(statuses))
+}
+
+// overrideReservationsTx 取消被管理员强制预约 / 审批覆盖的预约。
+func overrideReservationsTx(ctx context.Context, tx *sql.Tx, victims []GPUReservation, byID int64, operator string, now time.Time) error {
+	for _, v := range victims {
+		if _, err := tx.ExecContext(ctx, `
+UPDATE gpu_reservations
+SET status='cancelled', review_note=$2, reviewed_by=$3, reviewed_at=$4, updated_at=$4
+WHERE id=$1`, v.ID, fmt.Sprintf("被管理员预约 #%d 覆盖", byID), operator, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateReservationTx 新建预约并分配卡号：与同节点重叠的待审批 / 已批准预约的卡号不重复分配。
+// r.GPUIDs 非空时按指定卡号预约（管理员）；卡不足或指定卡号冲突时返回 *ReservationConflictError，
+// force 时改为取消冲突的预约（管理员覆盖），返回被覆盖的预约。
+func (s *Store) CreateReservationTx(ctx context.Context, tx *sql.Tx, r GPUReservation, force bool, operator string, now time.Time) (GPUReservation, []GPUReservation, error) {
+	r.NodeID = strings.TrimSpace(r.NodeID)
+	r.GPUModel = truncateRunes(r.GPUModel, 100)
+	r.Username = strings.TrimSpace(r.Username)
+	r.Purpose = truncateRunes(r.Purpose, 200)
+	if r.NodeID == "" || r.Username == "" {
+		return r, nil, errors.New("node_id/username 不能为空")
+	}
+	if r.Status != "approved" {
+		r.Status = "pending"
+	}
+	var nodeModel string
+	var total int
+	err := tx.QueryRowContext(ctx, `SELECT gpu_model, gpu_count FROM nodes WHERE node_id=$1 FOR UPDATE`, r.NodeID).Scan(&nodeModel, &total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, nil, errors.New("节点不存在或尚未上报")
+	}
+	if err != nil {
+		return r, nil, err
+	}
+	if total <= 0 {
+		return r, nil, errors.New("该节点没有 GPU")
+	}
+	if !gpuModelMatches(nodeModel, r.GPUModel) {
+		return r, nil, fmt.Errorf("节点 GPU 型号为 %s，与预约型号 %s 不符", nodeModel, r.GPUModel)
+	}
+	if len(r.GPUIDs) > 0 {
+		ids, err := normalizeGPUIDs(r.GPUIDs, total)
+		if err != nil {
+			return r, nil, err
+		}
+		r.GPUIDs = ids
+		r.GPUCount = len(ids)
+	}
+	if r.GPUCount <= 0 || r.GPUCount > total {
+		return r, nil, fmt.Errorf("gpu_count 必须在 [1, %d] 范围内", total)
+	}
+	if err := s.checkMaintenanceFreeTx(ctx, tx, r.NodeID, r.StartAt, r.EndAt, now); err != nil {
+		return r, nil, err
+	}
+	issues, err := s.OpenGPUHealthIssuesTx(ctx, tx, r.NodeID)
+	if err != nil {
+		return r, nil, err
+	}
+	unhealthy, nodeUnhealthy := UnhealthyGPUs(issues)
+	if nodeUnhealthy {
+		return r, nil, errors.New("节点硬件健康检查异常，暂停预约")
+	}
+	for _, id := range r.GPUIDs {
+		if unhealthy[id] {
+			return r, nil, fmt.Errorf("GPU %d 健康检查异常，不能预约", id)
+		}
+	}
+	if r.GPUCount > total-len(unhealthy) {
+		return r, nil, fmt.Errorf("节点有 %d 张卡健康检查异常，最多可预约 %d 张", len(unhealthy), total-len(unhealthy))
+	}
+
+	overlapping, err := overlappingReservationsTx(ctx, tx, r.NodeID, r.StartAt, r.EndAt, 0, []string{"pending", "approved"})
+	if err != nil {
+		return r, nil, err
+	}
+	if len(r.GPUIDs) == 0 {
+		taken := make(map[int64]bool)
+		for id := range unhealthy {
+			taken[id] = true
+		}
+		for _, o := range overlapping {
+			for _, id := range o.GPUIDs {
+				taken[id] = true
+			}
+		}
+		ids, ok := AllocateReservationGPUs(total, taken, r.GPUCount)
+		if !ok && force {
+			// 管理员覆盖：空闲卡不够时从小到大补上已被预约的卡
+			ids, _ = AllocateReservationGPUs(total, unhealthy, r.GPUCount)
+		}
+		if !ok && !force {
+			return r, nil, &ReservationConflictError{Conflicts: overlapping}
+		}
+		r.GPUIDs = ids
+	}
+	var conflicts []GPUReservation
+	for _, o := range overlapping {
+		if intersectGPUIDs(o.GPUIDs, r.GPUIDs) {
+			conflicts = append(conflicts, o)
+		}
+	}
+	if len(conflicts) > 0 && !force {
+		return r, nil, &ReservationConflictError{Conflicts: conflicts}
+	}
+
+	var reviewedBy string
+	var reviewedAt *time.Time
+	if r.Status == "approved" {
+		reviewedBy, reviewedAt = operator, &now
+	}
+	out, err := scanReservation(tx.QueryRowContext(ctx, `
+INSERT INTO gpu_reservations(node_id, gpu_model, gpu_count, gpu_ids, username, group_id, start_at, end_at, purpose, status, reviewed_by, reviewed_at)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+RETURNING `+reservationColumns,
+		r.NodeID, r.GPUModel, r.GPUCount, pq.Array(r.GPUIDs), r.Username, r.GroupID, r.StartAt, r.EndAt, r.Purpose, r.Status, reviewedBy, reviewedAt))
+	if err != nil {
+		return r, nil, err
+	}
+	if err := overrideReservationsTx(ctx, tx, conflicts, out.ID, operator, now); err != nil {
+		return out, nil, err
+	}
+	return out, conflicts, nil
+}
+
+// ReviewReservationTx 审批待审批的预约：批准时再次检查与已批准预约的冲突（可能由管理员覆盖产生），
+// force 时取消冲突的预约。返回审批后的预约与被覆盖的预约。
+func (s *Store) ReviewReservationTx(ctx context.Context, tx *sql.Tx, id int64, approve bool, note string, force bool, reviewer string, now time.Time) (GPUReservation, []GPUReservation, error) {
+	r, err := scanReservation(tx.QueryRowContext(ctx, `SELECT `+reservationColumns+` FROM gpu_reservations WHERE id=$1 FOR UPDATE`, id))
+	if err != nil {
+		return r, nil, err
+	}
+	if r.Status != "pending" {
+		return r, nil, errors.New("只能审批待审批的预约")
+	}
+	status := "rejected"
+	var conflicts []GPUReservation
+	if approve {
+		status = "approved"
+		if !r.EndAt.After(now) {
+			return r, nil, errors.New("预约已过期")
+		}
+		if err := s.checkMaintenanceFreeTx(ctx, tx, r.NodeID, r.StartAt, r.EndAt, now); err != nil {
+			return r, nil, err
+		}
+		issues, err := s.OpenGPUHealthIssuesTx(ctx, tx, r.NodeID)
+		if err != nil {
+			return r, nil, err
+		}
+		unhealthy, nodeUnhealthy := UnhealthyGPUs(issues)
+		if nodeUnhealthy {
+			return r, nil, errors.New("节点硬件健康检查异常，暂不能批准预约")
+		}
+		for _, id := range r.GPUIDs {
+			if unhealthy[id] {
+				return r, nil, fmt.Errorf("GPU %d 健康检查异常，暂不能批准预约", id)
+			}
+		}
+		overlapping, err := overlappingReservationsTx(ctx, tx, r.NodeID, r.StartAt, r.EndAt, r.ID, []string{"approved"})
+		if err != nil {
+			return r, nil, err
+		}
+		for _, o := range overlapping {
+			if intersectGPUIDs(o.GPUIDs, r.GPUIDs) {
+				conflicts = append(conflicts, o)
+			}
+		}
+		if len(conflicts) > 0 && !force {
+			return r, nil, &ReservationConflictError{Conflicts: conflicts}
+		}
+		if err := overrideReservationsTx(ctx, tx, conflicts, r.ID, reviewer, now); err != nil {
+			return r, nil, err
+		}
+	}
+	out, err := scanReservation(tx.QueryRowContext(ctx, `
+UPDATE gpu_reservations
+SET status=$2, review_note=$3, reviewed_by=$4, reviewed_at=$5, updated_at=$5
+WHERE id=$1
+RETURNING `+reservationColumns, id, status, truncateRunes(note, 200), reviewer, now))
+	return out, conflicts, err
+}
+
+// CancelReservation 取消尚未结束的预约；username 非空时只能取消本人发起的预约。
+func (s *Store) CancelReservation(ctx context.Context, id int64, username string, operator string, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE gpu_reservations
+SET status='cancelled', reviewed_by=CASE WHEN $2='' THEN $3 ELSE reviewed_by END, updated_at=$4
+WHERE id=$1 AND ($2='' OR username=$2) AND status IN ('pending','approved') AND end_at > $4`,
+		id, strings.TrimSpace(username), operator, now)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListReservations 按节点 / 状态 / 时间段过滤预约（与 [from, to) 重叠），按开始时间排序。
+// username 或 groupID 非空时只返回该账号发起或为该课题组发起的预约；statuses 为空表示不过滤状态。
+func (s *Store) ListReservations(ctx context.Context, nodeID string, username string, groupID int, statuses []string, from time.Time, to time.Time, limit int) ([]GPUReservation, error) {
+	return queryReservations(ctx, s.db, `
+SELECT `+reservationColumns+`
+FROM gpu_reservations
+WHERE ($1='' OR node_id=$1)
+  AND (($2='' AND $3=0) OR username=$2 OR ($3>0 AND group_id=$3))
+  AND (cardinality($4::text[])=0 OR status = ANY($4))
+  AND end_at > $5 AND start_at < $6
+ORDER BY start_at, id
+LIMIT $7`, strings.TrimSpace(nodeID), strings.TrimSpace(username), groupID, pq.Array(statuses), from, to, limit)
+}
+
+// ListActiveReservationsTx 返回节点上 ts 时刻生效中的已批准预约。
+func (s *Store) ListActiveReservationsTx(ctx context.Context, tx *sql.Tx, nodeID string, ts time.Time) ([]GPUReservation, error) {
+	return queryReservations(ctx, tx, `
+SELECT `+reservationColumns+`
+FROM gpu_reservations
+WHERE node_id=$1 AND status='approved' AND start_at <= $2 AND end_at > $2
+ORDER BY id`, nodeID, ts)
+}
+
+// ListResearchGroupMemberSetTx 返回课题组成员集合（计费账号）。
+func (s *Store) ListResearchGroupMemberSetTx(ctx context.Context, tx *sql.Tx, groupID int) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT username FROM research_group_members WHERE group_id=$1`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]bool)
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		out[u] = true
+	}
+	return out, rows.Err()
+}
+
+// UpsertReservationViolationTx 记录预约卡上的非预约人进程，返回首次发现与本次时间（均以库中值为准）及是否已下发终止。
+func (s *Store) UpsertReservationViolationTx(ctx context.Context, tx *sql.Tx, reservationID int64, nodeID string, pid int32, localUsername string, username string, now time.Time) (time.Time, time.Time, bool, error) {
+	// PID 被其他账号复用时重新计时
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM gpu_reservation_violations
+WHERE reservation_id=$1 AND pid=$2 AND local_username <> $3`, reservationID, pid, localUsername); err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	var firstSeen, lastSeen time.Time
+	var killAt sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+INSERT INTO gpu_reservation_violations(reservation_id, node_id, pid, local_username, username, first_seen, last_seen)
+VALUES($1,$2,$3,$4,$5,$6,$6)
+ON CONFLICT (reservation_id, pid) DO UPDATE SET last_seen=EXCLUDED.last_seen, username=EXCLUDED.username
+RETURNING first_seen, last_seen, kill_requested_at`, reservationID, nodeID, pid, localUsername, username, now).Scan(&firstSeen, &lastSeen, &killAt)
+	return firstSeen, lastSeen, killAt.Valid, err
+}
+
+func (s *Store) MarkReservationViolationKilledTx(ctx context.Context, tx *sql.Tx, reservationID int64, pid int32, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+UPDATE gpu_reservation_violations SET kill_requested_at=$3
+WHERE reservation_id=$1 AND pid=$2`, reservationID, pid, now)
+	return err
+}
+
+// ClearReservationViolationsTx 删除本次上报中已不再出现的违规进程记录。
+func (s *Store) ClearReservationViolationsTx(ctx context.Context, tx *sql.Tx, nodeID string, ts time.Time) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM gpu_reservation_violations WHERE node_id=$1 AND last_seen < $2`, nodeID, ts)
+	return err
+}
+
+// LoadFairShareUsage 统计 since 之后各计费账号的 GPU 卡分钟，按距 now 的时间以 halfLife 为半衰期衰减。
+// usage_records 不记录采样间隔，按节点最近上报的 interval_seconds 估算（缺失时用 defaultIntervalSeconds）。
+func (s *Store) LoadFairShareUsage(ctx context.Context, now time.Time, since time.Time, halfLife time.Duration, defaultIntervalSeconds int) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT ur.username,
+       SUM(ur.gpu_count * COALESCE(NULLIF(n.interval_seconds, 0), $4) / 60.0
+           * power(0.5, GREATEST(EXTRACT(EPOCH FROM ($1 - ur.timestamp)), 0) / $2))
+FROM usage_records ur
+LEFT JOIN nodes n ON n.node_id = ur.node_id
+WHERE ur.timestamp >= $3 AND ur.gpu_count > 0
+GROUP BY ur.username`, now, halfLife.Seconds(), since, defaultIntervalSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]float64)
+	for rows.Next() {
+		var u string
+		var v float64
+		if err := rows.Scan(&u, &v); err != nil {
+			return nil, err
+		}
+		out[u] = v
+	}
+	return out, rows.Err()
+}
+
+// ListResearchGroupMembership 返回计费账号到课题组名的映射。
+func (s *Store) ListResearchGroupMembership(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT m.username, g.group_name
+FROM research_group_members m
+JOIN research_groups g ON g.group_id = m.group_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var u, g string
+		if err := rows.Scan(&u, &g); err != nil {
+			return nil, err
+		}
+		out[u] = g
+	}
+	return out, rows.Err()
+}
+
+// LoadGPUModelStats 按 GPU 型号汇总在线且未排空的节点（online 之后有上报）的总卡数、最近一次上报中被占用的卡数，
+// 以及完整落在统计窗口内的 GPU 进程时长分位数。进程按 (节点, 本地账号, PID, 作业) 聚合，时长为首末采样间隔加一个采样周期；
+// 只统计 since 之后开始（since 前 gap 内没有采样）且已结束（最后一次采样早于 now-gap）的进程，
+// 避免把仍在运行或窗口前已开始的进程截断后的时长计入分位数。gap 为作业合并间隔。
+func (s *Store) LoadGPUModelStats(ctx context.Context, now time.Time, online time.Time, since time.Time, gap time.Duration, defaultIntervalSeconds int) ([]GPUModelStats, error) {
+	byModel := make(map[string]*GPUModelStats)
+	get := func(model string) *GPUModelStats {
+		key := normalizeGPUModel(model)
+		st := byModel[key]
+		if st == nil {
+			st = &GPUModelStats{Model: model}
+			byModel[key] = st
+		}
+		return st
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT n.gpu_model,
+       n.gpu_count - (SELECT COUNT(DISTINCT h.gpu_index) FROM gpu_health_issues h
+                      WHERE h.node_id = n.node_id AND h.resolved_at IS NULL AND h.severity = 'critical' AND h.gpu_index >= 0),
+       (SELECT COUNT(DISTINCT g->>'gpu_id')
+        FROM usage_records ur, jsonb_array_elements(ur.gpu_usage) g
+        WHERE ur.node_id = n.node_id AND ur.timestamp = n.last_report_ts)
+FROM nodes n
+WHERE n.last_seen_at >= $1 AND n.gpu_count > 0 AND n.gpu_model <> ''
+  AND NOT EXISTS (
+    SELECT 1 FROM node_maintenance m
+    WHERE m.node_id = n.node_id AND m.ended_at IS NULL AND m.drain_at <= $2 AND (m.end_at IS NULL OR m.end_at > $2)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM gpu_health_issues h
+    WHERE h.node_id = n.node_id AND h.resolved_at IS NULL AND h.severity = 'critical' AND h.gpu_index < 0
+  )`, online, now)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var model string
+		var total, busy int
+		if err := rows.Scan(&model, &total, &busy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		total = max(total, 0)
+		st := get(model)
+		st.TotalGPUs += total
+		st.BusyGPUs += min(busy, total)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+WITH procs AS (
+  SELECT ur.gpu_usage->0->>'gpu_model' AS model,
+         EXTRACT(EPOCH FROM (MAX(ur.timestamp) - MIN(ur.timestamp))) / 60.0 + COALESCE(NULLIF(MAX(n.interval_seconds), 0), $2) / 60.0 AS minutes
+  FROM usage_records ur
+  LEFT JOIN nodes n ON n.node_id = ur.node_id
+  WHERE ur.timestamp >= $1 AND ur.gpu_count > 0
+  GROUP BY ur.node_id, ur.local_username, ur.pid, ur.job_id, model
+  HAVING MIN(ur.timestamp) >= $3 AND MAX(ur.timestamp) < $4
+)
+SELECT model, COUNT(*),
+       percentile_cont(0.25) WITHIN GROUP (ORDER BY minutes),
+       percentile_cont(0.5) WITHIN GROUP (ORDER BY minutes),
+       percentile_cont(0.75) WITHIN GROUP (ORDER BY minutes)
+FROM procs
+WHERE model IS NOT NULL AND model <> ''
+GROUP BY model`, since.Add(-gap), defaultIntervalSeconds, since, now.Add(-gap))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var model string
+		var n int
+		var p25, p50, p75 float64
+		if err := rows.Scan(&model, &n, &p25, &p50, &p75); err != nil {
+			return nil, err
+		}
+		st := get(model)
+		if n > st.Samples {
+			st.Samples, st.P25, st.P50, st.P75 = n, round4(p25), round4(p50), round4(p75)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]GPUModelStats, 0, len(byModel))
+	for _, st := range byModel {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Model < out[j].Model })
+	return out, nil
+}
+
+func (s *Store) InsertPreemptionTx(ctx context.Context, tx *sql.Tx, p GPUPreemption) error {
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO gpu_preemptions(node_id, local_username, username, pid, gpu_ids, command, reason, queue_item_id, reservation_id, beneficiary, created_at)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+		p.NodeID, p.LocalUsername, p.Username, p.PID, pq.Array(p.GPUIDs), truncateRunes(p.Command, 256), p.Reason,
+		p.QueueItemID, p.ReservationID, p.Beneficiary, p.CreatedAt)
+	return err
+}
+
+// RecentPreemptedPIDsTx 返回节点上 since 之后已下发抢占的 PID，避免进程退出前重复抢占与重复记录。
+func (s *Store) RecentPreemptedPIDsTx(ctx context.Context, tx *sql.Tx, nodeID string, since time.Time) (map[int32]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT pid FROM gpu_preemptions WHERE node_id=$1 AND created_at >= $2`, nodeID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int32]bool)
+	for rows.Next() {
+		var pid int32
+		if err := rows.Scan(&pid); err != nil {
+			return nil, err
+		}
+		out[pid] = true
+	}
+	return out, rows.Err()
+}
+
+// ListPreemptions 按计费账号 / 节点 / 时间段查询抢占记录，最新的在前；username、nodeID 为空表示不过滤。
+func (s *Store) ListPreemptions(ctx context.Context, username string, nodeID string, from time.Time, to time.Time, limit int) ([]GPUPreemption, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, node_id, local_username, username, pid, gpu_ids, command, reason, queue_item_id, reservation_id, beneficiary, created_at
+FROM gpu_preemptions
+WHERE ($1='' OR username=$1) AND ($2='' OR node_id=$2) AND created_at >= $3 AND created_at < $4
+ORDER BY created_at DESC, id DESC
+LIMIT $5`, strings.TrimSpace(username), strings.TrimSpace(nodeID), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GPUPreemption, 0)
+	for rows.Next() {
+		var p GPUPreemption
+		if err := rows.Scan(&p.ID, &p.NodeID, &p.LocalUsername, &p.Username, &p.PID, pq.Array(&p.GPUIDs), &p.Command, &p.Reason,
+			&p.QueueItemID, &p.ReservationID, &p.Beneficiary, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		if p.GPUIDs == nil {
+			p.GPUIDs = []int64{}
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+const maintenanceColumns = `id, node_id, reason, drain_at, start_at, end_at, kick_ssh, notified_at, kicked_at, ended_at, created_by, created_at`
+
+func scanMaintenance(sc interface{ Scan(dest ...any) error }, now time.Time) (NodeMaintenance, error) {
+	var m NodeMaintenance
+	var endAt, notifiedAt, kickedAt, endedAt sql.NullTime
+	if err := sc.Scan(&m.ID, &m.NodeID, &m.Reason, &m.DrainAt, &m.StartAt, &endAt, &m.KickSSH, &notifiedAt, &kickedAt, &endedAt,
+		&m.CreatedBy, &m.CreatedAt); err != nil {
+		return NodeMaintenance{}, err
+	}
+	for _, x := range []struct {
+		v   sql.NullTime
+		dst **time.Time
+	}{{endAt, &m.EndAt}, {notifiedAt, &m.NotifiedAt}, {kickedAt, &m.KickedAt}, {endedAt, &m.EndedAt}} {
+		if x.v.Valid {
+			t := x.v.Time
+			*x.dst = &t
+		}
+	}
+	m.State = MaintenanceState(m, now)
+	return m, nil
+}
+
+func queryMaintenance(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, now time.Time, query string, args ...any) ([]NodeMaintenance, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]NodeMaintenance, 0)
+	for rows.Next() {
+		m, err := scanMaintenance(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// CreateMaintenance 登记维护窗口；同一节点尚未结束的窗口不能重叠。
+func (s *Store) CreateMaintenance(ctx context.Context, m NodeMaintenance, now time.Time) (NodeMaintenance, error) {
+	m.NodeID = strings.TrimSpace(m.NodeID)
+	m.Reason = truncateRunes(strings.TrimSpace(m.Reason), 500)
+	if m.NodeID == "" {
+		return m, errors.New("node_id 不能为空")
+	}
+	if m.StartAt.Before(m.DrainAt) {
+		return m, errors.New("start_at 不能早于 drain_at")
+	}
+	if m.EndAt != nil && !m.EndAt.After(m.StartAt) {
+		return m, errors.New("end_at 必须晚于 start_at")
+	}
+	var out NodeMaintenance
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		existing, err := s.ListOpenMaintenanceTx(ctx, tx, m.NodeID, now)
+		if err != nil {
+			return err
+		}
+		end := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+		if m.EndAt != nil {
+			end = *m.EndAt
+		}
+		for _, e := range existing {
+			if maintenanceOverlaps(e, m.DrainAt, end) {
+				return fmt.Errorf("与节点 %s 已有的维护 #%d 时间重叠", m.NodeID, e.ID)
+			}
+		}
+		out, err = scanMaintenance(tx.QueryRowContext(ctx, `
+INSERT INTO node_maintenance(node_id, reason, drain_at, start_at, end_at, kick_ssh, created_by)
+VALUES($1,$2,$3,$4,$5,$6,$7)
+RETURNING `+maintenanceColumns, m.NodeID, m.Reason, m.DrainAt, m.StartAt, m.EndAt, m.KickSSH, m.CreatedBy), now)
+		return err
+	})
+	return out, err
+}
+
+// EndMaintenance 结束（或取消尚未开始的）维护窗口。
+func (s *Store) EndMaintenance(ctx context.Context, id int64, now time.Time) (NodeMaintenance, error) {
+	return scanMaintenance(s.db.QueryRowContext(ctx, `
+UPDATE node_maintenance SET ended_at=$2
+WHERE id=$1 AND ended_at IS NULL AND (end_at IS NULL OR end_at > $2)
+RETURNING `+maintenanceColumns, id, now), now)
+}
+
+// ListMaintenance 返回维护窗口（新的在前）；includeEnded 为 false 时只返回未结束的。
+func (s *Store) ListMaintenance(ctx context.Context, nodeID string, includeEnded bool, now time.Time, limit int) ([]NodeMaintenance, error) {
+	return queryMaintenance(ctx, s.db, now, `
+SELECT `+maintenanceColumns+`
+FROM node_maintenance
+WHERE ($1='' OR node_id=$1) AND ($2 OR (ended_at IS NULL AND (end_at IS NULL OR end_at > $3)))
+ORDER BY drain_at DESC, id DESC
+LIMIT $4`, strings.TrimSpace(nodeID), includeEnded, now, limit)
+}
+
+// ListOpenMaintenanceTx 返回节点上未结束的维护窗口（含尚未开始排空的），按排空时间排序。
+func (s *Store) ListOpenMaintenanceTx(ctx context.Context, tx *sql.Tx, nodeID string, now time.Time) ([]NodeMaintenance, error) {
+	return queryMaintenance(ctx, tx, now, `
+SELECT `+maintenanceColumns+`
+FROM node_maintenance
+WHERE node_id=$1 AND ended_at IS NULL AND (end_at IS NULL OR end_at > $2)
+ORDER BY drain_at, id
+FOR UPDATE`, nodeID, now)
+}
+
+// GetBlockingMaintenance 返回节点当前生效（排空中或维护中）的维护窗口；没有时返回 nil。
+func (s *Store) GetBlockingMaintenance(ctx context.Context, nodeID string, now time.Time) (*NodeMaintenance, error) {
+	rows, err := queryMaintenance(ctx, s.db, now, `
+SELECT `+maintenanceColumns+`
+FROM node_maintenance
+WHERE node_id=$1 AND ended_at IS NULL AND drain_at <= $2 AND (end_at IS NULL OR end_at > $2)
+ORDER BY drain_at
+LIMIT 1`, strings.TrimSpace(nodeID), now)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+func (s *Store) MarkMaintenanceNotifiedTx(ctx context.Context, tx *sql.Tx, id int64, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE node_maintenance SET notified_at=$2 WHERE id=$1`, id, now)
+	return err
+}
+
+func (s *Store) MarkMaintenanceKickedTx(ctx context.Context, tx *sql.Tx, id int64, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE node_maintenance SET kicked_at=$2 WHERE id=$1`, id, now)
+	return err
+}
+
+// checkMaintenanceFreeTx 拒绝与节点维护窗口（自排空起）重叠的预约。
+func (s *Store) checkMaintenanceFreeTx(ctx context.Context, tx *sql.Tx, nodeID string, start time.Time, end time.Time, now time.Time) error {
+	windows, err := s.ListOpenMaintenanceTx(ctx, tx, nodeID, now)
+	if err != nil {
+		return err
+	}
+	for _, m := range windows {
+		if maintenanceOverlaps(m, start, end) {
+			return fmt.Errorf("节点 %s 在 %s 起维护（#%d），该时段不可预约", nodeID, m.DrainAt.Format("01-02 15:04"), m.ID)
+		}
+	}
+	return nil
+}
+
+// DetectOfflineNodes 把连续 missed 个上报周期未上报的节点标记为离线并写入上下线记录，返回本次新判定离线的节点。
+func (s *Store) DetectOfflineNodes(ctx context.Context, now time.Time, missed int) ([]NodeStatusEvent, error) {
+	if missed <= 0 {
+		missed = defaultNodeMissedIntervals
+	}
+	var out []NodeStatusEvent
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		out = nil
+		// 只锁定已超时的节点；正在上报（持有行锁）的节点跳过，留给下一轮检测
+		rows, err := tx.QueryContext(ctx, `
+SELECT node_id, last_seen_at, interval_seconds
+FROM nodes
+WHERE offline_since IS NULL
+  AND last_seen_at + make_interval(secs => $2 * CASE WHEN interval_seconds > 0 THEN interval_seconds ELSE 60 END) < $1
+FOR UPDATE SKIP LOCKED`, now, missed)
+		if err != nil {
+			return err
+		}
+		var candidates []NodeStatusEvent
+		for rows.Next() {
+			var ev NodeStatusEvent
+			var interval int
+			if err := rows.Scan(&ev.NodeID, &ev.LastSeenAt, &interval); err != nil {
+				rows.Close()
+				return err
+			}
+			if NodeOffline(ev.LastSeenAt, interval, missed, now) {
+				candidates = append(candidates, ev)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, ev := range candidates {
+			windows, err := s.ListOpenMaintenanceTx(ctx, tx, ev.NodeID, now)
+			if err != nil {
+				return err
+			}
+			for _, m := range windows {
+				if maintenanceBlocks(m, now) {
+					ev.InMaintenance = true
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE nodes SET offline_since=$2 WHERE node_id=$1`, ev.NodeID, ev.LastSeenAt); err != nil {
+				return err
+			}
+			ev.Status = "offline"
+			if err := tx.QueryRowContext(ctx, `
+INSERT INTO node_status_events(node_id, status, last_seen_at, offline_seconds, in_maintenance, created_at)
+VALUES($1,'offline',$2,0,$3,$4)
+RETURNING id, created_at`, ev.NodeID, ev.LastSeenAt, ev.InMaintenance, now).Scan(&ev.ID, &ev.CreatedAt); err != nil {
+				return err
+			}
+			out = append(out, ev)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// MarkNodeOnlineTx 在离线节点恢复上报时清除离线标记并写入上线记录；节点原本在线时返回 nil。
+func (s *Store) MarkNodeOnlineTx(ctx context.Context, tx *sql.Tx, nodeID string, now time.Time, inMaintenance bool) (*NodeStatusEvent, error) {
+	var offlineSince time.Time
+	err := tx.QueryRowContext(ctx, `
+UPDATE nodes n SET offline_since=NULL
+FROM (SELECT node_id, offline_since FROM nodes WHERE node_id=$1 FOR UPDATE) prev
+WHERE n.node_id=prev.node_id AND prev.offline_since IS NOT NULL
+RETURNING prev.offline_since`, strings.TrimSpace(nodeID)).Scan(&offlineSince)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ev := NodeStatusEvent{NodeID: strings.TrimSpace(nodeID), Status: "online", LastSeenAt: now, InMaintenance: inMaintenance}
+	if d := now.Sub(offlineSince); d > 0 {
+		ev.OfflineSeconds = int64(d.Seconds())
+	}
+	if err := tx.QueryRowContext(ctx, `
+INSERT INTO node_status_events(node_id, status, last_seen_at, offline_seconds, in_maintenance, created_at)
+VALUES($1,'online',$2,$3,$4,$2)
+RETURNING id, created_at`, ev.NodeID, now, ev.OfflineSeconds, inMaintenance).Scan(&ev.ID, &ev.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func (s *Store) ListNodeStatusEvents(ctx context.Context, nodeID string, from time.Time, to time.Time, limit int) ([]NodeStatusEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, node_id, status, last_seen_at, offline_seconds, in_maintenance, created_at
+FROM node_status_events
+WHERE ($1='' OR node_id=$1) AND created_at >= $2 AND created_at < $3
+ORDER BY created_at DESC, id DESC
+LIMIT $4`, strings.TrimSpace(nodeID), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]NodeStatusEvent, 0)
+	for rows.Next() {
+		var ev NodeStatusEvent
+		if err := rows.Scan(&ev.ID, &ev.NodeID, &ev.Status, &ev.LastSeenAt, &ev.OfflineSeconds, &ev.InMaintenance, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+func decodeNodeHealth(b []byte) *NodeHealth {
+	if len(b) == 0 {
+		return nil
+	}
+	var h NodeHealth
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil
+	}
+	return &h
+}
+
+const gpuHealthColumns = `id, node_id, gpu_index, bus_id, kind, severity, detail, first_seen_at, last_seen_at, resolved_at, resolved_by`
+
+func scanGPUHealthIssue(sc interface{ Scan(dest ...any) error }) (GPUHealthIssue, error) {
+	var it GPUHealthIssue
+	var resolvedAt sql.NullTime
+	if err := sc.Scan(&it.ID, &it.NodeID, &it.GPUIndex, &it.BusID, &it.Kind, &it.Severity, &it.Detail,
+		&it.FirstSeenAt, &it.LastSeenAt, &resolvedAt, &it.ResolvedBy); err != nil {
+		return GPUHealthIssue{}, err
+	}
+	if resolvedAt.Valid {
+		t := resolvedAt.Time
+		it.ResolvedAt = &t
+	}
+	return it, nil
+}
+
+func queryGPUHealthIssues(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, query string, args ...any) ([]GPUHealthIssue, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GPUHealthIssue, 0)
+	for rows.Next() {
+		it, err := scanGPUHealthIssue(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+// SyncGPUHealthTx 保存节点最近一次健康信号，并按本次判定结果更新健康问题：新问题插入、已有问题刷新，
+// 不再出现的可自动解除问题标记为 auto 解除。返回本次新发现的问题（用于告警）。
+func (s *Store) SyncGPUHealthTx(ctx context.Context, tx *sql.Tx, nodeID string, health *NodeHealth, observed []GPUHealthIssue, now time.Time) ([]GPUHealthIssue, error) {
+	raw, err := json.Marshal(health)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE nodes SET health=$2 WHERE node_id=$1`, nodeID, raw); err != nil {
+		return nil, err
+	}
+	open, err := queryGPUHealthIssues(ctx, tx, `
+SELECT `+gpuHealthColumns+`
+FROM gpu_health_issues
+WHERE node_id=$1 AND resolved_at IS NULL
+FOR UPDATE`, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		gpu  int
+		kind string
+	}
+	existing := make(map[key]GPUHealthIssue, len(open))
+	for _, it := range open {
+		existing[key{it.GPUIndex, it.Kind}] = it
+	}
+	seen := make(map[key]bool, len(observed))
+	var created []GPUHealthIssue
+	for _, it := range observed {
+		k := key{it.GPUIndex, it.Kind}
+		seen[k] = true
+		if cur, ok := existing[k]; ok {
+			if cur.Severity == "critical" {
+				it.Severity = "critical"
+			}
+			if _, err := tx.ExecContext(ctx, `
+UPDATE gpu_health_issues SET last_seen_at=$2, severity=$3, detail=$4, bus_id=$5 WHERE id=$1`,
+				cur.ID, now, it.Severity, truncateRunes(it.Detail, 500), it.BusID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		row, err := scanGPUHealthIssue(tx.QueryRowContext(ctx, `
+INSERT INTO gpu_health_issues(node_id, gpu_index, bus_id, kind, severity, detail, first_seen_at, last_seen_at)
+VALUES($1,$2,$3,$4,$5,$6,$7,$7)
+RETURNING `+gpuHealthColumns,
+			nodeID, it.GPUIndex, it.BusID, it.Kind, it.Severity, truncateRunes(it.Detail, 500), now))
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, row)
+	}
+	for k, it := range existing {
+		if seen[k] || !autoResolves(it.Kind) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE gpu_health_issues SET resolved_at=$2, resolved_by='auto' WHERE id=$1`, it.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// OpenGPUHealthIssuesTx 返回节点未解除的健康问题（预约与抢占据此排除异常卡）。
+func (s *Store) OpenGPUHealthIssuesTx(ctx context.Context, tx *sql.Tx, nodeID string) ([]GPUHealthIssue, error) {
+	return queryGPUHealthIssues(ctx, tx, `
+SELECT `+gpuHealthColumns+`
+FROM gpu_health_issues
+WHERE node_id=$1 AND resolved_at IS NULL
+ORDER BY gpu_index, kind`, nodeID)
+}
+
+func (s *Store) ListGPUHealthIssues(ctx context.Context, nodeID string, includeResolved bool, limit int) ([]GPUHealthIssue, error) {
+	return queryGPUHealthIssues(ctx, s.db, `
+SELECT `+gpuHealthColumns+`
+FROM gpu_health_issues
+WHERE ($1='' OR node_id=$1) AND ($2 OR resolved_at IS NULL)
+ORDER BY (resolved_at IS NULL) DESC, last_seen_at DESC, id DESC
+LIMIT $3`, strings.TrimSpace(nodeID), includeResolved, limit)
+}
+
+// ResolveGPUHealthIssue 由管理员确认解除问题（Xid 只能这样解除）；问题仍存在时会在下次上报重新出现。
+func (s *Store) ResolveGPUHealthIssue(ctx context.Context, id int64, operator string, now time.Time) (GPUHealthIssue, error) {
+	return scanGPUHealthIssue(s.db.QueryRowContext(ctx, `
+UPDATE gpu_health_issues SET resolved_at=$2, resolved_by=$3
+WHERE id=$1 AND resolved_at IS NULL
+RETURNING `+gpuHealthColumns, id, now, truncateRunes(strings.TrimSpace(operator), 50)))
+}
+
+// UpdateNodeInventoryTx 保存节点软硬件清单，字段变化写入 node_inventory_changes；返回本次的变化。
+func (s *Store) UpdateNodeInventoryTx(ctx context.Context, tx *sql.Tx, nodeID string, inv NodeInventory, now time.Time) ([]NodeInventoryChange, error) {
+	inv.DriverVersion = truncateRunes(strings.TrimSpace(inv.DriverVersion), 50)
+	inv.CUDAVersion = truncateRunes(strings.TrimSpace(inv.CUDAVersion), 50)
+	inv.KernelVersion = truncateRunes(strings.TrimSpace(inv.KernelVersion), 100)
+	inv.OSRelease = truncateRunes(strings.TrimSpace(inv.OSRelease), 100)
+	var prev NodeInventory
+	if err := tx.QueryRowContext(ctx, `
+SELECT driver_version, cuda_version, kernel_version, os_release, memory_total_mb, disk_total_gb
+FROM nodes WHERE node_id=$1 FOR UPDATE`, nodeID).Scan(
+		&prev.DriverVersion, &prev.CUDAVersion, &prev.KernelVersion, &prev.OSRelease, &prev.MemoryTotalMB, &prev.DiskTotalGB); err != nil {
+		return nil, err
+	}
+	changes := DiffInventory(prev, inv)
+	for i := range changes {
+		changes[i].NodeID, changes[i].ChangedAt = nodeID, now
+		if err := tx.QueryRowContext(ctx, `
+INSERT INTO node_inventory_changes(node_id, field, old_value, new_value, changed_at)
+VALUES($1,$2,$3,$4,$5)
+RETURNING id`, nodeID, changes[i].Field, changes[i].OldValue, changes[i].NewValue, now).Scan(&changes[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	// 本次没取到的字段保留原值（例如 nvidia-smi 暂时失败）
+	_, err := tx.ExecContext(ctx, `
+UPDATE nodes SET
+  driver_version=COALESCE(NULLIF($2,''), driver_version),
+  cuda_version=COALESCE(NULLIF($3,''), cuda_version),
+  kernel_version=COALESCE(NULLIF($4,''), kernel_version),
+  os_release=COALESCE(NULLIF($5,''), os_release),
+  memory_total_mb=COALESCE(NULLIF($6::BIGINT,0), memory_total_mb),
+  disk_total_gb=COALESCE(NULLIF($7::DOUBLE PRECISION,0), disk_total_gb),
+  inventory_updated_at=$8
+WHERE node_id=$1`, nodeID, inv.DriverVersion, inv.CUDAVersion, inv.KernelVersion, inv.OSRelease, inv.MemoryTotalMB, inv.DiskTotalGB, now)
+	return changes, err
+}
+
+func (s *Store) ListNodeInventory(ctx context.Context) ([]NodeInventoryStatus, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT node_id, gpu_model, last_seen_at, offline_since,
+       driver_version, cuda_version, kernel_version, os_release, memory_total_mb, disk_total_gb, inventory_updated_at
+FROM nodes
+ORDER BY node_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]NodeInventoryStatus, 0)
+	for rows.Next() {
+		var n NodeInventoryStatus
+		var offlineSince, updatedAt sql.NullTime
+		if err := rows.Scan(&n.NodeID, &n.GPUModel, &n.LastSeenAt, &offlineSince,
+			&n.DriverVersion, &n.CUDAVersion, &n.KernelVersion, &n.OSRelease, &n.MemoryTotalMB, &n.DiskTotalGB, &updatedAt); err != nil {
+			return nil, err
+		}
+		if offlineSince.Valid {
+			t := offlineSince.Time
+			n.OfflineSince = &t
+		}
+		if updatedAt.Valid {
+			t := updatedAt.Time
+			n.InventoryUpdatedAt = &t
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListNodeInventoryChanges(ctx context.Context, nodeID string, field string, from time.Time, to time.Time, limit int) ([]NodeInventoryChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, node_id, field, old_value, new_value, changed_at
+FROM node_inventory_changes
+WHERE ($1='' OR node_id=$1) AND ($2='' OR field=$2) AND changed_at >= $3 AND changed_at < $4
+ORDER BY changed_at DESC, id DESC
+LIMIT $5`, strings.TrimSpace(nodeID), strings.TrimSpace(field), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]NodeInventoryChange, 0)
+	for rows.Next() {
+		var ch NodeInventoryChange
+		if err := rows.Scan(&ch.ID, &ch.NodeID, &ch.Field, &ch.OldValue, &ch.NewValue, &ch.ChangedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	return out, rows.Err()
+}
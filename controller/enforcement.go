@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (l ResourceLimits) Validate(name string) error {
+	if l.MemoryHighMB < 0 || l.MemoryMaxMB < 0 || l.TasksMax < 0 {
+		return fmt.Errorf("%s 不能为负数", name)
+	}
+	if l.MemoryHighMB > 0 && l.MemoryMaxMB > 0 && l.MemoryHighMB > l.MemoryMaxMB {
+		return fmt.Errorf("%s.memory_high_mb 不能大于 memory_max_mb", name)
+	}
+	// 进程数过低会导致用户无法登录或执行简单命令
+	if l.TasksMax > 0 && l.TasksMax < 32 {
+		return fmt.Errorf("%s.tasks_max 至少为 32（0 表示不限制）", name)
+	}
+	return nil
+}
+
+// DecideResourceLimitActions 与 CPU 限流一致：受限期间每次上报都下发当前状态的限制（幂等，可修复被重置的 slice），
+// 从 limited/blocked 恢复时下发 0 解除限制。
+func DecideResourceLimitActions(username, status, prevStatus string, limited, blocked ResourceLimits) []Action {
+	var l ResourceLimits
+	var reason string
+	switch {
+	case status == "limited":
+		l, reason = limited, "余额不足，限制内存与进程数"
+	case status == "blocked":
+		l, reason = blocked, "已欠费，强限制内存与进程数"
+	case prevStatus == "limited" || prevStatus == "blocked":
+		reason = "余额已恢复，解除内存与进程数限制"
+	default:
+		return nil
+	}
+	return []Action{
+		{Type: "set_memory_limit", Username: username, MemoryHighMB: l.MemoryHighMB, MemoryMaxMB: l.MemoryMaxMB, Reason: reason},
+		{Type: "set_tasks_limit", Username: username, TasksMax: l.TasksMax, Reason: reason},
+	}
+}
+
+// DesiredEnforcement 计算本地账号在当前余额状态下应有的限制（与 DecideActions / CPU / 资源限制的下发口径一致）。
+func DesiredEnforcement(localUsername, billingUsername, status string, policy BillingPolicy, cfg Config) NodeEnforcement {
+	e := NodeEnforcement{LocalUsername: localUsername, BillingUsername: billingUsername, Status: status}
+	var limits ResourceLimits
+	switch status {
+	case "limited":
+		e.GPUBlocked = true
+		e.Reason = "余额不足，限制新 GPU 任务"
+		if cfg.EnableCPUControl {
+			e.CPUQuotaPercent = policy.CPULimitPercentLimited
+		}
+		limits = cfg.ResourceLimitsLimited
+	case "blocked":
+		e.GPUBlocked = true
+		e.Reason = "已欠费，限制 GPU 任务"
+		if cfg.EnableCPUControl {
+			e.CPUQuotaPercent = policy.CPULimitPercentBlocked
+		}
+		limits = cfg.ResourceLimitsBlocked
+	default:
+		return e
+	}
+	if cfg.EnableResourceLimits {
+		e.MemoryHighMB, e.MemoryMaxMB, e.TasksMax = limits.MemoryHighMB, limits.MemoryMaxMB, limits.TasksMax
+	}
+	return e
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 期望限制状态：DecideActions 只在状态变化时下发动作，节点重启或 slice 被重置后限制会悄悄消失。
+// Agent 周期性上送本机账号列表，控制器返回其中应受限账号的期望状态，Agent 校正实际状态并回报偏差。
+
+type nodeEnforcementReq struct {
+	NodeID         string   `json:"node_id"`
+	LocalUsernames []string `json:"local_usernames"`
+}
+
+func (s *Server) handleNodeEnforcement(c *gin.Context) {
+	var req nodeEnforcementReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.LocalUsernames) > 20000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "local_usernames 过多（最大 20000）"})
+		return
+	}
+	users, err := s.store.ListNodeEnforcement(c.Request.Context(), req.NodeID, req.LocalUsernames, s.cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"generated_at": time.Now(), "users": users})
+}
+
+type nodeEnforcementDriftReq struct {
+	NodeID string             `json:"node_id"`
+	Items  []EnforcementDrift `json:"items"`
+}
+
+func (s *Server) handleNodeEnforcementDrift(c *gin.Context) {
+	var req nodeEnforcementDriftReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Items) > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items 过多（最大 1000）"})
+		return
+	}
+	n, err := s.store.InsertEnforcementDrift(c.Request.Context(), req.NodeID, req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.metr.enforcementDriftTotal.Add(int64(n))
+	c.JSON(http.StatusOK, gin.H{"ok": true, "count": n})
+}
+
+func (s *Server) handleAdminEnforcementDrift(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 200, 5000)
+	rows, err := s.store.ListEnforcementDrift(c.Request.Context(), c.Query("node_id"), c.Query("username"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drift": rows})
+}
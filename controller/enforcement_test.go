@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecideResourceLimitActions(t *testing.T) {
+	limited := ResourceLimits{MemoryHighMB: 4096, MemoryMaxMB: 8192, TasksMax: 1024}
+	blocked := ResourceLimits{MemoryMaxMB: 1024, TasksMax: 128}
+
+	acts := DecideResourceLimitActions("alice", "blocked", "limited", limited, blocked)
+	if len(acts) != 2 || acts[0].Type != "set_memory_limit" || acts[0].MemoryMaxMB != 1024 || acts[0].MemoryHighMB != 0 || acts[1].TasksMax != 128 {
+		t.Fatalf("blocked actions=%+v", acts)
+	}
+	acts = DecideResourceLimitActions("alice", "normal", "blocked", limited, blocked)
+	if len(acts) != 2 || acts[0].MemoryMaxMB != 0 || acts[1].Type != "set_tasks_limit" || acts[1].TasksMax != 0 {
+		t.Fatalf("recover actions=%+v", acts)
+	}
+	if acts := DecideResourceLimitActions("alice", "warning", "normal", limited, blocked); len(acts) != 0 {
+		t.Fatalf("unexpected actions=%+v", acts)
+	}
+
+	if err := (ResourceLimits{MemoryHighMB: 2048, MemoryMaxMB: 1024}).Validate("x"); err == nil {
+		t.Fatalf("memory_high > memory_max should be rejected")
+	}
+	if err := (ResourceLimits{TasksMax: 8}).Validate("x"); err == nil {
+		t.Fatalf("tiny tasks_max should be rejected")
+	}
+}
+
+func TestDesiredEnforcement(t *testing.T) {
+	cfg := Config{
+		EnableCPUControl:      true,
+		EnableResourceLimits:  true,
+		ResourceLimitsBlocked: ResourceLimits{MemoryMaxMB: 4096, TasksMax: 256},
+	}
+	policy := BillingPolicy{CPULimitPercentLimited: 50, CPULimitPercentBlocked: 5}
+
+	e := DesiredEnforcement("alice_l", "alice", "blocked", policy, cfg)
+	if !e.GPUBlocked || e.CPUQuotaPercent != 5 || e.MemoryMaxMB != 4096 || e.TasksMax != 256 {
+		t.Fatalf("blocked enforcement=%+v", e)
+	}
+	cfg.EnableCPUControl = false
+	if e := DesiredEnforcement("alice_l", "alice", "limited", policy, cfg); !e.GPUBlocked || e.CPUQuotaPercent != 0 || e.MemoryMaxMB != 0 {
+		t.Fatalf("limited enforcement=%+v", e)
+	}
+	if e := DesiredEnforcement("alice_l", "alice", "warning", policy, cfg); e.GPUBlocked || e.TasksMax != 0 {
+		t.Fatalf("warning enforcement=%+v", e)
+	}
+}
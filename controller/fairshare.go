@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultFairShareHalfLifeHours = 168
+	defaultFairShareCacheSeconds  = 60
+)
+
+func (c FairShareConfig) Validate() error {
+	if c.HalfLifeHours < 0 {
+		return errors.New("fair_share.half_life_hours 不能为负数")
+	}
+	if c.WindowDays < 0 || c.WindowDays > 366 {
+		return errors.New("fair_share.window_days 必须在 [0, 366] 范围内")
+	}
+	if c.DefaultShare < 0 {
+		return errors.New("fair_share.default_share 不能为负数")
+	}
+	for name, v := range c.GroupShares {
+		if v <= 0 {
+			return fmt.Errorf("fair_share.group_shares[%s] 必须大于 0", name)
+		}
+	}
+	if c.CacheSeconds < 0 {
+		return errors.New("fair_share.cache_seconds 不能为负数")
+	}
+	return nil
+}
+
+func (c FairShareConfig) halfLife() time.Duration {
+	if c.HalfLifeHours > 0 {
+		return time.Duration(c.HalfLifeHours * float64(time.Hour))
+	}
+	return defaultFairShareHalfLifeHours * time.Hour
+}
+
+// window 为统计用量的时间范围，默认 4 个半衰期（更早的用量权重已不足 1/16）。
+func (c FairShareConfig) window() time.Duration {
+	if c.WindowDays > 0 {
+		return time.Duration(c.WindowDays) * 24 * time.Hour
+	}
+	return 4 * c.halfLife()
+}
+
+func (c FairShareConfig) defaultShare() float64 {
+	if c.DefaultShare > 0 {
+		return c.DefaultShare
+	}
+	return 1
+}
+
+func (c FairShareConfig) cacheTTL() time.Duration {
+	if c.CacheSeconds > 0 {
+		return time.Duration(c.CacheSeconds) * time.Second
+	}
+	return defaultFairShareCacheSeconds * time.Second
+}
+
+// ComputeFairShare 计算 users 中每个账号的公平份额分数（经典 fair-share：score = 2^(-用量占比/份额占比)）。
+// usage 为各账号衰减后的 GPU 卡分钟；groupOf / groupSize 为账号所属课题组与课题组人数。
+// 份额占比只在 users 与有用量的账号之间归一化；总用量为 0 时所有账号分数均为 1。
+func ComputeFairShare(users []string, usage map[string]float64, groupOf map[string]string, groupSize map[string]int, cfg FairShareConfig) map[string]FairShareEntry {
+	accounts := make(map[string]bool, len(users)+len(usage))
+	for _, u := range users {
+		accounts[u] = true
+	}
+	for u, v := range usage {
+		if v > 0 {
+			accounts[u] = true
+		}
+	}
+	out := make(map[string]FairShareEntry, len(accounts))
+	var totalUsage, totalShare float64
+	for u := range accounts {
+		share := cfg.defaultShare()
+		group := groupOf[u]
+		if group != "" {
+			if v, ok := cfg.GroupShares[group]; ok {
+				share = v
+			}
+			if n := groupSize[group]; n > 1 {
+				share /= float64(n)
+			}
+		}
+		e := FairShareEntry{Username: u, GroupName: group, UsageGPUMinutes: math.Max(usage[u], 0), Share: share}
+		totalUsage += e.UsageGPUMinutes
+		totalShare += share
+		out[u] = e
+	}
+	for u, e := range out {
+		if totalShare > 0 {
+			e.Share = e.Share / totalShare
+		}
+		e.Score = 1
+		if totalUsage > 0 && e.Share > 0 {
+			e.Score = math.Pow(2, -(e.UsageGPUMinutes/totalUsage)/e.Share)
+		}
+		e.UsageGPUMinutes = round4(e.UsageGPUMinutes)
+		e.Share = round4(e.Share)
+		e.Score = round4(e.Score)
+		out[u] = e
+	}
+	return out
+}
+
+// RankQueue 排序排队项：可抢占请求排在所有普通请求之后；同类中按公平份额分数从高到低、同分按排队时间先后。
+// scores 为空时同类内保持原有顺序（先来后到）。
+func RankQueue(items []QueueItem, scores map[string]FairShareEntry) []QueueItem {
+	out := make([]QueueItem, len(items))
+	copy(out, items)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Preemptible != out[j].Preemptible {
+			return !out[i].Preemptible
+		}
+		if len(scores) == 0 {
+			return false
+		}
+		si, sj := scores[out[i].Username].Score, scores[out[j].Username].Score
+		if si != sj {
+			return si > sj
+		}
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeFairShare(t *testing.T) {
+	cfg := FairShareConfig{Enabled: true, GroupShares: map[string]float64{"vision": 2}}
+	usage := map[string]float64{"heavy": 900, "light": 100}
+	scores := ComputeFairShare([]string{"heavy", "light", "idle"}, usage, nil, nil, cfg)
+	if !(scores["idle"].Score == 1 && scores["light"].Score > scores["heavy"].Score) {
+		t.Fatalf("scores=%+v", scores)
+	}
+	// 课题组份额翻倍后，同样用量的组员分数更高
+	groups := map[string]string{"a": "vision"}
+	scores = ComputeFairShare(nil, map[string]float64{"a": 100, "b": 100}, groups, map[string]int{"vision": 1}, cfg)
+	if scores["a"].Score <= scores["b"].Score {
+		t.Fatalf("group share not applied: %+v", scores)
+	}
+	if s := ComputeFairShare([]string{"x"}, nil, nil, nil, cfg); s["x"].Score != 1 {
+		t.Fatalf("zero total usage should score 1: %+v", s)
+	}
+}
+
+func TestRankQueue(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	items := []QueueItem{
+		{ID: 1, Username: "heavy", Timestamp: t0},
+		{ID: 2, Username: "light", Timestamp: t0.Add(time.Minute)},
+		{ID: 3, Username: "heavy", Timestamp: t0.Add(2 * time.Minute)},
+	}
+	scores := map[string]FairShareEntry{"heavy": {Score: 0.2}, "light": {Score: 0.9}}
+	got := RankQueue(items, scores)
+	if got[0].ID != 2 || got[1].ID != 1 || got[2].ID != 3 {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+	if fifo := RankQueue(items, nil); fifo[0].ID != 1 {
+		t.Fatalf("without scores should keep FIFO")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enqueueGPURequest 校验参数并加入排队，匿名接口、登录用户与节点本地 socket 共用。
+// preemptible 为可抢占请求（scavenger 档），排在普通请求之后；verified 为提交者已认证（匿名接口为 false）。
+func (s *Server) enqueueGPURequest(c *gin.Context, username string, gpuType string, count int, preemptible bool, verified bool) {
+	username = strings.TrimSpace(username)
+	gpuType = strings.TrimSpace(gpuType)
+	if username == "" || gpuType == "" || count <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username/gpu_type/count 参数不合法"})
+		return
+	}
+
+	id, pos := s.queue.Enqueue(QueueItem{
+		Username:    username,
+		GPUType:     gpuType,
+		Count:       count,
+		Timestamp:   time.Now(),
+		Preemptible: preemptible,
+		Verified:    verified,
+	})
+	score := 1.0
+	est := defaultWaitEstimate(pos)
+	// 公平份额出错时退回先来后到的位置
+	items, _, _ := s.rankedQueue(c.Request.Context(), username)
+	for _, it := range items {
+		if it.ID == id {
+			pos, score, est = it.Position, it.FairShareScore, it.Estimate
+		}
+	}
+	s.queue.SetPrediction(id, est)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":            "queued",
+		"id":                id,
+		"position":          pos,
+		"fair_share_score":  score,
+		"estimated_minutes": est.ExpectedMinutes,
+		"estimate":          est,
+		"message":           "当前无可用 GPU，已加入排队",
+	})
+}
+
+// rankedQueueItem 为排队项及其按公平份额排序后的位置（即有效优先级，1 最优先）与等待预估。
+type rankedQueueItem struct {
+	QueueItem
+	Position         int          `json:"position"`
+	FairShareScore   float64      `json:"fair_share_score"`
+	EstimatedMinutes int          `json:"estimated_minutes"` // 同 estimate.expected_minutes，兼容旧客户端
+	Estimate         WaitEstimate `json:"estimate"`
+}
+
+// rankedQueue 返回按公平份额排序的排队项及各账号的份额；extraUser 非空时即使未排队也计算其份额。
+// 未开启 fair_share 时按先来后到，分数均为 1；统计出错时同样退回先来后到并返回错误。
+// 等待预估按排在前面的同型号需求计算。
+func (s *Server) rankedQueue(ctx context.Context, extraUser string) ([]rankedQueueItem, map[string]FairShareEntry, error) {
+	snapshot := s.queue.Snapshot()
+	var scores map[string]FairShareEntry
+	var err error
+	if s.cfg.FairShare.Enabled {
+		users := make([]string, 0, len(snapshot)+1)
+		for _, it := range snapshot {
+			users = append(users, it.Username)
+		}
+		if extraUser != "" {
+			users = append(users, extraUser)
+		}
+		scores, err = s.fairShareScores(ctx, users)
+	}
+	return rankQueueItems(snapshot, scores, s.gpuModelStats(ctx)), scores, err
+}
+
+// cachedRankedQueue 只用已缓存的公平份额与型号统计排序，不访问数据库（供上报事务内的抢占使用）；
+// 型号统计尚未缓存时 ok 为 false。缓存由 runQueueStatsRefresher 在后台刷新。
+func (s *Server) cachedRankedQueue() (items []rankedQueueItem, stats []GPUModelStats, ok bool) {
+	s.waitStatsMu.Lock()
+	stats = s.waitStats
+	s.waitStatsMu.Unlock()
+	if stats == nil {
+		return nil, nil, false
+	}
+	snapshot := s.queue.Snapshot()
+	var scores map[string]FairShareEntry
+	if s.cfg.FairShare.Enabled {
+		users := make([]string, 0, len(snapshot))
+		for _, it := range snapshot {
+			users = append(users, it.Username)
+		}
+		s.fairShareMu.Lock()
+		if s.fairShareUsage != nil {
+			scores = s.fairShareFromCacheLocked(users)
+		}
+		s.fairShareMu.Unlock()
+	}
+	return rankQueueItems(snapshot, scores, stats), stats, true
+}
+
+// runQueueStatsRefresher 在开启 scavenger 且有排队时定期刷新公平份额与型号统计缓存，
+// 使上报事务内的抢占判断不必等待 usage_records 的统计查询。
+func (s *Server) runQueueStatsRefresher(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.cfg.Scavenger.Enabled || s.queue.Len() == 0 {
+			continue
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		if _, _, err := s.rankedQueue(refreshCtx, ""); err != nil {
+			log.Printf("排队统计刷新失败：%v", err)
+		}
+		cancel()
+	}
+}
+
+// rankQueueItems 按公平份额排序并计算每一项的位置与等待预估。
+func rankQueueItems(snapshot []QueueItem, scores map[string]FairShareEntry, stats []GPUModelStats) []rankedQueueItem {
+	ranked := RankQueue(snapshot, scores)
+	items := make([]rankedQueueItem, 0, len(ranked))
+	demand := make(map[string]int) // 型号 -> 排在前面的申请卡数
+	for i, it := range ranked {
+		score := 1.0
+		if e, ok := scores[it.Username]; ok {
+			score = e.Score
+		}
+		key := normalizeGPUModel(it.GPUType)
+		est := EstimateWait(stats, it.GPUType, demand[key], it.Count, i+1)
+		demand[key] += it.Count
+		items = append(items, rankedQueueItem{QueueItem: it, Position: i + 1, FairShareScore: score, EstimatedMinutes: est.ExpectedMinutes, Estimate: est})
+	}
+	return items
+}
+
+// gpuModelStats 返回缓存的型号统计；刷新失败时沿用上次结果（从未成功时返回 nil，按位置粗估）。
+func (s *Server) gpuModelStats(ctx context.Context) []GPUModelStats {
+	s.waitStatsMu.Lock()
+	defer s.waitStatsMu.Unlock()
+	now := time.Now()
+	if s.waitStats != nil && now.Sub(s.waitStatsAt) < waitStatsCacheSeconds*time.Second {
+		return s.waitStats
+	}
+	interval := s.cfg.SampleIntervalSeconds
+	if interval <= 0 {
+		interval = 60
+	}
+	online := now.Add(-3 * time.Duration(interval) * time.Second)
+	stats, err := s.store.LoadGPUModelStats(ctx, now, online, now.AddDate(0, 0, -waitHistoryDays), s.cfg.JobMergeGap(interval), interval)
+	if err == nil {
+		s.waitStats, s.waitStatsAt = stats, now
+	}
+	return s.waitStats
+}
+
+// fairShareScores 计算 users 的公平份额；用量统计按 cache_seconds 缓存，刷新失败时沿用上次结果。
+func (s *Server) fairShareScores(ctx context.Context, users []string) (map[string]FairShareEntry, error) {
+	cfg := s.cfg.FairShare
+	s.fairShareMu.Lock()
+	defer s.fairShareMu.Unlock()
+	now := time.Now()
+	var refreshErr error
+	if s.fairShareUsage == nil || now.Sub(s.fairShareAt) >= cfg.cacheTTL() {
+		usage, err := s.store.LoadFairShareUsage(ctx, now, now.Add(-cfg.window()), cfg.halfLife(), s.cfg.SampleIntervalSeconds)
+		var groups map[string]string
+		if err == nil {
+			groups, err = s.store.ListResearchGroupMembership(ctx)
+		}
+		if err == nil {
+			s.fairShareUsage, s.fairShareGroups, s.fairShareAt = usage, groups, now
+		}
+		refreshErr = err
+	}
+	if s.fairShareUsage == nil {
+		return nil, refreshErr
+	}
+	return s.fairShareFromCacheLocked(users), nil
+}
+
+// fairShareFromCacheLocked 用缓存的用量计算份额，调用方需持有 fairShareMu 且缓存非空。
+func (s *Server) fairShareFromCacheLocked(users []string) map[string]FairShareEntry {
+	groupSize := make(map[string]int)
+	for _, g := range s.fairShareGroups {
+		groupSize[g]++
+	}
+	return ComputeFairShare(users, s.fairShareUsage, s.fairShareGroups, groupSize, s.cfg.FairShare)
+}
+
+func (s *Server) userQueueItems(ctx context.Context, username string) ([]rankedQueueItem, FairShareEntry) {
+	ranked, scores, _ := s.rankedQueue(ctx, username)
+	items := make([]rankedQueueItem, 0)
+	for _, it := range ranked {
+		if it.Username == username {
+			items = append(items, it)
+		}
+	}
+	entry, ok := scores[username]
+	if !ok {
+		entry = FairShareEntry{Username: username, Score: 1}
+	}
+	return items, entry
+}
+
+// cancelGPURequest 取消排队项；username 为空时不校验归属。
+func (s *Server) cancelGPURequest(c *gin.Context, username string) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 不合法"})
+		return
+	}
+	if !s.queue.Cancel(id, username) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+type userGPURequestReq struct {
+	GPUType     string `json:"gpu_type"`
+	Count       int    `json:"count"`
+	Preemptible bool   `json:"preemptible"`
+}
+
+func (s *Server) handleUserGPURequest(c *gin.Context) {
+	var req userGPURequestReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	s.enqueueGPURequest(c, username, req.GPUType, req.Count, req.Preemptible, true)
+}
+
+func (s *Server) handleUserGPUQueue(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	items, entry := s.userQueueItems(c.Request.Context(), username)
+	c.JSON(http.StatusOK, gin.H{"username": username, "queue_length": s.queue.Len(), "items": items, "fair_share": entry})
+}
+
+func (s *Server) handleUserGPUCancel(c *gin.Context) {
+	s.cancelGPURequest(c, strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user"))))
+}
+
+func (s *Server) handleAdminGPUCancel(c *gin.Context) {
+	s.cancelGPURequest(c, "")
+}
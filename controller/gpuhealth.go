@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultRetiredPagesLimit = 60
+
+// criticalXids 为指示硬件故障、需要停用该卡的 Xid：48 DBE、61/62 内部微控制器错误、63/64 页退役 / 行重映射、
+// 74 NVLink、79 掉卡、92/94/95 ECC、119/120 GSP。
+var criticalXids = map[int]bool{48: true, 61: true, 62: true, 63: true, 64: true, 74: true, 79: true, 92: true, 94: true, 95: true, 119: true, 120: true}
+
+// applicationXids 一般由用户程序触发（非法访存、超时等），不代表硬件异常，默认忽略。
+var applicationXids = map[int]bool{13: true, 31: true, 43: true, 45: true}
+
+func (c GPUHealthConfig) Validate() error {
+	if c.RetiredPagesLimit < 0 {
+		return errors.New("gpu_health.retired_pages_limit 不能为负数")
+	}
+	for _, x := range c.IgnoreXids {
+		if x <= 0 {
+			return fmt.Errorf("gpu_health.ignore_xids 含非法 Xid：%d", x)
+		}
+	}
+	return nil
+}
+
+func (c GPUHealthConfig) retiredPagesLimit() int64 {
+	if c.RetiredPagesLimit > 0 {
+		return int64(c.RetiredPagesLimit)
+	}
+	return defaultRetiredPagesLimit
+}
+
+// autoResolves 判断问题是否在后续上报不再出现时自动解除；Xid 为一次性事件，需管理员确认。
+func autoResolves(kind string) bool {
+	return kind != "xid"
+}
+
+// EvaluateGPUHealth 把一次上报的健康信号转换为健康问题，同一卡同一类问题合并为一条（取最高严重度）。
+func EvaluateGPUHealth(h *NodeHealth, cfg GPUHealthConfig) []GPUHealthIssue {
+	if h == nil {
+		return nil
+	}
+	ignore := make(map[int]bool, len(cfg.IgnoreXids))
+	for _, x := range cfg.IgnoreXids {
+		ignore[x] = true
+	}
+	type key struct {
+		gpu  int
+		kind string
+	}
+	merged := make(map[key]*GPUHealthIssue)
+	add := func(gpu int, bus string, kind string, severity string, detail string) {
+		k := key{gpu, kind}
+		if cur := merged[k]; cur != nil {
+			if severity == "critical" {
+				cur.Severity = "critical"
+			}
+			if !strings.Contains(cur.Detail, detail) {
+				cur.Detail = truncateRunes(cur.Detail+"；"+detail, 500)
+			}
+			return
+		}
+		merged[k] = &GPUHealthIssue{GPUIndex: gpu, BusID: bus, Kind: kind, Severity: severity, Detail: detail}
+	}
+
+	limit := cfg.retiredPagesLimit()
+	for _, g := range h.GPUs {
+		gpu := int(g.Index)
+		if g.ECCUncorrectedVolatile > 0 {
+			add(gpu, g.BusID, "ecc_uncorrected", "critical", fmt.Sprintf("本次开机以来不可纠正 ECC 错误 %d 次", g.ECCUncorrectedVolatile))
+		}
+		if g.RetiredPagesPending {
+			add(gpu, g.BusID, "retired_pages_pending", "critical", "有待生效的退役页，需重置 GPU 或重启节点")
+		}
+		retired := max(g.RetiredPagesSBE, 0) + max(g.RetiredPagesDBE, 0)
+		if retired >= limit {
+			add(gpu, g.BusID, "retired_pages", "critical", fmt.Sprintf("退役页 %d 个（单比特 %d、双比特 %d），达到返修阈值 %d", retired, g.RetiredPagesSBE, g.RetiredPagesDBE, limit))
+		}
+	}
+	if len(h.LostGPUs) > 0 {
+		add(-1, strings.Join(h.LostGPUs, ","), "gpu_lost", "critical", "nvidia-smi 报告 GPU is lost："+strings.Join(h.LostGPUs, ", "))
+	}
+	if h.ExpectedGPUCount > 0 && h.DetectedGPUCount < h.ExpectedGPUCount {
+		add(-1, "", "gpu_missing", "critical", fmt.Sprintf("检测到 %d 张卡，期望 %d 张", h.DetectedGPUCount, h.ExpectedGPUCount))
+	}
+	for _, ev := range h.XidEvents {
+		if applicationXids[ev.Code] || ignore[ev.Code] {
+			continue
+		}
+		severity := "warning"
+		if criticalXids[ev.Code] {
+			severity = "critical"
+		}
+		detail := fmt.Sprintf("Xid %d", ev.Code)
+		if ev.Message != "" {
+			detail += "：" + truncateRunes(ev.Message, 120)
+		}
+		add(int(ev.GPUIndex), ev.BusID, "xid", severity, detail)
+	}
+
+	out := make([]GPUHealthIssue, 0, len(merged))
+	for _, it := range merged {
+		out = append(out, *it)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].GPUIndex != out[j].GPUIndex {
+			return out[i].GPUIndex < out[j].GPUIndex
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
+
+// UnhealthyGPUs 汇总未解除的 critical 问题：返回异常卡号，以及是否存在节点级异常（此时整个节点不再分配）。
+func UnhealthyGPUs(issues []GPUHealthIssue) (map[int64]bool, bool) {
+	gpus := make(map[int64]bool)
+	node := false
+	for _, it := range issues {
+		if it.Severity != "critical" || it.ResolvedAt != nil {
+			continue
+		}
+		if it.GPUIndex < 0 {
+			node = true
+		} else {
+			gpus[int64(it.GPUIndex)] = true
+		}
+	}
+	return gpus, node
+}
+
+// GPUHealthAlert 生成新发现健康问题的告警标题与正文。
+func GPUHealthAlert(nodeID string, issues []GPUHealthIssue) (string, string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "节点 %s 发现 %d 个 GPU 硬件健康问题：\n", nodeID, len(issues))
+	critical := false
+	for _, it := range issues {
+		where := "节点"
+		if it.GPUIndex >= 0 {
+			where = fmt.Sprintf("GPU %d", it.GPUIndex)
+		}
+		if it.BusID != "" {
+			where += "（" + it.BusID + "）"
+		}
+		fmt.Fprintf(&b, "- [%s] %s %s：%s\n", it.Severity, where, it.Kind, it.Detail)
+		critical = critical || it.Severity == "critical"
+	}
+	if critical {
+		b.WriteString("critical 问题涉及的卡（节点级问题时为整个节点）已停止参与预约与排队分配，处理后可在管理端解除。")
+	}
+	return fmt.Sprintf("HIT-AIOT-OPS 节点 %s GPU 健康异常", nodeID), b.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncGPUHealthTx 按本次上报的健康信号更新节点健康问题；旧版 Agent 不上报健康信号时不做任何变更。
+func (s *Server) syncGPUHealthTx(ctx context.Context, tx *sql.Tx, nodeID string, health *NodeHealth, now time.Time) ([]GPUHealthIssue, error) {
+	if health == nil {
+		return nil, nil
+	}
+	return s.store.SyncGPUHealthTx(ctx, tx, nodeID, health, EvaluateGPUHealth(health, s.cfg.GPUHealth), now)
+}
+
+func (s *Server) sendGPUHealthAlert(nodeID string, issues []GPUHealthIssue) {
+	subject, body := GPUHealthAlert(nodeID, issues)
+	log.Printf("GPU 健康异常：node=%s issues=%d", nodeID, len(issues))
+	s.sendAdminAlert("gpu_health", subject, body, gin.H{"node_id": nodeID, "issues": issues})
+}
+
+// handleAdminGPUHealth 返回 GPU 健康问题（默认只含未解除的）。
+func (s *Server) handleAdminGPUHealth(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 500, 5000)
+	rows, err := s.store.ListGPUHealthIssues(c.Request.Context(), c.Query("node_id"), c.Query("include_resolved") == "1", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"issues": rows})
+}
+
+// handleAdminGPUHealthResolve 由管理员确认解除健康问题（换卡、重置 GPU 后）。
+func (s *Server) handleAdminGPUHealthResolve(c *gin.Context) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 不合法"})
+		return
+	}
+	it, err := s.store.ResolveGPUHealthIssue(c.Request.Context(), id, s.currentOperator(c), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在或已解除"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "issue": it})
+}
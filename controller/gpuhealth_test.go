@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateGPUHealth(t *testing.T) {
+	h := &NodeHealth{
+		ExpectedGPUCount: 8,
+		DetectedGPUCount: 7,
+		GPUs: []GPUHealth{
+			{Index: 0, BusID: "00000000:18:00.0", ECCUncorrectedVolatile: 0, RetiredPagesSBE: -1, RetiredPagesDBE: -1},
+			{Index: 2, BusID: "00000000:3B:00.0", ECCUncorrectedVolatile: 3, RetiredPagesSBE: 50, RetiredPagesDBE: 12, RetiredPagesPending: true},
+		},
+		XidEvents: []XidEvent{
+			{GPUIndex: 2, Code: 48, Message: "DBE"},
+			{GPUIndex: 2, Code: 94, Message: "contained ECC"},
+			{GPUIndex: 0, Code: 13, Message: "Graphics Engine Exception"},
+			{GPUIndex: -1, BusID: "0000:5e:00", Code: 999},
+		},
+	}
+	issues := EvaluateGPUHealth(h, GPUHealthConfig{})
+	kinds := make(map[string]GPUHealthIssue)
+	for _, it := range issues {
+		kinds[fmt.Sprintf("%d/%s", it.GPUIndex, it.Kind)] = it
+	}
+	for _, k := range []string{"2/ecc_uncorrected", "2/retired_pages_pending", "2/retired_pages", "2/xid", "-1/gpu_missing", "-1/xid"} {
+		if _, ok := kinds[k]; !ok {
+			t.Fatalf("missing issue %s in %+v", k, issues)
+		}
+	}
+	if len(issues) != 6 {
+		t.Fatalf("application xid 13 should be ignored: %+v", issues)
+	}
+	if x := kinds["2/xid"]; x.Severity != "critical" || !strings.Contains(x.Detail, "Xid 48") || !strings.Contains(x.Detail, "Xid 94") {
+		t.Fatalf("merged xid issue: %+v", x)
+	}
+	if kinds["-1/xid"].Severity != "warning" {
+		t.Fatalf("unknown xid should be a warning")
+	}
+	gpus, node := UnhealthyGPUs(issues)
+	if !node || !gpus[2] || gpus[0] {
+		t.Fatalf("unhealthy gpus=%v node=%v", gpus, node)
+	}
+	if len(EvaluateGPUHealth(h, GPUHealthConfig{RetiredPagesLimit: 100, IgnoreXids: []int{999}})) != 4 {
+		t.Fatalf("config limit / ignore_xids not applied")
+	}
+	if EvaluateGPUHealth(nil, GPUHealthConfig{}) != nil || !autoResolves("gpu_lost") || autoResolves("xid") {
+		t.Fatalf("nil health / auto resolve mismatch")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type researchGroupReq struct {
+	GroupName       string `json:"group_name"`
+	AdvisorName     string `json:"advisor_name"`
+	AdvisorUsername string `json:"advisor_username"`
+}
+
+type researchGroupMemberReq struct {
+	Username     string   `json:"username"`
+	MonthlyLimit *float64 `json:"monthly_limit"`
+}
+
+func parseGroupID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimSpace(c.Param("id")))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id 不合法"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleAdminGroupsList(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 1000, 5000)
+	rows, err := s.store.ListResearchGroups(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": rows})
+}
+
+func (s *Server) handleAdminGroupCreate(c *gin.Context) {
+	var req researchGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := s.store.CreateResearchGroup(c.Request.Context(), req.GroupName, req.AdvisorName, req.AdvisorUsername)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "group_id": id})
+}
+
+func (s *Server) handleAdminGroupUpdate(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	var req researchGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.UpdateResearchGroup(c.Request.Context(), id, req.GroupName, req.AdvisorName, req.AdvisorUsername); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "课题组不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminGroupDelete(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteResearchGroup(c.Request.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "课题组不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminGroupRecharge(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	var req rechargeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	var g ResearchGroup
+	var changed []BalanceUpdateResult
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		policy, err := s.store.ResolveGroupPolicyTx(ctx, tx, id, s.cfg)
+		if err != nil {
+			return err
+		}
+		g, changed, err = s.store.RechargeGroupTx(ctx, tx, id, req.Amount, req.Method, time.Now(), policy.ApplyTo(s.cfg))
+		return err
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "课题组不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 恢复的组员不必等到下次扣费：立即向其各节点本地账号下发解除动作
+	for _, res := range changed {
+		s.enqueueRecoveryActions(ctx, res.User.Username, res.PrevStatus, res.User.Status)
+	}
+	c.JSON(http.StatusOK, gin.H{"group_id": g.GroupID, "balance": g.Balance, "status": g.Status})
+}
+
+// enqueueRecoveryActions 按节点账号映射把解除动作排入对应节点；未绑定节点账号时按同名账号下发到所有节点。
+func (s *Server) enqueueRecoveryActions(ctx context.Context, billingUsername, prevStatus, status string) {
+	accounts, err := s.store.ListUserNodeAccountsByBilling(ctx, billingUsername, 5000)
+	if err != nil {
+		return
+	}
+	if len(accounts) == 0 {
+		nodes, err := s.store.ListNodes(ctx, 5000)
+		if err != nil {
+			return
+		}
+		for _, n := range nodes {
+			accounts = append(accounts, UserNodeAccount{NodeID: n.NodeID, LocalUsername: billingUsername})
+		}
+	}
+	for _, acc := range accounts {
+		for _, a := range RecoveryActions(acc.LocalUsername, prevStatus, status, s.cfg) {
+			s.enqueueNodeAction(acc.NodeID, a)
+		}
+	}
+}
+
+func (s *Server) handleAdminGroupMembersList(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	rows, err := s.store.ListResearchGroupMembers(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": rows})
+}
+
+func (s *Server) handleAdminGroupMemberUpsert(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	var req researchGroupMemberReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.UpsertResearchGroupMember(c.Request.Context(), id, req.Username, req.MonthlyLimit, s.currentOperator(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminGroupMemberDelete(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	username := strings.TrimSpace(c.Param("username"))
+	if err := s.store.DeleteResearchGroupMember(c.Request.Context(), id, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// handleAdminGroupSyncMembers 按注册资料中的“导师”字段批量把学生加入课题组。
+func (s *Server) handleAdminGroupSyncMembers(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	added, err := s.store.SyncResearchGroupMembersByAdvisor(c.Request.Context(), id, s.currentOperator(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "added": added})
+}
+
+func (s *Server) handleAdminGroupSpend(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	s.respondGroupSpend(c, id)
+}
+
+// handleUserMyGroup 返回当前用户所在课题组及个人组内额度使用情况。
+func (s *Server) handleUserMyGroup(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	ctx := c.Request.Context()
+	g, m, err := s.store.GetResearchGroupByMember(ctx, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusOK, gin.H{"group": nil})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"group": g, "member": m})
+}
+
+// handleUserAdvisorGroups 返回当前用户作为导师负责的课题组。
+func (s *Server) handleUserAdvisorGroups(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	rows, err := s.store.ListResearchGroupsByAdvisor(c.Request.Context(), username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": rows})
+}
+
+// handleUserAdvisorGroupSpend 为导师提供组内按学生拆分的消费看板。
+func (s *Server) handleUserAdvisorGroupSpend(c *gin.Context) {
+	id, ok := parseGroupID(c)
+	if !ok {
+		return
+	}
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	g, err := s.store.GetResearchGroup(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "课题组不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if g.AdvisorUsername == "" || g.AdvisorUsername != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	s.respondGroupSpend(c, id)
+}
+
+func (s *Server) respondGroupSpend(c *gin.Context, groupID int) {
+	now := time.Now()
+	monthStart := startOfMonth(now)
+	from, to, err := parseStatsRange(c, 30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(c.Query("from")) == "" {
+		from = monthStart
+	}
+	ctx := c.Request.Context()
+	g, err := s.store.GetResearchGroup(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "课题组不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := s.store.ListGroupMemberSpend(ctx, groupID, from, to, monthStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group":   g,
+		"from":    from.Format(time.RFC3339),
+		"to":      to.Format(time.RFC3339),
+		"members": rows,
+	})
+}
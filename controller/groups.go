@@ -0,0 +1,35 @@
+package main
+
+// GroupBillingAllowed 判断组员本月费用是否仍由课题组承担：未设置 monthly_limit（nil）时始终承担，
+// 设置后本月组内消费达到额度即回落到个人余额。
+func GroupBillingAllowed(monthlyLimit *float64, spent float64) bool {
+	return monthlyLimit == nil || spent < *monthlyLimit
+}
+
+// RecoveryActions 返回本地账号从 limited/blocked 恢复为 normal/warning 时应下发的解除动作，
+// 用于课题组充值等不经过节点上报的状态变化；未恢复时返回 nil。
+func RecoveryActions(localUsername, prevStatus, status string, cfg Config) []Action {
+	if prevStatus != "limited" && prevStatus != "blocked" {
+		return nil
+	}
+	if status != "normal" && status != "warning" {
+		return nil
+	}
+	actions := []Action{{
+		Type:     "unblock_user",
+		Username: localUsername,
+		Reason:   "余额已恢复，解除限制",
+	}}
+	if cfg.EnableCPUControl {
+		actions = append(actions, Action{
+			Type:            "set_cpu_quota",
+			Username:        localUsername,
+			CPUQuotaPercent: 0,
+			Reason:          "余额已恢复，解除 CPU 限制",
+		})
+	}
+	if cfg.EnableResourceLimits {
+		actions = append(actions, DecideResourceLimitActions(localUsername, status, prevStatus, cfg.ResourceLimitsLimited, cfg.ResourceLimitsBlocked)...)
+	}
+	return actions
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupBillingFallbackAndMemberRecovery(t *testing.T) {
+	// 未设置月额度始终由组承担；额度用尽后回落到个人余额
+	if !GroupBillingAllowed(nil, 1e9) {
+		t.Fatalf("no monthly limit should always bill the group")
+	}
+	limit := 100.0
+	if !GroupBillingAllowed(&limit, 99.99) {
+		t.Fatalf("below monthly limit should bill the group")
+	}
+	if GroupBillingAllowed(&limit, 100) || GroupBillingAllowed(&limit, 150) {
+		t.Fatalf("exhausted monthly limit should fall back to personal balance")
+	}
+
+	// 组充值后组员状态跟随组余额，但个人消费上限仍然生效
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	group := StatusForBalance(500, 100, 10)
+	if st := EffectiveStatus(group, nil, now); st != "normal" {
+		t.Fatalf("member status should follow group: %s", st)
+	}
+	capped := now.Add(time.Hour)
+	if st := EffectiveStatus(group, &capped, now); st != "limited" {
+		t.Fatalf("member spend cap should still limit: %s", st)
+	}
+
+	cfg := Config{EnableCPUControl: true}
+	acts := RecoveryActions("alice_local", "blocked", "normal", cfg)
+	if len(acts) != 2 || acts[0].Type != "unblock_user" || acts[0].Username != "alice_local" || acts[1].Type != "set_cpu_quota" || acts[1].CPUQuotaPercent != 0 {
+		t.Fatalf("recovered member should be unblocked: %+v", acts)
+	}
+	if acts := RecoveryActions("alice_local", "blocked", "limited", cfg); acts != nil {
+		t.Fatalf("still limited member should not be unblocked: %+v", acts)
+	}
+	if acts := RecoveryActions("alice_local", "warning", "normal", cfg); acts != nil {
+		t.Fatalf("unrestricted member needs no actions: %+v", acts)
+	}
+}
+
+func TestGroupBilledActionsUseGroupPolicy(t *testing.T) {
+	cfg := Config{WarningThreshold: 100, LimitedThreshold: 10, KillGracePeriodSeconds: 3600, CPULimitPercentLimited: 50, CPULimitPercentBlocked: 10}
+	userGrace := 7200
+	user := DefaultBillingPolicy(cfg).Override(PolicyOverride{Scope: "user", KillGracePeriodSeconds: &userGrace})
+	groupGrace, groupWarn := 600, 500.0
+	group := DefaultBillingPolicy(cfg).Override(PolicyOverride{Scope: "group", KillGracePeriodSeconds: &groupGrace, WarningThreshold: &groupWarn})
+
+	p := user.WithBalanceThresholds(group)
+	if p.WarningThreshold != 500 || p.LimitedThreshold != 10 || p.KillGrace() != 10*time.Minute {
+		t.Fatalf("group-billed member should use group thresholds: %+v", p)
+	}
+	if p.CPULimitPercentLimited != user.CPULimitPercentLimited {
+		t.Fatalf("non-threshold fields should stay on user policy: %+v", p)
+	}
+
+	// 组余额欠费 20 分钟：按课题组宽限期（10 分钟）kill，而不是组员个人的 2 小时
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	blockedAt := now.Add(-20 * time.Minute)
+	u := User{Username: "alice", Balance: -5, Status: "blocked", BlockedAt: &blockedAt}
+	acts := DecideActions(now, "blocked", u, p.WarningThreshold, p.LimitedThreshold, p.KillGrace(), []int32{42})
+	if len(acts) != 1 || acts[0].Type != "kill_process" {
+		t.Fatalf("expected kill under group grace: %+v", acts)
+	}
+	if acts := DecideActions(now, "blocked", u, user.WarningThreshold, user.LimitedThreshold, user.KillGrace(), []int32{42}); len(acts) != 0 {
+		t.Fatalf("user grace would not kill yet: %+v", acts)
+	}
+}
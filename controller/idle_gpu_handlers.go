@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gpuProcSample 为本次上报中使用 GPU 的一条进程记录（proc.Username 已是计费账号），供空闲识别与预约保护共用。
+type gpuProcSample struct {
+	local string
+	proc  UserProcess
+	cost  float64
+}
+
+type idleGPUAlert struct {
+	username string
+	message  string
+}
+
+// detectIdleGPUsTx 识别空闲占卡进程并按空闲时长逐级下发 notify（同时发邮件），到达策略回收时间后下发 kill_process。
+// 节点或计费账号在豁免名单中时不记录；不再空闲的进程记录随本次上报清除。
+func (s *Server) detectIdleGPUsTx(ctx context.Context, tx *sql.Tx, nodeID string, devices []GPUDevice, reportTS time.Time, now time.Time, gap time.Duration, candidates []gpuProcSample) ([]Action, []idleGPUAlert, error) {
+	cfg := s.cfg.IdleGPU
+	nodeExempt, exemptUsers, err := s.store.LoadIdleGPUExemptionsTx(ctx, tx, nodeID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	var actions []Action
+	var alerts []idleGPUAlert
+	killMinutes := make(map[string]int) // billing_username -> 生效的回收时间
+	for _, c := range candidates {
+		if nodeExempt || exemptUsers[c.proc.Username] {
+			continue
+		}
+		memMB, util, idle := IdleGPUProcess(c.proc, devices, cfg)
+		if !idle {
+			continue
+		}
+		gpuIDs := make([]int64, 0, len(c.proc.GPUUsage))
+		for _, g := range c.proc.GPUUsage {
+			gpuIDs = append(gpuIDs, int64(g.GPUID))
+		}
+		h, err := s.store.UpsertIdleGPUHolderTx(ctx, tx, IdleGPUHolder{
+			NodeID:             nodeID,
+			PID:                c.proc.PID,
+			LocalUsername:      c.local,
+			Username:           c.proc.Username,
+			Command:            c.proc.Command,
+			GPUIDs:             gpuIDs,
+			MemoryMB:           memMB,
+			UtilizationPercent: util,
+			LastSeen:           reportTS,
+		}, c.cost, gap)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		km, ok := killMinutes[h.Username]
+		if !ok {
+			policy, err := s.store.ResolveUserPolicyTx(ctx, tx, h.Username, s.cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+			km = policy.IdleGPUKillMinutes
+			killMinutes[h.Username] = km
+		}
+		level, kill := IdleGPUStep(h.LastSeen.Sub(h.IdleSince), cfg, km)
+		kill = kill && h.KillRequestedAt == nil
+		if level <= h.NotifyLevel && !kill {
+			continue
+		}
+
+		msg := IdleGPUMessage(h, level, len(cfg.notifySteps()), km)
+		if kill {
+			msg = fmt.Sprintf("GPU 空闲回收：进程 %d（%s）占用显存 %.0f MB 已空闲 %d 分钟，按策略回收",
+				h.PID, truncateRunes(h.Command, 60), h.MemoryMB, int(h.LastSeen.Sub(h.IdleSince)/time.Minute))
+			actions = append(actions, Action{
+				Type:       "kill_process",
+				Username:   h.LocalUsername,
+				PIDs:       []int32{h.PID},
+				Reason:     msg,
+				KillLadder: s.cfg.KillSignalLadder,
+			})
+		}
+		actions = append(actions, Action{Type: "notify", Username: h.LocalUsername, Message: msg})
+		alerts = append(alerts, idleGPUAlert{username: h.Username, message: msg})
+		if err := s.store.MarkIdleGPUHolderTx(ctx, tx, nodeID, h.PID, level, kill, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := s.store.ClearIdleGPUHoldersTx(ctx, tx, nodeID, reportTS); err != nil {
+		return nil, nil, err
+	}
+	return actions, alerts, nil
+}
+
+// sendIdleGPUMail 在后台给用户发送空闲占卡提醒；未配置邮箱或 SMTP 时只记录日志。
+func (s *Server) sendIdleGPUMail(username string, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	email, err := s.store.GetUserEmailByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("GPU 空闲提醒：查询 %s 邮箱失败：%v", username, err)
+		}
+		return
+	}
+	settings, err := s.store.GetMailSettings(ctx, s.cfg)
+	if err != nil {
+		log.Printf("GPU 空闲提醒：读取邮件配置失败：%v", err)
+		return
+	}
+	subject := "HIT-AIOT-OPS GPU 空闲提醒"
+	body := fmt.Sprintf("你好 %s，\n\n%s。\n排队中的同学正在等待 GPU，如仍需使用请尽快恢复计算，如有特殊需要请联系管理员。\n\nHIT-AIOT-OPS团队", username, message)
+	if err := sendResetPasswordMail(settings, email, subject, body); err != nil {
+		log.Printf("GPU 空闲提醒：发送给 %s 失败：%v", username, err)
+	}
+}
+
+// handleAdminIdleGPUs 为“空闲占卡”报表：默认只列出空闲时长达到 window_minutes 的进程。
+func (s *Server) handleAdminIdleGPUs(c *gin.Context) {
+	minMinutes := parseLimit(c.Query("min_minutes"), s.cfg.IdleGPU.WindowMinutes, 100000)
+	limit := parseLimit(c.Query("limit"), 500, 5000)
+	rows, err := s.store.ListIdleGPUHolders(c.Request.Context(), c.Query("node_id"), c.Query("username"), time.Duration(minMinutes)*time.Minute, time.Now(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	totalMem := 0.0
+	for _, h := range rows {
+		totalMem += h.MemoryMB
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": s.cfg.IdleGPU.Enabled, "config": s.cfg.IdleGPU, "holders": rows, "total_memory_mb": totalMem})
+}
+
+// handleUserMyIdleGPUs 返回当前用户被识别为空闲占卡的进程。
+func (s *Server) handleUserMyIdleGPUs(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	rows, err := s.store.ListIdleGPUHolders(c.Request.Context(), "", username, 0, time.Now(), 200)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"holders": rows})
+}
+
+type idleGPUExemptionReq struct {
+	Scope     string     `json:"scope"`
+	Target    string     `json:"target"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (s *Server) handleAdminIdleGPUExemptionsList(c *gin.Context) {
+	rows, err := s.store.ListIdleGPUExemptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exemptions": rows})
+}
+
+func (s *Server) handleAdminIdleGPUExemptionUpsert(c *gin.Context) {
+	var req idleGPUExemptionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := IdleGPUExemption{Scope: req.Scope, Target: req.Target, Reason: req.Reason, ExpiresAt: req.ExpiresAt}
+	if err := s.store.UpsertIdleGPUExemption(c.Request.Context(), in, s.currentOperator(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminIdleGPUExemptionDelete(c *gin.Context) {
+	if err := s.store.DeleteIdleGPUExemption(c.Request.Context(), c.Query("scope"), c.Query("target")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
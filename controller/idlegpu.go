@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (c IdleGPUConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.UtilizationPercent < 0 || c.UtilizationPercent > 100 {
+		return errors.New("idle_gpu.utilization_percent 必须在 [0, 100] 范围内")
+	}
+	if c.MinMemoryMB < 0 {
+		return errors.New("idle_gpu.min_memory_mb 不能为负数")
+	}
+	if c.WindowMinutes <= 0 {
+		return errors.New("idle_gpu.window_minutes 必须为正数")
+	}
+	prev := 0
+	for i, m := range c.NotifyMinutes {
+		if m < c.WindowMinutes || m <= prev {
+			return fmt.Errorf("idle_gpu.notify_minutes[%d] 必须递增且不小于 window_minutes", i)
+		}
+		prev = m
+	}
+	if c.KillMinutes != 0 && c.KillMinutes < c.WindowMinutes {
+		return errors.New("idle_gpu.kill_minutes 为 0（不回收）或不小于 window_minutes")
+	}
+	return nil
+}
+
+// notifySteps 返回逐级提醒的空闲分钟数；未配置时在达到 window_minutes 时提醒一次。
+func (c IdleGPUConfig) notifySteps() []int {
+	if len(c.NotifyMinutes) == 0 {
+		return []int{c.WindowMinutes}
+	}
+	return c.NotifyMinutes
+}
+
+// IdleGPUProcess 判断进程是否空闲占卡：合计显存不少于 MinMemoryMB，且所用每张卡的利用率都已知并不超过阈值。
+// 同一张卡上有其他进程在计算时卡利用率不为 0，此时不会误判。返回合计显存与所用卡的最高利用率。
+func IdleGPUProcess(proc UserProcess, devices []GPUDevice, cfg IdleGPUConfig) (float64, float64, bool) {
+	if len(proc.GPUUsage) == 0 || len(devices) == 0 {
+		return 0, 0, false
+	}
+	memMB := 0.0
+	maxUtil := 0.0
+	for _, g := range proc.GPUUsage {
+		memMB += g.MemoryMB
+		d, ok := findGPUDevice(devices, g)
+		if !ok || d.UtilizationPercent < 0 {
+			return 0, 0, false
+		}
+		if d.UtilizationPercent > maxUtil {
+			maxUtil = d.UtilizationPercent
+		}
+	}
+	if memMB < cfg.MinMemoryMB || maxUtil > cfg.UtilizationPercent {
+		return memMB, maxUtil, false
+	}
+	return memMB, maxUtil, true
+}
+
+func findGPUDevice(devices []GPUDevice, g GPUUsage) (GPUDevice, bool) {
+	bus := strings.ToUpper(strings.TrimSpace(g.GPUBusID))
+	for _, d := range devices {
+		if bus != "" && strings.ToUpper(strings.TrimSpace(d.BusID)) == bus {
+			return d, true
+		}
+	}
+	for _, d := range devices {
+		if g.GPUID >= 0 && d.Index == g.GPUID {
+			return d, true
+		}
+	}
+	return GPUDevice{}, false
+}
+
+// IdleGPUStep 返回空闲 idle 时长对应的提醒级别（已越过的提醒节点数），以及是否已到回收时间（killMinutes=0 表示不回收）。
+func IdleGPUStep(idle time.Duration, cfg IdleGPUConfig, killMinutes int) (int, bool) {
+	minutes := int(idle / time.Minute)
+	level := 0
+	for _, m := range cfg.notifySteps() {
+		if minutes >= m {
+			level++
+		}
+	}
+	return level, killMinutes > 0 && minutes >= killMinutes
+}
+
+// IdleGPUMessage 生成第 level 级提醒文案；配置了回收时提示剩余时间。
+func IdleGPUMessage(h IdleGPUHolder, level int, total int, killMinutes int) string {
+	idle := int(h.LastSeen.Sub(h.IdleSince) / time.Minute)
+	msg := fmt.Sprintf("GPU 空闲提醒（%d/%d）：进程 %d（%s）占用显存 %.0f MB，GPU 利用率已 %d 分钟未超过阈值，请保存结果后释放",
+		level, total, h.PID, truncateRunes(h.Command, 60), h.MemoryMB, idle)
+	if killMinutes > 0 {
+		left := killMinutes - idle
+		if left < 0 {
+			left = 0
+		}
+		msg += fmt.Sprintf("；继续空闲 %d 分钟后将被回收", left)
+	}
+	return msg
+}
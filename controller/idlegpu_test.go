@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleGPUProcess(t *testing.T) {
+	cfg := IdleGPUConfig{Enabled: true, UtilizationPercent: 5, MinMemoryMB: 1024, WindowMinutes: 30}
+	devices := []GPUDevice{
+		{Index: 0, BusID: "00000000:18:00.0", UtilizationPercent: 0},
+		{Index: 1, BusID: "00000000:3B:00.0", UtilizationPercent: 87},
+		{Index: 2, BusID: "00000000:86:00.0", UtilizationPercent: -1},
+	}
+	proc := UserProcess{PID: 1, GPUUsage: []GPUUsage{{GPUID: 0, GPUBusID: "00000000:18:00.0", MemoryMB: 20480}}}
+	if mem, _, idle := IdleGPUProcess(proc, devices, cfg); !idle || mem != 20480 {
+		t.Fatalf("process on idle GPU should be idle, mem=%v idle=%v", mem, idle)
+	}
+	proc.GPUUsage = append(proc.GPUUsage, GPUUsage{GPUID: 1, MemoryMB: 100})
+	if _, util, idle := IdleGPUProcess(proc, devices, cfg); idle || util != 87 {
+		t.Fatalf("process using a busy GPU should not be idle, util=%v", util)
+	}
+	small := UserProcess{PID: 2, GPUUsage: []GPUUsage{{GPUID: 0, MemoryMB: 300}}}
+	if _, _, idle := IdleGPUProcess(small, devices, cfg); idle {
+		t.Fatalf("process below min_memory_mb should not be idle")
+	}
+	unknown := UserProcess{PID: 3, GPUUsage: []GPUUsage{{GPUID: 2, MemoryMB: 4096}}}
+	if _, _, idle := IdleGPUProcess(unknown, devices, cfg); idle {
+		t.Fatalf("unknown utilization should not be treated as idle")
+	}
+	if _, _, idle := IdleGPUProcess(proc, nil, cfg); idle {
+		t.Fatalf("old agents without device stats should never be idle")
+	}
+}
+
+func TestIdleGPUStep(t *testing.T) {
+	cfg := IdleGPUConfig{Enabled: true, WindowMinutes: 30, NotifyMinutes: []int{60, 240}}
+	if level, kill := IdleGPUStep(59*time.Minute, cfg, 0); level != 0 || kill {
+		t.Fatalf("level=%d kill=%v", level, kill)
+	}
+	if level, kill := IdleGPUStep(5*time.Hour, cfg, 480); level != 2 || kill {
+		t.Fatalf("level=%d kill=%v", level, kill)
+	}
+	if _, kill := IdleGPUStep(8*time.Hour, cfg, 480); !kill {
+		t.Fatalf("should be reclaimed after kill_minutes")
+	}
+	cfg.NotifyMinutes = nil
+	if level, _ := IdleGPUStep(30*time.Minute, cfg, 0); level != 1 {
+		t.Fatalf("without notify_minutes should notify once at window, level=%d", level)
+	}
+}
+
+func TestIdleGPUConfigValidate(t *testing.T) {
+	if err := (IdleGPUConfig{}).Validate(); err != nil {
+		t.Fatalf("disabled config should pass: %v", err)
+	}
+	ok := IdleGPUConfig{Enabled: true, UtilizationPercent: 5, MinMemoryMB: 1024, WindowMinutes: 30, NotifyMinutes: []int{30, 120}, KillMinutes: 720}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	bad := ok
+	bad.NotifyMinutes = []int{120, 60}
+	if bad.Validate() == nil {
+		t.Fatalf("non-increasing notify_minutes should fail")
+	}
+	bad = ok
+	bad.KillMinutes = 10
+	if bad.Validate() == nil {
+		t.Fatalf("kill_minutes below window should fail")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// driftFields 为参与基线比较的版本字段；内存与磁盘只记录变化，不参与比较。
+var driftFields = []string{"driver_version", "cuda_version", "kernel_version", "os_release"}
+
+func (c InventoryConfig) Validate() error {
+	for k := range c.Baseline {
+		known := false
+		for _, f := range driftFields {
+			known = known || f == k
+		}
+		if !known {
+			return fmt.Errorf("inventory.baseline 含未知字段：%s（可选 driver_version / cuda_version / kernel_version / os_release）", k)
+		}
+	}
+	return nil
+}
+
+// inventoryField 返回清单字段的字符串值；字段名未知时返回 nil。
+func inventoryField(inv NodeInventory, field string) *string {
+	var v string
+	switch field {
+	case "driver_version":
+		v = inv.DriverVersion
+	case "cuda_version":
+		v = inv.CUDAVersion
+	case "kernel_version":
+		v = inv.KernelVersion
+	case "os_release":
+		v = inv.OSRelease
+	case "memory_total_mb":
+		v = strconv.FormatInt(inv.MemoryTotalMB, 10)
+	case "disk_total_gb":
+		v = strconv.FormatFloat(inv.DiskTotalGB, 'f', 1, 64)
+	default:
+		return nil
+	}
+	return &v
+}
+
+// DiffInventory 比较新旧清单，返回变化的字段；旧值为空（首次上报）或新值为空（本次没取到）时不记为变化。
+func DiffInventory(prev NodeInventory, cur NodeInventory) []NodeInventoryChange {
+	blank := func(v string) bool { return v == "" || v == "0" || v == "0.0" }
+	var out []NodeInventoryChange
+	for _, f := range append(append([]string{}, driftFields...), "memory_total_mb", "disk_total_gb") {
+		a, b := *inventoryField(prev, f), *inventoryField(cur, f)
+		if a == b || blank(a) || blank(b) {
+			continue
+		}
+		out = append(out, NodeInventoryChange{Field: f, OldValue: a, NewValue: b})
+	}
+	return out
+}
+
+// compareVersions 按版本号比较 a 与 b（按 . - 空格 分段，数字段按数值比较，如 "12.4" > "9.2"），
+// 返回 -1 / 0 / 1；前缀相同时段数多者较大，完全相同的分段再按原字符串比较以保证结果确定。
+func compareVersions(a, b string) int {
+	sep := func(r rune) bool { return r == '.' || r == '-' || r == ' ' }
+	as, bs := strings.FieldsFunc(a, sep), strings.FieldsFunc(b, sep)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errX := strconv.ParseUint(as[i], 10, 64)
+		y, errY := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case errX == nil && errY == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	if len(as) != len(bs) {
+		if len(as) < len(bs) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// ComputeInventoryDrift 计算每个版本字段的基线（配置指定优先，否则取使用节点最多的值，并列时按版本号取较大者），
+// 返回基线与不一致的节点。字段为空的节点（如非 GPU 节点的驱动版本）不参与该字段的比较。
+func ComputeInventoryDrift(nodes []NodeInventoryStatus, pinned map[string]string) (map[string]string, []InventoryDrift) {
+	baseline := make(map[string]string, len(driftFields))
+	for _, f := range driftFields {
+		if v, ok := pinned[f]; ok && v != "" {
+			baseline[f] = v
+			continue
+		}
+		counts := make(map[string]int)
+		for _, n := range nodes {
+			if v := *inventoryField(n.NodeInventory, f); v != "" {
+				counts[v]++
+			}
+		}
+		best, bestN := "", 0
+		for v, c := range counts {
+			if c > bestN || (c == bestN && compareVersions(v, best) > 0) {
+				best, bestN = v, c
+			}
+		}
+		if best != "" {
+			baseline[f] = best
+		}
+	}
+	var drift []InventoryDrift
+	for _, n := range nodes {
+		for _, f := range driftFields {
+			v := *inventoryField(n.NodeInventory, f)
+			if b, ok := baseline[f]; ok && v != "" && v != b {
+				drift = append(drift, InventoryDrift{NodeID: n.NodeID, Field: f, Value: v, Baseline: b})
+			}
+		}
+	}
+	sort.SliceStable(drift, func(i, j int) bool { return drift[i].NodeID < drift[j].NodeID })
+	return baseline, drift
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleAdminInventory 返回各节点的软硬件清单、集群基线与不一致的节点。
+func (s *Server) handleAdminInventory(c *gin.Context) {
+	nodes, err := s.store.ListNodeInventory(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	baseline, drift := ComputeInventoryDrift(nodes, s.cfg.Inventory.Baseline)
+	if drift == nil {
+		drift = []InventoryDrift{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":           nodes,
+		"baseline":        baseline,
+		"pinned_baseline": s.cfg.Inventory.Baseline,
+		"drift":           drift,
+	})
+}
+
+// handleAdminInventoryChanges 返回清单变化记录（默认近 90 天）。
+func (s *Server) handleAdminInventoryChanges(c *gin.Context) {
+	from, to, err := parseStatsRange(c, 90)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := parseLimit(c.Query("limit"), 500, 5000)
+	rows, err := s.store.ListNodeInventoryChanges(c.Request.Context(), c.Query("node_id"), c.Query("field"), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": rows})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInventoryDrift(t *testing.T) {
+	node := func(id, driver, cuda, kernel string) NodeInventoryStatus {
+		return NodeInventoryStatus{NodeID: id, NodeInventory: NodeInventory{DriverVersion: driver, CUDAVersion: cuda, KernelVersion: kernel, OSRelease: "Ubuntu 22.04.4 LTS"}}
+	}
+	nodes := []NodeInventoryStatus{
+		node("60000", "535.154.05", "12.2", "5.15.0-105-generic"),
+		node("60001", "535.154.05", "12.2", "5.15.0-105-generic"),
+		node("60002", "550.54.15", "12.4", "5.15.0-107-generic"),
+		node("60003", "", "", "5.15.0-107-generic"),
+	}
+	baseline, drift := ComputeInventoryDrift(nodes, nil)
+	if baseline["driver_version"] != "535.154.05" || baseline["kernel_version"] != "5.15.0-107-generic" {
+		t.Fatalf("baseline (mode, tie -> greater): %v", baseline)
+	}
+	if len(drift) != 4 || drift[0].NodeID != "60000" || drift[2].NodeID != "60002" {
+		t.Fatalf("drift: %+v", drift)
+	}
+	_, drift = ComputeInventoryDrift(nodes, map[string]string{"driver_version": "550.54.15"})
+	for _, d := range drift {
+		if d.Field == "driver_version" && d.NodeID == "60002" {
+			t.Fatalf("pinned baseline should match 60002: %+v", drift)
+		}
+	}
+	// 并列时按版本号而非字典序取较大者："12.4" > "9.2"
+	tie := []NodeInventoryStatus{node("60000", "", "9.2", ""), node("60001", "", "12.4", "")}
+	if baseline, _ := ComputeInventoryDrift(tie, nil); baseline["cuda_version"] != "12.4" {
+		t.Fatalf("tie should pick newer version: %v", baseline)
+	}
+	if compareVersions("5.15.0-105-generic", "5.15.0-97-generic") <= 0 || compareVersions("550.54.15", "550.54.15") != 0 || compareVersions("12.2", "12.2.1") >= 0 {
+		t.Fatalf("compareVersions ordering")
+	}
+	if err := (InventoryConfig{Baseline: map[string]string{"gpu_model": "A100"}}).Validate(); err == nil {
+		t.Fatalf("unknown baseline field should be rejected")
+	}
+
+	prev := NodeInventory{DriverVersion: "535.154.05", KernelVersion: "5.15.0-105-generic", MemoryTotalMB: 515000}
+	changes := DiffInventory(prev, NodeInventory{DriverVersion: "550.54.15", CUDAVersion: "12.4", KernelVersion: "5.15.0-105-generic", MemoryTotalMB: 515000, DiskTotalGB: 1760.5})
+	if len(changes) != 1 || changes[0].Field != "driver_version" || changes[0].OldValue != "535.154.05" {
+		t.Fatalf("changes: %+v", changes)
+	}
+	if DiffInventory(prev, NodeInventory{}) != nil {
+		t.Fatalf("missing values should not count as changes")
+	}
+}
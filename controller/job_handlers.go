@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 作业查询：usage_records 按 PID 逐次采样，作业表把连续采样折叠成一次训练 / 推理任务，
+// 用户据此回答“这次训练花了多少钱”，明细（逐进程采样）通过 /jobs/:id 查看。
+
+// markRunning 标记仍在运行的作业：最近一次采样距今不超过合并间隔。
+func (s *Server) markRunning(jobs []Job) {
+	gap := s.cfg.JobMergeGap(0)
+	now := time.Now()
+	for i := range jobs {
+		jobs[i].Running = now.Sub(jobs[i].EndedAt) <= gap
+	}
+}
+
+func (s *Server) handleUserMyJobs(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	limit := parseLimit(c.Query("limit"), 50, 500)
+	jobs, err := s.store.ListJobs(c.Request.Context(), username, c.Query("node_id"), c.Query("gpu_only") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.markRunning(jobs)
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (s *Server) handleUserMyJobDetail(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	s.writeJobDetail(c, username)
+}
+
+func (s *Server) handleAdminJobs(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 200, 5000)
+	jobs, err := s.store.ListJobs(c.Request.Context(), c.Query("username"), c.Query("node_id"), c.Query("gpu_only") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.markRunning(jobs)
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (s *Server) handleAdminJobDetail(c *gin.Context) {
+	s.writeJobDetail(c, "")
+}
+
+// writeJobDetail 返回作业及其逐进程采样；owner 非空时只允许查看该计费账号的作业。
+func (s *Server) writeJobDetail(c *gin.Context, owner string) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 不合法"})
+		return
+	}
+	job, ok, err := s.store.GetJob(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok || (owner != "" && job.Username != owner) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "作业不存在"})
+		return
+	}
+	records, err := s.store.ListJobUsageRecords(c.Request.Context(), id, parseLimit(c.Query("limit"), 2000, 20000))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	jobs := []Job{job}
+	s.markRunning(jobs)
+	c.JSON(http.StatusOK, gin.H{"job": jobs[0], "records": records})
+}
+
+// handleUsageByTag 按标签值汇总费用（SLURM_JOB_ID、GPUOPS_PROJECT 等）；username 为空表示全部计费账号。
+func (s *Server) handleUsageByTag(c *gin.Context, username string) {
+	tag := strings.TrimSpace(c.Query("tag"))
+	if !tagKeyPattern.MatchString(tag) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tag 不合法（应为环境变量名，例如 SLURM_JOB_ID）"})
+		return
+	}
+	from, to, err := parseStatsRange(c, 90)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := s.store.ListUsageByTag(c.Request.Context(), tag, username, from, to, parseLimit(c.Query("limit"), 200, 5000))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tag": tag, "from": from.Format(time.RFC3339), "to": to.Format(time.RFC3339), "rows": rows})
+}
+
+func (s *Server) handleUserMyUsageByTag(c *gin.Context) {
+	s.handleUsageByTag(c, strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user"))))
+}
+
+func (s *Server) handleAdminStatsTags(c *gin.Context) {
+	s.handleUsageByTag(c, c.Query("username"))
+}
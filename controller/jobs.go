@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// JobKey 返回进程所属作业的标识：优先进程组（torchrun / 脚本拉起的多进程作业共享进程组），否则为 PID。
+func JobKey(proc UserProcess) string {
+	if proc.PGID > 1 {
+		return fmt.Sprintf("pg:%d", proc.PGID)
+	}
+	return fmt.Sprintf("pid:%d", proc.PID)
+}
+
+// Add 把一个进程在本周期内的用量计入作业合计；GPU 显存按进程求和，用于计算作业峰值。
+func (j *JobSample) Add(proc UserProcess, cost float64, intervalMinutes float64) {
+	j.GPUCount += len(proc.GPUUsage)
+	for _, g := range proc.GPUUsage {
+		j.GPUMemoryMB += g.MemoryMB
+	}
+	j.GPUMinutes += float64(len(proc.GPUUsage)) * intervalMinutes
+	j.CPUCoreMinutes += proc.CPUPercent / 100.0 * intervalMinutes
+	j.Cost += cost
+	for k, v := range proc.Tags {
+		if j.Tags == nil {
+			j.Tags = make(map[string]string)
+		}
+		if _, ok := j.Tags[k]; !ok {
+			j.Tags[k] = v
+		}
+	}
+}
+
+// JobMergeGap 返回同一作业两次采样之间允许的最大间隔。
+func (c Config) JobMergeGap(intervalSeconds int) time.Duration {
+	if c.JobMergeGapSeconds > 0 {
+		return time.Duration(c.JobMergeGapSeconds) * time.Second
+	}
+	if intervalSeconds <= 0 {
+		intervalSeconds = c.SampleIntervalSeconds
+	}
+	return time.Duration(2*intervalSeconds) * time.Second
+}
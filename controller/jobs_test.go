@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestJobSampleFold(t *testing.T) {
+	leader := UserProcess{PID: 100, PGID: 100, CPUPercent: 200, GPUUsage: []GPUUsage{{GPUID: 0, MemoryMB: 30000}, {GPUID: 1, MemoryMB: 20000}}}
+	worker := UserProcess{PID: 101, PGID: 100, CPUPercent: 100}
+	single := UserProcess{PID: 200}
+	if JobKey(leader) != "pg:100" || JobKey(worker) != "pg:100" || JobKey(single) != "pid:200" {
+		t.Fatalf("keys=%s %s %s", JobKey(leader), JobKey(worker), JobKey(single))
+	}
+
+	var j JobSample
+	j.Add(leader, 1.5, 1)
+	j.Add(worker, 0.02, 1)
+	if j.GPUCount != 2 || j.GPUMemoryMB != 50000 || j.GPUMinutes != 2 || j.CPUCoreMinutes != 3 || math.Abs(j.Cost-1.52) > 1e-9 {
+		t.Fatalf("sample=%+v", j)
+	}
+
+	cfg := Config{SampleIntervalSeconds: 60}
+	if g := cfg.JobMergeGap(30); g != time.Minute {
+		t.Fatalf("gap=%v", g)
+	}
+	if g := cfg.JobMergeGap(0); g != 2*time.Minute {
+		t.Fatalf("gap=%v", g)
+	}
+	cfg.JobMergeGapSeconds = 600
+	if g := cfg.JobMergeGap(30); g != 10*time.Minute {
+		t.Fatalf("gap=%v", g)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleNodeKillReport 接收 Agent 回报的 kill_process 执行结果。
+func (s *Server) handleNodeKillReport(c *gin.Context) {
+	var req KillReport
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := s.store.InsertKillReport(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "id": id})
+}
+
+func (s *Server) handleAdminKillReports(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 200, 5000)
+	rows, err := s.store.ListKillReports(c.Request.Context(), c.Query("username"), c.Query("node_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": rows})
+}
+
+// handleUserMyKillReports 让用户查看自己哪些进程被平台终止。
+func (s *Server) handleUserMyKillReports(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	limit := parseLimit(c.Query("limit"), 50, 500)
+	rows, err := s.store.ListKillReports(c.Request.Context(), username, "", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": rows})
+}
@@ -40,6 +40,9 @@ func main() {
 
 	srv := NewServer(cfg, store)
 	r := srv.Router()
+	go srv.runNodeWatcher(context.Background())
+	go srv.runQueueStatsRefresher(context.Background())
+	go srv.runSpendCapExpiry(context.Background())
 
 	log.Printf("控制器启动：listen=%s dry_run=%v", cfg.ListenAddr, cfg.DryRun)
 	if err := r.Run(cfg.ListenAddr); err != nil {
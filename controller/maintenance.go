@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceState 返回维护窗口在 now 时刻的状态：scheduled（未到排空时间）、draining（排空中）、
+// maintenance（维护中）、ended（已结束或被取消）。
+func MaintenanceState(m NodeMaintenance, now time.Time) string {
+	switch {
+	case m.EndedAt != nil, m.EndAt != nil && !now.Before(*m.EndAt):
+		return "ended"
+	case now.Before(m.DrainAt):
+		return "scheduled"
+	case now.Before(m.StartAt):
+		return "draining"
+	default:
+		return "maintenance"
+	}
+}
+
+// maintenanceBlocks 判断节点是否应拒绝新登录与分配（排空中或维护中）。
+func maintenanceBlocks(m NodeMaintenance, now time.Time) bool {
+	st := MaintenanceState(m, now)
+	return st == "draining" || st == "maintenance"
+}
+
+// maintenanceOverlaps 判断维护窗口（自排空起）是否与 [start, end) 重叠，用于拒绝落在维护期内的预约。
+func maintenanceOverlaps(m NodeMaintenance, start time.Time, end time.Time) bool {
+	if m.EndedAt != nil {
+		return false
+	}
+	return end.After(m.DrainAt) && (m.EndAt == nil || start.Before(*m.EndAt))
+}
+
+// MaintenanceNotice 为下发给在线用户的排空 / 维护通知。
+func MaintenanceNotice(m NodeMaintenance) string {
+	window := m.StartAt.Format("01-02 15:04") + " 起"
+	if m.EndAt != nil {
+		window = m.StartAt.Format("01-02 15:04") + " ~ " + m.EndAt.Format("01-02 15:04")
+	}
+	msg := fmt.Sprintf("节点 %s 将于 %s 维护，期间不再接受新的登录与 GPU 分配，请尽快保存数据并结束任务", m.NodeID, window)
+	if m.KickSSH {
+		msg += "；维护开始时将断开所有 SSH 会话"
+	}
+	if m.Reason != "" {
+		msg += "。原因：" + m.Reason
+	}
+	return msg
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type maintenanceReq struct {
+	NodeID  string   `json:"node_id"`
+	NodeIDs []string `json:"node_ids"`
+	Reason  string   `json:"reason"`
+	DrainAt string   `json:"drain_at"` // 为空表示立即排空
+	StartAt string   `json:"start_at"` // 为空表示与 drain_at 相同（立即维护）
+	EndAt   string   `json:"end_at"`   // 为空表示直到管理员结束
+	KickSSH bool     `json:"kick_ssh"`
+}
+
+// handleAdminMaintenanceCreate 为一个或多个节点登记维护窗口。
+func (s *Server) handleAdminMaintenanceCreate(c *gin.Context) {
+	var req maintenanceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	m := NodeMaintenance{Reason: req.Reason, DrainAt: now, KickSSH: req.KickSSH, CreatedBy: s.currentOperator(c)}
+	for _, f := range []struct {
+		name string
+		v    string
+		dst  *time.Time
+	}{{"drain_at", req.DrainAt, &m.DrainAt}, {"start_at", req.StartAt, &m.StartAt}} {
+		if strings.TrimSpace(f.v) == "" {
+			continue
+		}
+		t, err := parseTimeFlexible(f.v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": f.name + " 时间格式不合法，建议 RFC3339"})
+			return
+		}
+		*f.dst = t.In(time.Local)
+	}
+	if m.StartAt.IsZero() {
+		m.StartAt = m.DrainAt
+	}
+	if strings.TrimSpace(req.EndAt) != "" {
+		t, err := parseTimeFlexible(req.EndAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_at 时间格式不合法，建议 RFC3339"})
+			return
+		}
+		t = t.In(time.Local)
+		m.EndAt = &t
+	}
+	if id := strings.TrimSpace(req.NodeID); id != "" {
+		req.NodeIDs = append(req.NodeIDs, id)
+	}
+	if len(req.NodeIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node_ids 不能为空"})
+		return
+	}
+	out := make([]NodeMaintenance, 0, len(req.NodeIDs))
+	for _, id := range req.NodeIDs {
+		m.NodeID = id
+		row, err := s.store.CreateMaintenance(c.Request.Context(), m, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "created": out})
+			return
+		}
+		out = append(out, row)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "maintenance": out})
+}
+
+func (s *Server) handleAdminMaintenanceList(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 200, 2000)
+	rows, err := s.store.ListMaintenance(c.Request.Context(), c.Query("node_id"), c.Query("include_ended") == "1", time.Now(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"maintenance": rows})
+}
+
+// handleAdminMaintenanceEnd 提前结束维护或取消尚未开始的窗口。
+func (s *Server) handleAdminMaintenanceEnd(c *gin.Context) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 不合法"})
+		return
+	}
+	m, err := s.store.EndMaintenance(c.Request.Context(), id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在或已结束"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "maintenance": m})
+}
+
+// handleUserMaintenance 返回未结束的维护窗口，便于用户避开维护时段。
+func (s *Server) handleUserMaintenance(c *gin.Context) {
+	rows, err := s.store.ListMaintenance(c.Request.Context(), c.Query("node_id"), false, time.Now(), 500)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].DrainAt.Before(rows[j].DrainAt) })
+	c.JSON(http.StatusOK, gin.H{"maintenance": rows})
+}
+
+// applyMaintenanceTx 处理节点当前生效的维护窗口：排空开始后向在线用户（SSH 会话与进程属主）发一次通知，
+// 维护开始且配置了 kick_ssh 时下发一次 kick_ssh_all。返回是否处于排空 / 维护中（此时不再为该节点分配 GPU）。
+func (s *Server) applyMaintenanceTx(ctx context.Context, tx *sql.Tx, nodeID string, now time.Time, localUsers []string) ([]Action, bool, error) {
+	windows, err := s.store.ListOpenMaintenanceTx(ctx, tx, nodeID, now)
+	if err != nil {
+		return nil, false, err
+	}
+	var actions []Action
+	blocking := false
+	for _, m := range windows {
+		if !maintenanceBlocks(m, now) {
+			continue
+		}
+		blocking = true
+		if m.NotifiedAt == nil {
+			msg := MaintenanceNotice(m)
+			for _, u := range localUsers {
+				actions = append(actions, Action{Type: "notify", Username: u, Message: msg})
+			}
+			if err := s.store.MarkMaintenanceNotifiedTx(ctx, tx, m.ID, now); err != nil {
+				return nil, false, err
+			}
+		}
+		if m.KickSSH && m.KickedAt == nil && MaintenanceState(m, now) == "maintenance" {
+			actions = append(actions, Action{Type: "kick_ssh_all", Reason: fmt.Sprintf("节点维护开始（#%d）：%s", m.ID, m.Reason)})
+			if err := s.store.MarkMaintenanceKickedTx(ctx, tx, m.ID, now); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	return actions, blocking, nil
+}
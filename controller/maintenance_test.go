@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceState(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	end := t0.Add(4 * time.Hour)
+	m := NodeMaintenance{NodeID: "60000", Reason: "换电源", DrainAt: t0, StartAt: t0.Add(time.Hour), EndAt: &end, KickSSH: true}
+	cases := []struct {
+		at   time.Time
+		want string
+	}{
+		{t0.Add(-time.Minute), "scheduled"},
+		{t0, "draining"},
+		{t0.Add(time.Hour), "maintenance"},
+		{end, "ended"},
+	}
+	for _, tc := range cases {
+		if got := MaintenanceState(m, tc.at); got != tc.want {
+			t.Fatalf("state at %v: got %s want %s", tc.at, got, tc.want)
+		}
+	}
+	if maintenanceBlocks(m, t0.Add(-time.Minute)) || !maintenanceBlocks(m, t0.Add(30*time.Minute)) {
+		t.Fatalf("blocks mismatch")
+	}
+	if !maintenanceOverlaps(m, t0.Add(-time.Hour), t0.Add(time.Minute)) || maintenanceOverlaps(m, end, end.Add(time.Hour)) {
+		t.Fatalf("overlap mismatch")
+	}
+	ended := t0.Add(30 * time.Minute)
+	m.EndedAt = &ended
+	if MaintenanceState(m, t0.Add(time.Hour)) != "ended" || maintenanceOverlaps(m, t0, end) {
+		t.Fatalf("ended window should not block")
+	}
+	if msg := MaintenanceNotice(m); !strings.Contains(msg, "60000") || !strings.Contains(msg, "SSH") || !strings.Contains(msg, "换电源") {
+		t.Fatalf("notice: %s", msg)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -19,6 +21,26 @@ type controllerMetrics struct {
 	actionsUnblockUserTotal atomic.Int64
 	actionsKillTotal        atomic.Int64
 	actionsCPUQuotaTotal    atomic.Int64
+	actionsMemoryLimitTotal atomic.Int64
+	actionsTasksLimitTotal  atomic.Int64
+
+	enforcementDriftTotal atomic.Int64
+
+	// 排队等待预估与实际对比（排队项取到卡时记录）
+	queueWaitObservedTotal       atomic.Int64
+	queueWaitWithinRangeTotal    atomic.Int64
+	queueWaitActualSecondsSum    atomic.Int64
+	queueWaitPredictedSecondsSum atomic.Int64
+	queueWaitAbsErrorSecondsSum  atomic.Int64
+
+	// 节点离线检测：上下线次数与各节点当前是否在线（离线检测判定离线为 0）
+	nodeOfflineTotal atomic.Int64
+	nodeOnlineTotal  atomic.Int64
+	nodeUpMu         sync.Mutex
+	nodeUp           map[string]bool
+
+	// GPU 健康：新发现的健康问题数
+	gpuHealthIssuesTotal atomic.Int64
 
 	lastReportUnix atomic.Int64
 }
@@ -44,10 +66,52 @@ func (m *controllerMetrics) observeReport(receivedAt time.Time, duplicate bool,
 			m.actionsKillTotal.Add(1)
 		case "set_cpu_quota":
 			m.actionsCPUQuotaTotal.Add(1)
+		case "set_memory_limit":
+			m.actionsMemoryLimitTotal.Add(1)
+		case "set_tasks_limit":
+			m.actionsTasksLimitTotal.Add(1)
 		}
 	}
 }
 
+// observeQueueWait 记录一次排队项的实际等待与提交时的预估；没有预估（控制器重启前提交等）时不计入。
+func (m *controllerMetrics) observeQueueWait(predicted *WaitEstimate, actual time.Duration) {
+	if predicted == nil || actual < 0 {
+		return
+	}
+	expected := time.Duration(predicted.ExpectedMinutes) * time.Minute
+	m.queueWaitObservedTotal.Add(1)
+	if predicted.Contains(actual.Minutes()) {
+		m.queueWaitWithinRangeTotal.Add(1)
+	}
+	m.queueWaitActualSecondsSum.Add(int64(actual.Seconds()))
+	m.queueWaitPredictedSecondsSum.Add(int64(expected.Seconds()))
+	diff := actual - expected
+	if diff < 0 {
+		diff = -diff
+	}
+	m.queueWaitAbsErrorSecondsSum.Add(int64(diff.Seconds()))
+}
+
+// observeNodeEvent 记录一次上下线并更新该节点的在线状态。
+func (m *controllerMetrics) observeNodeEvent(ev NodeStatusEvent) {
+	if ev.Status == "online" {
+		m.nodeOnlineTotal.Add(1)
+	} else {
+		m.nodeOfflineTotal.Add(1)
+	}
+	m.setNodeUp(ev.NodeID, ev.Status == "online")
+}
+
+func (m *controllerMetrics) setNodeUp(nodeID string, up bool) {
+	m.nodeUpMu.Lock()
+	defer m.nodeUpMu.Unlock()
+	if m.nodeUp == nil {
+		m.nodeUp = make(map[string]bool)
+	}
+	m.nodeUp[nodeID] = up
+}
+
 func (m *controllerMetrics) render(queueLen int) string {
 	var b strings.Builder
 	write := func(name string, v int64) {
@@ -62,8 +126,39 @@ func (m *controllerMetrics) render(queueLen int) string {
 	write("gpuops_controller_actions_unblock_user_total", m.actionsUnblockUserTotal.Load())
 	write("gpuops_controller_actions_kill_process_total", m.actionsKillTotal.Load())
 	write("gpuops_controller_actions_set_cpu_quota_total", m.actionsCPUQuotaTotal.Load())
+	write("gpuops_controller_actions_set_memory_limit_total", m.actionsMemoryLimitTotal.Load())
+	write("gpuops_controller_actions_set_tasks_limit_total", m.actionsTasksLimitTotal.Load())
+
+	write("gpuops_controller_enforcement_drift_total", m.enforcementDriftTotal.Load())
 
 	write("gpuops_controller_queue_length", int64(queueLen))
+	write("gpuops_controller_queue_wait_observed_total", m.queueWaitObservedTotal.Load())
+	write("gpuops_controller_queue_wait_within_range_total", m.queueWaitWithinRangeTotal.Load())
+	write("gpuops_controller_queue_wait_actual_seconds_sum", m.queueWaitActualSecondsSum.Load())
+	write("gpuops_controller_queue_wait_predicted_seconds_sum", m.queueWaitPredictedSecondsSum.Load())
+	write("gpuops_controller_queue_wait_abs_error_seconds_sum", m.queueWaitAbsErrorSecondsSum.Load())
+	write("gpuops_controller_gpu_health_issues_total", m.gpuHealthIssuesTotal.Load())
+	write("gpuops_controller_node_offline_events_total", m.nodeOfflineTotal.Load())
+	write("gpuops_controller_node_online_events_total", m.nodeOnlineTotal.Load())
+	m.nodeUpMu.Lock()
+	nodeIDs := make([]string, 0, len(m.nodeUp))
+	offline := int64(0)
+	for id, up := range m.nodeUp {
+		nodeIDs = append(nodeIDs, id)
+		if !up {
+			offline++
+		}
+	}
+	sort.Strings(nodeIDs)
+	write("gpuops_controller_nodes_offline", offline)
+	for _, id := range nodeIDs {
+		up := int64(0)
+		if m.nodeUp[id] {
+			up = 1
+		}
+		write(fmt.Sprintf("gpuops_controller_node_up{node_id=%q}", id), up)
+	}
+	m.nodeUpMu.Unlock()
 	write("gpuops_controller_last_report_unix", m.lastReportUnix.Load())
 	return b.String()
 }
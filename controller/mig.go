@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type migPrice struct {
+	card    string
+	profile string
+	price   float64
+}
+
+// migProfileRe 匹配 MIG 规格，如 1g.10gb、3g.40gb、1g.10gb+me；拆分计算实例时为 1c.3g.40gb。
+var migProfileRe = regexp.MustCompile(`^(?:(\d+)c\.)?(\d+)g\.\d+gb(?:\+\w+)?$`)
+
+// GPUPrice 返回一条卡占用的每分钟单价。MIG 实例优先使用规格单价，
+// 未配置时按实例占整卡的比例（MIGFraction）折算整卡单价。
+func (pi PriceIndex) GPUPrice(g GPUUsage, defaultPricePerMinute float64) float64 {
+	full, ok := pi.MatchPrice(g.GPUModel)
+	if !ok {
+		full = defaultPricePerMinute
+	}
+	profile := strings.ToLower(strings.TrimSpace(g.MIGProfile))
+	if profile == "" {
+		return full
+	}
+	for _, p := range pi.mig {
+		if p.profile == profile && strings.Contains(g.GPUModel, p.card) {
+			return p.price
+		}
+	}
+	return full * MIGFraction(g.GPUModel, profile)
+}
+
+// MIGFraction 返回 MIG 实例占整卡计算切片的比例：A30 整卡 4 片，A100 / H100 等为 7 片；
+// 拆分了计算实例（1c.3g.40gb）时按计算实例的切片数。规格无法识别时按整卡计。
+func MIGFraction(gpuModel string, profile string) float64 {
+	m := migProfileRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(profile)))
+	if m == nil {
+		return 1
+	}
+	slices := m[2]
+	if m[1] != "" {
+		slices = m[1]
+	}
+	n, err := strconv.Atoi(slices)
+	if err != nil || n <= 0 {
+		return 1
+	}
+	total := 7.0
+	if strings.Contains(strings.ToUpper(gpuModel), "A30") {
+		total = 4
+	}
+	return math.Min(float64(n)/total, 1)
+}
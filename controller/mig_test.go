@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMIGPricing(t *testing.T) {
+	pi := NewPriceIndex([]PriceRow{
+		{Model: "A100", Price: 0.7},
+		{Model: "A30", Price: 0.4},
+		{Model: "A100 3g.40gb", Price: 0.25},
+		{Model: "1g.10gb", Price: 0.12},
+	})
+	if _, ok := pi.MatchPrice("NVIDIA A100 3g.40gb"); !ok {
+		t.Fatalf("card price should still match")
+	}
+	proc := UserProcess{GPUUsage: []GPUUsage{
+		{GPUModel: "NVIDIA A100-SXM4-80GB", MIGProfile: "3g.40gb"},
+		{GPUModel: "NVIDIA H100 80GB HBM3", MIGProfile: "1g.10gb"},
+		{GPUModel: "NVIDIA A100-SXM4-80GB", MIGProfile: "2g.20gb"},
+		{GPUModel: "NVIDIA A30", MIGProfile: "2g.12gb"},
+		{GPUModel: "NVIDIA A100-SXM4-80GB"},
+	}}
+	// 0.25（规格单价）+ 0.12（通配规格单价）+ 0.7*2/7 + 0.4*2/4 + 0.7（整卡）
+	if got := CalculateProcessCost(proc, pi, 0.1, ScavengerConfig{}); got != 1.47 {
+		t.Fatalf("cost=%v want=1.47", got)
+	}
+	if f := MIGFraction("NVIDIA A100-SXM4-40GB", "1c.3g.20gb"); math.Abs(f-1.0/7) > 1e-9 {
+		t.Fatalf("compute instance fraction=%v", f)
+	}
+	if MIGFraction("NVIDIA A100", "unknown") != 1 {
+		t.Fatalf("unknown profile should be charged as full card")
+	}
+}
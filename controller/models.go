@@ -9,15 +9,18 @@ type MetricsData struct {
 	// ReportID 为单次上报的全局唯一 ID，用于幂等：控制器只处理一次，避免重试导致重复扣费。
 	ReportID string `json:"report_id"`
 	// IntervalSeconds 为 Agent 上报周期（秒）。为空时由控制器用 sample_interval_seconds 兜底。
-	IntervalSeconds int           `json:"interval_seconds,omitempty"`
-	CPUModel        string        `json:"cpu_model,omitempty"`
-	CPUCount        int           `json:"cpu_count,omitempty"`
-	GPUModel        string        `json:"gpu_model,omitempty"`
-	GPUCount        int           `json:"gpu_count,omitempty"`
-	NetRxBytes      uint64        `json:"net_rx_bytes,omitempty"`
-	NetTxBytes      uint64        `json:"net_tx_bytes,omitempty"`
-	SSHUsers        []string      `json:"ssh_users,omitempty"`
-	Users           []UserProcess `json:"users"`
+	IntervalSeconds int            `json:"interval_seconds,omitempty"`
+	CPUModel        string         `json:"cpu_model,omitempty"`
+	CPUCount        int            `json:"cpu_count,omitempty"`
+	GPUModel        string         `json:"gpu_model,omitempty"`
+	GPUCount        int            `json:"gpu_count,omitempty"`
+	NetRxBytes      uint64         `json:"net_rx_bytes,omitempty"`
+	NetTxBytes      uint64         `json:"net_tx_bytes,omitempty"`
+	SSHUsers        []string       `json:"ssh_users,omitempty"`
+	GPUs            []GPUDevice    `json:"gpus,omitempty"`      // 每张卡的利用率与显存（旧版 Agent 不上报）
+	Health          *NodeHealth    `json:"health,omitempty"`    // 硬件健康信号（旧版 Agent 不上报）
+	Inventory       *NodeInventory `json:"inventory,omitempty"` // 软硬件清单（Agent 按较长周期携带）
+	Users           []UserProcess  `json:"users"`
 }
 
 type UserProcess struct {
@@ -27,13 +30,104 @@ type UserProcess struct {
 	MemoryMB   float64    `json:"memory_mb"`
 	GPUUsage   []GPUUsage `json:"gpu_usage"`
 	Command    string     `json:"command,omitempty"`
+	// root / 共享服务账号启动的进程由 Agent 归属到真实用户：ProcessUser 为进程实际属主，
+	// Attribution 为归属依据（cgroup / container_label / userns / env），为空表示按属主计费。
+	ProcessUser string `json:"process_user,omitempty"`
+	Attribution string `json:"attribution,omitempty"`
+	// PGID 为进程组 ID，用于把同一作业的多个进程聚合为一个作业（旧版 Agent 不上报时按 PID 聚合）
+	PGID int32 `json:"pgid,omitempty"`
+	// Tags 为 Agent 按白名单读取的进程环境变量（SLURM_JOB_ID、GPUOPS_PROJECT 等），入库前经 SanitizeTags 清洗
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
+// GPUUsage 为进程在一张卡上的占用；MIGProfile / MIGUUID 非空表示运行在 MIG 实例上（GPUID 为父卡编号）。
 type GPUUsage struct {
-	GPUID    int32   `json:"gpu_id"`
-	GPUModel string  `json:"gpu_model"`
-	GPUBusID string  `json:"gpu_bus_id"`
-	MemoryMB float64 `json:"memory_mb"`
+	GPUID      int32   `json:"gpu_id"`
+	GPUModel   string  `json:"gpu_model"`
+	GPUBusID   string  `json:"gpu_bus_id"`
+	MemoryMB   float64 `json:"memory_mb"`
+	MIGProfile string  `json:"mig_profile,omitempty"`
+	MIGUUID    string  `json:"mig_uuid,omitempty"`
+}
+
+// GPUDevice 为单张卡的瞬时状态；UtilizationPercent 为 -1 表示驱动未提供利用率。
+type GPUDevice struct {
+	Index              int32   `json:"index"`
+	BusID              string  `json:"bus_id"`
+	Name               string  `json:"name"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+	MemoryUsedMB       float64 `json:"memory_used_mb"`
+	MemoryTotalMB      float64 `json:"memory_total_mb"`
+}
+
+// NodeInventory 为节点软硬件清单；取不到的字段为空。
+type NodeInventory struct {
+	DriverVersion string   `json:"driver_version"`
+	CUDAVersion   string   `json:"cuda_version"`
+	KernelVersion string   `json:"kernel_version"`
+	OSRelease     string   `json:"os_release"`
+	MemoryTotalMB int64    `json:"memory_total_mb"`
+	DiskTotalGB   float64  `json:"disk_total_gb"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// NodeInventoryStatus 为管理端清单报表中的一行。
+type NodeInventoryStatus struct {
+	NodeID       string     `json:"node_id"`
+	GPUModel     string     `json:"gpu_model"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	OfflineSince *time.Time `json:"offline_since,omitempty"`
+	NodeInventory
+	InventoryUpdatedAt *time.Time `json:"inventory_updated_at,omitempty"`
+}
+
+// NodeInventoryChange 为一次清单字段变化（驱动升级、换内核等）。
+type NodeInventoryChange struct {
+	ID        int64     `json:"id"`
+	NodeID    string    `json:"node_id"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// InventoryDrift 为节点某字段与集群基线不一致。
+type InventoryDrift struct {
+	NodeID   string `json:"node_id"`
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	Baseline string `json:"baseline"`
+}
+
+// NodeHealth 为 Agent 上报的硬件健康信号；ExpectedGPUCount 为 0 表示节点未配置期望卡数。
+type NodeHealth struct {
+	ExpectedGPUCount int         `json:"expected_gpu_count,omitempty"`
+	DetectedGPUCount int         `json:"detected_gpu_count"`
+	LostGPUs         []string    `json:"lost_gpus,omitempty"`
+	GPUs             []GPUHealth `json:"gpus,omitempty"`
+	XidEvents        []XidEvent  `json:"xid_events,omitempty"`
+	Errors           []string    `json:"errors,omitempty"`
+}
+
+// GPUHealth 为单卡 ECC 与退役页计数；-1 表示驱动 / 架构不支持该计数。
+type GPUHealth struct {
+	Index                   int32  `json:"index"`
+	BusID                   string `json:"bus_id"`
+	ECCCorrectedVolatile    int64  `json:"ecc_corrected_volatile"`
+	ECCUncorrectedVolatile  int64  `json:"ecc_uncorrected_volatile"`
+	ECCUncorrectedAggregate int64  `json:"ecc_uncorrected_aggregate"`
+	RetiredPagesSBE         int64  `json:"retired_pages_sbe"`
+	RetiredPagesDBE         int64  `json:"retired_pages_dbe"`
+	RetiredPagesPending     bool   `json:"retired_pages_pending"`
+}
+
+// XidEvent 为内核日志中的一条 NVIDIA Xid；GPUIndex 为 -1 表示无法对应到卡号。
+type XidEvent struct {
+	GPUIndex int32  `json:"gpu_index"`
+	BusID    string `json:"bus_id"`
+	Code     int    `json:"code"`
+	Message  string `json:"message,omitempty"`
+	Time     string `json:"time,omitempty"`
 }
 
 type ControllerResponse struct {
@@ -42,12 +136,188 @@ type ControllerResponse struct {
 
 // Action 为控制器下发到节点的动作。
 type Action struct {
-	Type            string  `json:"type"` // notify, block_user, unblock_user, kill_process, kick_ssh_all, kick_ssh_user
+	Type            string     `json:"type"` // notify, block_user, unblock_user, set_cpu_quota, set_memory_limit, set_tasks_limit, kill_process, kick_ssh_all, kick_ssh_user
+	Username        string     `json:"username"`
+	PIDs            []int32    `json:"pids,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+	Message         string     `json:"message,omitempty"`
+	CPUQuotaPercent float64    `json:"cpu_quota_percent,omitempty"` // set_cpu_quota 使用
+	KillLadder      []KillStep `json:"kill_ladder,omitempty"`       // kill_process 使用；为空时 Agent 按 SIGTERM → 5s → SIGKILL
+	MemoryHighMB    int64      `json:"memory_high_mb,omitempty"`    // set_memory_limit 使用；0 表示不限制
+	MemoryMaxMB     int64      `json:"memory_max_mb,omitempty"`     // set_memory_limit 使用；0 表示不限制
+	TasksMax        int64      `json:"tasks_max,omitempty"`         // set_tasks_limit 使用；0 表示不限制
+}
+
+// ResourceLimits 为某一余额状态下用户 slice 的内存与进程数限制（对应 systemd MemoryHigh/MemoryMax/TasksMax），0 表示不限制。
+type ResourceLimits struct {
+	MemoryHighMB int64 `yaml:"memory_high_mb" json:"memory_high_mb"`
+	MemoryMaxMB  int64 `yaml:"memory_max_mb" json:"memory_max_mb"`
+	TasksMax     int64 `yaml:"tasks_max" json:"tasks_max"`
+}
+
+// IdleGPUConfig 为空闲占卡识别配置：进程占用显存不少于 MinMemoryMB，且所用每张卡利用率都不超过
+// UtilizationPercent，连续 WindowMinutes 分钟即视为空闲；按 NotifyMinutes 逐级提醒，KillMinutes>0 时到期回收。
+type IdleGPUConfig struct {
+	Enabled            bool    `yaml:"enabled" json:"enabled"`
+	UtilizationPercent float64 `yaml:"utilization_percent" json:"utilization_percent"`
+	MinMemoryMB        float64 `yaml:"min_memory_mb" json:"min_memory_mb"`
+	WindowMinutes      int     `yaml:"window_minutes" json:"window_minutes"`
+	NotifyMinutes      []int   `yaml:"notify_minutes" json:"notify_minutes"`
+	KillMinutes        int     `yaml:"kill_minutes" json:"kill_minutes"` // 可被计费策略覆盖；0 表示不回收
+}
+
+// ScavengerConfig 为可抢占（scavenger）档配置：进程环境变量 GPUOPS_TIER=scavenger 的 GPU 费用按 PriceFactor 折扣，
+// 普通排队请求或生效中的预约需要卡时被 kill_process 抢占。
+type ScavengerConfig struct {
+	Enabled     bool    `yaml:"enabled" json:"enabled"`
+	PriceFactor float64 `yaml:"price_factor" json:"price_factor"` // GPU 单价系数，默认 0.3
+}
+
+// NodeWatchConfig 为节点离线检测配置：连续 MissedIntervals 个上报周期未上报即判定离线，
+// 上下线时向 AlertEmails 发邮件、向 WebhookURL 推送 JSON；两者都为空时只记录不告警。
+type NodeWatchConfig struct {
+	MissedIntervals int      `yaml:"missed_intervals" json:"missed_intervals"` // 默认 3
+	CheckSeconds    int      `yaml:"check_seconds" json:"check_seconds"`       // 检查周期，默认 30 秒
+	AlertEmails     []string `yaml:"alert_emails" json:"alert_emails"`
+	WebhookURL      string   `yaml:"webhook_url" json:"webhook_url"`
+}
+
+// InventoryConfig 为软硬件清单配置：Baseline 以字段名（driver_version / cuda_version / kernel_version / os_release）
+// 为键指定基线版本，未指定的字段取集群中最多节点使用的值。
+type InventoryConfig struct {
+	Baseline map[string]string `yaml:"baseline" json:"baseline"`
+}
+
+// GPUHealthConfig 为硬件健康判定配置；数值为 0 时使用默认值（见 gpuhealth.go）。
+type GPUHealthConfig struct {
+	RetiredPagesLimit int   `yaml:"retired_pages_limit" json:"retired_pages_limit"` // 退役页达到该数量视为需返修，默认 60
+	IgnoreXids        []int `yaml:"ignore_xids" json:"ignore_xids"`                 // 额外忽略的 Xid（应用层错误 13/31/43/45 默认忽略）
+}
+
+// GPUHealthIssue 为一条硬件健康问题。GPUIndex 为 -1 表示节点级（掉卡、卡数不符、无法对应卡号的 Xid）；
+// Severity 为 critical 时该卡（节点级时整个节点）不再参与预约、排队可用卡统计与抢占。
+// Xid 需管理员确认后解除，其余问题在后续上报不再出现时自动解除（ResolvedBy=auto）。
+type GPUHealthIssue struct {
+	ID          int64      `json:"id"`
+	NodeID      string     `json:"node_id"`
+	GPUIndex    int        `json:"gpu_index"`
+	BusID       string     `json:"bus_id"`
+	Kind        string     `json:"kind"`     // ecc_uncorrected / retired_pages_pending / retired_pages / xid / gpu_lost / gpu_missing
+	Severity    string     `json:"severity"` // critical / warning
+	Detail      string     `json:"detail"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy  string     `json:"resolved_by,omitempty"`
+}
+
+// NodeStatusEvent 为一次节点上下线记录；InMaintenance 表示发生在维护窗口内（不告警）。
+type NodeStatusEvent struct {
+	ID             int64     `json:"id"`
+	NodeID         string    `json:"node_id"`
+	Status         string    `json:"status"` // offline / online
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	OfflineSeconds int64     `json:"offline_seconds"`
+	InMaintenance  bool      `json:"in_maintenance"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// GPUPreemption 为一次 scavenger 进程被抢占的记录；Reason 为 queue（普通排队请求）或 reservation（预约生效）。
+type GPUPreemption struct {
+	ID            int64     `json:"id"`
+	NodeID        string    `json:"node_id"`
+	LocalUsername string    `json:"local_username"`
+	Username      string    `json:"username"`
+	PID           int32     `json:"pid"`
+	GPUIDs        []int64   `json:"gpu_ids"`
+	Command       string    `json:"command"`
+	Reason        string    `json:"reason"`
+	QueueItemID   int64     `json:"queue_item_id,omitempty"`
+	ReservationID int64     `json:"reservation_id,omitempty"`
+	Beneficiary   string    `json:"beneficiary"` // 获得该卡的排队人或预约人
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReservationConfig 为 GPU 预约配置；数值为 0 时使用默认值（见 reservation.go）。
+type ReservationConfig struct {
+	AutoApprove      bool `yaml:"auto_approve" json:"auto_approve"`             // 为 false 时用户预约需管理员审批
+	MaxHours         int  `yaml:"max_hours" json:"max_hours"`                   // 单次预约最长时长
+	MaxDaysAhead     int  `yaml:"max_days_ahead" json:"max_days_ahead"`         // 最多提前多少天预约
+	KillGraceSeconds int  `yaml:"kill_grace_seconds" json:"kill_grace_seconds"` // 非预约人进程从提醒到终止的宽限期
+}
+
+// FairShareConfig 为 GPU 排队的公平份额配置：按计费账号近期 GPU 用量（按半衰期衰减）与份额排序，关闭时按先来后到。
+// GroupShares 以课题组名为键，组内成员平分该组份额；未加入课题组的账号与未配置的课题组使用 DefaultShare。
+type FairShareConfig struct {
+	Enabled       bool               `yaml:"enabled" json:"enabled"`
+	HalfLifeHours float64            `yaml:"half_life_hours" json:"half_life_hours"`
+	WindowDays    int                `yaml:"window_days" json:"window_days"`
+	DefaultShare  float64            `yaml:"default_share" json:"default_share"`
+	GroupShares   map[string]float64 `yaml:"group_shares" json:"group_shares"`
+	CacheSeconds  int                `yaml:"cache_seconds" json:"cache_seconds"` // 用量统计缓存时间，避免每次查询排队都扫描 usage_records
+}
+
+// FairShareEntry 为某计费账号的公平份额：UsageGPUMinutes 为衰减后的 GPU 卡分钟，Share 为归一化份额，
+// Score 在 (0, 1] 之间，越大越优先。
+type FairShareEntry struct {
 	Username        string  `json:"username"`
-	PIDs            []int32 `json:"pids,omitempty"`
+	GroupName       string  `json:"group_name,omitempty"`
+	UsageGPUMinutes float64 `json:"usage_gpu_minutes"`
+	Share           float64 `json:"share"`
+	Score           float64 `json:"score"`
+}
+
+// KillStep 为 kill_process 信号阶梯中的一步：发送 Signal 后最多等待 WaitSeconds 秒再进入下一步。
+type KillStep struct {
+	Signal      string `json:"signal" yaml:"signal"` // 如 SIGUSR1 / SIGTERM / SIGKILL
+	WaitSeconds int    `json:"wait_seconds" yaml:"wait_seconds"`
+}
+
+// KillReport 为 Agent 执行 kill_process 后回报的结果。
+type KillReport struct {
+	ID            int64      `json:"id"`
+	NodeID        string     `json:"node_id"`
+	LocalUsername string     `json:"local_username"`
+	Username      string     `json:"username"` // 计费账号（入库时按节点映射解析）
+	Reason        string     `json:"reason"`
+	RequestedPIDs []int32    `json:"requested_pids"`
+	KilledPIDs    []int32    `json:"killed_pids"`
+	SurvivedPIDs  []int32    `json:"survived_pids"`
+	SkippedPIDs   []int32    `json:"skipped_pids"` // 执行前已退出或不属于该用户
+	TreePIDs      []int32    `json:"tree_pids"`    // 随进程树 / 进程组 / 容器 cgroup 一并处理的 PID
+	Cgroups       []string   `json:"cgroups"`      // 整体处理的容器 cgroup
+	Ladder        []KillStep `json:"ladder"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    time.Time  `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// NodeEnforcement 为节点本地账号应处于的限制状态；Agent 周期性拉取并把实际状态校正到该状态。
+type NodeEnforcement struct {
+	LocalUsername   string  `json:"local_username"`
+	BillingUsername string  `json:"billing_username"`
+	Status          string  `json:"status"`
+	GPUBlocked      bool    `json:"gpu_blocked"`
+	CPUQuotaPercent float64 `json:"cpu_quota_percent"` // 0 表示不限制
+	MemoryHighMB    int64   `json:"memory_high_mb"`
+	MemoryMaxMB     int64   `json:"memory_max_mb"`
+	TasksMax        int64   `json:"tasks_max"`
 	Reason          string  `json:"reason,omitempty"`
-	Message         string  `json:"message,omitempty"`
-	CPUQuotaPercent float64 `json:"cpu_quota_percent,omitempty"` // set_cpu_quota 使用
+}
+
+// EnforcementDrift 为 Agent 发现的“期望限制”与“实际限制”不一致的记录。
+type EnforcementDrift struct {
+	ID            int64     `json:"id"`
+	NodeID        string    `json:"node_id"`
+	LocalUsername string    `json:"local_username"`
+	Username      string    `json:"username"` // 计费账号（入库时按节点映射解析）
+	Item          string    `json:"item"`     // gpu_block / cpu_quota / memory / tasks
+	Expected      string    `json:"expected"`
+	Actual        string    `json:"actual"`
+	Repaired      bool      `json:"repaired"`
+	Error         string    `json:"error,omitempty"`
+	DetectedAt    time.Time `json:"detected_at"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type User struct {
@@ -63,19 +333,75 @@ type PriceRow struct {
 }
 
 type UsageRecord struct {
-	NodeID      string    `json:"node_id"`
-	Username    string    `json:"username"` // 兼容字段：等同 billing_username
-	LocalUser   string    `json:"local_username"`
-	BillingUser string    `json:"billing_username"`
-	Registered  bool      `json:"registered"`
-	Timestamp   time.Time `json:"timestamp"`
-	PID         int32     `json:"pid"`
-	CPUPercent  float64   `json:"cpu_percent"`
-	MemoryMB    float64   `json:"memory_mb"`
-	GPUCount    int       `json:"gpu_count"`
-	Command     string    `json:"command"`
-	GPUUsage    string    `json:"gpu_usage"` // JSON 字符串（原样返回）
-	Cost        float64   `json:"cost"`
+	NodeID      string            `json:"node_id"`
+	Username    string            `json:"username"` // 兼容字段：等同 billing_username
+	LocalUser   string            `json:"local_username"`
+	BillingUser string            `json:"billing_username"`
+	Registered  bool              `json:"registered"`
+	Timestamp   time.Time         `json:"timestamp"`
+	PID         int32             `json:"pid"`
+	CPUPercent  float64           `json:"cpu_percent"`
+	MemoryMB    float64           `json:"memory_mb"`
+	GPUCount    int               `json:"gpu_count"`
+	Command     string            `json:"command"`
+	GPUUsage    string            `json:"gpu_usage"` // JSON 字符串（原样返回）
+	Cost        float64           `json:"cost"`
+	ProcessUser string            `json:"process_user,omitempty"`
+	Attribution string            `json:"attribution,omitempty"`
+	JobID       int64             `json:"job_id,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	ProjectID   int               `json:"project_id,omitempty"`
+}
+
+// Job 为按 (节点, 本地账号, 进程组/PID, 命令) 聚合的连续用量；started_at 为首次采样所覆盖周期的开始。
+type Job struct {
+	ID              int64             `json:"id"`
+	NodeID          string            `json:"node_id"`
+	LocalUsername   string            `json:"local_username"`
+	Username        string            `json:"username"` // 计费账号
+	JobKey          string            `json:"job_key"`  // pg:<pgid> 或 pid:<pid>
+	Command         string            `json:"command"`
+	GroupID         int               `json:"group_id"`
+	StartedAt       time.Time         `json:"started_at"`
+	EndedAt         time.Time         `json:"ended_at"`
+	DurationSeconds int64             `json:"duration_seconds"`
+	Samples         int               `json:"samples"`
+	GPUMinutes      float64           `json:"gpu_minutes"`
+	CPUCoreMinutes  float64           `json:"cpu_core_minutes"`
+	PeakGPUMemoryMB float64           `json:"peak_gpu_memory_mb"`
+	PeakGPUCount    int               `json:"peak_gpu_count"`
+	Cost            float64           `json:"cost"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	ProjectID       int               `json:"project_id,omitempty"`
+	Running         bool              `json:"running"`
+}
+
+// JobSample 为一次上报内同一作业全部进程的合计。
+type JobSample struct {
+	LocalUsername  string
+	Username       string
+	JobKey         string
+	Command        string
+	GroupID        int
+	GPUCount       int
+	GPUMemoryMB    float64
+	GPUMinutes     float64
+	CPUCoreMinutes float64
+	Cost           float64
+	Tags           map[string]string
+	ProjectID      int
+}
+
+// UsageTagSummary 为按某个标签值汇总的用量（例如同一 SLURM_JOB_ID / GPUOPS_PROJECT）。
+type UsageTagSummary struct {
+	Tag               string    `json:"tag"`
+	Value             string    `json:"value"`
+	Users             int       `json:"users"`
+	UsageRecords      int       `json:"usage_records"`
+	GPUProcessRecords int       `json:"gpu_process_records"`
+	TotalCost         float64   `json:"total_cost"`
+	FirstSeen         time.Time `json:"first_seen"`
+	LastSeen          time.Time `json:"last_seen"`
 }
 
 type NodeStatus struct {
@@ -96,6 +422,35 @@ type NodeStatus struct {
 	SSHActiveCount    int       `json:"ssh_active_count"`
 	CostTotal         float64   `json:"cost_total"`
 	UpdatedAt         time.Time `json:"updated_at"`
+
+	// OfflineSince 非空表示离线检测已判定节点离线（值为最后一次上报时间）
+	OfflineSince *time.Time `json:"offline_since,omitempty"`
+
+	// Health 为最近一次上报的硬件健康信号；HealthIssues 为未解除的健康问题（仅管理端节点列表填充）
+	Health       *NodeHealth      `json:"health,omitempty"`
+	HealthIssues []GPUHealthIssue `json:"health_issues,omitempty"`
+
+	// Maintenance 为最近一个未结束的维护窗口（仅管理端节点列表填充）；Drained 表示排空后已没有用户进程
+	Maintenance *NodeMaintenance `json:"maintenance,omitempty"`
+	Drained     bool             `json:"drained,omitempty"`
+}
+
+// NodeMaintenance 为节点维护窗口：DrainAt 起排空（拒绝新登录与分配、通知在线用户），StartAt 起进入维护，
+// EndAt 为空表示直到管理员结束。State 为 scheduled / draining / maintenance / ended（按查询时刻计算）。
+type NodeMaintenance struct {
+	ID         int64      `json:"id"`
+	NodeID     string     `json:"node_id"`
+	Reason     string     `json:"reason"`
+	DrainAt    time.Time  `json:"drain_at"`
+	StartAt    time.Time  `json:"start_at"`
+	EndAt      *time.Time `json:"end_at,omitempty"`
+	KickSSH    bool       `json:"kick_ssh"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	KickedAt   *time.Time `json:"kicked_at,omitempty"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	State      string     `json:"state"`
 }
 
 // UserNodeAccount 表示“节点本地账号”到“计费账号”的映射。
@@ -183,6 +538,7 @@ type PowerUser struct {
 
 type UsageUserSummary struct {
 	Username          string  `json:"username"`
+	Project           string  `json:"project,omitempty"` // 仅 by=project 时填充，空串表示未归属项目
 	UsageRecords      int     `json:"usage_records"`
 	GPUProcessRecords int     `json:"gpu_process_records"`
 	CPUProcessRecords int     `json:"cpu_process_records"`
@@ -194,6 +550,7 @@ type UsageUserSummary struct {
 type UsageMonthlySummary struct {
 	Month             string  `json:"month"`
 	Username          string  `json:"username"`
+	Project           string  `json:"project,omitempty"`
 	UsageRecords      int     `json:"usage_records"`
 	GPUProcessRecords int     `json:"gpu_process_records"`
 	CPUProcessRecords int     `json:"cpu_process_records"`
@@ -279,3 +636,150 @@ type PlatformUsageNodeDetail struct {
 	TotalCost       float64   `json:"total_cost"`
 	LastUsageAt     time.Time `json:"last_usage_at"`
 }
+
+// ResearchGroup 表示课题组（导师）账户：组员的用量可由组余额统一承担。
+type ResearchGroup struct {
+	GroupID         int        `json:"group_id"`
+	GroupName       string     `json:"group_name"`
+	AdvisorName     string     `json:"advisor_name"`
+	AdvisorUsername string     `json:"advisor_username"`
+	Balance         float64    `json:"balance"`
+	Status          string     `json:"status"`
+	BlockedAt       *time.Time `json:"blocked_at,omitempty"`
+	MemberCount     int        `json:"member_count"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type ResearchGroupMember struct {
+	GroupID      int       `json:"group_id"`
+	Username     string    `json:"username"`
+	MonthlyLimit *float64  `json:"monthly_limit,omitempty"` // 为空表示不限
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// GroupMemberSpend 为导师看板中单个组员在统计区间内的消费汇总。
+type GroupMemberSpend struct {
+	Username          string   `json:"username"`
+	RealName          string   `json:"real_name"`
+	MonthlyLimit      *float64 `json:"monthly_limit,omitempty"`
+	MonthSpent        float64  `json:"month_spent"`
+	UsageRecords      int      `json:"usage_records"`
+	GPUProcessRecords int      `json:"gpu_process_records"`
+	GroupCost         float64  `json:"group_cost"`
+	PersonalCost      float64  `json:"personal_cost"`
+}
+
+// UserSpendCap 为用户的消费上限配置；NodeID 为 "*" 时按所有节点合计。
+type UserSpendCap struct {
+	Username     string    `json:"username"`
+	NodeID       string    `json:"node_id"`
+	DailyLimit   *float64  `json:"daily_limit,omitempty"`   // 为空表示不限
+	MonthlyLimit *float64  `json:"monthly_limit,omitempty"` // 为空表示不限
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserSpendCapStatus 为用户查看自己的上限与当前消费。
+type UserSpendCapStatus struct {
+	UserSpendCap
+	DaySpent   float64 `json:"day_spent"`
+	MonthSpent float64 `json:"month_spent"`
+}
+
+// PolicyOverride 为按用户或课题组覆盖的计费策略；字段为空表示沿用上一级。
+type PolicyOverride struct {
+	Scope                  string    `json:"scope"`  // user / group
+	Target                 string    `json:"target"` // 计费账号或 group_id
+	WarningThreshold       *float64  `json:"warning_threshold,omitempty"`
+	LimitedThreshold       *float64  `json:"limited_threshold,omitempty"`
+	KillGracePeriodSeconds *int      `json:"kill_grace_period_seconds,omitempty"`
+	CPULimitPercentLimited *float64  `json:"cpu_limit_percent_limited,omitempty"`
+	CPULimitPercentBlocked *float64  `json:"cpu_limit_percent_blocked,omitempty"`
+	IdleGPUKillMinutes     *int      `json:"idle_gpu_kill_minutes,omitempty"`
+	Note                   string    `json:"note"`
+	CreatedBy              string    `json:"created_by"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// Project 为项目 / 成本中心：同一计费账号的费用可按项目拆分，项目可设月度预算（nil 表示不设）。
+type Project struct {
+	ProjectID     int       `json:"project_id"`
+	ProjectName   string    `json:"project_name"`
+	Description   string    `json:"description"`
+	MonthlyBudget *float64  `json:"monthly_budget"`
+	MonthSpend    float64   `json:"month_spend"`
+	Members       int       `json:"members"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type ProjectMember struct {
+	ProjectID int       `json:"project_id"`
+	Username  string    `json:"username"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProjectDefault 为节点本地账号的默认项目，NodeID 为 "*" 表示所有节点。
+type ProjectDefault struct {
+	NodeID        string    `json:"node_id"`
+	LocalUsername string    `json:"local_username"`
+	ProjectID     int       `json:"project_id"`
+	ProjectName   string    `json:"project_name"`
+	CreatedBy     string    `json:"created_by"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// IdleGPUHolder 为一个空闲占卡的进程。
+type IdleGPUHolder struct {
+	NodeID             string     `json:"node_id"`
+	PID                int32      `json:"pid"`
+	LocalUsername      string     `json:"local_username"`
+	Username           string     `json:"username"`
+	Command            string     `json:"command"`
+	GPUIDs             []int64    `json:"gpu_ids"`
+	MemoryMB           float64    `json:"memory_mb"`
+	UtilizationPercent float64    `json:"utilization_percent"`
+	IdleSince          time.Time  `json:"idle_since"`
+	LastSeen           time.Time  `json:"last_seen"`
+	IdleMinutes        int        `json:"idle_minutes"`
+	IdleCost           float64    `json:"idle_cost"`
+	NotifyLevel        int        `json:"notify_level"`
+	NotifiedAt         *time.Time `json:"notified_at"`
+	KillRequestedAt    *time.Time `json:"kill_requested_at"`
+}
+
+// IdleGPUExemption 为空闲占卡豁免：scope=user 时 target 为计费账号，scope=node 时为节点 ID。
+type IdleGPUExemption struct {
+	Scope     string     `json:"scope"`
+	Target    string     `json:"target"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// GPUReservation 为一次 GPU 预约：在 NodeID 上为 [StartAt, EndAt) 预订 GPUCount 张卡（GPUIDs 为分配到的卡号）。
+type GPUReservation struct {
+	ID         int64      `json:"id"`
+	NodeID     string     `json:"node_id"`
+	GPUModel   string     `json:"gpu_model"`
+	GPUCount   int        `json:"gpu_count"`
+	GPUIDs     []int64    `json:"gpu_ids"`
+	Username   string     `json:"username"`
+	GroupID    int        `json:"group_id"` // >0 表示为课题组预约，组员均为预约人
+	StartAt    time.Time  `json:"start_at"`
+	EndAt      time.Time  `json:"end_at"`
+	Purpose    string     `json:"purpose"`
+	Status     string     `json:"status"` // pending / approved / rejected / cancelled
+	ReviewNote string     `json:"review_note"`
+	ReviewedBy string     `json:"reviewed_by"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
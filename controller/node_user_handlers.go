@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 以下接口供节点 Agent 的本地 Unix socket 代理使用：Agent 通过 SO_PEERCRED 确认调用者 UID，
+// 再以 (node_id, local_username) 调用这里，由控制器映射到计费账号，调用者只能查询自己的数据。
+
+// resolveNodeUser 解析节点本地账号对应的计费账号；未绑定时按本地账号本身计费（与扣费逻辑一致）。
+func (s *Server) resolveNodeUser(c *gin.Context) (localUsername string, billingUsername string, bound bool, ok bool) {
+	nodeID := strings.TrimSpace(c.Query("node_id"))
+	localUsername = strings.TrimSpace(c.Query("local_username"))
+	if nodeID == "" || localUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node_id/local_username 不能为空"})
+		return "", "", false, false
+	}
+	ctx := c.Request.Context()
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		billingUsername, bound, err = s.store.ResolveBillingUsernameTx(ctx, tx, nodeID, localUsername)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", "", false, false
+	}
+	if !bound || strings.TrimSpace(billingUsername) == "" {
+		billingUsername = localUsername
+	}
+	return localUsername, billingUsername, bound, true
+}
+
+func (s *Server) handleNodeUserWhoami(c *gin.Context) {
+	local, billing, bound, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"local_username": local, "billing_username": billing, "bound": bound})
+}
+
+func (s *Server) handleNodeUserBalance(c *gin.Context) {
+	local, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	var u User
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		u, err = s.store.EnsureUserTx(ctx, tx, billing, s.cfg.DefaultBalance)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"local_username": local,
+		"username":       u.Username,
+		"balance":        u.Balance,
+		"status":         u.Status,
+	})
+}
+
+func (s *Server) handleNodeUserUsage(c *gin.Context) {
+	_, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	limit := parseLimit(c.Query("limit"), 200, 5000)
+	records, err := s.store.ListUsageByUser(c.Request.Context(), billing, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records})
+}
+
+func (s *Server) handleNodeUserQueue(c *gin.Context) {
+	_, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	items, entry := s.userQueueItems(c.Request.Context(), billing)
+	c.JSON(http.StatusOK, gin.H{"username": billing, "queue_length": s.queue.Len(), "items": items, "fair_share": entry})
+}
+
+func (s *Server) handleNodeUserGPURequest(c *gin.Context) {
+	_, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	var req userGPURequestReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.enqueueGPURequest(c, billing, req.GPUType, req.Count, req.Preemptible, true)
+}
+
+func (s *Server) handleNodeUserGPUCancel(c *gin.Context) {
+	_, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	s.cancelGPURequest(c, billing)
+}
+
+type nodeUserBindReq struct {
+	BillingUsername string `json:"billing_username"`
+	Message         string `json:"message"`
+}
+
+// handleNodeUserBind 为调用者的本地账号提交绑定登记；node_id/local_username 由 Agent 按对端 UID 填写，不可伪造。
+func (s *Server) handleNodeUserBind(c *gin.Context) {
+	var req nodeUserBindReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	nodeID := strings.TrimSpace(c.Query("node_id"))
+	localUsername := strings.TrimSpace(c.Query("local_username"))
+	billing := strings.TrimSpace(req.BillingUsername)
+	if nodeID == "" || localUsername == "" || billing == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "billing_username/node_id/local_username 不能为空"})
+		return
+	}
+	ctx := c.Request.Context()
+	var id int
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		id, err = s.store.CreateUserRequestTx(ctx, tx, "bind", billing, nodeID, localUsername, strings.TrimSpace(req.Message))
+		return err
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "request_ids": []int{id}})
+}
+
+// guardPublicUserQuery 在 lock_public_user_query 开启后保护 /api/users/:username/*：
+// 仅允许管理员（Bearer admin_token 或管理员会话）或本人登录会话访问，其余调用请走节点本地 socket。
+func (s *Server) guardPublicUserQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.cfg.LockPublicUserQuery {
+			c.Next()
+			return
+		}
+		auth := strings.TrimSpace(c.GetHeader("Authorization"))
+		const prefix = "Bearer "
+		if strings.HasPrefix(auth, prefix) && strings.TrimSpace(strings.TrimPrefix(auth, prefix)) == s.cfg.AdminToken {
+			c.Next()
+			return
+		}
+		if s.cfg.SessionHours > 0 {
+			if cookie, err := c.Cookie(sessionCookieName); err == nil && strings.TrimSpace(cookie) != "" {
+				p, err := verifySession(strings.TrimSpace(s.cfg.AuthSecret), cookie, time.Now())
+				if err == nil && (p.Role == "admin" || p.Username == strings.TrimSpace(c.Param("username"))) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized：请在节点上使用 gpuops（本地 socket）或登录 Web 查询"})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNodeMissedIntervals = 3
+	defaultNodeWatchCheck      = 30 * time.Second
+)
+
+func (c NodeWatchConfig) Validate() error {
+	if c.MissedIntervals < 0 || c.MissedIntervals > 100 {
+		return errors.New("node_watch.missed_intervals 必须在 [0, 100] 范围内")
+	}
+	if c.CheckSeconds < 0 || c.CheckSeconds > 3600 {
+		return errors.New("node_watch.check_seconds 必须在 [0, 3600] 范围内")
+	}
+	for _, e := range c.AlertEmails {
+		if !strings.Contains(e, "@") {
+			return fmt.Errorf("node_watch.alert_emails 含非法邮箱：%q", e)
+		}
+	}
+	if u := strings.TrimSpace(c.WebhookURL); u != "" {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("node_watch.webhook_url 必须是 http(s) 地址")
+		}
+	}
+	return nil
+}
+
+func (c NodeWatchConfig) missedIntervals() int {
+	if c.MissedIntervals > 0 {
+		return c.MissedIntervals
+	}
+	return defaultNodeMissedIntervals
+}
+
+func (c NodeWatchConfig) checkEvery() time.Duration {
+	if c.CheckSeconds > 0 {
+		return time.Duration(c.CheckSeconds) * time.Second
+	}
+	return defaultNodeWatchCheck
+}
+
+// NodeOffline 判断节点自 lastSeen 起是否已连续 missed 个上报周期未上报。
+func NodeOffline(lastSeen time.Time, intervalSeconds int, missed int, now time.Time) bool {
+	if intervalSeconds <= 0 {
+		intervalSeconds = 60
+	}
+	if missed <= 0 {
+		missed = defaultNodeMissedIntervals
+	}
+	return now.Sub(lastSeen) > time.Duration(missed*intervalSeconds)*time.Second
+}
+
+// NodeStatusAlert 生成上下线告警的标题与正文。
+func NodeStatusAlert(ev NodeStatusEvent) (string, string) {
+	if ev.Status == "online" {
+		return fmt.Sprintf("HIT-AIOT-OPS 节点 %s 已恢复上报", ev.NodeID),
+			fmt.Sprintf("节点 %s 于 %s 恢复上报，本次离线约 %s。",
+				ev.NodeID, ev.LastSeenAt.Format("2006-01-02 15:04:05"), formatSeconds(ev.OfflineSeconds))
+	}
+	return fmt.Sprintf("HIT-AIOT-OPS 节点 %s 离线", ev.NodeID),
+		fmt.Sprintf("节点 %s 自 %s 起未再上报（检测时间 %s），请检查节点 Agent、网络与电源。",
+			ev.NodeID, ev.LastSeenAt.Format("2006-01-02 15:04:05"), ev.CreatedAt.Format("2006-01-02 15:04:05"))
+}
+
+func formatSeconds(sec int64) string {
+	d := time.Duration(sec) * time.Second
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%d 小时 %d 分钟", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%d 秒", sec)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runNodeWatcher 周期检查节点上报情况，把超过 missed_intervals 个周期未上报的节点标记为离线并告警。
+// 上线（恢复上报）在 processMetrics 中处理。
+func (s *Server) runNodeWatcher(ctx context.Context) {
+	s.refreshNodeUpMetrics(ctx)
+	ticker := time.NewTicker(s.cfg.NodeWatch.checkEvery())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.checkOfflineNodes(ctx, time.Now())
+	}
+}
+
+func (s *Server) checkOfflineNodes(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	events, err := s.store.DetectOfflineNodes(ctx, now, s.cfg.NodeWatch.missedIntervals())
+	if err != nil {
+		log.Printf("节点离线检测失败：%v", err)
+		return
+	}
+	for _, ev := range events {
+		log.Printf("节点离线：node=%s last_seen=%s maintenance=%v", ev.NodeID, ev.LastSeenAt.Format(time.RFC3339), ev.InMaintenance)
+		s.metr.observeNodeEvent(ev)
+		if !ev.InMaintenance {
+			go s.sendNodeStatusAlert(ev)
+		}
+	}
+}
+
+// refreshNodeUpMetrics 启动时按数据库中的离线标记初始化各节点的在线指标。
+func (s *Server) refreshNodeUpMetrics(ctx context.Context) {
+	nodes, err := s.store.ListNodes(ctx, 2000)
+	if err != nil {
+		log.Printf("节点离线检测：读取节点列表失败：%v", err)
+		return
+	}
+	for _, n := range nodes {
+		s.metr.setNodeUp(n.NodeID, n.OfflineSince == nil)
+	}
+}
+
+// sendNodeStatusAlert 发送节点上下线告警。
+func (s *Server) sendNodeStatusAlert(ev NodeStatusEvent) {
+	subject, body := NodeStatusAlert(ev)
+	s.sendAdminAlert("node_"+ev.Status, subject, body, gin.H{
+		"node_id":         ev.NodeID,
+		"last_seen_at":    ev.LastSeenAt,
+		"offline_seconds": ev.OfflineSeconds,
+		"detected_at":     ev.CreatedAt,
+	})
+}
+
+// sendAdminAlert 把告警发送到 node_watch.alert_emails 与 webhook_url（POST JSON：event、title、message 与 fields）。
+func (s *Server) sendAdminAlert(event string, subject string, body string, fields gin.H) {
+	cfg := s.cfg.NodeWatch
+	if len(cfg.AlertEmails) == 0 && strings.TrimSpace(cfg.WebhookURL) == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if len(cfg.AlertEmails) > 0 {
+		settings, err := s.store.GetMailSettings(ctx, s.cfg)
+		if err != nil {
+			log.Printf("告警 %s：读取邮件配置失败：%v", event, err)
+		} else {
+			for _, to := range cfg.AlertEmails {
+				if err := sendResetPasswordMail(settings, to, subject, body+"\n\nHIT-AIOT-OPS团队"); err != nil {
+					log.Printf("告警 %s：发送给 %s 失败：%v", event, to, err)
+				}
+			}
+		}
+	}
+
+	if u := strings.TrimSpace(cfg.WebhookURL); u != "" {
+		payload := gin.H{"event": event, "title": subject, "message": body}
+		for k, v := range fields {
+			payload[k] = v
+		}
+		raw, _ := json.Marshal(payload)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(raw))
+		if err != nil {
+			log.Printf("告警 %s：构造 webhook 请求失败：%v", event, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("告警 %s：webhook 推送失败：%v", event, err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			log.Printf("告警 %s：webhook 返回 %s", event, resp.Status)
+		}
+	}
+}
+
+// handleAdminNodeEvents 返回节点上下线记录（默认近 7 天）。
+func (s *Server) handleAdminNodeEvents(c *gin.Context) {
+	from, to, err := parseStatsRange(c, 7)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := parseLimit(c.Query("limit"), 200, 5000)
+	rows, err := s.store.ListNodeStatusEvents(c.Request.Context(), c.Query("node_id"), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events":           rows,
+		"missed_intervals": s.cfg.NodeWatch.missedIntervals(),
+		"alerts_enabled":   len(s.cfg.NodeWatch.AlertEmails) > 0 || strings.TrimSpace(s.cfg.NodeWatch.WebhookURL) != "",
+	})
+}
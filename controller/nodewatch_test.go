@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeOfflineDetection(t *testing.T) {
+	last := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	if NodeOffline(last, 60, 3, last.Add(3*time.Minute)) {
+		t.Fatalf("exactly 3 missed intervals should still be online")
+	}
+	if !NodeOffline(last, 60, 3, last.Add(3*time.Minute+time.Second)) {
+		t.Fatalf("should be offline after 3 missed intervals")
+	}
+	if NodeOffline(last, 0, 0, last.Add(2*time.Minute)) || !NodeOffline(last, 0, 0, last.Add(4*time.Minute)) {
+		t.Fatalf("defaults (60s x 3) mismatch")
+	}
+	subject, body := NodeStatusAlert(NodeStatusEvent{NodeID: "60000", Status: "online", LastSeenAt: last, OfflineSeconds: 3900})
+	if !strings.Contains(subject, "恢复") || !strings.Contains(body, "1 小时 5 分钟") {
+		t.Fatalf("online alert: %s / %s", subject, body)
+	}
+	if subject, _ := NodeStatusAlert(NodeStatusEvent{NodeID: "60000", Status: "offline", LastSeenAt: last}); !strings.Contains(subject, "离线") {
+		t.Fatalf("offline alert: %s", subject)
+	}
+	if err := (NodeWatchConfig{WebhookURL: "ftp://x"}).Validate(); err == nil {
+		t.Fatalf("non-http webhook should be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// BillingPolicy 为某个用户最终生效的计费策略：全局配置 → 课题组覆盖 → 用户覆盖。
+type BillingPolicy struct {
+	WarningThreshold       float64 `json:"warning_threshold"`
+	LimitedThreshold       float64 `json:"limited_threshold"`
+	KillGracePeriodSeconds int     `json:"kill_grace_period_seconds"`
+	CPULimitPercentLimited float64 `json:"cpu_limit_percent_limited"`
+	CPULimitPercentBlocked float64 `json:"cpu_limit_percent_blocked"`
+	IdleGPUKillMinutes     int     `json:"idle_gpu_kill_minutes"`
+}
+
+func DefaultBillingPolicy(cfg Config) BillingPolicy {
+	return BillingPolicy{
+		WarningThreshold:       cfg.WarningThreshold,
+		LimitedThreshold:       cfg.LimitedThreshold,
+		KillGracePeriodSeconds: cfg.KillGracePeriodSeconds,
+		CPULimitPercentLimited: cfg.CPULimitPercentLimited,
+		CPULimitPercentBlocked: cfg.CPULimitPercentBlocked,
+		IdleGPUKillMinutes:     cfg.IdleGPU.KillMinutes,
+	}
+}
+
+// Override 叠加一层覆盖；叠加后不合法（如 limited >= warning）时忽略该层，沿用上一级。
+func (p BillingPolicy) Override(o PolicyOverride) BillingPolicy {
+	next := p.merge(o)
+	if next.Validate() != nil {
+		return p
+	}
+	return next
+}
+
+func (p BillingPolicy) merge(o PolicyOverride) BillingPolicy {
+	next := p
+	if o.WarningThreshold != nil {
+		next.WarningThreshold = *o.WarningThreshold
+	}
+	if o.LimitedThreshold != nil {
+		next.LimitedThreshold = *o.LimitedThreshold
+	}
+	if o.KillGracePeriodSeconds != nil {
+		next.KillGracePeriodSeconds = *o.KillGracePeriodSeconds
+	}
+	if o.CPULimitPercentLimited != nil {
+		next.CPULimitPercentLimited = *o.CPULimitPercentLimited
+	}
+	if o.CPULimitPercentBlocked != nil {
+		next.CPULimitPercentBlocked = *o.CPULimitPercentBlocked
+	}
+	if o.IdleGPUKillMinutes != nil {
+		next.IdleGPUKillMinutes = *o.IdleGPUKillMinutes
+	}
+	return next
+}
+
+// Validate 与 Config.Validate 中对应字段的约束保持一致。
+func (p BillingPolicy) Validate() error {
+	if p.WarningThreshold <= 0 {
+		return errors.New("warning_threshold 必须为正数")
+	}
+	if p.LimitedThreshold < 0 || p.LimitedThreshold >= p.WarningThreshold {
+		return errors.New("limited_threshold 必须在 [0, warning_threshold) 范围内")
+	}
+	if p.KillGracePeriodSeconds < 0 {
+		return errors.New("kill_grace_period_seconds 不能为负数")
+	}
+	if p.CPULimitPercentLimited < 1 || p.CPULimitPercentLimited > 100 {
+		return errors.New("cpu_limit_percent_limited 必须在 [1, 100] 范围内")
+	}
+	if p.CPULimitPercentBlocked < 1 || p.CPULimitPercentBlocked > 100 {
+		return errors.New("cpu_limit_percent_blocked 必须在 [1, 100] 范围内")
+	}
+	if p.IdleGPUKillMinutes < 0 {
+		return errors.New("idle_gpu_kill_minutes 不能为负数")
+	}
+	return nil
+}
+
+func (p BillingPolicy) KillGrace() time.Duration {
+	return time.Duration(p.KillGracePeriodSeconds) * time.Second
+}
+
+// WithBalanceThresholds 在状态由另一份余额（课题组余额）判定时，改用该余额策略的阈值与宽限期，
+// 保证 DecideActions 与扣费时计算状态的口径一致；CPU 限制等其余字段保留本策略。
+func (p BillingPolicy) WithBalanceThresholds(b BillingPolicy) BillingPolicy {
+	p.WarningThreshold = b.WarningThreshold
+	p.LimitedThreshold = b.LimitedThreshold
+	p.KillGracePeriodSeconds = b.KillGracePeriodSeconds
+	return p
+}
+
+// ApplyTo 返回套用本策略阈值后的配置副本，供扣费/充值按用户阈值计算状态。
+func (p BillingPolicy) ApplyTo(cfg Config) Config {
+	cfg.WarningThreshold = p.WarningThreshold
+	cfg.LimitedThreshold = p.LimitedThreshold
+	cfg.KillGracePeriodSeconds = p.KillGracePeriodSeconds
+	cfg.CPULimitPercentLimited = p.CPULimitPercentLimited
+	cfg.CPULimitPercentBlocked = p.CPULimitPercentBlocked
+	cfg.IdleGPU.KillMinutes = p.IdleGPUKillMinutes
+	return cfg
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type policyOverrideReq struct {
+	Scope                  string   `json:"scope"`  // user / group
+	Target                 string   `json:"target"` // 计费账号或 group_id
+	WarningThreshold       *float64 `json:"warning_threshold"`
+	LimitedThreshold       *float64 `json:"limited_threshold"`
+	KillGracePeriodSeconds *int     `json:"kill_grace_period_seconds"`
+	CPULimitPercentLimited *float64 `json:"cpu_limit_percent_limited"`
+	CPULimitPercentBlocked *float64 `json:"cpu_limit_percent_blocked"`
+	IdleGPUKillMinutes     *int     `json:"idle_gpu_kill_minutes"`
+	Note                   string   `json:"note"`
+}
+
+func (s *Server) handleAdminPoliciesList(c *gin.Context) {
+	limit := parseLimit(c.Query("limit"), 1000, 5000)
+	rows, err := s.store.ListPolicyOverrides(c.Request.Context(), c.Query("scope"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"defaults":  DefaultBillingPolicy(s.cfg),
+		"overrides": rows,
+	})
+}
+
+func (s *Server) handleAdminPolicyUpsert(c *gin.Context) {
+	var req policyOverrideReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := PolicyOverride{
+		Scope:                  req.Scope,
+		Target:                 req.Target,
+		WarningThreshold:       req.WarningThreshold,
+		LimitedThreshold:       req.LimitedThreshold,
+		KillGracePeriodSeconds: req.KillGracePeriodSeconds,
+		CPULimitPercentLimited: req.CPULimitPercentLimited,
+		CPULimitPercentBlocked: req.CPULimitPercentBlocked,
+		IdleGPUKillMinutes:     req.IdleGPUKillMinutes,
+		Note:                   req.Note,
+	}
+	if err := s.store.UpsertPolicyOverride(c.Request.Context(), in, s.currentOperator(c), s.cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminPolicyDelete(c *gin.Context) {
+	if err := s.store.DeletePolicyOverride(c.Request.Context(), c.Query("scope"), c.Query("target")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// handleAdminPolicyEffective 返回某个计费账号叠加课题组/用户覆盖后最终生效的策略。
+func (s *Server) handleAdminPolicyEffective(c *gin.Context) {
+	username := strings.TrimSpace(c.Query("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username 不能为空"})
+		return
+	}
+	ctx := c.Request.Context()
+	var policy BillingPolicy
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		policy, err = s.store.ResolveUserPolicyTx(ctx, tx, username, s.cfg)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"username": username, "policy": policy})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBillingPolicy_OverrideOrderAndInvalidFallback(t *testing.T) {
+	base := BillingPolicy{WarningThreshold: 100, LimitedThreshold: 10, KillGracePeriodSeconds: 300, CPULimitPercentLimited: 50, CPULimitPercentBlocked: 10}
+	grace := 3600
+	groupWarning := 500.0
+	p := base.Override(PolicyOverride{Scope: "group", WarningThreshold: &groupWarning})
+	p = p.Override(PolicyOverride{Scope: "user", KillGracePeriodSeconds: &grace})
+	if p.WarningThreshold != 500 || p.KillGracePeriodSeconds != 3600 || p.LimitedThreshold != 10 {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+
+	// limited >= warning 不合法，整层忽略
+	badLimited := 600.0
+	if got := p.Override(PolicyOverride{Scope: "user", LimitedThreshold: &badLimited}); got != p {
+		t.Fatalf("invalid override should be ignored, got %+v", got)
+	}
+}
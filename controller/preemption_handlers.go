@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// preemptionDedupWindow 内已下发抢占的 PID 不再重复抢占（kill 信号阶梯执行期间进程可能仍出现在上报中）。
+const preemptionDedupWindow = 10 * time.Minute
+
+// preemptScavengersTx 在普通排队请求缺卡时抢占本节点型号匹配的 scavenger 进程：
+// 需求为排在队列中、型号匹配本节点的已认证普通请求卡数，减去已为其抢占的卡数与全局空闲卡数；
+// 按 SelectPreemptionVictims 选卡，向受影响用户下发 notify 与 kill_process 并记录抢占。
+func (s *Server) preemptScavengersTx(ctx context.Context, tx *sql.Tx, nodeID string, nodeModel string, now time.Time, samples []gpuProcSample) ([]Action, error) {
+	if !s.cfg.Scavenger.Enabled || len(samples) == 0 {
+		return nil, nil
+	}
+	// 只读缓存：上报事务内不做 usage_records 统计查询；型号统计尚未缓存时无法判断空闲卡，不抢占
+	items, stats, ok := s.cachedRankedQueue()
+	if !ok {
+		return nil, nil
+	}
+	s.preemptMu.Lock()
+	defer s.preemptMu.Unlock()
+	// 清理已离开队列的排队项
+	live := make(map[int64]bool, len(items))
+	for _, it := range items {
+		live[it.ID] = true
+	}
+	for id := range s.preemptCredits {
+		if !live[id] {
+			delete(s.preemptCredits, id)
+		}
+	}
+	ordered := make([]QueueItem, 0, len(items))
+	for _, it := range items {
+		ordered = append(ordered, it.QueueItem)
+	}
+	queue, need := PreemptionDemand(ordered, nodeModel, s.preemptCredits)
+	if need <= 0 {
+		return nil, nil
+	}
+	for _, st := range stats {
+		if gpuModelMatches(st.Model, nodeModel) {
+			need -= st.TotalGPUs - st.BusyGPUs
+		}
+	}
+	if need <= 0 {
+		return nil, nil
+	}
+
+	skip, err := s.store.RecentPreemptedPIDsTx(ctx, tx, nodeID, now.Add(-preemptionDedupWindow))
+	if err != nil {
+		return nil, err
+	}
+	// 健康检查异常的卡腾出来也无法使用；节点级异常时不抢占
+	issues, err := s.store.OpenGPUHealthIssuesTx(ctx, tx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	unhealthy, nodeUnhealthy := UnhealthyGPUs(issues)
+	if nodeUnhealthy {
+		return nil, nil
+	}
+	exclude := make(map[int32]bool, len(unhealthy))
+	for id := range unhealthy {
+		exclude[int32(id)] = true
+	}
+	procs := make([]UserProcess, 0, len(samples))
+	locals := make(map[int32]string, len(samples))
+	for _, p := range samples {
+		procs = append(procs, p.proc)
+		locals[p.proc.PID] = p.local
+	}
+	gpus, victims := SelectPreemptionVictims(procs, need, skip, exclude)
+	if len(gpus) == 0 {
+		return nil, nil
+	}
+	// 按队列顺序把腾出的卡记到排队项上
+	beneficiary := queue[0].Item
+	freed := len(gpus)
+	for _, w := range queue {
+		if freed <= 0 {
+			break
+		}
+		n := min(freed, w.Need)
+		s.preemptCredits[w.Item.ID] += n
+		freed -= n
+	}
+
+	var actions []Action
+	for _, v := range victims {
+		reason := fmt.Sprintf("节点 %s 的 GPU %s 被普通优先级排队请求抢占（scavenger 档）", nodeID, formatGPUIDs(procGPUIDs(v)))
+		acts, err := s.recordPreemptionTx(ctx, tx, GPUPreemption{
+			NodeID:        nodeID,
+			LocalUsername: locals[v.PID],
+			Username:      v.Username,
+			PID:           v.PID,
+			GPUIDs:        procGPUIDs(v),
+			Command:       v.Command,
+			Reason:        "queue",
+			QueueItemID:   beneficiary.ID,
+			Beneficiary:   beneficiary.Username,
+			CreatedAt:     now,
+		}, reason)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, acts...)
+	}
+	return actions, nil
+}
+
+// recordPreemptionTx 记录一次抢占并返回下发给受影响本地账号的 notify 与 kill_process。
+func (s *Server) recordPreemptionTx(ctx context.Context, tx *sql.Tx, p GPUPreemption, reason string) ([]Action, error) {
+	if err := s.store.InsertPreemptionTx(ctx, tx, p); err != nil {
+		return nil, err
+	}
+	return []Action{
+		{Type: "kill_process", Username: p.LocalUsername, PIDs: []int32{p.PID}, Reason: reason, KillLadder: s.cfg.KillSignalLadder},
+		{Type: "notify", Username: p.LocalUsername, Message: reason + "，进程 " + fmt.Sprint(p.PID) + " 将被终止；可在抢占记录中查看"},
+	}, nil
+}
+
+func procGPUIDs(proc UserProcess) []int64 {
+	out := make([]int64, 0, len(proc.GPUUsage))
+	for _, g := range proc.GPUUsage {
+		out = append(out, int64(g.GPUID))
+	}
+	return out
+}
+
+func (s *Server) handleUserMyPreemptions(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	s.respondPreemptions(c, username, "")
+}
+
+func (s *Server) handleAdminPreemptions(c *gin.Context) {
+	s.respondPreemptions(c, c.Query("username"), c.Query("node_id"))
+}
+
+func (s *Server) handleNodeUserPreemptions(c *gin.Context) {
+	_, billing, _, ok := s.resolveNodeUser(c)
+	if !ok {
+		return
+	}
+	s.respondPreemptions(c, billing, "")
+}
+
+// respondPreemptions 返回时间段内（默认近 30 天）的抢占记录。
+func (s *Server) respondPreemptions(c *gin.Context, username string, nodeID string) {
+	from, to, err := parseStatsRange(c, 30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := parseLimit(c.Query("limit"), 200, 2000)
+	rows, err := s.store.ListPreemptions(c.Request.Context(), username, nodeID, from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preemptions": rows})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type projectReq struct {
+	ProjectName   string   `json:"project_name"`
+	Description   string   `json:"description"`
+	MonthlyBudget *float64 `json:"monthly_budget"`
+}
+
+type projectMemberReq struct {
+	Username string `json:"username"`
+}
+
+type projectDefaultReq struct {
+	NodeID        string `json:"node_id"`
+	LocalUsername string `json:"local_username"`
+	ProjectID     int    `json:"project_id"`
+}
+
+func parseProjectID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimSpace(c.Param("id")))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id 不合法"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleAdminProjectsList(c *gin.Context) {
+	rows, err := s.store.ListProjects(c.Request.Context(), startOfMonth(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": rows})
+}
+
+func (s *Server) handleAdminProjectCreate(c *gin.Context) {
+	var req projectReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := s.store.CreateProject(c.Request.Context(), req.ProjectName, req.Description, req.MonthlyBudget)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "project_id": id})
+}
+
+func (s *Server) handleAdminProjectUpdate(c *gin.Context) {
+	id, ok := parseProjectID(c)
+	if !ok {
+		return
+	}
+	var req projectReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.UpdateProject(c.Request.Context(), id, req.ProjectName, req.Description, req.MonthlyBudget); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminProjectDelete(c *gin.Context) {
+	id, ok := parseProjectID(c)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteProject(c.Request.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminProjectMembersList(c *gin.Context) {
+	id, ok := parseProjectID(c)
+	if !ok {
+		return
+	}
+	rows, err := s.store.ListProjectMembers(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": rows})
+}
+
+func (s *Server) handleAdminProjectMemberAdd(c *gin.Context) {
+	id, ok := parseProjectID(c)
+	if !ok {
+		return
+	}
+	var req projectMemberReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.AddProjectMember(c.Request.Context(), id, req.Username, s.currentOperator(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminProjectMemberDelete(c *gin.Context) {
+	id, ok := parseProjectID(c)
+	if !ok {
+		return
+	}
+	username := strings.TrimSpace(c.Param("username"))
+	if err := s.store.RemoveProjectMember(c.Request.Context(), id, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminProjectDefaultsList(c *gin.Context) {
+	rows, err := s.store.ListProjectDefaults(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"defaults": rows})
+}
+
+// handleAdminProjectDefaultUpsert 设置节点本地账号的默认项目（进程未标注 GPUOPS_PROJECT 时使用）。
+func (s *Server) handleAdminProjectDefaultUpsert(c *gin.Context) {
+	var req projectDefaultReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.UpsertProjectDefault(c.Request.Context(), req.NodeID, req.LocalUsername, req.ProjectID, s.currentOperator(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminProjectDefaultDelete(c *gin.Context) {
+	nodeID := strings.TrimSpace(c.Query("node_id"))
+	localUsername := strings.TrimSpace(c.Query("local_username"))
+	if err := s.store.DeleteProjectDefault(c.Request.Context(), nodeID, localUsername); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// handleUserMyProjects 返回当前用户所属的项目及各项目本月费用、预算。
+func (s *Server) handleUserMyProjects(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	rows, err := s.store.ListProjectsByMember(c.Request.Context(), username, startOfMonth(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": rows})
+}
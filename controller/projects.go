@@ -0,0 +1,18 @@
+package main
+
+import (
+	"regexp"
+)
+
+// projectTagKey 为进程标注所属项目的环境变量；Agent 需在 PROCESS_ENV_TAGS 中包含该变量（默认已包含）。
+const projectTagKey = "GPUOPS_PROJECT"
+
+var projectNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ProjectBudgetCrossed 判断本次上报是否使项目月度费用越过预算（before < budget <= after），用于只提醒一次。
+func ProjectBudgetCrossed(before float64, after float64, budget *float64) bool {
+	if budget == nil || *budget <= 0 {
+		return false
+	}
+	return before < *budget && after >= *budget
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProjectBudgetCrossed(t *testing.T) {
+	budget := 100.0
+	if !ProjectBudgetCrossed(99, 100, &budget) || !ProjectBudgetCrossed(90, 120, &budget) {
+		t.Fatalf("crossing budget should be reported")
+	}
+	if ProjectBudgetCrossed(100, 110, &budget) || ProjectBudgetCrossed(50, 60, &budget) {
+		t.Fatalf("only the report that crosses the budget should be reported")
+	}
+	if ProjectBudgetCrossed(0, 1000, nil) {
+		t.Fatalf("nil budget means unlimited")
+	}
+}
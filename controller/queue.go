@@ -6,28 +6,83 @@ import (
 )
 
 // QueueItem 表示一次 GPU 申请请求。
-// 当前实现仅支持排队记录（不做真实分配），用于后续扩展 findAvailableGPU 等策略。
+// 当前实现仅支持排队记录（不做真实分配）：计费账号在匹配型号上启动新的 GPU 进程时视为已取到卡并移出队列。
 type QueueItem struct {
+	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
 	GPUType   string    `json:"gpu_type"`
 	Count     int       `json:"count"`
 	Timestamp time.Time `json:"timestamp"`
+	// Preemptible 为可抢占请求：排在所有普通请求之后，也不会为它抢占 scavenger 进程
+	Preemptible bool `json:"preemptible"`
+	// Verified 表示提交者已认证（登录用户或节点本地 socket）；匿名接口提交的请求只排队，不触发抢占
+	Verified bool `json:"verified"`
+
+	// predicted 为提交时的等待预估，取到卡时与实际等待对比（见 /metrics）
+	predicted *WaitEstimate
 }
 
 type Queue struct {
-	mu    sync.Mutex
-	items []QueueItem
+	mu     sync.Mutex
+	items  []QueueItem
+	nextID int64
 }
 
 func NewQueue() *Queue {
 	return &Queue{items: make([]QueueItem, 0)}
 }
 
-func (q *Queue) Enqueue(item QueueItem) int {
+// Enqueue 追加排队项并分配 ID，返回排队位置（从 1 开始）。
+func (q *Queue) Enqueue(item QueueItem) (int64, int) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	q.nextID++
+	item.ID = q.nextID
 	q.items = append(q.items, item)
-	return len(q.items)
+	return item.ID, len(q.items)
+}
+
+// Cancel 取消 username 自己的排队项；username 为空表示不校验归属（管理员）。
+func (q *Queue) Cancel(id int64, username string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.ID != id {
+			continue
+		}
+		if username != "" && it.Username != username {
+			return false
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// SetPrediction 记录排队项提交时的等待预估。
+func (q *Queue) SetPrediction(id int64, est WaitEstimate) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.items {
+		if q.items[i].ID == id {
+			q.items[i].predicted = &est
+			return
+		}
+	}
+}
+
+// Fulfill 在计费账号启动了 gpuModel 型号上的新 GPU 进程时，移除其最早一条型号匹配的排队项并返回。
+func (q *Queue) Fulfill(username string, gpuModel string) (QueueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.Username != username || !gpuModelMatches(gpuModel, it.GPUType) {
+			continue
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		return it, true
+	}
+	return QueueItem{}, false
 }
 
 func (q *Queue) Snapshot() []QueueItem {
@@ -43,11 +98,3 @@ func (q *Queue) Len() int {
 	defer q.mu.Unlock()
 	return len(q.items)
 }
-
-func estimateWaitMinutes(position int) int {
-	// 简单估算：每个排队项按 10 分钟计算。后续可改成基于历史分配/作业时长的预测。
-	if position <= 0 {
-		return 0
-	}
-	return position * 10
-}
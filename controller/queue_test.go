@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestQueueFulfill(t *testing.T) {
+	q := NewQueue()
+	q.Enqueue(QueueItem{Username: "alice", GPUType: "A100", Count: 1})
+	id, _ := q.Enqueue(QueueItem{Username: "alice", GPUType: "rtx3090", Count: 1})
+	q.SetPrediction(id, WaitEstimate{ExpectedMinutes: 10})
+	it, ok := q.Fulfill("alice", "NVIDIA GeForce RTX 3090")
+	if !ok || it.ID != id || it.predicted == nil || q.Len() != 1 {
+		t.Fatalf("fulfill mismatch: %+v ok=%v len=%d", it, ok, q.Len())
+	}
+	if _, ok := q.Fulfill("bob", "NVIDIA A100-SXM4-80GB"); ok {
+		t.Fatalf("other users should not fulfill alice's request")
+	}
+}
@@ -30,6 +30,17 @@ func (s *Server) handleRegistryResolve(c *gin.Context) {
 		return
 	}
 
+	// 排空 / 维护中的节点拒绝新登录（豁免账号除外，便于管理员运维）
+	m, err := s.store.GetBlockingMaintenance(ctx, nodeID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if m != nil {
+		c.JSON(http.StatusOK, gin.H{"registered": false, "maintenance": true, "state": m.State, "reason": m.Reason})
+		return
+	}
+
 	blacklisted, err := s.store.IsBlacklisted(ctx, nodeID, localUsername)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -74,6 +85,17 @@ func (s *Server) handleRegistryNodeUsersTxt(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "node_id 不能为空"})
 		return
 	}
+	// 排空 / 维护中返回空列表：控制器不可达时节点按缓存同样拒绝新登录
+	m, err := s.store.GetBlockingMaintenance(c.Request.Context(), nodeID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if m != nil {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.String(http.StatusOK, "")
+		return
+	}
 	users, err := s.store.ListAllowedLocalUsersByNode(c.Request.Context(), nodeID, 200000)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
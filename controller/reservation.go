@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReservationMaxHours     = 72
+	defaultReservationMaxDaysAhead = 30
+	defaultReservationKillGrace    = 5 * time.Minute
+)
+
+func (c ReservationConfig) Validate() error {
+	if c.MaxHours < 0 || c.MaxHours > 24*31 {
+		return errors.New("reservations.max_hours 必须在 [0, 744] 范围内")
+	}
+	if c.MaxDaysAhead < 0 || c.MaxDaysAhead > 366 {
+		return errors.New("reservations.max_days_ahead 必须在 [0, 366] 范围内")
+	}
+	if c.KillGraceSeconds < 0 || c.KillGraceSeconds > 3600 {
+		return errors.New("reservations.kill_grace_seconds 必须在 [0, 3600] 范围内")
+	}
+	return nil
+}
+
+func (c ReservationConfig) maxDuration() time.Duration {
+	if c.MaxHours > 0 {
+		return time.Duration(c.MaxHours) * time.Hour
+	}
+	return defaultReservationMaxHours * time.Hour
+}
+
+func (c ReservationConfig) maxAhead() time.Duration {
+	if c.MaxDaysAhead > 0 {
+		return time.Duration(c.MaxDaysAhead) * 24 * time.Hour
+	}
+	return defaultReservationMaxDaysAhead * 24 * time.Hour
+}
+
+func (c ReservationConfig) killGrace() time.Duration {
+	if c.KillGraceSeconds > 0 {
+		return time.Duration(c.KillGraceSeconds) * time.Second
+	}
+	return defaultReservationKillGrace
+}
+
+// ValidateReservationWindow 校验用户预约的时间窗：不能早于当前时间（允许 5 分钟误差）、不超过最长时长与最远提前天数。
+// 管理员代约不受时长与提前天数限制。
+func ValidateReservationWindow(start time.Time, end time.Time, now time.Time, cfg ReservationConfig) error {
+	if start.IsZero() || end.IsZero() {
+		return errors.New("start_at/end_at 不能为空")
+	}
+	if !end.After(start) {
+		return errors.New("end_at 必须晚于 start_at")
+	}
+	if start.Before(now.Add(-5 * time.Minute)) {
+		return errors.New("start_at 不能早于当前时间")
+	}
+	if end.Sub(start) > cfg.maxDuration() {
+		return fmt.Errorf("单次预约不能超过 %d 小时", int(cfg.maxDuration()/time.Hour))
+	}
+	if start.After(now.Add(cfg.maxAhead())) {
+		return fmt.Errorf("最多提前 %d 天预约", int(cfg.maxAhead()/(24*time.Hour)))
+	}
+	return nil
+}
+
+// AllocateReservationGPUs 从 [0, total) 中按卡号从小到大选出 count 张未被占用的卡；不足时返回 false。
+func AllocateReservationGPUs(total int, taken map[int64]bool, count int) ([]int64, bool) {
+	out := make([]int64, 0, count)
+	for i := 0; i < total && len(out) < count; i++ {
+		if !taken[int64(i)] {
+			out = append(out, int64(i))
+		}
+	}
+	return out, len(out) == count
+}
+
+// gpuModelMatches 判断节点型号是否满足预约型号（忽略大小写与空格的包含匹配，便于填写 "A100" 这类简称）。
+func gpuModelMatches(nodeModel string, want string) bool {
+	want = normalizeGPUModel(strings.TrimSpace(want))
+	return want == "" || strings.Contains(normalizeGPUModel(nodeModel), want)
+}
+
+// normalizeGPUIDs 去重并排序卡号，卡号必须在 [0, total) 内。
+func normalizeGPUIDs(ids []int64, total int) ([]int64, error) {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id < 0 || id >= int64(total) {
+			return nil, fmt.Errorf("gpu_ids 中的卡号 %d 超出节点卡数 %d", id, total)
+		}
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// reservedGPUsUsed 判断进程是否使用了预约中的某张卡（按 nvidia-smi index 匹配）。
+func reservedGPUsUsed(proc UserProcess, gpuIDs []int64) bool {
+	for _, g := range proc.GPUUsage {
+		for _, id := range gpuIDs {
+			if int64(g.GPUID) == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReservationHolder 判断计费账号是否为预约人：本人预约，或课题组预约的组员（groupMembers 为该组成员集合）。
+func ReservationHolder(r GPUReservation, username string, groupMembers map[string]bool) bool {
+	if username == r.Username {
+		return true
+	}
+	return r.GroupID > 0 && groupMembers[username]
+}
+
+func formatGPUIDs(ids []int64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, fmt.Sprintf("%d", id))
+	}
+	return strings.Join(parts, ",")
+}
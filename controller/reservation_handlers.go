@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type reservationReq struct {
+	NodeID   string  `json:"node_id"`
+	GPUModel string  `json:"gpu_model"`
+	GPUCount int     `json:"gpu_count"`
+	GPUIDs   []int64 `json:"gpu_ids"` // 仅管理员可指定卡号
+	GroupID  int     `json:"group_id"`
+	StartAt  string  `json:"start_at"`
+	EndAt    string  `json:"end_at"`
+	Purpose  string  `json:"purpose"`
+	Username string  `json:"username"` // 仅管理员代约时填写
+	Force    bool    `json:"force"`    // 仅管理员：覆盖冲突的预约
+}
+
+type reservationReviewReq struct {
+	Note  string `json:"note"`
+	Force bool   `json:"force"`
+}
+
+func parseReservationID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id 不合法"})
+		return 0, false
+	}
+	return id, true
+}
+
+// parseReservationWindow 解析预约起止时间并统一为本地时间（与 NOW() 写入的时间列一致）。
+func parseReservationWindow(req reservationReq) (time.Time, time.Time, error) {
+	start, err := parseTimeFlexible(req.StartAt)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("start_at 时间格式不合法，建议 RFC3339")
+	}
+	end, err := parseTimeFlexible(req.EndAt)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("end_at 时间格式不合法，建议 RFC3339")
+	}
+	return start.In(time.Local), end.In(time.Local), nil
+}
+
+// respondReservationError 把冲突错误映射为 409 并附带冲突的预约。
+func respondReservationError(c *gin.Context, err error) {
+	var conflict *ReservationConflictError
+	if errors.As(err, &conflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflict.Conflicts})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "预约不存在"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// handleUserReservationCreate 用户预约 GPU；为课题组预约时须是该组组员或导师。
+func (s *Server) handleUserReservationCreate(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	var req reservationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	now := time.Now()
+	start, end, err := parseReservationWindow(req)
+	if err == nil {
+		err = ValidateReservationWindow(start, end, now, s.cfg.Reservations)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.GroupID > 0 {
+		ok, err := s.canBookForGroup(ctx, username, req.GroupID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能为自己所在或指导的课题组预约"})
+			return
+		}
+	}
+	in := GPUReservation{
+		NodeID:   req.NodeID,
+		GPUModel: req.GPUModel,
+		GPUCount: req.GPUCount,
+		Username: username,
+		GroupID:  req.GroupID,
+		StartAt:  start,
+		EndAt:    end,
+		Purpose:  req.Purpose,
+	}
+	if s.cfg.Reservations.AutoApprove {
+		in.Status = "approved"
+	}
+	var out GPUReservation
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		out, _, err = s.store.CreateReservationTx(ctx, tx, in, false, "system", now)
+		return err
+	}); err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reservation": out})
+}
+
+func (s *Server) canBookForGroup(ctx context.Context, username string, groupID int) (bool, error) {
+	g, _, err := s.store.GetResearchGroupByMember(ctx, username)
+	if err == nil && g.GroupID == groupID {
+		return true, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	groups, err := s.store.ListResearchGroupsByAdvisor(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range groups {
+		if g.GroupID == groupID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// handleUserMyReservations 返回本人发起及所在课题组的预约（默认最近 7 天起）。
+func (s *Server) handleUserMyReservations(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	ctx := c.Request.Context()
+	groupID := 0
+	if g, _, err := s.store.GetResearchGroupByMember(ctx, username); err == nil {
+		groupID = g.GroupID
+	}
+	now := time.Now()
+	rows, err := s.store.ListReservations(ctx, "", username, groupID, nil, now.AddDate(0, 0, -7), now.AddDate(1, 0, 0), 500)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reservations": rows})
+}
+
+func (s *Server) handleUserReservationCancel(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+	if err := s.store.CancelReservation(c.Request.Context(), id, username, username, time.Now()); err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// handleReservationCalendar 返回时间段内待审批与已批准的预约，供排期查看（登录用户与管理员共用）。
+func (s *Server) handleReservationCalendar(c *gin.Context) {
+	from, to, err := parseReservationRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := s.store.ListReservations(c.Request.Context(), c.Query("node_id"), "", 0, []string{"pending", "approved"}, from, to, 2000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from.Format(time.RFC3339), "to": to.Format(time.RFC3339), "reservations": rows})
+}
+
+// parseReservationRange 解析 from/to，默认从今天起 14 天。
+func parseReservationRange(c *gin.Context) (time.Time, time.Time, error) {
+	from := startOfDay(time.Now())
+	to := from.AddDate(0, 0, 14)
+	if x := strings.TrimSpace(c.Query("from")); x != "" {
+		t, err := parseTimeFlexible(x)
+		if err != nil {
+			return from, to, errors.New("from 时间格式不合法")
+		}
+		from = t.In(time.Local)
+	}
+	if x := strings.TrimSpace(c.Query("to")); x != "" {
+		t, err := parseTimeFlexible(x)
+		if err != nil {
+			return from, to, errors.New("to 时间格式不合法")
+		}
+		to = t.In(time.Local)
+	}
+	if !to.After(from) {
+		return from, to, errors.New("to 必须晚于 from")
+	}
+	return from, to, nil
+}
+
+func (s *Server) handleAdminReservationsList(c *gin.Context) {
+	from, to, err := parseReservationRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var statuses []string
+	if v := strings.TrimSpace(c.Query("status")); v != "" {
+		statuses = strings.Split(v, ",")
+	}
+	limit := parseLimit(c.Query("limit"), 1000, 5000)
+	rows, err := s.store.ListReservations(c.Request.Context(), c.Query("node_id"), c.Query("username"), 0, statuses, from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reservations": rows})
+}
+
+// handleAdminReservationCreate 管理员代约：直接批准，可指定卡号；force 时覆盖（取消）冲突的预约。
+func (s *Server) handleAdminReservationCreate(c *gin.Context) {
+	var req reservationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end, err := parseReservationWindow(req)
+	if err == nil && !end.After(start) {
+		err = errors.New("end_at 必须晚于 start_at")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	operator := s.currentOperator(c)
+	in := GPUReservation{
+		NodeID:   req.NodeID,
+		GPUModel: req.GPUModel,
+		GPUCount: req.GPUCount,
+		GPUIDs:   req.GPUIDs,
+		Username: req.Username,
+		GroupID:  req.GroupID,
+		StartAt:  start,
+		EndAt:    end,
+		Purpose:  req.Purpose,
+		Status:   "approved",
+	}
+	var out GPUReservation
+	var overridden []GPUReservation
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		out, overridden, err = s.store.CreateReservationTx(ctx, tx, in, req.Force, operator, time.Now())
+		return err
+	}); err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reservation": out, "overridden": overridden})
+}
+
+func (s *Server) handleAdminReservationApprove(c *gin.Context) {
+	s.handleAdminReservationReview(c, true)
+}
+
+func (s *Server) handleAdminReservationReject(c *gin.Context) {
+	s.handleAdminReservationReview(c, false)
+}
+
+func (s *Server) handleAdminReservationReview(c *gin.Context, approve bool) {
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+	var req reservationReviewReq
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ctx := c.Request.Context()
+	var out GPUReservation
+	var overridden []GPUReservation
+	if err := s.store.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		out, overridden, err = s.store.ReviewReservationTx(ctx, tx, id, approve, req.Note, req.Force, s.currentOperator(c), time.Now())
+		return err
+	}); err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reservation": out, "overridden": overridden})
+}
+
+func (s *Server) handleAdminReservationCancel(c *gin.Context) {
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+	if err := s.store.CancelReservation(c.Request.Context(), id, "", s.currentOperator(c), time.Now()); err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// enforceReservationsTx 保护生效中的预约：预约卡上的非预约人进程首次发现时下发 notify，
+// 超过 kill_grace_seconds 仍在运行则下发一次 kill_process；scavenger 档进程直接抢占。
+func (s *Server) enforceReservationsTx(ctx context.Context, tx *sql.Tx, nodeID string, now time.Time, samples []gpuProcSample) ([]Action, error) {
+	active, err := s.store.ListActiveReservationsTx(ctx, tx, nodeID, now)
+	if err != nil {
+		return nil, err
+	}
+	var actions []Action
+	grace := s.cfg.Reservations.killGrace()
+	members := make(map[int]map[string]bool)
+	for _, r := range active {
+		if r.GroupID > 0 && members[r.GroupID] == nil {
+			set, err := s.store.ListResearchGroupMemberSetTx(ctx, tx, r.GroupID)
+			if err != nil {
+				return nil, err
+			}
+			members[r.GroupID] = set
+		}
+		for _, p := range samples {
+			if !reservedGPUsUsed(p.proc, r.GPUIDs) || ReservationHolder(r, p.proc.Username, members[r.GroupID]) {
+				continue
+			}
+			firstSeen, lastSeen, killed, err := s.store.UpsertReservationViolationTx(ctx, tx, r.ID, nodeID, p.proc.PID, p.local, p.proc.Username, now)
+			if err != nil {
+				return nil, err
+			}
+			if killed {
+				continue
+			}
+			desc := fmt.Sprintf("节点 %s 的 GPU %s 已被 %s 预约（%s ~ %s）", nodeID, formatGPUIDs(r.GPUIDs), r.Username,
+				r.StartAt.Format("01-02 15:04"), r.EndAt.Format("01-02 15:04"))
+			if s.cfg.Scavenger.Enabled && IsScavenger(p.proc) {
+				// scavenger 档进程不给宽限期，直接抢占
+				acts, err := s.recordPreemptionTx(ctx, tx, GPUPreemption{
+					NodeID:        nodeID,
+					LocalUsername: p.local,
+					Username:      p.proc.Username,
+					PID:           p.proc.PID,
+					GPUIDs:        procGPUIDs(p.proc),
+					Command:       p.proc.Command,
+					Reason:        "reservation",
+					ReservationID: r.ID,
+					Beneficiary:   r.Username,
+					CreatedAt:     now,
+				}, desc+"，scavenger 档进程被抢占")
+				if err != nil {
+					return nil, err
+				}
+				actions = append(actions, acts...)
+				if err := s.store.MarkReservationViolationKilledTx(ctx, tx, r.ID, p.proc.PID, now); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if lastSeen.Equal(firstSeen) {
+				actions = append(actions, Action{
+					Type:     "notify",
+					Username: p.local,
+					Message:  fmt.Sprintf("%s，请在 %d 分钟内结束进程 %d 或改用其他卡，否则将被终止", desc, int(grace/time.Minute), p.proc.PID),
+				})
+				continue
+			}
+			if lastSeen.Sub(firstSeen) < grace {
+				continue
+			}
+			reason := fmt.Sprintf("%s，进程 %d 占用预约卡超过宽限期，已终止", desc, p.proc.PID)
+			actions = append(actions,
+				Action{Type: "kill_process", Username: p.local, PIDs: []int32{p.proc.PID}, Reason: reason, KillLadder: s.cfg.KillSignalLadder},
+				Action{Type: "notify", Username: p.local, Message: reason},
+			)
+			if err := s.store.MarkReservationViolationKilledTx(ctx, tx, r.ID, p.proc.PID, now); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.store.ClearReservationViolationsTx(ctx, tx, nodeID, now); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidateReservationWindow(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	cfg := ReservationConfig{MaxHours: 24, MaxDaysAhead: 7}
+	if err := ValidateReservationWindow(now.Add(time.Hour), now.Add(5*time.Hour), now, cfg); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	cases := []struct {
+		start, end time.Time
+	}{
+		{now.Add(time.Hour), now.Add(time.Hour)},
+		{now.Add(-time.Hour), now.Add(time.Hour)},
+		{now, now.Add(25 * time.Hour)},
+		{now.AddDate(0, 0, 8), now.AddDate(0, 0, 8).Add(time.Hour)},
+	}
+	for i, c := range cases {
+		if ValidateReservationWindow(c.start, c.end, now, cfg) == nil {
+			t.Fatalf("case %d should fail", i)
+		}
+	}
+}
+
+func TestAllocateReservationGPUs(t *testing.T) {
+	ids, ok := AllocateReservationGPUs(4, map[int64]bool{0: true, 2: true}, 2)
+	if !ok || fmt.Sprint(ids) != "[1 3]" {
+		t.Fatalf("ids=%v ok=%v", ids, ok)
+	}
+	if _, ok := AllocateReservationGPUs(4, map[int64]bool{0: true, 2: true}, 3); ok {
+		t.Fatalf("should not allocate more than free GPUs")
+	}
+	if _, err := normalizeGPUIDs([]int64{3, 1, 3}, 4); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := normalizeGPUIDs([]int64{4}, 4); err == nil {
+		t.Fatalf("out-of-range gpu id should fail")
+	}
+}
+
+func TestReservationHolder(t *testing.T) {
+	r := GPUReservation{Username: "alice", GroupID: 3, GPUIDs: []int64{1, 2}}
+	members := map[string]bool{"bob": true}
+	if !ReservationHolder(r, "alice", nil) || !ReservationHolder(r, "bob", members) || ReservationHolder(r, "carol", members) {
+		t.Fatalf("holder check mismatch")
+	}
+	r.GroupID = 0
+	if ReservationHolder(r, "bob", members) {
+		t.Fatalf("personal reservation should not cover group members")
+	}
+	if !reservedGPUsUsed(UserProcess{GPUUsage: []GPUUsage{{GPUID: 2}}}, r.GPUIDs) || reservedGPUsUsed(UserProcess{GPUUsage: []GPUUsage{{GPUID: 0}}}, r.GPUIDs) {
+		t.Fatalf("reserved gpu match mismatch")
+	}
+}
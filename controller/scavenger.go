@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// tierTagKey 为进程声明计费档位的环境变量；Agent 需在 PROCESS_ENV_TAGS 中包含该变量（默认已包含）。
+const (
+	tierTagKey       = "GPUOPS_TIER"
+	tierScavenger    = "scavenger"
+	defaultScavPrice = 0.3
+)
+
+func (c ScavengerConfig) Validate() error {
+	if c.PriceFactor < 0 || c.PriceFactor > 1 {
+		return errors.New("scavenger.price_factor 必须在 [0, 1] 范围内")
+	}
+	return nil
+}
+
+func (c ScavengerConfig) priceFactor() float64 {
+	if c.PriceFactor > 0 {
+		return c.PriceFactor
+	}
+	return defaultScavPrice
+}
+
+// IsScavenger 判断进程是否声明为可抢占档（GPUOPS_TIER=scavenger，不区分大小写）。
+func IsScavenger(proc UserProcess) bool {
+	return strings.EqualFold(strings.TrimSpace(proc.Tags[tierTagKey]), tierScavenger)
+}
+
+// PreemptionWant 为一条可为之抢占的排队项及其仍缺的卡数。
+type PreemptionWant struct {
+	Item QueueItem
+	Need int
+}
+
+// PreemptionDemand 按队列顺序返回可为之抢占的排队项及总缺卡数：只计已认证（Verified）、非可抢占、
+// 型号匹配 nodeModel 的请求，减去 credits 中已为其抢占的卡数。
+func PreemptionDemand(items []QueueItem, nodeModel string, credits map[int64]int) ([]PreemptionWant, int) {
+	var wants []PreemptionWant
+	total := 0
+	for _, it := range items {
+		if !it.Verified || it.Preemptible || !gpuModelMatches(nodeModel, it.GPUType) {
+			continue
+		}
+		if n := it.Count - credits[it.ID]; n > 0 {
+			wants = append(wants, PreemptionWant{Item: it, Need: n})
+			total += n
+		}
+	}
+	return wants, total
+}
+
+// SelectPreemptionVictims 从节点进程中选出最多 need 张可腾出的卡：卡上只有 scavenger 进程（且不在 skip 中）才可抢占，
+// excludeGPUs 中的卡（健康检查异常）腾出也无法使用，不参与选择；
+// 按卡上显存占用从小到大（丢失的状态最少）、卡号从小到大选择。返回选中的卡号及其上的全部进程。
+func SelectPreemptionVictims(procs []UserProcess, need int, skip map[int32]bool, excludeGPUs map[int32]bool) ([]int32, []UserProcess) {
+	if need <= 0 {
+		return nil, nil
+	}
+	type gpuLoad struct {
+		id       int32
+		memoryMB float64
+		procs    []UserProcess
+		blocked  bool
+	}
+	byGPU := make(map[int32]*gpuLoad)
+	for _, p := range procs {
+		for _, g := range p.GPUUsage {
+			gl := byGPU[g.GPUID]
+			if gl == nil {
+				gl = &gpuLoad{id: g.GPUID}
+				byGPU[g.GPUID] = gl
+			}
+			gl.memoryMB += g.MemoryMB
+			gl.procs = append(gl.procs, p)
+			if !IsScavenger(p) || skip[p.PID] || excludeGPUs[g.GPUID] {
+				gl.blocked = true
+			}
+		}
+	}
+	candidates := make([]*gpuLoad, 0, len(byGPU))
+	for _, gl := range byGPU {
+		if !gl.blocked {
+			candidates = append(candidates, gl)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].memoryMB != candidates[j].memoryMB {
+			return candidates[i].memoryMB < candidates[j].memoryMB
+		}
+		return candidates[i].id < candidates[j].id
+	})
+	var gpus []int32
+	var victims []UserProcess
+	seen := make(map[int32]bool)
+	for _, gl := range candidates {
+		if len(gpus) >= need {
+			break
+		}
+		gpus = append(gpus, gl.id)
+		for _, p := range gl.procs {
+			if !seen[p.PID] {
+				seen[p.PID] = true
+				victims = append(victims, p)
+			}
+		}
+	}
+	return gpus, victims
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScavengerPricingAndVictims(t *testing.T) {
+	pi := NewPriceIndex([]PriceRow{{Model: "A100", Price: 1}})
+	proc := UserProcess{PID: 1, GPUUsage: []GPUUsage{{GPUID: 0, GPUModel: "NVIDIA A100"}}, Tags: map[string]string{tierTagKey: "Scavenger"}}
+	cfg := ScavengerConfig{Enabled: true, PriceFactor: 0.25}
+	if got := CalculateProcessCost(proc, pi, 0, cfg); math.Abs(got-0.25) > 1e-9 {
+		t.Fatalf("scavenger cost=%v", got)
+	}
+	if got := CalculateProcessCost(proc, pi, 0, ScavengerConfig{}); math.Abs(got-1) > 1e-9 {
+		t.Fatalf("disabled tier should use full price, got %v", got)
+	}
+
+	scav := map[string]string{tierTagKey: tierScavenger}
+	procs := []UserProcess{
+		{PID: 10, Tags: scav, GPUUsage: []GPUUsage{{GPUID: 0, MemoryMB: 8000}}},
+		{PID: 11, Tags: scav, GPUUsage: []GPUUsage{{GPUID: 1, MemoryMB: 2000}}},
+		{PID: 12, Tags: scav, GPUUsage: []GPUUsage{{GPUID: 2, MemoryMB: 1000}}},
+		{PID: 13, GPUUsage: []GPUUsage{{GPUID: 2, MemoryMB: 500}}}, // 普通进程共用卡 2，不可抢占
+	}
+	gpus, victims := SelectPreemptionVictims(procs, 1, nil, nil)
+	if fmt.Sprint(gpus) != "[1]" || len(victims) != 1 || victims[0].PID != 11 {
+		t.Fatalf("gpus=%v victims=%+v", gpus, victims)
+	}
+	gpus, _ = SelectPreemptionVictims(procs, 3, map[int32]bool{11: true}, nil)
+	if fmt.Sprint(gpus) != "[0]" {
+		t.Fatalf("skip/blocked mismatch: %v", gpus)
+	}
+}
+
+func TestPreemptionDemandIgnoresUnverified(t *testing.T) {
+	scav := map[string]string{tierTagKey: tierScavenger}
+	procs := []UserProcess{
+		{PID: 10, Tags: scav, GPUUsage: []GPUUsage{{GPUID: 0, MemoryMB: 8000}}},
+		{PID: 11, Tags: scav, GPUUsage: []GPUUsage{{GPUID: 1, MemoryMB: 2000}}},
+	}
+	// 匿名接口提交的大额请求：不产生抢占需求，也就不会下发 kill
+	anon := []QueueItem{{ID: 1, Username: "ghost", GPUType: "A100", Count: 64}}
+	wants, need := PreemptionDemand(anon, "NVIDIA A100-SXM4-80GB", nil)
+	if len(wants) != 0 || need != 0 {
+		t.Fatalf("unverified request should not create demand: %+v need=%d", wants, need)
+	}
+	if gpus, victims := SelectPreemptionVictims(procs, need, nil, nil); len(gpus) != 0 || len(victims) != 0 {
+		t.Fatalf("unverified request must not kill: gpus=%v victims=%+v", gpus, victims)
+	}
+
+	items := append(anon,
+		QueueItem{ID: 2, Username: "alice", GPUType: "A100", Count: 2, Verified: true},
+		QueueItem{ID: 3, Username: "bob", GPUType: "A100", Count: 4, Verified: true, Preemptible: true},
+		QueueItem{ID: 4, Username: "carol", GPUType: "RTX 3090", Count: 1, Verified: true},
+	)
+	wants, need = PreemptionDemand(items, "NVIDIA A100-SXM4-80GB", map[int64]int{2: 1})
+	if need != 1 || len(wants) != 1 || wants[0].Item.ID != 2 {
+		t.Fatalf("wants=%+v need=%d", wants, need)
+	}
+}
+
+func TestRankQueuePreemptibleLast(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	items := []QueueItem{
+		{ID: 1, Username: "a", Timestamp: t0, Preemptible: true},
+		{ID: 2, Username: "b", Timestamp: t0.Add(time.Minute)},
+	}
+	if got := RankQueue(items, nil); got[0].ID != 2 {
+		t.Fatalf("preemptible request should rank last: %+v", got)
+	}
+}
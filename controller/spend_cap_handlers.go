@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type spendCapReq struct {
+	Username     string   `json:"username"`
+	NodeID       string   `json:"node_id"` // 为空或 "*" 表示所有节点合计
+	DailyLimit   *float64 `json:"daily_limit"`
+	MonthlyLimit *float64 `json:"monthly_limit"`
+}
+
+// spendCapAlert 记录本次上报新触发的上限，事务提交后再发邮件。
+type spendCapAlert struct {
+	username string
+	breach   SpendCapBreach
+}
+
+func (s *Server) handleAdminSpendCapsList(c *gin.Context) {
+	username := strings.TrimSpace(c.Query("username"))
+	rows, err := s.store.ListSpendCapStatus(c.Request.Context(), username, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"caps": rows})
+}
+
+func (s *Server) handleAdminSpendCapUpsert(c *gin.Context) {
+	var req spendCapReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := UserSpendCap{
+		Username:     req.Username,
+		NodeID:       req.NodeID,
+		DailyLimit:   req.DailyLimit,
+		MonthlyLimit: req.MonthlyLimit,
+	}
+	if err := s.store.UpsertSpendCap(c.Request.Context(), in, s.currentOperator(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.refreshSpendCapStatus(c.Request.Context(), in.Username, time.Now())
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) handleAdminSpendCapDelete(c *gin.Context) {
+	username := strings.TrimSpace(c.Query("username"))
+	nodeID := strings.TrimSpace(c.Query("node_id"))
+	if err := s.store.DeleteSpendCap(c.Request.Context(), username, nodeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.refreshSpendCapStatus(c.Request.Context(), username, time.Now())
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// runSpendCapExpiry 每分钟处理到期的全局消费上限：清除限制、重算状态，并立即下发解除动作。
+// 否则空闲用户的 users.status 会一直停在 limited，限制状态校正也会持续按 limited 限制。
+func (s *Server) runSpendCapExpiry(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.expireSpendCaps(ctx, time.Now())
+	}
+}
+
+func (s *Server) expireSpendCaps(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	changed, err := s.store.ExpireSpendCapLimits(ctx, now, s.cfg)
+	if err != nil {
+		log.Printf("消费上限到期处理失败：%v", err)
+		return
+	}
+	for _, res := range changed {
+		s.enqueueRecoveryActions(ctx, res.User.Username, res.PrevStatus, res.User.Status)
+	}
+}
+
+// refreshSpendCapStatus 在管理员修改/删除上限后重算用户状态；失败时由下一次扣费兜底。
+func (s *Server) refreshSpendCapStatus(ctx context.Context, username string, now time.Time) {
+	res, err := s.store.RefreshUserStatus(ctx, username, now, s.cfg)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("消费上限变更后重算用户 %s 状态失败：%v", username, err)
+		}
+		return
+	}
+	s.enqueueRecoveryActions(ctx, res.User.Username, res.PrevStatus, res.User.Status)
+}
+
+// handleUserMySpendCaps 返回当前用户的消费上限、已消费金额与是否处于上限限制中。
+func (s *Server) handleUserMySpendCaps(c *gin.Context) {
+	username := strings.TrimSpace(fmt.Sprintf("%v", c.MustGet("auth_user")))
+	ctx := c.Request.Context()
+	now := time.Now()
+	rows, err := s.store.ListSpendCapStatus(ctx, username, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	until, reason, err := s.store.GetSpendCapState(ctx, username, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"caps":           rows,
+		"limited_until":  until,
+		"limited_reason": reason,
+	})
+}
+
+// sendSpendCapMail 在后台给用户发送上限触发提醒；未配置邮箱或 SMTP 时只记录日志。
+func (s *Server) sendSpendCapMail(username string, breach SpendCapBreach) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	email, err := s.store.GetUserEmailByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("消费上限提醒：查询 %s 邮箱失败：%v", username, err)
+		}
+		return
+	}
+	settings, err := s.store.GetMailSettings(ctx, s.cfg)
+	if err != nil {
+		log.Printf("消费上限提醒：读取邮件配置失败：%v", err)
+		return
+	}
+	subject := "HIT-AIOT-OPS 消费上限提醒"
+	body := fmt.Sprintf("你好 %s，\n\n%s。\n上限将于 %s 自动重置，如需调整请联系管理员。\n\nHIT-AIOT-OPS团队",
+		username, breach.Message(), breach.Until.Format("2006-01-02 15:04"))
+	if err := sendResetPasswordMail(settings, email, subject, body); err != nil {
+		log.Printf("消费上限提醒：发送给 %s 失败：%v", username, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// startOfDay 返回 t 所在自然日的起点（本地时区），用于按日统计消费上限。
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// SpendCapBreach 描述一次被触发的消费上限。
+type SpendCapBreach struct {
+	NodeID string // "*" 表示所有节点合计
+	Period string // daily / monthly
+	Limit  float64
+	Spent  float64
+	Until  time.Time // 上限重置时间（下一个自然日/自然月起点）
+}
+
+// Message 生成下发给用户的提示文案。
+func (b SpendCapBreach) Message() string {
+	scope := "今日"
+	if b.Period == "monthly" {
+		scope = "本月"
+	}
+	if b.NodeID != "" && b.NodeID != "*" {
+		scope += "在节点 " + b.NodeID + " 上"
+	}
+	return fmt.Sprintf("%s消费已达上限 %s 元（已消费 %s 元），%s 前限制新 GPU 任务",
+		scope, formatMoney(b.Limit), formatMoney(b.Spent), b.Until.Format("2006-01-02 15:04"))
+}
+
+// CheckSpendCap 判断单条上限配置是否被触发；日、月同时触发时取重置更晚的月上限。
+func CheckSpendCap(sc UserSpendCap, daySpent float64, monthSpent float64, now time.Time) *SpendCapBreach {
+	if sc.MonthlyLimit != nil && monthSpent >= *sc.MonthlyLimit {
+		return &SpendCapBreach{
+			NodeID: sc.NodeID,
+			Period: "monthly",
+			Limit:  *sc.MonthlyLimit,
+			Spent:  round4(monthSpent),
+			Until:  startOfMonth(now).AddDate(0, 1, 0),
+		}
+	}
+	if sc.DailyLimit != nil && daySpent >= *sc.DailyLimit {
+		return &SpendCapBreach{
+			NodeID: sc.NodeID,
+			Period: "daily",
+			Limit:  *sc.DailyLimit,
+			Spent:  round4(daySpent),
+			Until:  startOfDay(now).AddDate(0, 0, 1),
+		}
+	}
+	return nil
+}
+
+// EffectiveStatus 在余额状态基础上叠加消费上限：上限生效期间至少为 limited。
+func EffectiveStatus(balanceStatus string, capLimitedUntil *time.Time, now time.Time) string {
+	if capLimitedUntil == nil || !now.Before(*capLimitedUntil) {
+		return balanceStatus
+	}
+	if balanceStatus == "normal" || balanceStatus == "warning" {
+		return "limited"
+	}
+	return balanceStatus
+}
+
+// RefreshStatus 在余额状态上叠加仍生效的全局消费上限；上限已到期时返回 nil，表示应清除该限制。
+func RefreshStatus(balanceStatus string, capLimitedUntil *time.Time, now time.Time) (string, *time.Time) {
+	if capLimitedUntil != nil && !now.Before(*capLimitedUntil) {
+		capLimitedUntil = nil
+	}
+	return EffectiveStatus(balanceStatus, capLimitedUntil, now), capLimitedUntil
+}
+
+// NodeCapStatuses 在账号状态上叠加单节点消费上限，返回本节点上的前后状态（用于 DecideActions）。
+// prevUntil 为本次上报前记录的节点限制：只要仍有记录（到期后才在本次清除）就视为上次处于 limited，
+// 这样限制到期时能从 limited 变回 normal 并下发 unblock_user；curUntil 为本次判定后的限制。
+func NodeCapStatuses(prevStatus string, status string, prevUntil *time.Time, curUntil *time.Time, now time.Time) (string, string) {
+	if prevUntil != nil && (prevStatus == "normal" || prevStatus == "warning") {
+		prevStatus = "limited"
+	}
+	return prevStatus, EffectiveStatus(status, curUntil, now)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckSpendCap_MonthlyWinsAndResets(t *testing.T) {
+	now := time.Date(2026, 3, 15, 22, 30, 0, 0, time.UTC)
+	daily, monthly := 10.0, 200.0
+	sc := UserSpendCap{Username: "alice", NodeID: "*", DailyLimit: &daily, MonthlyLimit: &monthly}
+
+	if b := CheckSpendCap(sc, 9.99, 150, now); b != nil {
+		t.Fatalf("unexpected breach: %+v", b)
+	}
+	b := CheckSpendCap(sc, 10, 150, now)
+	if b == nil || b.Period != "daily" || !b.Until.Equal(time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected daily breach until next day, got %+v", b)
+	}
+	b = CheckSpendCap(sc, 12, 200, now)
+	if b == nil || b.Period != "monthly" || !b.Until.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected monthly breach until next month, got %+v", b)
+	}
+}
+
+func TestEffectiveStatus_SpendCap(t *testing.T) {
+	now := time.Date(2026, 3, 15, 22, 30, 0, 0, time.UTC)
+	until := now.Add(90 * time.Minute)
+	if got := EffectiveStatus("normal", &until, now); got != "limited" {
+		t.Fatalf("status=%s want limited", got)
+	}
+	if got := EffectiveStatus("blocked", &until, now); got != "blocked" {
+		t.Fatalf("status=%s want blocked", got)
+	}
+	if got := EffectiveStatus("warning", &until, until); got != "warning" {
+		t.Fatalf("status=%s want warning after reset", got)
+	}
+}
+
+func TestNodeSpendCapScopedToNode(t *testing.T) {
+	now := time.Date(2026, 3, 15, 22, 30, 0, 0, time.UTC)
+	daily := 5.0
+	sc := UserSpendCap{Username: "alice", NodeID: "60001", DailyLimit: &daily}
+	b := CheckSpendCap(sc, 5, 5, now)
+	if b == nil || b.NodeID != "60001" {
+		t.Fatalf("expected node breach, got %+v", b)
+	}
+	until := b.Until
+
+	// 触发上限的节点：normal -> limited，下发 block_user
+	prev, cur := NodeCapStatuses("normal", "normal", nil, &until, now)
+	if prev != "normal" || cur != "limited" {
+		t.Fatalf("capped node: prev=%s cur=%s", prev, cur)
+	}
+	u := User{Username: "alice", Balance: 500, Status: cur}
+	if acts := DecideActions(now, prev, u, 100, 10, time.Minute, nil); len(acts) == 0 || acts[0].Type != "block_user" {
+		t.Fatalf("capped node should block: %+v", acts)
+	}
+	// 其他节点没有节点限制：账号状态不变，不下发任何动作
+	prev, cur = NodeCapStatuses("normal", "normal", nil, nil, now)
+	u.Status = cur
+	if acts := DecideActions(now, prev, u, 100, 10, time.Minute, nil); cur != "normal" || len(acts) != 0 {
+		t.Fatalf("other node should stay normal: cur=%s acts=%+v", cur, acts)
+	}
+	// 限制到期（记录在本次清除）：limited -> normal，下发 unblock_user
+	later := until.Add(time.Minute)
+	prev, cur = NodeCapStatuses("normal", "normal", &until, nil, later)
+	u.Status = cur
+	acts := DecideActions(later, prev, u, 100, 10, time.Minute, nil)
+	if prev != "limited" || cur != "normal" || len(acts) == 0 || acts[0].Type != "unblock_user" {
+		t.Fatalf("expired node cap should unblock: prev=%s cur=%s acts=%+v", prev, cur, acts)
+	}
+}
+
+func TestRefreshStatusExpiresSpendCap(t *testing.T) {
+	now := time.Date(2026, 3, 16, 0, 5, 0, 0, time.UTC)
+	expired := now.Add(-5 * time.Minute)
+	// 日上限已在 00:00 到期：空闲用户不再扣费，也要恢复并下发 unblock_user
+	status, until := RefreshStatus("normal", &expired, now)
+	if status != "normal" || until != nil {
+		t.Fatalf("expired cap should be cleared: status=%s until=%v", status, until)
+	}
+	if acts := RecoveryActions("alice", "limited", status, Config{}); len(acts) != 1 || acts[0].Type != "unblock_user" {
+		t.Fatalf("expired cap should unblock: %+v", acts)
+	}
+	active := now.Add(time.Hour)
+	if status, until := RefreshStatus("warning", &active, now); status != "limited" || until == nil {
+		t.Fatalf("active cap should stay limited: status=%s until=%v", status, until)
+	}
+	if status, _ := RefreshStatus("blocked", &expired, now); status != "blocked" {
+		t.Fatalf("balance status should still apply: %s", status)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	maxProcessTags     = 16
+	maxProcessTagValue = 128
+)
+
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// SanitizeTags 清洗 Agent 上报的进程标签：键必须是合法的环境变量名，值去空白并截断，
+// 最多保留 maxProcessTags 个（按键排序），全部无效时返回 nil。
+func SanitizeTags(tags map[string]string) map[string]string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if tagKeyPattern.MatchString(k) && strings.TrimSpace(tags[k]) != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	if len(keys) > maxProcessTags {
+		keys = keys[:maxProcessTags]
+	}
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		out[k] = truncateRunes(tags[k], maxProcessTagValue)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeTags(t *testing.T) {
+	in := map[string]string{"SLURM_JOB_ID": " 4242 ", "bad-key": "x", "EMPTY": " ", "GPUOPS_PROJECT": strings.Repeat("界", 200)}
+	out := SanitizeTags(in)
+	if len(out) != 2 || out["SLURM_JOB_ID"] != "4242" || len([]rune(out["GPUOPS_PROJECT"])) != maxProcessTagValue {
+		t.Fatalf("tags=%v", out)
+	}
+	if SanitizeTags(map[string]string{"1X": "y"}) != nil {
+		t.Fatal("invalid keys should yield nil")
+	}
+	many := map[string]string{}
+	for i := 0; i < 40; i++ {
+		many[fmt.Sprintf("K%02d", i)] = "v"
+	}
+	if out := SanitizeTags(many); len(out) != maxProcessTags || out["K00"] != "v" {
+		t.Fatalf("len=%d", len(out))
+	}
+
+	var j JobSample
+	j.Add(UserProcess{PID: 1, Tags: map[string]string{"SLURM_JOB_ID": "1"}}, 0, 1)
+	j.Add(UserProcess{PID: 2, Tags: map[string]string{"SLURM_JOB_ID": "2", "GPUOPS_PROJECT": "p"}}, 0, 1)
+	if j.Tags["SLURM_JOB_ID"] != "1" || j.Tags["GPUOPS_PROJECT"] != "p" {
+		t.Fatalf("job tags=%v", j.Tags)
+	}
+}
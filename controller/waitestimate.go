@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// waitHistoryDays 为估算排队等待时统计历史 GPU 进程时长的天数
+	waitHistoryDays = 14
+	// waitMinSamples 为某型号历史进程数少于该值时退回按位置粗估
+	waitMinSamples = 5
+	// waitStatsCacheSeconds 为型号统计的缓存时间
+	waitStatsCacheSeconds = 300
+)
+
+// GPUModelStats 为某 GPU 型号的占用与历史进程时长分位数（分钟），用于估算排队等待。
+type GPUModelStats struct {
+	Model     string  `json:"model"`
+	TotalGPUs int     `json:"total_gpus"` // 在线节点的卡数
+	BusyGPUs  int     `json:"busy_gpus"`  // 最近一次上报中有进程的卡数
+	Samples   int     `json:"samples"`    // 历史 GPU 进程数
+	P25       float64 `json:"p25_minutes"`
+	P50       float64 `json:"p50_minutes"`
+	P75       float64 `json:"p75_minutes"`
+}
+
+// WaitEstimate 为排队等待的预估区间（分钟）；Basis 为 history（按历史时长与当前占用）或 default（数据不足时按位置粗估）。
+type WaitEstimate struct {
+	LowMinutes      int    `json:"low_minutes"`
+	ExpectedMinutes int    `json:"expected_minutes"`
+	HighMinutes     int    `json:"high_minutes"`
+	Basis           string `json:"basis"`
+}
+
+// Contains 判断实际等待分钟数是否落在预估区间内。
+func (e WaitEstimate) Contains(minutes float64) bool {
+	return minutes >= float64(e.LowMinutes) && minutes <= float64(e.HighMinutes)
+}
+
+// normalizeGPUModel 统一型号写法（忽略大小写、空格与连字符），"rtx3090" 可匹配 "NVIDIA GeForce RTX 3090"。
+func normalizeGPUModel(v string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(v) {
+		if r == ' ' || r == '-' || r == '_' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// defaultWaitEstimate 为数据不足时的粗估：每个排队位置约 10 分钟，区间为其 0.5~1.5 倍。
+func defaultWaitEstimate(position int) WaitEstimate {
+	if position <= 0 {
+		return WaitEstimate{Basis: "default"}
+	}
+	return WaitEstimate{LowMinutes: position * 5, ExpectedMinutes: position * 10, HighMinutes: position * 15, Basis: "default"}
+}
+
+// EstimateWait 估算申请 count 张 gpuType 卡、且前面还有 demandAhead 张同型号需求时的等待区间。
+// 空闲卡足够时为 0；否则还需释放 need 张卡，全部同型号卡按历史进程时长轮转，
+// 预计 need×P50/总卡数 分钟，区间取 P25 与 P75。匹配不到型号或历史进程太少时按位置粗估。
+func EstimateWait(stats []GPUModelStats, gpuType string, demandAhead int, count int, position int) WaitEstimate {
+	want := normalizeGPUModel(gpuType)
+	var total, busy int
+	var best *GPUModelStats
+	for i := range stats {
+		st := &stats[i]
+		if want == "" || !strings.Contains(normalizeGPUModel(st.Model), want) {
+			continue
+		}
+		total += st.TotalGPUs
+		busy += st.BusyGPUs
+		if best == nil || st.Samples > best.Samples {
+			best = st
+		}
+	}
+	if best == nil || total <= 0 {
+		return defaultWaitEstimate(position)
+	}
+	need := demandAhead + count - (total - busy)
+	if need <= 0 {
+		return WaitEstimate{Basis: "history"}
+	}
+	if best.Samples < waitMinSamples || best.P50 <= 0 {
+		return defaultWaitEstimate(position)
+	}
+	scale := float64(need) / float64(total)
+	est := WaitEstimate{
+		LowMinutes:      int(math.Ceil(best.P25 * scale)),
+		ExpectedMinutes: int(math.Ceil(best.P50 * scale)),
+		HighMinutes:     int(math.Ceil(best.P75 * scale)),
+		Basis:           "history",
+	}
+	if est.ExpectedMinutes < 1 {
+		est.ExpectedMinutes = 1
+	}
+	if est.LowMinutes > est.ExpectedMinutes {
+		est.LowMinutes = est.ExpectedMinutes
+	}
+	if est.HighMinutes < est.ExpectedMinutes {
+		est.HighMinutes = est.ExpectedMinutes
+	}
+	return est
+}
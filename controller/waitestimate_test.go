@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEstimateWait(t *testing.T) {
+	stats := []GPUModelStats{{Model: "NVIDIA GeForce RTX 3090", TotalGPUs: 8, BusyGPUs: 6, Samples: 100, P25: 40, P50: 80, P75: 160}}
+	if est := EstimateWait(stats, "rtx3090", 0, 2, 1); est.ExpectedMinutes != 0 || est.Basis != "history" {
+		t.Fatalf("free GPUs should mean no wait: %+v", est)
+	}
+	// 前面还有 4 张需求，需再释放 4 张：4×80/8=40 分钟，区间 20~80
+	est := EstimateWait(stats, "RTX 3090", 4, 2, 3)
+	if est.LowMinutes != 20 || est.ExpectedMinutes != 40 || est.HighMinutes != 80 {
+		t.Fatalf("unexpected estimate: %+v", est)
+	}
+	if !est.Contains(60) || est.Contains(90) {
+		t.Fatalf("range check mismatch")
+	}
+	if est := EstimateWait(stats, "A100", 0, 1, 2); est.Basis != "default" || est.ExpectedMinutes != 20 {
+		t.Fatalf("unknown model should fall back: %+v", est)
+	}
+	stats[0].Samples = 1
+	if est := EstimateWait(stats, "3090", 4, 2, 3); est.Basis != "default" {
+		t.Fatalf("too few samples should fall back: %+v", est)
+	}
+}
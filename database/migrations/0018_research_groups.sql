@@ -0,0 +1,39 @@
+-- 0018_research_groups.sql：课题组（导师）共享余额 + 组员额度
+
+CREATE TABLE IF NOT EXISTS research_groups (
+    group_id SERIAL PRIMARY KEY,
+    group_name VARCHAR(80) UNIQUE NOT NULL,
+    advisor_name VARCHAR(80) NOT NULL DEFAULT '',         -- 对应 user_accounts.advisor（自由文本），用于同步组员
+    advisor_username VARCHAR(50) NOT NULL DEFAULT '',     -- 导师的平台账号（可查看组内消费看板）
+    balance DECIMAL(12,2) NOT NULL DEFAULT 0.0,
+    status VARCHAR(20) NOT NULL DEFAULT 'normal',          -- normal, warning, limited, blocked
+    blocked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- 一个计费账号最多属于一个课题组
+CREATE TABLE IF NOT EXISTS research_group_members (
+    username VARCHAR(50) PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES research_groups(group_id) ON DELETE CASCADE,
+    monthly_limit DECIMAL(12,2) NULL,                      -- 组员每月可用组内额度；NULL 表示不限
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS group_recharge_records (
+    recharge_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    method VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- usage_records 记录本条费用由哪个课题组承担（0 表示个人账户）
+ALTER TABLE usage_records
+    ADD COLUMN IF NOT EXISTS group_id INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_research_group_members_group ON research_group_members(group_id);
+CREATE INDEX IF NOT EXISTS idx_research_groups_advisor ON research_groups(advisor_username);
+CREATE INDEX IF NOT EXISTS idx_usage_group_timestamp ON usage_records(group_id, timestamp);
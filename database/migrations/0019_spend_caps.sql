@@ -0,0 +1,19 @@
+-- 0019_spend_caps.sql：按用户的每日/每月消费上限（可细化到单个节点）
+
+CREATE TABLE IF NOT EXISTS user_spend_caps (
+    username VARCHAR(50) NOT NULL,
+    node_id VARCHAR(50) NOT NULL DEFAULT '*',              -- 具体节点或 "*" 表示所有节点合计
+    daily_limit DECIMAL(12,2) NULL,                        -- 自然日消费上限；NULL 表示不限
+    monthly_limit DECIMAL(12,2) NULL,                      -- 自然月消费上限；NULL 表示不限
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (username, node_id)
+);
+
+-- 触发上限后进入 limited，直到该时间点（下一个自然日/自然月）自动恢复
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS cap_limited_until TIMESTAMP NULL,
+    ADD COLUMN IF NOT EXISTS cap_reason VARCHAR(200) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_usage_username_node_timestamp ON usage_records(username, node_id, timestamp);
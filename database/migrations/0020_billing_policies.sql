@@ -0,0 +1,16 @@
+-- 0020_billing_policies.sql：按用户 / 课题组覆盖全局计费策略（阈值、宽限期、CPU 限制）
+
+CREATE TABLE IF NOT EXISTS billing_policies (
+    scope VARCHAR(10) NOT NULL,                 -- user / group
+    target VARCHAR(50) NOT NULL,                -- scope=user 时为计费账号；scope=group 时为 group_id
+    warning_threshold DECIMAL(12,2) NULL,       -- 以下字段为 NULL 表示沿用上一级（课题组或全局配置）
+    limited_threshold DECIMAL(12,2) NULL,
+    kill_grace_period_seconds INT NULL,
+    cpu_limit_percent_limited DECIMAL(6,2) NULL,
+    cpu_limit_percent_blocked DECIMAL(6,2) NULL,
+    note VARCHAR(200) NOT NULL DEFAULT '',
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, target)
+);
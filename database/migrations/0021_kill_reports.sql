@@ -0,0 +1,20 @@
+-- 0021_kill_reports.sql：Agent 回报 kill_process 的执行结果（哪些进程真正退出）
+
+CREATE TABLE IF NOT EXISTS kill_reports (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号（按 user_node_accounts 解析）
+    reason TEXT NOT NULL DEFAULT '',
+    requested_pids JSONB NOT NULL,
+    killed_pids JSONB NOT NULL,
+    survived_pids JSONB NOT NULL,
+    skipped_pids JSONB NOT NULL,                -- 执行前已退出或不属于该用户
+    ladder JSONB NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kill_reports_username_created ON kill_reports(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_kill_reports_node_created ON kill_reports(node_id, created_at);
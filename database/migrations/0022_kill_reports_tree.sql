@@ -0,0 +1,5 @@
+-- 0022_kill_reports_tree.sql：kill 结果记录随进程树 / 容器 cgroup 一并处理的进程
+
+ALTER TABLE kill_reports
+    ADD COLUMN IF NOT EXISTS tree_pids JSONB NOT NULL DEFAULT '[]'::jsonb,
+    ADD COLUMN IF NOT EXISTS cgroups JSONB NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,18 @@
+-- 0023_enforcement_drift.sql：Agent 校正限制状态时发现的偏差（重启、slice 被重置等导致限制丢失）
+
+CREATE TABLE IF NOT EXISTS enforcement_drift (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号（按 user_node_accounts 解析）
+    item VARCHAR(20) NOT NULL,                  -- gpu_block / cpu_quota / memory / tasks
+    expected VARCHAR(200) NOT NULL,
+    actual VARCHAR(200) NOT NULL,
+    repaired BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT NOT NULL DEFAULT '',
+    detected_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_enforcement_drift_node_created ON enforcement_drift(node_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_enforcement_drift_username_created ON enforcement_drift(username, created_at);
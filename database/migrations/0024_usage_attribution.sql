@@ -0,0 +1,5 @@
+-- 0024_usage_attribution.sql：root / 容器 / 共享账号进程归属到真实用户后，记录进程实际属主与归属依据
+
+ALTER TABLE usage_records
+    ADD COLUMN IF NOT EXISTS process_user VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attribution VARCHAR(32) NOT NULL DEFAULT '';
@@ -0,0 +1,28 @@
+-- 0025_jobs.sql：按 (节点, 本地账号, 进程组/PID, 命令) 把连续采样聚合为作业
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号
+    job_key VARCHAR(32) NOT NULL,               -- pg:<pgid> 或 pid:<pid>
+    command TEXT NOT NULL DEFAULT '',
+    group_id INT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP NOT NULL,                -- 最近一次采样时间
+    samples INT NOT NULL DEFAULT 0,
+    gpu_minutes DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cpu_core_minutes DOUBLE PRECISION NOT NULL DEFAULT 0,
+    peak_gpu_memory_mb DOUBLE PRECISION NOT NULL DEFAULT 0,
+    peak_gpu_count INT NOT NULL DEFAULT 0,
+    cost DECIMAL(12,4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_match ON jobs(node_id, local_username, job_key, ended_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_username_started ON jobs(username, started_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_node_started ON jobs(node_id, started_at);
+
+ALTER TABLE usage_records ADD COLUMN IF NOT EXISTS job_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_usage_records_job ON usage_records(job_id) WHERE job_id > 0;
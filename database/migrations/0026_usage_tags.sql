@@ -0,0 +1,6 @@
+-- 0026_usage_tags.sql：进程标签（Agent 按白名单读取的环境变量，如 SLURM_JOB_ID / GPUOPS_PROJECT）
+
+ALTER TABLE usage_records ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_usage_records_tags ON usage_records USING GIN (tags);
@@ -0,0 +1,35 @@
+-- 0027_projects.sql：项目 / 成本中心，用量按项目拆分，项目可设月度预算
+
+CREATE TABLE IF NOT EXISTS projects (
+    project_id SERIAL PRIMARY KEY,
+    project_name VARCHAR(64) UNIQUE NOT NULL,      -- 进程通过 GPUOPS_PROJECT=<project_name> 标注
+    description TEXT NOT NULL DEFAULT '',
+    monthly_budget DECIMAL(12,2) NULL,             -- NULL 表示不设预算
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INT NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,                 -- 计费账号
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_members_username ON project_members(username);
+
+-- 节点本地账号的默认项目（进程未标注 GPUOPS_PROJECT 时使用）；node_id='*' 表示所有节点
+CREATE TABLE IF NOT EXISTS project_defaults (
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    project_id INT NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (node_id, local_username)
+);
+
+ALTER TABLE usage_records ADD COLUMN IF NOT EXISTS project_id INT NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS project_id INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_usage_project_timestamp ON usage_records(project_id, timestamp) WHERE project_id > 0;
@@ -0,0 +1,35 @@
+-- 0028_idle_gpu.sql：空闲占卡识别（占显存但卡利用率长期为 0）、豁免名单与按策略回收
+
+-- 当前处于空闲状态的 GPU 进程；进程恢复计算或退出后删除
+CREATE TABLE IF NOT EXISTS gpu_idle_holders (
+    node_id VARCHAR(50) NOT NULL,
+    pid INT NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,                  -- 计费账号
+    command VARCHAR(256) NOT NULL DEFAULT '',
+    gpu_ids INT[] NOT NULL DEFAULT '{}',
+    memory_mb DOUBLE PRECISION NOT NULL DEFAULT 0,  -- 最近一次采样的显存占用
+    utilization_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    idle_since TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    idle_cost DECIMAL(12,4) NOT NULL DEFAULT 0,     -- 空闲期间产生的费用
+    notify_level INT NOT NULL DEFAULT 0,            -- 已发送的提醒级别（对应 notify_minutes 的下标 + 1）
+    notified_at TIMESTAMP NULL,
+    kill_requested_at TIMESTAMP NULL,
+    PRIMARY KEY (node_id, pid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_idle_holders_username ON gpu_idle_holders(username);
+
+CREATE TABLE IF NOT EXISTS gpu_idle_exemptions (
+    scope VARCHAR(10) NOT NULL,                     -- user（计费账号）/ node
+    target VARCHAR(50) NOT NULL,
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NULL,                      -- NULL 表示长期有效
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, target)
+);
+
+-- 空闲多久后回收（分钟），NULL 沿用上一级；0 表示不回收
+ALTER TABLE billing_policies ADD COLUMN IF NOT EXISTS idle_gpu_kill_minutes INT NULL;
@@ -0,0 +1,40 @@
+-- 0029_gpu_reservations.sql：GPU 预约（在某节点上为某时间段预订 N 张卡），预约期间非预约人的进程会被提醒并终止
+
+CREATE TABLE IF NOT EXISTS gpu_reservations (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    gpu_model VARCHAR(100) NOT NULL DEFAULT '',     -- 申请时指定的型号（为空表示不限），需与节点上报的型号匹配
+    gpu_count INT NOT NULL,
+    gpu_ids INT[] NOT NULL DEFAULT '{}',            -- 分配到的卡号（nvidia-smi index）
+    username VARCHAR(50) NOT NULL,                  -- 预约人（计费账号）
+    group_id INT NOT NULL DEFAULT 0,                -- >0 表示为课题组预约，组员均可使用
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NOT NULL,
+    purpose VARCHAR(200) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending / approved / rejected / cancelled
+    review_note VARCHAR(200) NOT NULL DEFAULT '',
+    reviewed_by VARCHAR(50) NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (end_at > start_at),
+    CHECK (gpu_count > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_reservations_node_time ON gpu_reservations(node_id, start_at, end_at);
+CREATE INDEX IF NOT EXISTS idx_gpu_reservations_username ON gpu_reservations(username, start_at DESC);
+
+-- 预约期间在预约卡上运行的非预约人进程；首次发现时提醒，超过宽限期后终止
+CREATE TABLE IF NOT EXISTS gpu_reservation_violations (
+    reservation_id BIGINT NOT NULL REFERENCES gpu_reservations(id) ON DELETE CASCADE,
+    node_id VARCHAR(50) NOT NULL,
+    pid INT NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    kill_requested_at TIMESTAMP NULL,
+    PRIMARY KEY (reservation_id, pid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_reservation_violations_node ON gpu_reservation_violations(node_id, last_seen);
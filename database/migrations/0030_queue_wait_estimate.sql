@@ -0,0 +1,2 @@
+-- 0030_queue_wait_estimate.sql：排队等待估算按（节点, 上报时间）查询最近一次上报中被占用的 GPU
+CREATE INDEX IF NOT EXISTS idx_usage_node_timestamp ON usage_records(node_id, timestamp);
@@ -0,0 +1,20 @@
+-- 0031_gpu_preemptions.sql：可抢占（scavenger）档进程被抢占的记录，供受影响用户与管理员查看
+
+CREATE TABLE IF NOT EXISTS gpu_preemptions (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,               -- 被抢占进程的计费账号
+    pid INT NOT NULL,
+    gpu_ids INT[] NOT NULL DEFAULT '{}',
+    command TEXT NOT NULL DEFAULT '',
+    reason VARCHAR(20) NOT NULL,                 -- queue / reservation
+    queue_item_id BIGINT NOT NULL DEFAULT 0,
+    reservation_id BIGINT NOT NULL DEFAULT 0,
+    beneficiary VARCHAR(50) NOT NULL DEFAULT '', -- 获得该卡的排队人或预约人
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (reason IN ('queue', 'reservation'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_preemptions_username ON gpu_preemptions(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_gpu_preemptions_node_pid ON gpu_preemptions(node_id, pid, created_at);
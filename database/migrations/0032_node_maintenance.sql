@@ -0,0 +1,22 @@
+-- 0032_node_maintenance.sql：节点维护窗口与排空（drain）流程
+
+-- drain_at 起排空：不再接受新登录与分配，通知在线用户、等待作业结束；
+-- start_at 起进入维护（kick_ssh 时下发 kick_ssh_all）；end_at 为空表示直到管理员结束维护。
+CREATE TABLE IF NOT EXISTS node_maintenance (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    drain_at TIMESTAMP NOT NULL,
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NULL,
+    kick_ssh BOOLEAN NOT NULL DEFAULT FALSE,
+    notified_at TIMESTAMP NULL,     -- 已向在线用户发送排空通知
+    kicked_at TIMESTAMP NULL,       -- 已下发 kick_ssh_all
+    ended_at TIMESTAMP NULL,        -- 管理员提前结束或取消
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (start_at >= drain_at),
+    CHECK (end_at IS NULL OR end_at > start_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_maintenance_node ON node_maintenance(node_id, drain_at);
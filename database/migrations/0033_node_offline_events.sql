@@ -0,0 +1,18 @@
+-- 0033_node_offline_events.sql：节点离线检测（连续多个上报周期未上报视为离线）与上下线记录
+
+ALTER TABLE nodes
+    ADD COLUMN IF NOT EXISTS offline_since TIMESTAMP NULL;
+
+CREATE TABLE IF NOT EXISTS node_status_events (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    status VARCHAR(10) NOT NULL,            -- offline / online
+    last_seen_at TIMESTAMP NOT NULL,        -- 离线：最后一次上报时间；上线：恢复后首次上报时间
+    offline_seconds BIGINT NOT NULL DEFAULT 0, -- 上线事件：本次离线持续时长（自最后一次上报起）
+    in_maintenance BOOLEAN NOT NULL DEFAULT FALSE, -- 发生在维护窗口内（不发送告警）
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (status IN ('offline', 'online'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_status_events_node ON node_status_events(node_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_node_status_events_created ON node_status_events(created_at);
@@ -0,0 +1,22 @@
+-- 0034_gpu_health.sql：GPU 硬件健康（ECC、退役页、Xid、掉卡）——节点最近一次健康信号与健康问题记录
+
+ALTER TABLE nodes
+    ADD COLUMN IF NOT EXISTS health JSONB NULL;
+
+CREATE TABLE IF NOT EXISTS gpu_health_issues (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    gpu_index INT NOT NULL DEFAULT -1,      -- -1 表示节点级（掉卡、卡数不符、无法对应卡号的 Xid）
+    bus_id TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(30) NOT NULL,              -- ecc_uncorrected / retired_pages_pending / retired_pages / xid / gpu_lost / gpu_missing
+    severity VARCHAR(10) NOT NULL,          -- critical：停止分配；warning：仅提示
+    detail TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP NULL,
+    resolved_by VARCHAR(50) NOT NULL DEFAULT '', -- auto（不再出现时自动解除）或管理员
+    CHECK (severity IN ('critical', 'warning'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_gpu_health_issues_open ON gpu_health_issues(node_id, gpu_index, kind) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_gpu_health_issues_node ON gpu_health_issues(node_id, first_seen_at);
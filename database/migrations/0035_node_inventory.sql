@@ -0,0 +1,22 @@
+-- 0035_node_inventory.sql：节点软硬件清单（驱动 / CUDA / 内核 / 系统版本、内存与磁盘容量）及变化记录
+
+ALTER TABLE nodes
+    ADD COLUMN IF NOT EXISTS driver_version TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cuda_version TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS kernel_version TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS os_release TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS memory_total_mb BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS disk_total_gb DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS inventory_updated_at TIMESTAMP NULL;
+
+CREATE TABLE IF NOT EXISTS node_inventory_changes (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    field VARCHAR(30) NOT NULL,             -- driver_version / cuda_version / kernel_version / os_release / memory_total_mb / disk_total_gb
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_inventory_changes_node ON node_inventory_changes(node_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_node_inventory_changes_time ON node_inventory_changes(changed_at);
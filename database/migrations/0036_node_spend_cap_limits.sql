@@ -0,0 +1,6 @@
+-- 0036_node_spend_cap_limits.sql：单节点消费上限的限制记在上限配置行上，只影响该节点
+-- （users.cap_limited_until 仅用于 node_id='*' 的全局上限）
+
+ALTER TABLE user_spend_caps
+    ADD COLUMN IF NOT EXISTS limited_until TIMESTAMP NULL,
+    ADD COLUMN IF NOT EXISTS limited_reason VARCHAR(200) NOT NULL DEFAULT '';
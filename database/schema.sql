@@ -7,6 +7,8 @@ CREATE TABLE IF NOT EXISTS users (
     status VARCHAR(20) NOT NULL DEFAULT 'normal', -- normal, warning, limited, blocked
     blocked_at TIMESTAMP NULL,
     last_charge_time TIMESTAMP NOT NULL DEFAULT NOW(),
+    cap_limited_until TIMESTAMP NULL,   -- 触发消费上限后的限制截止时间
+    cap_reason VARCHAR(200) NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
@@ -23,6 +25,12 @@ CREATE TABLE IF NOT EXISTS usage_records (
     command TEXT NOT NULL DEFAULT '',
     gpu_usage JSONB NOT NULL,
     cost DECIMAL(10,4) NOT NULL,
+    group_id INT NOT NULL DEFAULT 0, -- 费用由哪个课题组承担（0 表示个人账户）
+    process_user VARCHAR(50) NOT NULL DEFAULT '', -- 进程实际属主（root 等被归属到真实用户时非空）
+    attribution VARCHAR(32) NOT NULL DEFAULT '', -- 归属依据：cgroup / container_label / userns / env
+    job_id BIGINT NOT NULL DEFAULT 0, -- 所属作业（jobs.id，0 表示未聚合）
+    tags JSONB NOT NULL DEFAULT '{}'::jsonb, -- 进程标签（白名单环境变量，如 SLURM_JOB_ID / GPUOPS_PROJECT）
+    project_id INT NOT NULL DEFAULT 0, -- 费用归属的项目（0 表示未归属项目）
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
@@ -76,6 +84,15 @@ CREATE TABLE IF NOT EXISTS nodes (
     usage_records_count INT NOT NULL DEFAULT 0,
     ssh_active_count INT NOT NULL DEFAULT 0,
     cost_total DECIMAL(12,4) NOT NULL DEFAULT 0.0,
+    offline_since TIMESTAMP NULL,           -- 离线检测标记的离线时间（最后一次上报时间），在线时为 NULL
+    health JSONB NULL,                      -- 最近一次上报的硬件健康信号（ECC、退役页、Xid、掉卡）
+    driver_version TEXT NOT NULL DEFAULT '',
+    cuda_version TEXT NOT NULL DEFAULT '',
+    kernel_version TEXT NOT NULL DEFAULT '',
+    os_release TEXT NOT NULL DEFAULT '',
+    memory_total_mb BIGINT NOT NULL DEFAULT 0,
+    disk_total_gb DOUBLE PRECISION NOT NULL DEFAULT 0, -- 根分区容量
+    inventory_updated_at TIMESTAMP NULL,    -- 软硬件清单最近一次上报时间
     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
 
@@ -131,6 +148,9 @@ CREATE INDEX IF NOT EXISTS idx_usage_local_username ON usage_records(local_usern
 CREATE INDEX IF NOT EXISTS idx_usage_timestamp ON usage_records(timestamp);
 CREATE INDEX IF NOT EXISTS idx_usage_node ON usage_records(node_id);
 CREATE INDEX IF NOT EXISTS idx_usage_timestamp_username ON usage_records(timestamp, username);
+CREATE INDEX IF NOT EXISTS idx_usage_records_job ON usage_records(job_id) WHERE job_id > 0;
+CREATE INDEX IF NOT EXISTS idx_usage_records_tags ON usage_records USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_usage_project_timestamp ON usage_records(project_id, timestamp) WHERE project_id > 0;
 CREATE INDEX IF NOT EXISTS idx_user_node_accounts_billing ON user_node_accounts(billing_username);
 CREATE INDEX IF NOT EXISTS idx_user_requests_status ON user_requests(status);
 CREATE INDEX IF NOT EXISTS idx_user_requests_billing ON user_requests(billing_username);
@@ -232,3 +252,327 @@ CREATE INDEX IF NOT EXISTS idx_ssh_exemptions_user ON ssh_exemptions(local_usern
 INSERT INTO ssh_exemptions(node_id, local_username, created_by)
 VALUES('*', 'baojh', 'system')
 ON CONFLICT (node_id, local_username) DO NOTHING;
+
+-- 课题组（导师）共享余额 + 组员额度
+CREATE TABLE IF NOT EXISTS research_groups (
+    group_id SERIAL PRIMARY KEY,
+    group_name VARCHAR(80) UNIQUE NOT NULL,
+    advisor_name VARCHAR(80) NOT NULL DEFAULT '',     -- 对应 user_accounts.advisor
+    advisor_username VARCHAR(50) NOT NULL DEFAULT '', -- 导师的平台账号
+    balance DECIMAL(12,2) NOT NULL DEFAULT 0.0,
+    status VARCHAR(20) NOT NULL DEFAULT 'normal',      -- normal, warning, limited, blocked
+    blocked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS research_group_members (
+    username VARCHAR(50) PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES research_groups(group_id) ON DELETE CASCADE,
+    monthly_limit DECIMAL(12,2) NULL,                  -- NULL 表示不限
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS group_recharge_records (
+    recharge_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    method VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_research_group_members_group ON research_group_members(group_id);
+CREATE INDEX IF NOT EXISTS idx_research_groups_advisor ON research_groups(advisor_username);
+CREATE INDEX IF NOT EXISTS idx_usage_group_timestamp ON usage_records(group_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS user_spend_caps (
+    username VARCHAR(50) NOT NULL,
+    node_id VARCHAR(50) NOT NULL DEFAULT '*',  -- 具体节点或 "*" 表示所有节点合计
+    daily_limit DECIMAL(12,2) NULL,
+    monthly_limit DECIMAL(12,2) NULL,
+    limited_until TIMESTAMP NULL,              -- 单节点上限触发后的限制截止时间（node_id='*' 时记在 users.cap_limited_until）
+    limited_reason VARCHAR(200) NOT NULL DEFAULT '',
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (username, node_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_username_node_timestamp ON usage_records(username, node_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_usage_node_timestamp ON usage_records(node_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS billing_policies (
+    scope VARCHAR(10) NOT NULL,                 -- user / group
+    target VARCHAR(50) NOT NULL,                -- 计费账号或 group_id
+    warning_threshold DECIMAL(12,2) NULL,       -- NULL 表示沿用上一级
+    limited_threshold DECIMAL(12,2) NULL,
+    kill_grace_period_seconds INT NULL,
+    cpu_limit_percent_limited DECIMAL(6,2) NULL,
+    cpu_limit_percent_blocked DECIMAL(6,2) NULL,
+    idle_gpu_kill_minutes INT NULL,
+    note VARCHAR(200) NOT NULL DEFAULT '',
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, target)
+);
+
+CREATE TABLE IF NOT EXISTS kill_reports (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号
+    reason TEXT NOT NULL DEFAULT '',
+    requested_pids JSONB NOT NULL,
+    killed_pids JSONB NOT NULL,
+    survived_pids JSONB NOT NULL,
+    skipped_pids JSONB NOT NULL,                -- 执行前已退出或不属于该用户
+    ladder JSONB NOT NULL,
+    tree_pids JSONB NOT NULL DEFAULT '[]'::jsonb, -- 随进程树 / 进程组 / 容器 cgroup 一并处理的 PID
+    cgroups JSONB NOT NULL DEFAULT '[]'::jsonb,   -- 整体处理的容器 cgroup
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kill_reports_username_created ON kill_reports(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_kill_reports_node_created ON kill_reports(node_id, created_at);
+
+-- Agent 校正限制状态时发现的偏差
+CREATE TABLE IF NOT EXISTS enforcement_drift (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号
+    item VARCHAR(20) NOT NULL,                  -- gpu_block / cpu_quota / memory / tasks
+    expected VARCHAR(200) NOT NULL,
+    actual VARCHAR(200) NOT NULL,
+    repaired BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT NOT NULL DEFAULT '',
+    detected_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_enforcement_drift_node_created ON enforcement_drift(node_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_enforcement_drift_username_created ON enforcement_drift(username, created_at);
+
+-- 作业聚合：按 (节点, 本地账号, 进程组/PID, 命令) 把连续采样折叠为一行
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,              -- 计费账号
+    job_key VARCHAR(32) NOT NULL,               -- pg:<pgid> 或 pid:<pid>
+    command TEXT NOT NULL DEFAULT '',
+    group_id INT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP NOT NULL,                -- 最近一次采样时间
+    samples INT NOT NULL DEFAULT 0,
+    gpu_minutes DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cpu_core_minutes DOUBLE PRECISION NOT NULL DEFAULT 0,
+    peak_gpu_memory_mb DOUBLE PRECISION NOT NULL DEFAULT 0,
+    peak_gpu_count INT NOT NULL DEFAULT 0,
+    cost DECIMAL(12,4) NOT NULL DEFAULT 0,
+    tags JSONB NOT NULL DEFAULT '{}'::jsonb,    -- 首次出现的进程标签
+    project_id INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_match ON jobs(node_id, local_username, job_key, ended_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_username_started ON jobs(username, started_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_node_started ON jobs(node_id, started_at);
+
+-- 项目 / 成本中心：同一计费账号的费用可按项目拆分
+CREATE TABLE IF NOT EXISTS projects (
+    project_id SERIAL PRIMARY KEY,
+    project_name VARCHAR(64) UNIQUE NOT NULL,      -- 进程通过 GPUOPS_PROJECT=<project_name> 标注
+    description TEXT NOT NULL DEFAULT '',
+    monthly_budget DECIMAL(12,2) NULL,             -- NULL 表示不设预算
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INT NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,                 -- 计费账号
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_members_username ON project_members(username);
+
+-- 节点本地账号的默认项目（进程未标注 GPUOPS_PROJECT 时使用）；node_id='*' 表示所有节点
+CREATE TABLE IF NOT EXISTS project_defaults (
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    project_id INT NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (node_id, local_username)
+);
+
+-- 当前处于空闲状态的 GPU 进程；进程恢复计算或退出后删除
+CREATE TABLE IF NOT EXISTS gpu_idle_holders (
+    node_id VARCHAR(50) NOT NULL,
+    pid INT NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,                  -- 计费账号
+    command VARCHAR(256) NOT NULL DEFAULT '',
+    gpu_ids INT[] NOT NULL DEFAULT '{}',
+    memory_mb DOUBLE PRECISION NOT NULL DEFAULT 0,  -- 最近一次采样的显存占用
+    utilization_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    idle_since TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    idle_cost DECIMAL(12,4) NOT NULL DEFAULT 0,     -- 空闲期间产生的费用
+    notify_level INT NOT NULL DEFAULT 0,            -- 已发送的提醒级别（对应 notify_minutes 的下标 + 1）
+    notified_at TIMESTAMP NULL,
+    kill_requested_at TIMESTAMP NULL,
+    PRIMARY KEY (node_id, pid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_idle_holders_username ON gpu_idle_holders(username);
+
+CREATE TABLE IF NOT EXISTS gpu_idle_exemptions (
+    scope VARCHAR(10) NOT NULL,                     -- user（计费账号）/ node
+    target VARCHAR(50) NOT NULL,
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NULL,                      -- NULL 表示长期有效
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, target)
+);
+
+-- GPU 预约
+CREATE TABLE IF NOT EXISTS gpu_reservations (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    gpu_model VARCHAR(100) NOT NULL DEFAULT '',     -- 申请时指定的型号（为空表示不限），需与节点上报的型号匹配
+    gpu_count INT NOT NULL,
+    gpu_ids INT[] NOT NULL DEFAULT '{}',            -- 分配到的卡号（nvidia-smi index）
+    username VARCHAR(50) NOT NULL,                  -- 预约人（计费账号）
+    group_id INT NOT NULL DEFAULT 0,                -- >0 表示为课题组预约，组员均可使用
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NOT NULL,
+    purpose VARCHAR(200) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending / approved / rejected / cancelled
+    review_note VARCHAR(200) NOT NULL DEFAULT '',
+    reviewed_by VARCHAR(50) NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (end_at > start_at),
+    CHECK (gpu_count > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_reservations_node_time ON gpu_reservations(node_id, start_at, end_at);
+CREATE INDEX IF NOT EXISTS idx_gpu_reservations_username ON gpu_reservations(username, start_at DESC);
+
+-- 预约期间在预约卡上运行的非预约人进程；首次发现时提醒，超过宽限期后终止
+CREATE TABLE IF NOT EXISTS gpu_reservation_violations (
+    reservation_id BIGINT NOT NULL REFERENCES gpu_reservations(id) ON DELETE CASCADE,
+    node_id VARCHAR(50) NOT NULL,
+    pid INT NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    kill_requested_at TIMESTAMP NULL,
+    PRIMARY KEY (reservation_id, pid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_reservation_violations_node ON gpu_reservation_violations(node_id, last_seen);
+
+-- GPU 抢占（scavenger 档）
+CREATE TABLE IF NOT EXISTS gpu_preemptions (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    local_username VARCHAR(50) NOT NULL,
+    username VARCHAR(50) NOT NULL,               -- 被抢占进程的计费账号
+    pid INT NOT NULL,
+    gpu_ids INT[] NOT NULL DEFAULT '{}',
+    command TEXT NOT NULL DEFAULT '',
+    reason VARCHAR(20) NOT NULL,                 -- queue / reservation
+    queue_item_id BIGINT NOT NULL DEFAULT 0,
+    reservation_id BIGINT NOT NULL DEFAULT 0,
+    beneficiary VARCHAR(50) NOT NULL DEFAULT '', -- 获得该卡的排队人或预约人
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (reason IN ('queue', 'reservation'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_gpu_preemptions_username ON gpu_preemptions(username, created_at);
+CREATE INDEX IF NOT EXISTS idx_gpu_preemptions_node_pid ON gpu_preemptions(node_id, pid, created_at);
+
+-- 节点维护与排空
+-- drain_at 起排空：不再接受新登录与分配，通知在线用户、等待作业结束；
+-- start_at 起进入维护（kick_ssh 时下发 kick_ssh_all）；end_at 为空表示直到管理员结束维护。
+CREATE TABLE IF NOT EXISTS node_maintenance (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    drain_at TIMESTAMP NOT NULL,
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NULL,
+    kick_ssh BOOLEAN NOT NULL DEFAULT FALSE,
+    notified_at TIMESTAMP NULL,     -- 已向在线用户发送排空通知
+    kicked_at TIMESTAMP NULL,       -- 已下发 kick_ssh_all
+    ended_at TIMESTAMP NULL,        -- 管理员提前结束或取消
+    created_by VARCHAR(50) NOT NULL DEFAULT 'admin',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (start_at >= drain_at),
+    CHECK (end_at IS NULL OR end_at > start_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_maintenance_node ON node_maintenance(node_id, drain_at);
+
+-- 节点上下线记录（离线检测）
+CREATE TABLE IF NOT EXISTS node_status_events (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    status VARCHAR(10) NOT NULL,            -- offline / online
+    last_seen_at TIMESTAMP NOT NULL,        -- 离线：最后一次上报时间；上线：恢复后首次上报时间
+    offline_seconds BIGINT NOT NULL DEFAULT 0, -- 上线事件：本次离线持续时长（自最后一次上报起）
+    in_maintenance BOOLEAN NOT NULL DEFAULT FALSE, -- 发生在维护窗口内（不发送告警）
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (status IN ('offline', 'online'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_status_events_node ON node_status_events(node_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_node_status_events_created ON node_status_events(created_at);
+
+-- GPU 硬件健康问题
+-- critical 问题涉及的卡（gpu_index=-1 时为整个节点）不再参与预约、排队可用卡统计与抢占；
+-- xid 需管理员确认解除，其余问题在后续上报不再出现时自动解除。
+CREATE TABLE IF NOT EXISTS gpu_health_issues (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    gpu_index INT NOT NULL DEFAULT -1,      -- -1 表示节点级（掉卡、卡数不符、无法对应卡号的 Xid）
+    bus_id TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(30) NOT NULL,              -- ecc_uncorrected / retired_pages_pending / retired_pages / xid / gpu_lost / gpu_missing
+    severity VARCHAR(10) NOT NULL,          -- critical：停止分配；warning：仅提示
+    detail TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP NULL,
+    resolved_by VARCHAR(50) NOT NULL DEFAULT '', -- auto（不再出现时自动解除）或管理员
+    CHECK (severity IN ('critical', 'warning'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_gpu_health_issues_open ON gpu_health_issues(node_id, gpu_index, kind) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_gpu_health_issues_node ON gpu_health_issues(node_id, first_seen_at);
+
+-- 节点软硬件清单变化记录（驱动升级、换内核等）
+CREATE TABLE IF NOT EXISTS node_inventory_changes (
+    id BIGSERIAL PRIMARY KEY,
+    node_id VARCHAR(50) NOT NULL,
+    field VARCHAR(30) NOT NULL,             -- driver_version / cuda_version / kernel_version / os_release / memory_total_mb / disk_total_gb
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_inventory_changes_node ON node_inventory_changes(node_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_node_inventory_changes_time ON node_inventory_changes(changed_at);
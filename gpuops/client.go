@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	authToken  = "token"
+	authSocket = "socket"
+
+	defaultControllerURL = "http://controller:8000"
+	defaultAgentSocket   = "/run/gpu-node-agent/agent.sock"
+	sessionCookieName    = "gpuops_session"
+)
+
+// Client 封装两种鉴权方式：
+//   - token：直接访问控制器，携带登录签发的会话令牌（Authorization: Bearer）
+//   - socket：访问本机节点 Agent 的 Unix socket，身份由内核提供的对端 UID 决定
+type Client struct {
+	mode          string
+	controllerURL string
+	token         string
+	socketPath    string
+	http          *http.Client
+}
+
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("请求失败：HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("请求失败：HTTP %d：%s", e.Status, e.Message)
+}
+
+func newTokenClient(controllerURL string, token string) *Client {
+	return &Client{
+		mode:          authToken,
+		controllerURL: strings.TrimRight(controllerURL, "/"),
+		token:         token,
+		http:          &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func newSocketClient(socketPath string) *Client {
+	return &Client{
+		mode:       authSocket,
+		socketPath: socketPath,
+		http: &http.Client{
+			Timeout: 15 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// do 发送请求并返回响应体；非 2xx 时尽量解析 {"error": "..."} 作为错误信息。
+func (c *Client) do(ctx context.Context, method string, path string, body any) ([]byte, error) {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	base := c.controllerURL
+	if c.mode == authSocket {
+		// 经 Unix socket 访问时主机名不参与路由
+		base = "http://agent"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.mode == authToken && c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 16*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(b, &e)
+		msg := strings.TrimSpace(e.Error)
+		if msg == "" {
+			msg = strings.TrimSpace(string(b))
+		}
+		return nil, &apiError{Status: res.StatusCode, Message: msg}
+	}
+	return b, nil
+}
+
+// login 用账号密码登录控制器，返回会话令牌（即 Web 登录使用的 cookie 值）。
+func login(ctx context.Context, controllerURL string, username string, password string) (string, error) {
+	c := newTokenClient(controllerURL, "")
+	b, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.controllerURL+"/api/auth/login", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return "", &apiError{Status: res.StatusCode, Message: e.Error}
+	}
+	for _, ck := range res.Cookies() {
+		if ck.Name == sessionCookieName && ck.Value != "" {
+			return ck.Value, nil
+		}
+	}
+	return "", errors.New("登录成功但控制器未返回会话令牌")
+}
+
+func tokenFilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gpuops", "token"), nil
+}
+
+func loadSavedToken() string {
+	p, err := tokenFilePath()
+	if err != nil {
+		return ""
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func saveToken(token string) (string, error) {
+	p, err := tokenFilePath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", err
+	}
+	return p, os.WriteFile(p, []byte(token+"\n"), 0600)
+}
+
+func removeToken() error {
+	p, err := tokenFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
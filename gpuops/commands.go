@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type balanceResp struct {
+	Username      string  `json:"username"`
+	LocalUsername string  `json:"local_username"`
+	Balance       float64 `json:"balance"`
+	Status        string  `json:"status"`
+}
+
+type usageRecord struct {
+	NodeID     string    `json:"node_id"`
+	LocalUser  string    `json:"local_username"`
+	Timestamp  time.Time `json:"timestamp"`
+	PID        int32     `json:"pid"`
+	CPUPercent float64   `json:"cpu_percent"`
+	MemoryMB   float64   `json:"memory_mb"`
+	GPUCount   int       `json:"gpu_count"`
+	Command    string    `json:"command"`
+	Cost       float64   `json:"cost"`
+}
+
+type queueItem struct {
+	ID               int64         `json:"id"`
+	GPUType          string        `json:"gpu_type"`
+	Count            int           `json:"count"`
+	Timestamp        time.Time     `json:"timestamp"`
+	Position         int           `json:"position"`
+	EstimatedMinutes int           `json:"estimated_minutes"`
+	Estimate         *waitEstimate `json:"estimate"`
+}
+
+// waitEstimate 为控制器返回的等待预估区间（旧版控制器不返回）。
+type waitEstimate struct {
+	LowMinutes  int `json:"low_minutes"`
+	HighMinutes int `json:"high_minutes"`
+}
+
+// fmtWait 显示等待区间；没有区间时退回单个估计值。
+func fmtWait(expected int, est *waitEstimate) string {
+	if est == nil || est.HighMinutes <= est.LowMinutes {
+		return strconv.Itoa(expected)
+	}
+	return strconv.Itoa(est.LowMinutes) + "~" + strconv.Itoa(est.HighMinutes)
+}
+
+type announcement struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Pinned    bool      `json:"pinned"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// pick 按鉴权方式选择请求路径：token 方式访问控制器，socket 方式访问本机 Agent。
+func pick(c *Client, tokenPath string, socketPath string) string {
+	if c.mode == authSocket {
+		return socketPath
+	}
+	return tokenPath
+}
+
+func cmdLogin(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	defUser := ""
+	if u, err := user.Current(); err == nil {
+		defUser = u.Username
+	}
+	username := fs.String("u", defUser, "Web 登录用户名")
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	password := os.Getenv("GPUOPS_PASSWORD")
+	if password == "" {
+		var err error
+		if password, err = readPassword(fmt.Sprintf("%s 的密码：", *username)); err != nil {
+			return err
+		}
+	}
+	token, err := login(ctx, o.controllerURL, strings.TrimSpace(*username), password)
+	if err != nil {
+		return err
+	}
+	path, err := saveToken(token)
+	if err != nil {
+		return fmt.Errorf("保存令牌失败：%w", err)
+	}
+	fmt.Fprintf(stdout, "登录成功，令牌已保存到 %s\n", path)
+	return nil
+}
+
+// readPassword 从终端读取密码；终端下通过 stty 关闭回显。
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		stty := func(arg string) {
+			cmd := exec.Command("stty", arg)
+			cmd.Stdin = os.Stdin
+			_ = cmd.Run()
+		}
+		stty("-echo")
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("未读取到密码")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func cmdLogout(_ context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	if err := removeToken(); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "已删除本地令牌")
+	return nil
+}
+
+func cmdWhoami(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/auth/me", "/whoami"), nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	if c.mode == authSocket {
+		var r struct {
+			LocalUsername   string `json:"local_username"`
+			BillingUsername string `json:"billing_username"`
+			Bound           bool   `json:"bound"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+		bound := "否（按本地账号计费）"
+		if r.Bound {
+			bound = "是"
+		}
+		return printKV([][2]string{{"鉴权方式", "节点本地 socket"}, {"本地账号", r.LocalUsername}, {"计费账号", r.BillingUsername}, {"已绑定", bound}})
+	}
+	var r struct {
+		Authenticated bool   `json:"authenticated"`
+		Username      string `json:"username"`
+		Role          string `json:"role"`
+		ExpiresAt     string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	if !r.Authenticated {
+		return errors.New("令牌无效或已过期：请重新执行 gpuops login")
+	}
+	return printKV([][2]string{{"鉴权方式", "令牌"}, {"控制器", c.controllerURL}, {"账号", r.Username}, {"角色", r.Role}, {"令牌过期", r.ExpiresAt}})
+}
+
+func cmdBalance(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/user/me/balance", "/balance"), nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r balanceResp
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	pairs := [][2]string{{"计费账号", r.Username}}
+	if r.LocalUsername != "" && r.LocalUsername != r.Username {
+		pairs = append(pairs, [2]string{"本地账号", r.LocalUsername})
+	}
+	pairs = append(pairs, [2]string{"余额", fmtMoney(r.Balance) + " 元"}, [2]string{"状态", statusLabel(r.Status)})
+	return printKV(pairs)
+}
+
+func cmdUsage(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	limit := fs.Int("limit", 50, "返回条数（最大 5000）")
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return usageError("limit 必须大于 0")
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	q := "?limit=" + strconv.Itoa(*limit)
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/user/me/usage", "/usage")+q, nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		Records []usageRecord `json:"records"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(r.Records))
+	total := 0.0
+	for _, rec := range r.Records {
+		total += rec.Cost
+		rows = append(rows, []string{
+			fmtTime(rec.Timestamp), rec.NodeID, rec.LocalUser, strconv.Itoa(int(rec.PID)),
+			strconv.Itoa(rec.GPUCount), strconv.FormatFloat(rec.CPUPercent, 'f', 1, 64),
+			strconv.FormatFloat(rec.MemoryMB, 'f', 0, 64), strconv.FormatFloat(rec.Cost, 'f', 4, 64),
+			truncate(rec.Command, 40),
+		})
+	}
+	if err := printTable([]string{"时间", "节点", "本地账号", "PID", "GPU", "CPU%", "内存MB", "费用", "命令"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "共 %d 条，合计 %s 元\n", len(r.Records), strconv.FormatFloat(total, 'f', 4, 64))
+	return nil
+}
+
+func cmdRequest(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	preemptible := fs.Bool("preemptible", false, "可抢占申请（scavenger 档，排在普通申请之后；进程需设置 GPUOPS_TIER=scavenger 才按折扣计费）")
+	pos, err := parseFlags(o, fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) < 1 || len(pos) > 2 {
+		return usageError("用法：gpuops request <gpu类型> [数量]")
+	}
+	count := 1
+	if len(pos) == 2 {
+		if count, err = strconv.Atoi(pos[1]); err != nil || count <= 0 {
+			return usageError("数量必须是正整数")
+		}
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"gpu_type": pos[0], "count": count, "preemptible": *preemptible}
+	raw, err := c.do(ctx, http.MethodPost, pick(c, "/api/user/gpu/request", "/request"), body)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		ID               int64         `json:"id"`
+		Position         int           `json:"position"`
+		EstimatedMinutes int           `json:"estimated_minutes"`
+		Estimate         *waitEstimate `json:"estimate"`
+		Message          string        `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	return printKV([][2]string{
+		{"排队ID", strconv.FormatInt(r.ID, 10)},
+		{"位置", strconv.Itoa(r.Position)},
+		{"预估等待", fmtWait(r.EstimatedMinutes, r.Estimate) + " 分钟"},
+		{"说明", r.Message},
+	})
+}
+
+func cmdCancel(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	pos, err := parseFlags(o, fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("用法：gpuops cancel <排队ID>")
+	}
+	id, err := strconv.ParseInt(pos[0], 10, 64)
+	if err != nil || id <= 0 {
+		return usageError("排队ID 必须是正整数")
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	method, path := http.MethodDelete, "/api/user/gpu/queue/"+strconv.FormatInt(id, 10)
+	if c.mode == authSocket {
+		method, path = http.MethodPost, "/cancel?id="+strconv.FormatInt(id, 10)
+	}
+	raw, err := c.do(ctx, method, path, nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	fmt.Fprintf(stdout, "已取消排队 #%d\n", id)
+	return nil
+}
+
+func cmdQueue(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/user/gpu/queue", "/queue"), nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		QueueLength int         `json:"queue_length"`
+		Items       []queueItem `json:"items"`
+		FairShare   *struct {
+			UsageGPUMinutes float64 `json:"usage_gpu_minutes"`
+			Score           float64 `json:"score"`
+		} `json:"fair_share"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(r.Items))
+	for _, it := range r.Items {
+		rows = append(rows, []string{
+			strconv.FormatInt(it.ID, 10), it.GPUType, strconv.Itoa(it.Count),
+			strconv.Itoa(it.Position), fmtWait(it.EstimatedMinutes, it.Estimate), fmtTime(it.Timestamp),
+		})
+	}
+	if err := printTable([]string{"ID", "GPU类型", "数量", "位置", "预估等待(分钟)", "提交时间"}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "我的排队 %d 项，全局队列长度 %d\n", len(r.Items), r.QueueLength)
+	if r.FairShare != nil {
+		// 旧版控制器不返回 fair_share
+		fmt.Fprintf(stdout, "公平份额分数 %.4f（近期 GPU 用量 %.1f 卡分钟，分数越高越优先）\n", r.FairShare.Score, r.FairShare.UsageGPUMinutes)
+	}
+	return nil
+}
+
+type preemption struct {
+	NodeID        string    `json:"node_id"`
+	LocalUsername string    `json:"local_username"`
+	PID           int32     `json:"pid"`
+	GPUIDs        []int64   `json:"gpu_ids"`
+	Command       string    `json:"command"`
+	Reason        string    `json:"reason"`
+	Beneficiary   string    `json:"beneficiary"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func cmdPreemptions(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	limit := fs.Int("limit", 50, "返回条数（最大 2000）")
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return usageError("limit 必须大于 0")
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	q := "?limit=" + strconv.Itoa(*limit)
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/user/me/preemptions", "/preemptions")+q, nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		Preemptions []preemption `json:"preemptions"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	reasons := map[string]string{"queue": "排队请求", "reservation": "预约"}
+	rows := make([][]string, 0, len(r.Preemptions))
+	for _, p := range r.Preemptions {
+		gpus := make([]string, 0, len(p.GPUIDs))
+		for _, g := range p.GPUIDs {
+			gpus = append(gpus, strconv.FormatInt(g, 10))
+		}
+		rows = append(rows, []string{
+			fmtTime(p.CreatedAt), p.NodeID, p.LocalUsername, strconv.Itoa(int(p.PID)), strings.Join(gpus, ","),
+			reasons[p.Reason], p.Beneficiary, truncate(p.Command, 40),
+		})
+	}
+	return printTable([]string{"时间", "节点", "本地账号", "PID", "GPU", "原因", "获得者", "命令"}, rows)
+}
+
+func cmdBind(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	billing := fs.String("billing", "", "计费账号（Web 注册的用户名；token 方式默认为当前登录账号）")
+	nodeID := fs.String("node", "", "节点编号（token 方式必填；socket 方式自动取本机）")
+	local := fs.String("local", "", "节点上的本地账号（token 方式必填；socket 方式自动取调用者）")
+	message := fs.String("m", "", "备注（给审核管理员）")
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	if c.mode == authSocket {
+		if strings.TrimSpace(*billing) == "" {
+			return usageError("socket 方式需要 -billing 指定计费账号")
+		}
+		raw, err = c.do(ctx, http.MethodPost, "/bind", map[string]string{"billing_username": *billing, "message": *message})
+	} else {
+		if strings.TrimSpace(*nodeID) == "" || strings.TrimSpace(*local) == "" {
+			return usageError("token 方式需要 -node 与 -local")
+		}
+		if strings.TrimSpace(*billing) == "" {
+			me, err := c.do(ctx, http.MethodGet, "/api/auth/me", nil)
+			if err != nil {
+				return err
+			}
+			var r struct {
+				Username string `json:"username"`
+			}
+			if err := json.Unmarshal(me, &r); err != nil || r.Username == "" {
+				return errors.New("令牌无效或已过期：请重新执行 gpuops login")
+			}
+			*billing = r.Username
+		}
+		raw, err = c.do(ctx, http.MethodPost, "/api/requests/bind", map[string]any{
+			"billing_username": *billing,
+			"items":            []map[string]string{{"node_id": *nodeID, "local_username": *local}},
+			"message":          *message,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		RequestIDs []int `json:"request_ids"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(r.RequestIDs))
+	for _, id := range r.RequestIDs {
+		ids = append(ids, "#"+strconv.Itoa(id))
+	}
+	fmt.Fprintf(stdout, "已提交绑定登记 %s（计费账号 %s），请等待管理员审核\n", strings.Join(ids, " "), *billing)
+	return nil
+}
+
+func cmdAnnouncements(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error {
+	if _, err := parseFlags(o, fs, args); err != nil {
+		return err
+	}
+	// 公告无需登录：没有令牌也没有本机 socket 时直接匿名访问控制器
+	c, err := o.client()
+	if err != nil {
+		if o.auth != "auto" {
+			return err
+		}
+		c = newTokenClient(o.controllerURL, "")
+	}
+	raw, err := c.do(ctx, http.MethodGet, pick(c, "/api/announcements", "/notice"), nil)
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		return printJSON(raw)
+	}
+	var r struct {
+		Notice        []string       `json:"notice"`
+		Blocked       bool           `json:"blocked"`
+		BlockedReason string         `json:"blocked_reason"`
+		Announcements []announcement `json:"announcements"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	if r.Blocked {
+		fmt.Fprintf(stdout, "❌ 本机已限制你的 GPU 使用：%s\n\n", r.BlockedReason)
+	}
+	if len(r.Notice) > 0 {
+		fmt.Fprintln(stdout, "本机通知：")
+		for _, ln := range r.Notice {
+			fmt.Fprintf(stdout, "  %s\n", ln)
+		}
+		fmt.Fprintln(stdout)
+	}
+	if len(r.Announcements) == 0 {
+		fmt.Fprintln(stdout, "暂无公告")
+		return nil
+	}
+	for _, a := range r.Announcements {
+		pin := ""
+		if a.Pinned {
+			pin = "[置顶] "
+		}
+		fmt.Fprintf(stdout, "%s%s  (%s)\n%s\n\n", pin, a.Title, fmtTime(a.CreatedAt), strings.TrimSpace(a.Content))
+	}
+	return nil
+}
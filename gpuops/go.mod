@@ -0,0 +1,3 @@
+module hit-aiot-ops/gpuops
+
+go 1.21
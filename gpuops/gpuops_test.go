@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func captureStdout(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := stdout
+	stdout = &buf
+	t.Cleanup(func() { stdout = old })
+	return &buf
+}
+
+func TestTokenMode_BalanceTable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/user/me/balance" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"unauthorized"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"username":"alice","balance":80,"status":"warning"}`))
+	}))
+	defer srv.Close()
+
+	out := captureStdout(t)
+	if code := run([]string{"balance", "-controller", srv.URL, "-token", "tok"}); code != 0 {
+		t.Fatalf("exit=%d", code)
+	}
+	if s := out.String(); !strings.Contains(s, "alice") || !strings.Contains(s, "80.00 元") || !strings.Contains(s, "余额预警") {
+		t.Fatalf("unexpected output:\n%s", s)
+	}
+
+	if code := run([]string{"balance", "-controller", srv.URL, "-token", "bad"}); code != 1 {
+		t.Fatalf("expected failure exit=1, got %d", code)
+	}
+}
+
+func TestSocketMode_RequestAndCancel(t *testing.T) {
+	var got []string
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix socket 不可用：%v", err)
+	}
+	srv := &httptest.Server{Listener: ln, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.URL.RequestURI())
+		_, _ = w.Write([]byte(`{"status":"queued","id":7,"position":2,"estimated_minutes":20,"message":"ok"}`))
+	})}}
+	srv.Start()
+	defer srv.Close()
+
+	out := captureStdout(t)
+	// 位置参数之后的标志也要生效
+	if code := run([]string{"request", "A100", "2", "-auth", "socket", "-socket", sock, "-o", "json"}); code != 0 {
+		t.Fatalf("request exit=%d", code)
+	}
+	if !strings.Contains(out.String(), `"id": 7`) {
+		t.Fatalf("json output=%s", out.String())
+	}
+	if code := run([]string{"cancel", "7", "-auth", "socket", "-socket", sock}); code != 0 {
+		t.Fatalf("cancel exit=%d", code)
+	}
+	want := []string{"POST /request", "POST /cancel?id=7"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests=%v", got)
+	}
+
+	if code := run([]string{"request", "-auth", "socket", "-socket", sock}); code != 2 {
+		t.Fatalf("missing gpu type should be usage error, got %d", code)
+	}
+}
@@ -0,0 +1,188 @@
+// gpuops 是面向集群用户的命令行客户端：查询余额/用量、申请与取消 GPU 排队、提交账号绑定、查看公告。
+//
+// 鉴权方式：
+//   - 在计算节点上默认经本机 Agent 的 Unix socket 访问，无需登录（按调用者 UID 识别身份）
+//   - 其他机器上先 gpuops login，令牌保存在 ~/.config/gpuops/token，之后直接访问控制器
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var stdout io.Writer = os.Stdout
+
+type options struct {
+	controllerURL string
+	token         string
+	socketPath    string
+	auth          string // auto / token / socket
+	output        string // table / json
+}
+
+func envOr(key string, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.controllerURL, "controller", envOr("CONTROLLER_URL", defaultControllerURL), "控制器地址（token 方式使用）")
+	fs.StringVar(&o.token, "token", os.Getenv("GPUOPS_TOKEN"), "会话令牌（默认读取 gpuops login 保存的令牌）")
+	fs.StringVar(&o.socketPath, "socket", envOr("GPUOPS_AGENT_SOCKET", defaultAgentSocket), "节点 Agent 本地 socket 路径")
+	fs.StringVar(&o.auth, "auth", envOr("GPUOPS_AUTH", "auto"), "鉴权方式：auto / token / socket")
+	fs.StringVar(&o.output, "o", envOr("GPUOPS_OUTPUT", "table"), "输出格式：table / json")
+}
+
+func (o *options) validate() error {
+	switch o.output {
+	case "table", "json":
+	default:
+		return fmt.Errorf("不支持的输出格式：%s（可选 table / json）", o.output)
+	}
+	switch o.auth {
+	case "auto", authToken, authSocket:
+	default:
+		return fmt.Errorf("不支持的鉴权方式：%s（可选 auto / token / socket）", o.auth)
+	}
+	return nil
+}
+
+// client 按鉴权方式创建客户端；auto 时优先使用已有令牌，其次本机 Agent socket。
+func (o *options) client() (*Client, error) {
+	token := strings.TrimSpace(o.token)
+	if token == "" && o.auth != authSocket {
+		token = loadSavedToken()
+	}
+	switch o.auth {
+	case authToken:
+		if token == "" {
+			return nil, errors.New("未登录：请先执行 gpuops login 或通过 -token / GPUOPS_TOKEN 提供令牌")
+		}
+		return newTokenClient(o.controllerURL, token), nil
+	case authSocket:
+		return newSocketClient(o.socketPath), nil
+	}
+	if token != "" {
+		return newTokenClient(o.controllerURL, token), nil
+	}
+	if fi, err := os.Stat(o.socketPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		return newSocketClient(o.socketPath), nil
+	}
+	return nil, errors.New("未登录且本机没有节点 Agent socket：请先执行 gpuops login")
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, o *options, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"login", "login [-u 用户名]", "登录控制器并保存令牌", cmdLogin},
+	{"logout", "logout", "删除本地保存的令牌", cmdLogout},
+	{"whoami", "whoami", "显示当前身份（socket 方式下含计费账号映射）", cmdWhoami},
+	{"balance", "balance", "查询余额与状态", cmdBalance},
+	{"usage", "usage [-limit N]", "查询最近的用量记录", cmdUsage},
+	{"request", "request [-preemptible] <gpu类型> [数量]", "申请 GPU（加入排队）", cmdRequest},
+	{"cancel", "cancel <排队ID>", "取消自己的排队申请", cmdCancel},
+	{"queue", "queue", "查看自己的排队状态", cmdQueue},
+	{"preemptions", "preemptions [-limit N]", "查看自己被抢占的 scavenger 进程", cmdPreemptions},
+	{"bind", "bind -billing <计费账号> [-node 节点 -local 本地账号] [-m 备注]", "提交账号绑定登记（需管理员审核）", cmdBind},
+	{"announcements", "announcements", "查看公告（socket 方式下含本机通知）", cmdAnnouncements},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "用法：gpuops <命令> [参数]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-64s %s\n", c.usage, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "通用参数：-o table|json  -auth auto|token|socket  -controller URL  -token T  -socket PATH")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "未知命令：%s\n\n", args[0])
+		usage(os.Stderr)
+		return 2
+	}
+
+	var o options
+	fs := flag.NewFlagSet("gpuops "+cmd.name, flag.ContinueOnError)
+	o.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法：gpuops %s\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := cmd.run(ctx, &o, fs, args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "gpuops %s：%v\n", cmd.name, err)
+		var ue usageError
+		if errors.As(err, &ue) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// parseFlags 允许标志出现在位置参数之后（例如 gpuops request A100 2 -o json）。
+func parseFlags(o *options, fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if err := o.validate(); err != nil {
+		return nil, usageError(err.Error())
+	}
+	return positional, nil
+}
@@ -10,10 +10,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-	"syscall"
 	"time"
-
-	"github.com/shirou/gopsutil/v3/process"
 )
 
 func loadSSHExemptUsers() map[string]struct{} {
@@ -36,17 +33,29 @@ func loadSSHExemptUsers() map[string]struct{} {
 }
 
 func (a *NodeAgent) ExecuteAction(ctx context.Context, action Action) error {
+	if err := a.executeAction(ctx, action); err != nil {
+		return err
+	}
+	a.recordEnforcement(action)
+	return nil
+}
+
+func (a *NodeAgent) executeAction(ctx context.Context, action Action) error {
 	switch action.Type {
 	case "notify":
 		return a.writeNotice(action.Username, action.Message)
 	case "block_user":
-		return a.blockUserGPUAccess(action.Username, action.Reason)
+		return a.blockUserGPUAccess(ctx, action.Username, action.Reason)
 	case "unblock_user":
-		return a.unblockUserGPUAccess(action.Username)
+		return a.unblockUserGPUAccess(ctx, action.Username)
 	case "set_cpu_quota":
 		return a.setUserCPUQuota(ctx, action.Username, action.CPUQuotaPercent, action.Reason)
+	case "set_memory_limit":
+		return a.setUserMemoryLimit(ctx, action.Username, action.MemoryHighMB, action.MemoryMaxMB, action.Reason)
+	case "set_tasks_limit":
+		return a.setUserTasksLimit(ctx, action.Username, action.TasksMax, action.Reason)
 	case "kill_process":
-		return a.killProcesses(ctx, action.Username, action.PIDs, action.Reason)
+		return a.killProcesses(ctx, action.Username, action.PIDs, action.Reason, action.KillLadder)
 	case "kick_ssh_all":
 		return a.kickAllSSH(ctx, action.Reason)
 	case "kick_ssh_user":
@@ -147,7 +156,7 @@ func (a *NodeAgent) writeNotice(username string, message string) error {
 	return os.WriteFile(noticeFile, []byte(content), 0644)
 }
 
-func (a *NodeAgent) blockUserGPUAccess(username string, reason string) error {
+func (a *NodeAgent) blockUserGPUAccess(ctx context.Context, username string, reason string) error {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return errors.New("username 不能为空")
@@ -157,10 +166,19 @@ func (a *NodeAgent) blockUserGPUAccess(username string, reason string) error {
 	if strings.TrimSpace(reason) == "" {
 		reason = "余额不足，限制新 GPU 任务"
 	}
-	return os.WriteFile(flagFile, []byte(reason+"\n"), 0644)
+	if err := os.WriteFile(flagFile, []byte(reason+"\n"), 0644); err != nil {
+		return err
+	}
+	if !a.gpuDeviceBlock {
+		return nil
+	}
+	if err := a.applyGPUDeviceBlock(ctx, username, true); err != nil {
+		return fmt.Errorf("已写入 .gpu_blocked，但 GPU 设备封禁失败：%w", err)
+	}
+	return nil
 }
 
-func (a *NodeAgent) unblockUserGPUAccess(username string) error {
+func (a *NodeAgent) unblockUserGPUAccess(ctx context.Context, username string) error {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return errors.New("username 不能为空")
@@ -169,54 +187,8 @@ func (a *NodeAgent) unblockUserGPUAccess(username string) error {
 	if err := os.Remove(flagFile); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return nil
-}
-
-func (a *NodeAgent) killProcesses(ctx context.Context, username string, pids []int32, reason string) error {
-	username = strings.TrimSpace(username)
-	if username == "" {
-		return errors.New("username 不能为空")
-	}
-	if len(pids) == 0 {
+	if !a.gpuDeviceBlock {
 		return nil
 	}
-
-	log.Printf("执行 kill_process：user=%s pids=%v reason=%s", username, pids, strings.TrimSpace(reason))
-
-	for _, pid := range pids {
-		proc, err := process.NewProcess(pid)
-		if err != nil {
-			continue
-		}
-		procUser, err := proc.Username()
-		if err != nil || procUser != username {
-			continue
-		}
-
-		_ = syscall.Kill(int(pid), syscall.SIGTERM)
-	}
-
-	// 给进程一点退出时间，避免直接 SIGKILL 造成数据损坏
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(5 * time.Second):
-	}
-
-	for _, pid := range pids {
-		proc, err := process.NewProcess(pid)
-		if err != nil {
-			continue
-		}
-		procUser, err := proc.Username()
-		if err != nil || procUser != username {
-			continue
-		}
-		if err := syscall.Kill(int(pid), syscall.SIGKILL); err != nil {
-			// 可能已经退出，不视为硬错误
-			log.Printf("SIGKILL 失败 pid=%d err=%v", pid, err)
-		}
-	}
-
-	return nil
+	return a.applyGPUDeviceBlock(ctx, username, false)
 }
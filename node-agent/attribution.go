@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// 进程归属：root 或共享服务账号启动的进程（docker/podman 以 root 运行的容器、sudo 拉起的作业等）
+// 按以下依据归属到真实用户，依次尝试，命中即止：
+//  1. container_label：进程位于 docker/podman 容器 cgroup，容器带 gpuops.user 等标签（ATTRIBUTION_LABELS）
+//  2. cgroup：进程位于某个用户的 user-<uid>.slice（例如在登录会话里 sudo 启动）
+//  3. userns：进程 UID 落在 /etc/subuid 中某用户的子 UID 区间（rootless 容器内的非 root 用户）
+//  4. env：进程环境变量 SUDO_USER（须与进程 loginuid 一致）；属主在 ATTRIBUTION_ENV_USERS 中时另认 GPUOPS_USER
+//
+// 归属结果必须是本机存在的普通账号，不能是 root 或共享服务账号本身；都不命中时与原来一样不计费。
+
+const (
+	subuidPath             = "/etc/subuid"
+	containerOwnerCacheTTL = 10 * time.Minute
+)
+
+var defaultAttributionLabels = []string{"gpuops.user"}
+
+// loginUIDUnset 为未经登录会话启动的进程（系统服务、容器）的 loginuid。
+const loginUIDUnset = "4294967295"
+
+var (
+	userSliceUIDPattern = regexp.MustCompile(`/user-(\d+)\.slice(/|$)`)
+	containerIDPattern  = regexp.MustCompile(`(?:docker-|/docker/|libpod-)([0-9a-f]{12,64})`)
+)
+
+type containerOwner struct {
+	username string
+	at       time.Time
+}
+
+// processOwner 返回进程属主用户名；UID 在本机没有对应账号时（容器内 UID、子 UID 区间）返回 "uid:<n>"。
+func processOwner(proc *process.Process) (string, uint32, error) {
+	uids, err := proc.Uids()
+	if err != nil || len(uids) == 0 {
+		return "", 0, err
+	}
+	uid := uint32(uids[0])
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		return u.Username, uid, nil
+	}
+	return "uid:" + strconv.FormatUint(uint64(uid), 10), uid, nil
+}
+
+// needsAttribution 判断属主是否需要再归属：root、配置的共享服务账号，或本机不存在的 UID。
+func (a *NodeAgent) needsAttribution(owner string) bool {
+	if owner == "root" || strings.HasPrefix(owner, "uid:") {
+		return true
+	}
+	_, ok := a.attributeUsers[owner]
+	return ok
+}
+
+// attributeProcess 返回进程应归属的用户与依据；无法归属时返回空字符串。
+func (a *NodeAgent) attributeProcess(ctx context.Context, pid int32, uid uint32) (string, string) {
+	cgPath, _, _ := readProcCgroupPath(procFSRoot, pid)
+
+	if id, runtime := containerIDFromCgroup(cgPath); id != "" {
+		if u := a.containerLabelUser(ctx, runtime, id); a.validAttributedUser(u) {
+			return u, "container_label"
+		}
+	}
+	if sliceUID, ok := userSliceUID(cgPath); ok && sliceUID != uid {
+		if u, err := user.LookupId(strconv.FormatUint(uint64(sliceUID), 10)); err == nil && a.validAttributedUser(u.Username) {
+			return u.Username, "cgroup"
+		}
+	}
+	if u := subuidOwner(subuidPath, uid); a.validAttributedUser(u) {
+		return u, "userns"
+	}
+	if u := envAttributedUser(procFSRoot, pid, a.trustsEnvUser(uid)); a.validAttributedUser(u) {
+		return u, "env"
+	}
+	return "", ""
+}
+
+// trustsEnvUser 判断是否采信进程环境中的 GPUOPS_USER：只有属主在 ATTRIBUTION_ENV_USERS 中
+// （启动脚本由管理员维护的服务账号）才采信，否则任何能控制自身环境的账号都能把费用记到别人名下。
+func (a *NodeAgent) trustsEnvUser(uid uint32) bool {
+	if len(a.attributionEnvUsers) == 0 {
+		return false
+	}
+	owner := "uid:" + strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		owner = u.Username
+	}
+	_, ok := a.attributionEnvUsers[owner]
+	return ok
+}
+
+func (a *NodeAgent) validAttributedUser(username string) bool {
+	username = strings.TrimSpace(username)
+	if username == "" || a.needsAttribution(username) {
+		return false
+	}
+	_, err := user.Lookup(username)
+	return err == nil
+}
+
+// userSliceUID 从 cgroup 路径中取出 user-<uid>.slice 的 UID（v1/v2 路径格式一致）。
+func userSliceUID(cgroupPath string) (uint32, bool) {
+	m := userSliceUIDPattern.FindStringSubmatch(cgroupPath)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(m[1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// containerIDFromCgroup 识别 docker / podman 容器 ID；containerd / k8s 没有统一的标签查询方式，不处理。
+func containerIDFromCgroup(cgroupPath string) (id string, runtime string) {
+	m := containerIDPattern.FindStringSubmatch(cgroupPath)
+	if m == nil {
+		return "", ""
+	}
+	if strings.Contains(m[0], "libpod-") {
+		return m[1], "podman"
+	}
+	return m[1], "docker"
+}
+
+// subuidOwner 返回子 UID 区间包含 uid 的用户（/etc/subuid 每行 name:start:count）。
+func subuidOwner(path string, uid uint32) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Split(strings.TrimSpace(sc.Text()), ":")
+		if len(parts) != 3 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+		start, err1 := strconv.ParseUint(parts[1], 10, 32)
+		count, err2 := strconv.ParseUint(parts[2], 10, 32)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if uint64(uid) >= start && uint64(uid) < start+count {
+			// 名字也可能写成 UID
+			if _, err := strconv.Atoi(parts[0]); err == nil {
+				if u, err := user.LookupId(parts[0]); err == nil {
+					return u.Username
+				}
+				return ""
+			}
+			return parts[0]
+		}
+	}
+	return ""
+}
+
+// readProcEnviron 解析 /proc/<pid>/environ（以 NUL 分隔的 KEY=VALUE）；读取失败返回 nil。
+func readProcEnviron(procRoot string, pid int32) map[string]string {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(int(pid)), "environ"))
+	if err != nil {
+		return nil
+	}
+	env := make(map[string]string)
+	for _, kv := range strings.Split(string(b), "\x00") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// envAttributedUser 读取 /proc/<pid>/environ 中的归属用户。环境变量可由进程属主任意设置：
+// GPUOPS_USER 只在 trustGPUOpsUser（属主在管理员白名单中）时采信；
+// SUDO_USER 只在与进程的 loginuid（登录会话的真实用户，sudo 与容器内无法修改）一致时采信。
+func envAttributedUser(procRoot string, pid int32, trustGPUOpsUser bool) string {
+	env := readProcEnviron(procRoot, pid)
+	if v := strings.TrimSpace(env["GPUOPS_USER"]); v != "" && trustGPUOpsUser {
+		return v
+	}
+	if v := strings.TrimSpace(env["SUDO_USER"]); v != "" && loginUIDMatches(procRoot, pid, v) {
+		return v
+	}
+	return ""
+}
+
+// loginUIDMatches 判断进程的 /proc/<pid>/loginuid 是否为 username 的 UID；未设置 loginuid 时不匹配。
+func loginUIDMatches(procRoot string, pid int32, username string) bool {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(int(pid)), "loginuid"))
+	if err != nil {
+		return false
+	}
+	id := strings.TrimSpace(string(b))
+	if id == "" || id == loginUIDUnset {
+		return false
+	}
+	u, err := user.Lookup(username)
+	return err == nil && u.Uid == id
+}
+
+// containerLabelUser 通过 docker/podman inspect 读取容器标签，结果（含未命中）缓存一段时间。
+func (a *NodeAgent) containerLabelUser(ctx context.Context, runtime string, id string) string {
+	key := runtime + "/" + id
+	a.attrMu.Lock()
+	if c, ok := a.containerOwners[key]; ok && time.Since(c.at) < containerOwnerCacheTTL {
+		a.attrMu.Unlock()
+		return c.username
+	}
+	a.attrMu.Unlock()
+
+	username := ""
+	if hasCommand(runtime) {
+		inspectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		out, err := exec.CommandContext(inspectCtx, runtime, "inspect", "--format", "{{json .Config.Labels}}", id).Output()
+		cancel()
+		if err == nil {
+			username = labelUser(out, a.attributionLabels)
+		}
+	}
+
+	a.attrMu.Lock()
+	defer a.attrMu.Unlock()
+	now := time.Now()
+	for k, c := range a.containerOwners {
+		if now.Sub(c.at) >= containerOwnerCacheTTL {
+			delete(a.containerOwners, k)
+		}
+	}
+	a.containerOwners[key] = containerOwner{username: username, at: now}
+	return username
+}
+
+// labelUser 从 inspect 输出的标签 JSON 中按 keys 顺序取第一个非空值。
+func labelUser(inspectJSON []byte, keys []string) string {
+	var labels map[string]string
+	if err := json.Unmarshal(inspectJSON, &labels); err != nil {
+		return ""
+	}
+	for _, k := range keys {
+		if v := strings.TrimSpace(labels[strings.TrimSpace(k)]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserSliceUIDAndContainerID(t *testing.T) {
+	if uid, ok := userSliceUID("/user.slice/user-1001.slice/session-3.scope"); !ok || uid != 1001 {
+		t.Fatalf("uid=%d ok=%v", uid, ok)
+	}
+	if _, ok := userSliceUID("/system.slice/docker-0123456789abcdef.scope"); ok {
+		t.Fatal("system slice should not match")
+	}
+
+	cases := map[string][2]string{
+		"/system.slice/docker-0123456789abcdef0123.scope":        {"0123456789abcdef0123", "docker"},
+		"/docker/0123456789abcdef0123":                           {"0123456789abcdef0123", "docker"},
+		"/machine.slice/libpod-fedcba9876543210.scope/container": {"fedcba9876543210", "podman"},
+		"/kubepods/besteffort/pod1/0123456789abcdef":             {"", ""},
+	}
+	for path, want := range cases {
+		id, runtime := containerIDFromCgroup(path)
+		if id != want[0] || runtime != want[1] {
+			t.Fatalf("%s: id=%s runtime=%s", path, id, runtime)
+		}
+	}
+}
+
+func TestSubuidOwnerEnvAndLabels(t *testing.T) {
+	dir := t.TempDir()
+	subuid := filepath.Join(dir, "subuid")
+	if err := os.WriteFile(subuid, []byte("# comment\nalice:100000:65536\nbob:165536:65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if u := subuidOwner(subuid, 165537); u != "bob" {
+		t.Fatalf("owner=%q", u)
+	}
+	if u := subuidOwner(subuid, 1000); u != "" {
+		t.Fatalf("owner=%q", u)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "42"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := "PATH=/usr/bin\x00SUDO_USER=" + me.Username + "\x00GPUOPS_USER=carol\x00"
+	if err := os.WriteFile(filepath.Join(dir, "42", "environ"), []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 loginuid（服务 / 容器进程）：SUDO_USER 不可信；GPUOPS_USER 只在属主被信任时采信
+	if u := envAttributedUser(dir, 42, false); u != "" {
+		t.Fatalf("untrusted env user=%q", u)
+	}
+	if u := envAttributedUser(dir, 42, true); u != "carol" {
+		t.Fatalf("trusted env user=%q", u)
+	}
+	writeLoginUID := func(id string) {
+		if err := os.WriteFile(filepath.Join(dir, "42", "loginuid"), []byte(id+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLoginUID(me.Uid)
+	if u := envAttributedUser(dir, 42, false); u != me.Username {
+		t.Fatalf("SUDO_USER matching loginuid should be trusted: %q", u)
+	}
+	writeLoginUID("4294967295")
+	if u := envAttributedUser(dir, 42, false); u != "" {
+		t.Fatalf("unset loginuid should not trust SUDO_USER: %q", u)
+	}
+	writeLoginUID(me.Uid + "1")
+	if u := envAttributedUser(dir, 42, false); u != "" {
+		t.Fatalf("mismatched loginuid should not trust SUDO_USER: %q", u)
+	}
+
+	labels := []byte(`{"gpuops.user":"","owner":"dave","maintainer":"x"}`)
+	if u := labelUser(labels, []string{"gpuops.user", "owner"}); u != "dave" {
+		t.Fatalf("label user=%q", u)
+	}
+	if u := labelUser([]byte("null"), defaultAttributionLabels); u != "" {
+		t.Fatalf("label user=%q", u)
+	}
+}
+
+func TestProcessEnvTags(t *testing.T) {
+	env := map[string]string{"SLURM_JOB_ID": "4242", "GPUOPS_PROJECT": " vision ", "AWS_SECRET_ACCESS_KEY": "x", "GPUOPS_JOB": ""}
+	tags := processEnvTags(env, defaultProcessEnvTags)
+	if len(tags) != 2 || tags["SLURM_JOB_ID"] != "4242" || tags["GPUOPS_PROJECT"] != "vision" {
+		t.Fatalf("tags=%v", tags)
+	}
+	if tags := processEnvTags(nil, defaultProcessEnvTags); tags != nil {
+		t.Fatalf("tags=%v", tags)
+	}
+	if l := parseEnvTagList("off"); l != nil {
+		t.Fatalf("list=%v", l)
+	}
+	if l := parseEnvTagList(" MY_TAG, ,OTHER "); len(l) != 2 || l[0] != "MY_TAG" || l[1] != "OTHER" {
+		t.Fatalf("list=%v", l)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 限制状态校正：控制器只在状态变化时下发 block_user / set_cpu_quota 等动作，
+// systemd --runtime 属性和 cgroup 写入在重启、slice 重建或人工修改后都会丢失。
+// Agent 周期性向控制器获取本机账号的期望状态，与实际状态比较，修复偏差并回报。
+//
+// enforcement_state.json 记录 Agent 自己最后一次成功施加的限制：只有期望值或已施加值非零的项目才比较，
+// 避免把 logind 默认的 TasksMax=33% 等系统自带配置误判为偏差。
+
+const enforcementStateFile = "enforcement_state.json"
+
+func (a *NodeAgent) enforcementStatePath() string {
+	return filepath.Join(a.stateDir, enforcementStateFile)
+}
+
+// loadEnforcementStateLocked 读取已施加状态（调用方持有 enforceMu），文件不存在时返回空表。
+func (a *NodeAgent) loadEnforcementStateLocked() map[string]NodeEnforcement {
+	if a.enforceState != nil {
+		return a.enforceState
+	}
+	a.enforceState = map[string]NodeEnforcement{}
+	b, err := os.ReadFile(a.enforcementStatePath())
+	if err != nil {
+		return a.enforceState
+	}
+	if err := json.Unmarshal(b, &a.enforceState); err != nil {
+		a.logger.Printf("解析 %s 失败，将重新记录：%v", enforcementStateFile, err)
+		a.enforceState = map[string]NodeEnforcement{}
+	}
+	return a.enforceState
+}
+
+func (a *NodeAgent) saveEnforcementStateLocked() {
+	if err := os.MkdirAll(a.stateDir, 0755); err != nil {
+		a.logger.Printf("创建 state 目录失败：%v", err)
+		return
+	}
+	b, _ := json.MarshalIndent(a.enforceState, "", "  ")
+	tmp := a.enforcementStatePath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		a.logger.Printf("写 %s 失败：%v", enforcementStateFile, err)
+		return
+	}
+	_ = os.Rename(tmp, a.enforcementStatePath())
+}
+
+func enforcementIsZero(e NodeEnforcement) bool {
+	return !e.GPUBlocked && e.CPUQuotaPercent <= 0 && e.MemoryHighMB <= 0 && e.MemoryMaxMB <= 0 && e.TasksMax <= 0
+}
+
+// updateEnforcementState 修改某账号的已施加状态并落盘，全部为零时删除该账号。
+func (a *NodeAgent) updateEnforcementState(username string, fn func(*NodeEnforcement)) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return
+	}
+	a.enforceMu.Lock()
+	defer a.enforceMu.Unlock()
+	state := a.loadEnforcementStateLocked()
+	e := state[username]
+	e.LocalUsername = username
+	fn(&e)
+	if enforcementIsZero(e) {
+		if _, ok := state[username]; !ok {
+			return
+		}
+		delete(state, username)
+	} else {
+		state[username] = e
+	}
+	a.saveEnforcementStateLocked()
+}
+
+// recordEnforcement 在限制类动作执行成功后记录已施加状态。
+func (a *NodeAgent) recordEnforcement(action Action) {
+	switch action.Type {
+	case "block_user":
+		a.updateEnforcementState(action.Username, func(e *NodeEnforcement) { e.GPUBlocked = true })
+	case "unblock_user":
+		a.updateEnforcementState(action.Username, func(e *NodeEnforcement) { e.GPUBlocked = false })
+	case "set_cpu_quota":
+		a.updateEnforcementState(action.Username, func(e *NodeEnforcement) { e.CPUQuotaPercent = action.CPUQuotaPercent })
+	case "set_memory_limit":
+		a.updateEnforcementState(action.Username, func(e *NodeEnforcement) {
+			e.MemoryHighMB, e.MemoryMaxMB = action.MemoryHighMB, action.MemoryMaxMB
+		})
+	case "set_tasks_limit":
+		a.updateEnforcementState(action.Username, func(e *NodeEnforcement) { e.TasksMax = action.TasksMax })
+	}
+}
+
+// localEnforcementUsers 返回需要校正的本机账号：/home 下的目录 ∪ 已施加过限制的账号。
+func (a *NodeAgent) localEnforcementUsers() []string {
+	seen := map[string]struct{}{}
+	if entries, err := os.ReadDir("/home"); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				seen[e.Name()] = struct{}{}
+			}
+		}
+	}
+	a.enforceMu.Lock()
+	for u := range a.loadEnforcementStateLocked() {
+		seen[u] = struct{}{}
+	}
+	a.enforceMu.Unlock()
+	out := make([]string, 0, len(seen))
+	for u := range seen {
+		out = append(out, u)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// observedEnforcement 为实际观测到的限制；Observable=false 时只知道 .gpu_blocked 标记，其余项目无法读取。
+type observedEnforcement struct {
+	Observable      bool
+	GPUBlocked      bool
+	CPUQuotaPercent float64
+	MemoryHighMB    int64
+	MemoryMaxMB     int64
+	TasksMax        int64
+}
+
+// parseSystemdSliceProps 解析 `systemctl show -p ...` 输出；infinity 视为不限制（0）。
+// 返回值中的 devicePolicy 用于判断设备封禁（closed/strict 视为封禁）。
+func parseSystemdSliceProps(out string) (obs observedEnforcement, devicePolicy string) {
+	obs.Observable = true
+	for _, ln := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(ln), "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "CPUQuotaPerSecUSec":
+			if v == "infinity" || v == "" {
+				continue
+			}
+			// systemd 以时长显示，如 "500ms"、"1s"、"1min 30s"
+			d, err := time.ParseDuration(strings.ReplaceAll(strings.ReplaceAll(v, "min", "m"), " ", ""))
+			if err == nil {
+				obs.CPUQuotaPercent = float64(d.Microseconds()) / 10000
+			}
+		case "MemoryHigh":
+			obs.MemoryHighMB = parseLimitBytesMB(v)
+		case "MemoryMax":
+			obs.MemoryMaxMB = parseLimitBytesMB(v)
+		case "TasksMax":
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+				obs.TasksMax = n
+			}
+		case "DevicePolicy":
+			devicePolicy = v
+		}
+	}
+	return obs, devicePolicy
+}
+
+// parseLimitBytesMB 把字节数（cgroup 文件或 systemd 属性）换算成 MB，"max"/"infinity" 返回 0。
+func parseLimitBytesMB(v string) int64 {
+	n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	if err != nil || n == 0 || n >= math.MaxInt64 {
+		return 0
+	}
+	return int64(n / uint64(mb))
+}
+
+func readCgroupV2Value(dir string, file string) (string, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+func (a *NodeAgent) observeEnforcement(ctx context.Context, username string) observedEnforcement {
+	var obs observedEnforcement
+	_, flagErr := os.Stat(filepath.Join("/home", username, ".gpu_blocked"))
+	flag := flagErr == nil
+
+	uid, err := lookupUID(ctx, username)
+	if err != nil {
+		obs.GPUBlocked = flag
+		return obs
+	}
+	if isSystemd() && hasCommand("systemctl") {
+		out, err := exec.CommandContext(ctx, "systemctl", "show", fmt.Sprintf("user-%d.slice", uid),
+			"-p", "CPUQuotaPerSecUSec", "-p", "MemoryHigh", "-p", "MemoryMax", "-p", "TasksMax", "-p", "DevicePolicy").Output()
+		if err == nil {
+			obs, policy := parseSystemdSliceProps(string(out))
+			obs.GPUBlocked = flag
+			// cgroup v1 devices 规则无法从 systemd 读取，只在 systemd 方式下额外检查 DevicePolicy
+			if a.gpuDeviceBlock && flag {
+				if _, err := findCgroupV1MountPoint("devices"); err != nil && policy == "auto" {
+					obs.GPUBlocked = false
+				}
+			}
+			return obs
+		}
+	}
+	if dir, err := userSliceDirV2(cgroupFSRoot, uid, "cpu.max"); err == nil {
+		obs.Observable = true
+		if v, ok := readCgroupV2Value(dir, "cpu.max"); ok {
+			if f := strings.Fields(v); len(f) == 2 && f[0] != "max" {
+				quota, _ := strconv.ParseFloat(f[0], 64)
+				period, _ := strconv.ParseFloat(f[1], 64)
+				if period > 0 {
+					// cpu.max 是总配额，与 CPUQuota 一致按单核百分比计
+					obs.CPUQuotaPercent = quota / period * 100
+				}
+			}
+		}
+		if v, ok := readCgroupV2Value(dir, "memory.high"); ok {
+			obs.MemoryHighMB = parseLimitBytesMB(v)
+		}
+		if v, ok := readCgroupV2Value(dir, "memory.max"); ok {
+			obs.MemoryMaxMB = parseLimitBytesMB(v)
+		}
+		if v, ok := readCgroupV2Value(dir, "pids.max"); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				obs.TasksMax = n
+			}
+		}
+	}
+	obs.GPUBlocked = flag
+	return obs
+}
+
+// compareEnforcement 返回期望与实际不一致的项目（gpu_block / cpu_quota / memory / tasks）。
+// 只比较期望值或已施加值非零的项目；无法观测时把期望中的限制视为需要重新施加。
+func compareEnforcement(want NodeEnforcement, last NodeEnforcement, obs observedEnforcement) []EnforcementDrift {
+	var out []EnforcementDrift
+	add := func(item, expected, actual string) {
+		out = append(out, EnforcementDrift{LocalUsername: want.LocalUsername, Item: item, Expected: expected, Actual: actual})
+	}
+
+	if want.GPUBlocked || last.GPUBlocked || obs.GPUBlocked {
+		if want.GPUBlocked != obs.GPUBlocked {
+			add("gpu_block", strconv.FormatBool(want.GPUBlocked), strconv.FormatBool(obs.GPUBlocked))
+		}
+	}
+	if !obs.Observable {
+		// 只能确认标记文件；限制类项目按期望重新施加（幂等），不作为偏差回报
+		return out
+	}
+	if want.CPUQuotaPercent > 0 || last.CPUQuotaPercent > 0 {
+		if math.Abs(want.CPUQuotaPercent-obs.CPUQuotaPercent) > 0.5 {
+			add("cpu_quota", fmt.Sprintf("%.2f", want.CPUQuotaPercent), fmt.Sprintf("%.2f", obs.CPUQuotaPercent))
+		}
+	}
+	if want.MemoryHighMB > 0 || want.MemoryMaxMB > 0 || last.MemoryHighMB > 0 || last.MemoryMaxMB > 0 {
+		if want.MemoryHighMB != obs.MemoryHighMB || want.MemoryMaxMB != obs.MemoryMaxMB {
+			add("memory", fmt.Sprintf("high=%dM max=%dM", want.MemoryHighMB, want.MemoryMaxMB),
+				fmt.Sprintf("high=%dM max=%dM", obs.MemoryHighMB, obs.MemoryMaxMB))
+		}
+	}
+	if want.TasksMax > 0 || last.TasksMax > 0 {
+		if want.TasksMax != obs.TasksMax {
+			add("tasks", strconv.FormatInt(want.TasksMax, 10), strconv.FormatInt(obs.TasksMax, 10))
+		}
+	}
+	return out
+}
+
+func (a *NodeAgent) repairEnforcement(ctx context.Context, want NodeEnforcement, item string) error {
+	reason := want.Reason
+	if reason == "" {
+		reason = "enforcement reconcile"
+	}
+	switch item {
+	case "gpu_block":
+		if want.GPUBlocked {
+			return a.blockUserGPUAccess(ctx, want.LocalUsername, reason)
+		}
+		return a.unblockUserGPUAccess(ctx, want.LocalUsername)
+	case "cpu_quota":
+		return a.setUserCPUQuota(ctx, want.LocalUsername, want.CPUQuotaPercent, reason)
+	case "memory":
+		return a.setUserMemoryLimit(ctx, want.LocalUsername, want.MemoryHighMB, want.MemoryMaxMB, reason)
+	case "tasks":
+		return a.setUserTasksLimit(ctx, want.LocalUsername, want.TasksMax, reason)
+	}
+	return fmt.Errorf("未知校正项目：%s", item)
+}
+
+// reconcileEnforcement 获取期望状态并校正；控制器不可达时退回只按 .gpu_blocked 补齐设备封禁。
+func (a *NodeAgent) reconcileEnforcement(ctx context.Context) {
+	users := a.localEnforcementUsers()
+	fetchCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	desired, err := a.fetchEnforcement(fetchCtx, users)
+	cancel()
+	if err != nil {
+		a.logger.Printf("获取期望限制状态失败，仅补齐本地 GPU 封禁：%v", err)
+		a.reconcileGPUBlocks(ctx)
+		return
+	}
+
+	wantBy := make(map[string]NodeEnforcement, len(desired))
+	for _, d := range desired {
+		wantBy[d.LocalUsername] = d
+	}
+	a.enforceMu.Lock()
+	lastBy := make(map[string]NodeEnforcement)
+	for u, e := range a.loadEnforcementStateLocked() {
+		lastBy[u] = e
+	}
+	a.enforceMu.Unlock()
+
+	var drift []EnforcementDrift
+	for _, u := range users {
+		want, ok := wantBy[u]
+		if !ok {
+			want = NodeEnforcement{LocalUsername: u}
+		}
+		last := lastBy[u]
+		if enforcementIsZero(want) && enforcementIsZero(last) {
+			if _, err := os.Stat(filepath.Join("/home", u, ".gpu_blocked")); err != nil {
+				continue
+			}
+		}
+
+		userCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		obs := a.observeEnforcement(userCtx, u)
+		items := compareEnforcement(want, last, obs)
+		failed := false
+		for i := range items {
+			items[i].DetectedAt = time.Now()
+			if err := a.repairEnforcement(userCtx, want, items[i].Item); err != nil {
+				items[i].Error = err.Error()
+				failed = true
+				a.logger.Printf("限制校正失败：user=%s item=%s err=%v", u, items[i].Item, err)
+				continue
+			}
+			items[i].Repaired = true
+		}
+		if !obs.Observable && !enforcementIsZero(want) {
+			// 无法读取 cgroup 时按期望幂等地重新施加限制
+			if want.CPUQuotaPercent > 0 {
+				_ = a.repairEnforcement(userCtx, want, "cpu_quota")
+			}
+			if want.MemoryHighMB > 0 || want.MemoryMaxMB > 0 {
+				_ = a.repairEnforcement(userCtx, want, "memory")
+			}
+			if want.TasksMax > 0 {
+				_ = a.repairEnforcement(userCtx, want, "tasks")
+			}
+		}
+		cancel()
+		drift = append(drift, items...)
+		if !failed {
+			want := want
+			a.updateEnforcementState(u, func(e *NodeEnforcement) { *e = want })
+		}
+	}
+
+	if len(drift) == 0 {
+		return
+	}
+	a.logger.Printf("限制校正：发现偏差 %d 项", len(drift))
+	postCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if err := a.postEnforcementDrift(postCtx, drift); err != nil {
+		a.logger.Printf("回报限制偏差失败：%v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseSystemdSliceProps(t *testing.T) {
+	out := "CPUQuotaPerSecUSec=500ms\nMemoryHigh=4294967296\nMemoryMax=infinity\nTasksMax=512\nDevicePolicy=closed\n"
+	obs, policy := parseSystemdSliceProps(out)
+	if !obs.Observable || obs.CPUQuotaPercent != 50 || obs.MemoryHighMB != 4096 || obs.MemoryMaxMB != 0 || obs.TasksMax != 512 || policy != "closed" {
+		t.Fatalf("obs=%+v policy=%s", obs, policy)
+	}
+	obs, _ = parseSystemdSliceProps("CPUQuotaPerSecUSec=1min 30s\nTasksMax=infinity\n")
+	if obs.CPUQuotaPercent != 9000 || obs.TasksMax != 0 {
+		t.Fatalf("obs=%+v", obs)
+	}
+}
+
+func TestCompareEnforcement(t *testing.T) {
+	want := NodeEnforcement{LocalUsername: "alice", GPUBlocked: true, CPUQuotaPercent: 20, TasksMax: 256}
+
+	// 与期望一致（CPU 在 0.5% 容差内），未施加过的内存限制不比较
+	obs := observedEnforcement{Observable: true, GPUBlocked: true, CPUQuotaPercent: 20.3, TasksMax: 256, MemoryMaxMB: 8192}
+	if d := compareEnforcement(want, NodeEnforcement{}, obs); len(d) != 0 {
+		t.Fatalf("unexpected drift: %+v", d)
+	}
+
+	// 重启后限制丢失
+	obs = observedEnforcement{Observable: true, TasksMax: 10813}
+	d := compareEnforcement(want, want, obs)
+	if len(d) != 3 || d[0].Item != "gpu_block" || d[1].Item != "cpu_quota" || d[2].Item != "tasks" {
+		t.Fatalf("drift=%+v", d)
+	}
+
+	// 已解除但残留的限制：期望为空，已施加状态非零
+	last := NodeEnforcement{LocalUsername: "alice", MemoryHighMB: 1024, MemoryMaxMB: 2048}
+	obs = observedEnforcement{Observable: true, MemoryHighMB: 1024, MemoryMaxMB: 2048}
+	d = compareEnforcement(NodeEnforcement{LocalUsername: "alice"}, last, obs)
+	if len(d) != 1 || d[0].Item != "memory" {
+		t.Fatalf("drift=%+v", d)
+	}
+
+	// 无法观测时只比较 GPU 标记
+	if d := compareEnforcement(want, want, observedEnforcement{GPUBlocked: true}); len(d) != 0 {
+		t.Fatalf("unobservable drift=%+v", d)
+	}
+}
@@ -10,25 +10,140 @@ import (
 	"strings"
 )
 
-var errNoNvidiaSMI = errors.New("未检测到 nvidia-smi")
+var errNoGPUTool = errors.New("未检测到 nvidia-smi 或 rocm-smi")
+
+// gpuCollector 为 GPU 厂商工具的采集接口：进程占用的卡与显存、每张卡的利用率与显存、驱动版本。
+// 目前有 nvidia-smi 与 rocm-smi 两种实现，由 detectGPUCollector 按本机已安装的工具选择。
+type gpuCollector interface {
+	Name() string
+	ProcessUsage(ctx context.Context) (map[int32][]GPUUsage, error)
+	Devices(ctx context.Context) ([]GPUDevice, error)
+	// Versions 返回驱动版本与运行时版本（NVIDIA 为 CUDA 版本；ROCm 不提供，为空）。
+	Versions(ctx context.Context) (string, string, error)
+	// DeviceMajors 返回封禁 GPU 时需要拒绝的字符设备主设备号（见 gpu_block.go）。
+	DeviceMajors(procDevices string) []int
+}
+
+// commandRunner 执行外部命令并返回 stdout；测试中替换为回放录制的命令输出。
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
 
+func execCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s 执行失败：%w（stderr=%s）", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return b, nil
+}
+
+// detectGPUCollector 按 nvidia-smi、rocm-smi 的顺序选择采集实现；都没有时返回 nil（非 GPU 节点）。
+func detectGPUCollector(lookPath func(string) (string, error), run commandRunner) gpuCollector {
+	if _, err := lookPath("nvidia-smi"); err == nil {
+		return nvidiaCollector{run: run}
+	}
+	if _, err := lookPath("rocm-smi"); err == nil {
+		return rocmCollector{run: run}
+	}
+	return nil
+}
+
+// gpuBackend 返回本机的 GPU 采集实现；未检测到时每次上报重新检测（驱动可能在 Agent 启动后才安装）。
+func (a *NodeAgent) gpuBackend() gpuCollector {
+	if a.gpu == nil {
+		if a.gpu = detectGPUCollector(exec.LookPath, execCommand); a.gpu != nil {
+			a.logger.Printf("GPU 采集后端：%s", a.gpu.Name())
+		}
+	}
+	return a.gpu
+}
+
+// getGPUUsageMap 返回 PID -> 使用的卡；无 GPU / 无驱动时返回空表。
 func (a *NodeAgent) getGPUUsageMap(ctx context.Context) (map[int32][]GPUUsage, error) {
-	out := make(map[int32][]GPUUsage)
+	c := a.gpuBackend()
+	if c == nil {
+		return make(map[int32][]GPUUsage), nil
+	}
+	return c.ProcessUsage(ctx)
+}
+
+// getGPUDevices 采集每张卡的利用率与显存，用于控制器识别“占着显存不计算”的空闲进程。
+func (a *NodeAgent) getGPUDevices(ctx context.Context) ([]GPUDevice, error) {
+	c := a.gpuBackend()
+	if c == nil {
+		return nil, nil
+	}
+	return c.Devices(ctx)
+}
+
+// nvidiaCollector 通过 nvidia-smi 的 csv 查询采集。
+type nvidiaCollector struct {
+	run commandRunner
+}
+
+func (nvidiaCollector) Name() string { return "nvidia-smi" }
 
-	lines, err := a.runNvidiaSMI(ctx,
+func (nvidiaCollector) DeviceMajors(procDevices string) []int { return nvidiaDeviceMajors(procDevices) }
+
+func (c nvidiaCollector) query(ctx context.Context, args ...string) ([]string, error) {
+	b, err := c.run(ctx, "nvidia-smi", args...)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(string(b))
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func (c nvidiaCollector) ProcessUsage(ctx context.Context) (map[int32][]GPUUsage, error) {
+	lines, err := c.query(ctx,
 		"--query-compute-apps=pid,gpu_name,gpu_bus_id,used_memory",
 		"--format=csv,noheader,nounits",
 	)
 	if err != nil {
-		// 无 GPU/无驱动时允许降级
-		if errors.Is(err, errNoNvidiaSMI) {
-			return out, nil
-		}
 		return nil, err
 	}
+	busIDToIndex := make(map[string]int32)
+	if idxLines, err := c.query(ctx, "--query-gpu=index,pci.bus_id", "--format=csv,noheader"); err == nil {
+		busIDToIndex = parseNvidiaBusIndex(idxLines)
+	}
+	usage := parseNvidiaComputeApps(lines, busIDToIndex)
+	c.applyMIG(ctx, usage, busIDToIndex)
+	return usage, nil
+}
 
-	busIDToIndex, _ := a.getBusIDToIndexMap(ctx)
+func (c nvidiaCollector) Devices(ctx context.Context) ([]GPUDevice, error) {
+	lines, err := c.query(ctx,
+		"--query-gpu=index,pci.bus_id,name,utilization.gpu,memory.used,memory.total",
+		"--format=csv,noheader,nounits",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var out []GPUDevice
+	for _, line := range lines {
+		if d, ok := parseGPUDeviceLine(line); ok {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
 
+func (c nvidiaCollector) Versions(ctx context.Context) (string, string, error) {
+	b, err := c.run(ctx, "nvidia-smi")
+	if err != nil {
+		return "", "", err
+	}
+	driver, cuda := parseSMIVersions(string(b))
+	return driver, cuda, nil
+}
+
+// parseNvidiaComputeApps 解析 --query-compute-apps 输出；卡号按 PCI 地址对应，找不到时为 -1。
+func parseNvidiaComputeApps(lines []string, busIDToIndex map[string]int32) map[int32][]GPUUsage {
+	out := make(map[int32][]GPUUsage)
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -60,22 +175,10 @@ func (a *NodeAgent) getGPUUsageMap(ctx context.Context) (map[int32][]GPUUsage, e
 			MemoryMB: memMB,
 		})
 	}
-
-	return out, nil
+	return out
 }
 
-func (a *NodeAgent) getBusIDToIndexMap(ctx context.Context) (map[string]int32, error) {
-	lines, err := a.runNvidiaSMI(ctx,
-		"--query-gpu=index,pci.bus_id",
-		"--format=csv,noheader",
-	)
-	if err != nil {
-		if errors.Is(err, errNoNvidiaSMI) {
-			return map[string]int32{}, nil
-		}
-		return nil, err
-	}
-
+func parseNvidiaBusIndex(lines []string) map[string]int32 {
 	out := make(map[string]int32)
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -93,55 +196,31 @@ func (a *NodeAgent) getBusIDToIndexMap(ctx context.Context) (map[string]int32, e
 		busID := normalizeBusID(parts[1])
 		out[busID] = int32(idx64)
 	}
-	return out, nil
+	return out
 }
 
-func (a *NodeAgent) getGPUInventory(ctx context.Context) (string, int, error) {
-	lines, err := a.runNvidiaSMI(ctx,
-		"--query-gpu=name",
-		"--format=csv,noheader",
-	)
-	if err != nil {
-		if errors.Is(err, errNoNvidiaSMI) {
-			return "", 0, nil
-		}
-		return "", 0, err
-	}
-	count := 0
-	model := ""
-	for _, line := range lines {
-		name := strings.TrimSpace(line)
-		if name == "" {
-			continue
-		}
-		count++
-		if model == "" {
-			model = name
-		}
+// parseGPUDeviceLine 解析 --query-gpu 的一行；利用率为 [N/A]（部分虚拟化 / MIG 场景）时记为 -1。
+func parseGPUDeviceLine(line string) (GPUDevice, bool) {
+	parts := splitCSVLine(strings.TrimSpace(line))
+	if len(parts) < 6 {
+		return GPUDevice{}, false
 	}
-	return model, count, nil
-}
-
-func (a *NodeAgent) runNvidiaSMI(ctx context.Context, args ...string) ([]string, error) {
-	cmd := exec.CommandContext(ctx, "nvidia-smi", args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	b, err := cmd.Output()
+	idx, err := parseInt32(parts[0])
 	if err != nil {
-		// Linux 上找不到命令一般是 *exec.Error
-		var ee *exec.Error
-		if errors.As(err, &ee) {
-			return nil, errNoNvidiaSMI
-		}
-		return nil, fmt.Errorf("nvidia-smi 执行失败：%w（stderr=%s）", err, strings.TrimSpace(stderr.String()))
+		return GPUDevice{}, false
 	}
-
-	text := strings.TrimSpace(string(b))
-	if text == "" {
-		return nil, nil
+	d := GPUDevice{
+		Index:              idx,
+		BusID:              parts[1],
+		Name:               parts[2],
+		UtilizationPercent: -1,
+	}
+	if v, err := strconv.ParseFloat(parts[3], 64); err == nil {
+		d.UtilizationPercent = v
 	}
-	lines := strings.Split(text, "\n")
-	return lines, nil
+	d.MemoryUsedMB, _ = strconv.ParseFloat(parts[4], 64)
+	d.MemoryTotalMB, _ = strconv.ParseFloat(parts[5], 64)
+	return d, true
 }
 
 func splitCSVLine(line string) []string {
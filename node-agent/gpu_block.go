@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GPU 设备级封禁：.gpu_blocked 只对 Bash Hook 生效，直接 `command python` 或运行二进制即可绕过。
+// 这里在用户 slice 上禁止打开 GPU 设备（NVIDIA 为 /dev/nvidia*，ROCm 为 /dev/kfd 与 /dev/dri/*），由内核在 open() 时拦截：
+//   - cgroup v1：向 devices.deny 写入 "c <major>:* rwm"，解除时写 devices.allow（只影响本机 GPU 后端的设备）
+//   - cgroup v2：设备控制依赖 eBPF，交给 systemd：DevicePolicy=closed + DeviceAllow 白名单（不含 GPU 设备）
+//
+// 设备控制只在 open() 时检查，已打开 GPU 的进程不受影响，仍由 kill_process 处理。
+
+const (
+	nvidiaDeviceMajor = 195 // /dev/nvidia0..N、/dev/nvidiactl、/dev/nvidia-modeset
+	drmDeviceMajor    = 226 // /dev/dri/card*、/dev/dri/renderD*
+	procDevicesPath   = "/proc/devices"
+)
+
+// defaultGPUBlockDeviceAllow 为 systemd 方式下封禁期间仍允许的设备（终端、伪终端、fuse 等 misc 设备）；
+// /dev/null、/dev/zero、/dev/urandom 等标准伪设备由 DevicePolicy=closed 自动放行。
+var defaultGPUBlockDeviceAllow = []string{"char-pts rw", "/dev/tty rw", "/dev/ptmx rw", "char-misc rw"}
+
+// nvidiaDeviceMajors 返回 NVIDIA 相关字符设备的主设备号：固定的 195，以及 /proc/devices 中
+// nvidia-uvm、nvidia-caps、nvidia-nvswitch 等动态分配的主设备号。
+func nvidiaDeviceMajors(procDevices string) []int {
+	return charDeviceMajors(procDevices, nvidiaDeviceMajor, func(name string) bool {
+		return strings.HasPrefix(name, "nvidia")
+	})
+}
+
+// rocmDeviceMajors 返回 AMD ROCm 计算所需字符设备的主设备号：DRM 的 226（/dev/dri/renderD*，
+// 也包括 card*），以及 /proc/devices 中动态分配的 kfd（/dev/kfd，ROCm 运行时必须打开）。
+func rocmDeviceMajors(procDevices string) []int {
+	return charDeviceMajors(procDevices, drmDeviceMajor, func(name string) bool {
+		return name == "kfd" || name == "drm"
+	})
+}
+
+// charDeviceMajors 返回 fixed 以及 /proc/devices 字符设备段中名称满足 match 的主设备号（升序）；
+// /proc/devices 不可读时只返回 fixed。
+func charDeviceMajors(procDevices string, fixed int, match func(name string) bool) []int {
+	seen := map[int]struct{}{fixed: {}}
+	if f, err := os.Open(procDevices); err == nil {
+		defer f.Close()
+		inChar := false
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			ln := strings.TrimSpace(sc.Text())
+			switch {
+			case ln == "Character devices:":
+				inChar = true
+				continue
+			case ln == "Block devices:":
+				inChar = false
+				continue
+			}
+			fields := strings.Fields(ln)
+			if !inChar || len(fields) != 2 || !match(fields[1]) {
+				continue
+			}
+			if major, err := strconv.Atoi(fields[0]); err == nil && major > 0 {
+				seen[major] = struct{}{}
+			}
+		}
+	}
+	out := make([]int, 0, len(seen))
+	for m := range seen {
+		out = append(out, m)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// gpuDeviceMajors 按本机 GPU 采集后端选择要封禁的设备；尚未检测到后端时两类设备都封禁。
+func (a *NodeAgent) gpuDeviceMajors(procDevices string) []int {
+	c := a.gpuBackend()
+	if c != nil {
+		return c.DeviceMajors(procDevices)
+	}
+	seen := make(map[int]struct{})
+	for _, m := range append(nvidiaDeviceMajors(procDevices), rocmDeviceMajors(procDevices)...) {
+		seen[m] = struct{}{}
+	}
+	out := make([]int, 0, len(seen))
+	for m := range seen {
+		out = append(out, m)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func gpuDeviceRules(majors []int) []string {
+	rules := make([]string, 0, len(majors))
+	for _, m := range majors {
+		rules = append(rules, fmt.Sprintf("c %d:* rwm", m))
+	}
+	return rules
+}
+
+// writeDeviceRules 逐条写入 devices.deny / devices.allow（内核要求每次 write 只含一条规则）。
+func writeDeviceRules(path string, rules []string) error {
+	for _, r := range rules {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(r + "\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("写 %s 失败（%s）：%w", path, r, err)
+		}
+	}
+	return nil
+}
+
+// setGPUDeviceAccessCgroupV1 在 devices 层级中为用户 slice 写入规则，返回实际生效的目录。
+// 子 cgroup（session-N.scope）会继承父级的 deny 规则；用户未登录、slice 不存在时，
+// 封禁改为创建 gpuops/user-<uid> 并迁入用户进程（与 CPU 限流的 v1 兜底一致）。
+func setGPUDeviceAccessCgroupV1(devicesRoot string, uid int, username string, rules []string, block bool) (string, error) {
+	file := "devices.allow"
+	if block {
+		file = "devices.deny"
+	}
+	for _, dir := range []string{
+		filepath.Join(devicesRoot, "user.slice", fmt.Sprintf("user-%d.slice", uid)),
+		filepath.Join(devicesRoot, fmt.Sprintf("user-%d.slice", uid)),
+	} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return dir, writeDeviceRules(filepath.Join(dir, file), rules)
+		}
+	}
+
+	dir := filepath.Join(devicesRoot, "gpuops", fmt.Sprintf("user-%d", uid))
+	if !block {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			return "", nil
+		}
+		return dir, writeDeviceRules(filepath.Join(dir, file), rules)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建 cgroup v1 devices 目录失败：%w", err)
+	}
+	if err := writeDeviceRules(filepath.Join(dir, file), rules); err != nil {
+		return dir, err
+	}
+	return dir, moveUserProcsToTasks(username, filepath.Join(dir, "tasks"))
+}
+
+// systemdGPUDeviceArgs 生成 systemctl 参数；"DeviceAllow=" 先清空旧列表，再逐条追加白名单。
+func systemdGPUDeviceArgs(uid int, block bool, allow []string) []string {
+	args := []string{"set-property", "--runtime", fmt.Sprintf("user-%d.slice", uid)}
+	if !block {
+		return append(args, "DevicePolicy=auto", "DeviceAllow=")
+	}
+	args = append(args, "DevicePolicy=closed", "DeviceAllow=")
+	for _, a := range allow {
+		if a = strings.TrimSpace(a); a != "" {
+			args = append(args, "DeviceAllow="+a)
+		}
+	}
+	return args
+}
+
+// setUserGPUDeviceAccess 封禁/恢复用户对 GPU 设备的访问，返回使用的方式（cgroup-v1 / systemd）。
+func (a *NodeAgent) setUserGPUDeviceAccess(ctx context.Context, username string, block bool) (string, error) {
+	uid, err := lookupUID(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if mount, err := findCgroupV1MountPoint("devices"); err == nil {
+		rules := gpuDeviceRules(a.gpuDeviceMajors(procDevicesPath))
+		if _, err := setGPUDeviceAccessCgroupV1(mount, uid, username, rules, block); err != nil {
+			return "", err
+		}
+		return "cgroup-v1", nil
+	}
+	if isSystemd() && hasCommand("systemctl") {
+		out, err := exec.CommandContext(ctx, "systemctl", systemdGPUDeviceArgs(uid, block, a.gpuDeviceAllow)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("systemctl set-property 失败：%w（out=%s）", err, strings.TrimSpace(string(out)))
+		}
+		return "systemd", nil
+	}
+	return "", errors.New("GPU 设备封禁失败：需要 cgroup v1 devices 控制器或 systemd（cgroup v2）")
+}
+
+// reconcileGPUBlocks 按 /home/*/.gpu_blocked 补齐设备封禁：Agent 重启、系统重启或 v1 下用户 slice
+// 重新创建后，规则会丢失。systemd 方式的 --runtime 属性在重启前一直有效，每个进程生命周期只需设置一次。
+func (a *NodeAgent) reconcileGPUBlocks(ctx context.Context) {
+	if !a.gpuDeviceBlock {
+		return
+	}
+	flags, _ := filepath.Glob(filepath.Join("/home", "*", ".gpu_blocked"))
+	for _, flag := range flags {
+		username := filepath.Base(filepath.Dir(flag))
+		a.gpuBlockMu.Lock()
+		_, done := a.gpuBlockSystemd[username]
+		a.gpuBlockMu.Unlock()
+		if done {
+			continue
+		}
+		if err := a.applyGPUDeviceBlock(ctx, username, true); err != nil {
+			a.logger.Printf("GPU 设备封禁补齐失败：user=%s err=%v", username, err)
+		}
+	}
+}
+
+func (a *NodeAgent) applyGPUDeviceBlock(ctx context.Context, username string, block bool) error {
+	method, err := a.setUserGPUDeviceAccess(ctx, username, block)
+	if err != nil {
+		return err
+	}
+	a.gpuBlockMu.Lock()
+	defer a.gpuBlockMu.Unlock()
+	if block && method == "systemd" {
+		a.gpuBlockSystemd[username] = struct{}{}
+	} else {
+		delete(a.gpuBlockSystemd, username)
+	}
+	return nil
+}
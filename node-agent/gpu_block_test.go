@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNvidiaDeviceMajors(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "devices")
+	content := "Character devices:\n  1 mem\n195 nvidia-frontend\n234 nvidia-uvm\n235 nvidia-caps\n\nBlock devices:\n236 nvidia-fake-block\n"
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := gpuDeviceRules(nvidiaDeviceMajors(p))
+	want := []string{"c 195:* rwm", "c 234:* rwm", "c 235:* rwm"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("rules=%v want %v", got, want)
+	}
+	// /proc/devices 不可读时至少封禁 195
+	if got := nvidiaDeviceMajors(filepath.Join(t.TempDir(), "missing")); len(got) != 1 || got[0] != nvidiaDeviceMajor {
+		t.Fatalf("fallback majors=%v", got)
+	}
+}
+
+func TestRocmDeviceMajors(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "devices")
+	content := "Character devices:\n  1 mem\n195 nvidia-frontend\n226 drm\n238 kfd\n\nBlock devices:\n239 kfd\n"
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 按采集后端选择：ROCm 节点封禁 /dev/dri 与 /dev/kfd，不动 NVIDIA 设备
+	a := &NodeAgent{gpu: rocmCollector{}}
+	got := gpuDeviceRules(a.gpuDeviceMajors(p))
+	want := []string{"c 226:* rwm", "c 238:* rwm"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("rocm rules=%v want %v", got, want)
+	}
+	a = &NodeAgent{gpu: nvidiaCollector{}}
+	if got := gpuDeviceRules(a.gpuDeviceMajors(p)); strings.Join(got, ",") != "c 195:* rwm" {
+		t.Fatalf("nvidia rules=%v", got)
+	}
+	// /proc/devices 不可读时至少封禁 DRM
+	if got := rocmDeviceMajors(filepath.Join(t.TempDir(), "missing")); len(got) != 1 || got[0] != drmDeviceMajor {
+		t.Fatalf("fallback majors=%v", got)
+	}
+}
+
+func TestSetGPUDeviceAccessCgroupV1_FakeRoot(t *testing.T) {
+	root := t.TempDir()
+	slice := filepath.Join(root, "user.slice", "user-1000.slice")
+	if err := os.MkdirAll(slice, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"devices.deny", "devices.allow"} {
+		if err := os.WriteFile(filepath.Join(slice, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules := []string{"c 195:* rwm", "c 234:* rwm"}
+
+	dir, err := setGPUDeviceAccessCgroupV1(root, 1000, "alice", rules, true)
+	if err != nil || dir != slice {
+		t.Fatalf("block dir=%s err=%v", dir, err)
+	}
+	b, _ := os.ReadFile(filepath.Join(slice, "devices.deny"))
+	if string(b) != "c 195:* rwm\nc 234:* rwm\n" {
+		t.Fatalf("devices.deny=%q", b)
+	}
+
+	if _, err := setGPUDeviceAccessCgroupV1(root, 1000, "alice", rules, false); err != nil {
+		t.Fatalf("unblock err=%v", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(slice, "devices.allow"))
+	if string(b) != "c 195:* rwm\nc 234:* rwm\n" {
+		t.Fatalf("devices.allow=%q", b)
+	}
+
+	// 用户 slice 不存在且从未封禁：解除时无事可做
+	if dir, err := setGPUDeviceAccessCgroupV1(root, 1001, "bob", rules, false); err != nil || dir != "" {
+		t.Fatalf("unblock without slice dir=%s err=%v", dir, err)
+	}
+}
+
+func TestSystemdGPUDeviceArgs(t *testing.T) {
+	got := strings.Join(systemdGPUDeviceArgs(1000, true, []string{"char-pts rw", " ", "/dev/tty rw"}), "|")
+	want := "set-property|--runtime|user-1000.slice|DevicePolicy=closed|DeviceAllow=|DeviceAllow=char-pts rw|DeviceAllow=/dev/tty rw"
+	if got != want {
+		t.Fatalf("block args=%s", got)
+	}
+	got = strings.Join(systemdGPUDeviceArgs(1000, false, nil), "|")
+	if got != "set-property|--runtime|user-1000.slice|DevicePolicy=auto|DeviceAllow=" {
+		t.Fatalf("unblock args=%s", got)
+	}
+}
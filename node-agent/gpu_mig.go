@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MIG（Multi-Instance GPU）：--query-compute-apps 只给出父卡的 PCI 地址，无法区分实例。
+// 开启 MIG 的节点额外解析 nvidia-smi -L（实例规格与 UUID）和 nvidia-smi 默认输出
+// 的 MIG devices / Processes 表（进程所在的 GI/CI），把进程的卡记录细化到实例。
+
+var (
+	smiListGPURe = regexp.MustCompile(`^GPU\s+(\d+):\s*(.+?)\s*\(UUID:`)
+	smiListMIGRe = regexp.MustCompile(`^MIG\s+(\S+)\s+Device\s+(\d+):\s*\(UUID:\s*(MIG-[^)\s]+)\)`)
+	smiMIGDevRe  = regexp.MustCompile(`^\|\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s+\|`)
+	smiMIGProcRe = regexp.MustCompile(`^\|\s*(\d+)\s+(\d+|N/A)\s+(\d+|N/A)\s+(\d+)\s+\S+\s+.*?(\d+)MiB\s*\|$`)
+)
+
+// migInstance 为 nvidia-smi -L 中的一个 MIG 设备。
+type migInstance struct {
+	Profile string
+	UUID    string
+}
+
+// migProcess 为 Processes 表中运行在 MIG 实例上的一行。
+type migProcess struct {
+	GPU      int32
+	PID      int32
+	MemoryMB float64
+	migInstance
+}
+
+// parseSMIList 解析 nvidia-smi -L：返回卡名与 (卡号, MIG 设备号) -> 实例。
+func parseSMIList(out string) (map[int32]string, map[[2]int32]migInstance) {
+	names := make(map[int32]string)
+	instances := make(map[[2]int32]migInstance)
+	gpu := int32(-1)
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if m := smiListGPURe.FindStringSubmatch(line); m != nil {
+			idx, err := parseInt32(m[1])
+			if err != nil {
+				gpu = -1
+				continue
+			}
+			gpu = idx
+			names[gpu] = m[2]
+			continue
+		}
+		if m := smiListMIGRe.FindStringSubmatch(line); m != nil && gpu >= 0 {
+			dev, err := parseInt32(m[2])
+			if err != nil {
+				continue
+			}
+			instances[[2]int32{gpu, dev}] = migInstance{Profile: m[1], UUID: m[3]}
+		}
+	}
+	return names, instances
+}
+
+// parseSMIMIGTables 解析 nvidia-smi 默认输出：MIG devices 表给出 (卡, GI, CI) -> MIG 设备号，
+// Processes 表给出进程所在的 (卡, GI, CI)；非 MIG 卡上的进程（GI 为 N/A）不返回。
+func parseSMIMIGTables(out string, instances map[[2]int32]migInstance) []migProcess {
+	devOf := make(map[[3]int32]int32)
+	var procs []migProcess
+	section := ""
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.Contains(line, "MIG devices:"):
+			section = "mig"
+			continue
+		case strings.Contains(line, "Processes:"):
+			section = "procs"
+			continue
+		}
+		switch section {
+		case "mig":
+			m := smiMIGDevRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			var v [4]int32
+			for i := range v {
+				n, _ := strconv.ParseInt(m[i+1], 10, 32)
+				v[i] = int32(n)
+			}
+			devOf[[3]int32{v[0], v[1], v[2]}] = v[3]
+		case "procs":
+			m := smiMIGProcRe.FindStringSubmatch(line)
+			if m == nil || m[2] == "N/A" || m[3] == "N/A" {
+				continue
+			}
+			gpu, _ := parseInt32(m[1])
+			gi, _ := parseInt32(m[2])
+			ci, _ := parseInt32(m[3])
+			pid, err := parseInt32(m[4])
+			if err != nil || pid <= 0 {
+				continue
+			}
+			p := migProcess{GPU: gpu, PID: pid}
+			p.MemoryMB, _ = strconv.ParseFloat(m[5], 64)
+			if dev, ok := devOf[[3]int32{gpu, gi, ci}]; ok {
+				p.migInstance = instances[[2]int32{gpu, dev}]
+			}
+			procs = append(procs, p)
+		}
+	}
+	return procs
+}
+
+// applyMIGProcesses 用 MIG 进程表替换对应进程在 MIG 卡上的记录（每个实例一条，带规格与 UUID）。
+func applyMIGProcesses(usage map[int32][]GPUUsage, procs []migProcess, names map[int32]string, busOf map[int32]string) {
+	byPID := make(map[int32][]migProcess)
+	for _, p := range procs {
+		byPID[p.PID] = append(byPID[p.PID], p)
+	}
+	for pid, list := range byPID {
+		migGPUs := make(map[int32]bool, len(list))
+		for _, p := range list {
+			migGPUs[p.GPU] = true
+		}
+		var kept []GPUUsage
+		for _, u := range usage[pid] {
+			if !migGPUs[u.GPUID] {
+				kept = append(kept, u)
+			}
+		}
+		for _, p := range list {
+			kept = append(kept, GPUUsage{
+				GPUID:      p.GPU,
+				GPUModel:   names[p.GPU],
+				GPUBusID:   busOf[p.GPU],
+				MemoryMB:   p.MemoryMB,
+				MIGProfile: p.Profile,
+				MIGUUID:    p.UUID,
+			})
+		}
+		usage[pid] = kept
+	}
+}
+
+// applyMIG 在开启 MIG 的节点上细化进程的卡记录；未开启 MIG 时只多一次 nvidia-smi -L。
+func (c nvidiaCollector) applyMIG(ctx context.Context, usage map[int32][]GPUUsage, busIDToIndex map[string]int32) {
+	listOut, err := c.run(ctx, "nvidia-smi", "-L")
+	if err != nil {
+		return
+	}
+	names, instances := parseSMIList(string(listOut))
+	if len(instances) == 0 {
+		return
+	}
+	out, err := c.run(ctx, "nvidia-smi")
+	if err != nil {
+		return
+	}
+	busOf := make(map[int32]string, len(busIDToIndex))
+	for bus, idx := range busIDToIndex {
+		busOf[idx] = bus
+	}
+	applyMIGProcesses(usage, parseSMIMIGTables(string(out), instances), names, busOf)
+}
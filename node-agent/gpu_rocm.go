@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rocmCollector 通过 rocm-smi 的 JSON 输出采集 AMD GPU（MI 系列）。
+// rocm-smi 不提供“进程在每张卡上的显存”，进程显存按其使用的卡数平均分摊。
+type rocmCollector struct {
+	run commandRunner
+}
+
+var (
+	rocmCardRe = regexp.MustCompile(`^card(\d+)$`)
+	rocmPIDRe  = regexp.MustCompile(`^PID\s*(\d+)$`)
+	rocmNumRe  = regexp.MustCompile(`\d+`)
+)
+
+func (rocmCollector) Name() string { return "rocm-smi" }
+
+func (rocmCollector) DeviceMajors(procDevices string) []int { return rocmDeviceMajors(procDevices) }
+
+func (c rocmCollector) query(ctx context.Context, args ...string) ([]byte, error) {
+	return c.run(ctx, "rocm-smi", append(args, "--json")...)
+}
+
+func (c rocmCollector) Devices(ctx context.Context) ([]GPUDevice, error) {
+	b, err := c.query(ctx, "--showproductname", "--showbus", "--showuse", "--showmeminfo", "vram")
+	if err != nil {
+		return nil, err
+	}
+	return parseROCmDevices(b)
+}
+
+func (c rocmCollector) ProcessUsage(ctx context.Context) (map[int32][]GPUUsage, error) {
+	pids, err := c.query(ctx, "--showpids")
+	if err != nil {
+		return nil, err
+	}
+	pidGPUs, err := c.query(ctx, "--showpidgpus")
+	if err != nil {
+		return nil, err
+	}
+	devices, err := c.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseROCmProcesses(pids, pidGPUs, devices)
+}
+
+func (c rocmCollector) Versions(ctx context.Context) (string, string, error) {
+	b, err := c.query(ctx, "--showdriverversion")
+	if err != nil {
+		return "", "", err
+	}
+	out, err := decodeROCmJSON(b)
+	if err != nil {
+		return "", "", err
+	}
+	return rocmValue(out["system"], "Driver version"), "", nil
+}
+
+// decodeROCmJSON 解析 rocm-smi --json 的输出；部分版本会在 JSON 前打印 WARNING 行，需跳过。
+func decodeROCmJSON(b []byte) (map[string]map[string]string, error) {
+	if i := bytes.IndexByte(b, '{'); i > 0 {
+		b = b[i:]
+	}
+	out := make(map[string]map[string]string)
+	if len(bytes.TrimSpace(b)) == 0 {
+		return out, nil
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("rocm-smi 输出解析失败：%w", err)
+	}
+	return out, nil
+}
+
+// rocmValue 按候选键取值（不同 ROCm 版本键名大小写不同，如 "Card series" / "Card Series"）。
+func rocmValue(fields map[string]string, keys ...string) string {
+	for _, k := range keys {
+		for fk, v := range fields {
+			if strings.EqualFold(fk, k) {
+				return strings.TrimSpace(v)
+			}
+		}
+	}
+	return ""
+}
+
+func parseROCmDevices(b []byte) ([]GPUDevice, error) {
+	cards, err := decodeROCmJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	var out []GPUDevice
+	for key, fields := range cards {
+		m := rocmCardRe.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		idx, err := parseInt32(m[1])
+		if err != nil {
+			continue
+		}
+		d := GPUDevice{
+			Index:              idx,
+			BusID:              rocmValue(fields, "PCI Bus"),
+			Name:               rocmValue(fields, "Card Series", "Card SKU", "Card Model"),
+			UtilizationPercent: -1,
+		}
+		if v, err := strconv.ParseFloat(rocmValue(fields, "GPU use (%)"), 64); err == nil {
+			d.UtilizationPercent = v
+		}
+		if v, err := strconv.ParseFloat(rocmValue(fields, "VRAM Total Used Memory (B)"), 64); err == nil {
+			d.MemoryUsedMB = v / 1024 / 1024
+		}
+		if v, err := strconv.ParseFloat(rocmValue(fields, "VRAM Total Memory (B)"), 64); err == nil {
+			d.MemoryTotalMB = v / 1024 / 1024
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out, nil
+}
+
+// parseROCmProcesses 合并 --showpids（"名称, 使用卡数, 显存字节, SDMA, CU 占用"）
+// 与 --showpidgpus（进程使用的卡号列表）的输出。
+func parseROCmProcesses(pidsJSON []byte, pidGPUsJSON []byte, devices []GPUDevice) (map[int32][]GPUUsage, error) {
+	pids, err := decodeROCmJSON(pidsJSON)
+	if err != nil {
+		return nil, err
+	}
+	pidGPUs, err := decodeROCmJSON(pidGPUsJSON)
+	if err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int32]GPUDevice, len(devices))
+	for _, d := range devices {
+		byIndex[d.Index] = d
+	}
+	gpusOf := make(map[int32][]int32)
+	for _, fields := range pidGPUs {
+		for k, v := range fields {
+			m := rocmPIDRe.FindStringSubmatch(strings.TrimSpace(k))
+			if m == nil {
+				continue
+			}
+			pid, err := parseInt32(m[1])
+			if err != nil {
+				continue
+			}
+			for _, n := range rocmNumRe.FindAllString(v, -1) {
+				if idx, err := parseInt32(n); err == nil {
+					gpusOf[pid] = append(gpusOf[pid], idx)
+				}
+			}
+		}
+	}
+
+	out := make(map[int32][]GPUUsage)
+	for _, fields := range pids {
+		for k, v := range fields {
+			m := rocmPIDRe.FindStringSubmatch(strings.TrimSpace(k))
+			if m == nil {
+				continue
+			}
+			pid, err := parseInt32(m[1])
+			if err != nil || pid <= 0 {
+				continue
+			}
+			gpus := gpusOf[pid]
+			if len(gpus) == 0 {
+				continue
+			}
+			parts := splitCSVLine(v)
+			var vramMB float64
+			if len(parts) >= 3 {
+				if b, err := strconv.ParseFloat(parts[2], 64); err == nil {
+					vramMB = b / 1024 / 1024 / float64(len(gpus))
+				}
+			}
+			for _, idx := range gpus {
+				d, ok := byIndex[idx]
+				if !ok {
+					d = GPUDevice{Index: -1}
+				}
+				out[pid] = append(out[pid], GPUUsage{
+					GPUID:    d.Index,
+					GPUModel: d.Name,
+					GPUBusID: d.BusID,
+					MemoryMB: vramMB,
+				})
+			}
+		}
+	}
+	return out, nil
+}
@@ -1,9 +1,131 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+// fixtureRunner 回放 testdata 下录制的命令输出，key 为完整的命令行。
+func fixtureRunner(t *testing.T, files map[string]string) commandRunner {
+	return func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		cmdline := strings.Join(append([]string{name}, args...), " ")
+		f, ok := files[cmdline]
+		if !ok {
+			t.Fatalf("unexpected command: %s", cmdline)
+		}
+		return os.ReadFile(filepath.Join("testdata", f))
+	}
+}
+
+func TestDetectGPUCollector(t *testing.T) {
+	only := func(tool string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			if name == tool {
+				return "/usr/bin/" + name, nil
+			}
+			return "", errors.New("not found")
+		}
+	}
+	if c := detectGPUCollector(only("nvidia-smi"), nil); c == nil || c.Name() != "nvidia-smi" {
+		t.Fatalf("expected nvidia collector, got %v", c)
+	}
+	if c := detectGPUCollector(only("rocm-smi"), nil); c == nil || c.Name() != "rocm-smi" {
+		t.Fatalf("expected rocm collector, got %v", c)
+	}
+	if c := detectGPUCollector(only("none"), nil); c != nil {
+		t.Fatalf("expected no collector, got %v", c)
+	}
+}
+
+func TestNvidiaCollectorFixtures(t *testing.T) {
+	c := nvidiaCollector{run: fixtureRunner(t, map[string]string{
+		"nvidia-smi --query-compute-apps=pid,gpu_name,gpu_bus_id,used_memory --format=csv,noheader,nounits": "nvidia-smi/compute_apps.csv",
+		"nvidia-smi --query-gpu=index,pci.bus_id --format=csv,noheader":                                     "nvidia-smi/gpu_index.csv",
+		"nvidia-smi -L": "nvidia-smi/list.txt",
+		"nvidia-smi --query-gpu=index,pci.bus_id,name,utilization.gpu,memory.used,memory.total --format=csv,noheader,nounits": "nvidia-smi/devices.csv",
+	})}
+	usage, err := c.ProcessUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := usage[12345]; len(u) != 2 || u[0].GPUID != 1 || u[1].GPUID != 2 || u[0].MemoryMB != 20480 || u[0].GPUModel != "NVIDIA A100-SXM4-80GB" {
+		t.Fatalf("unexpected usage for 12345: %+v", u)
+	}
+	if u := usage[23456]; len(u) != 1 || u[0].GPUID != 0 {
+		t.Fatalf("unexpected usage for 23456: %+v", u)
+	}
+	devices, err := c.Devices(context.Background())
+	if err != nil || len(devices) != 3 || devices[1].UtilizationPercent != 97 || devices[2].UtilizationPercent != -1 {
+		t.Fatalf("unexpected devices=%+v err=%v", devices, err)
+	}
+}
+
+func TestNvidiaCollectorMIG(t *testing.T) {
+	c := nvidiaCollector{run: fixtureRunner(t, map[string]string{
+		"nvidia-smi --query-compute-apps=pid,gpu_name,gpu_bus_id,used_memory --format=csv,noheader,nounits": "nvidia-smi/mig_compute_apps.csv",
+		"nvidia-smi --query-gpu=index,pci.bus_id --format=csv,noheader":                                     "nvidia-smi/gpu_index.csv",
+		"nvidia-smi -L": "nvidia-smi/mig_list.txt",
+		"nvidia-smi":    "nvidia-smi/mig_smi.txt",
+	})}
+	usage, err := c.ProcessUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := usage[12345]; len(u) != 1 || u[0].GPUID != 0 || u[0].MIGProfile != "3g.40gb" || u[0].MIGUUID != "MIG-0a1b2c3d-4e5f-5a6b-8c7d-9e0f1a2b3c4d" ||
+		u[0].MemoryMB != 9766 || u[0].GPUModel != "NVIDIA A100-SXM4-80GB" || u[0].GPUBusID != "00000000:18:00.0" {
+		t.Fatalf("unexpected usage for 12345: %+v", u)
+	}
+	if u := usage[23456]; len(u) != 1 || u[0].MIGProfile != "1g.10gb" || u[0].MIGUUID != "MIG-1b2c3d4e-5f6a-5b7c-9d8e-0f1a2b3c4d5e" {
+		t.Fatalf("unexpected usage for 23456: %+v", u)
+	}
+	if u := usage[34567]; len(u) != 1 || u[0].GPUID != 1 || u[0].MIGProfile != "" || u[0].MemoryMB != 20480 {
+		t.Fatalf("non-MIG card should keep compute-apps record: %+v", u)
+	}
+	if driver, cuda, err := c.Versions(context.Background()); err != nil || driver != "535.154.05" || cuda != "12.2" {
+		t.Fatalf("driver=%q cuda=%q err=%v", driver, cuda, err)
+	}
+}
+
+func TestROCmCollectorFixtures(t *testing.T) {
+	c := rocmCollector{run: fixtureRunner(t, map[string]string{
+		"rocm-smi --showproductname --showbus --showuse --showmeminfo vram --json": "rocm-smi/devices.json",
+		"rocm-smi --showpids --json":          "rocm-smi/pids.json",
+		"rocm-smi --showpidgpus --json":       "rocm-smi/pidgpus.json",
+		"rocm-smi --showdriverversion --json": "rocm-smi/driverversion.json",
+	})}
+	devices, err := c.Devices(context.Background())
+	if err != nil || len(devices) != 3 {
+		t.Fatalf("unexpected devices=%+v err=%v", devices, err)
+	}
+	if d := devices[0]; d.Index != 0 || d.Name != "AMD Instinct MI210" || d.BusID != "0000:C1:00.0" || d.UtilizationPercent != 87 || d.MemoryTotalMB != 65520 || d.MemoryUsedMB != 32760 {
+		t.Fatalf("unexpected card0=%+v", d)
+	}
+	if devices[2].UtilizationPercent != -1 || devices[2].Name != "AMD Instinct MI210" {
+		t.Fatalf("N/A utilization / upper-case keys: %+v", devices[2])
+	}
+	usage, err := c.ProcessUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := usage[3250]; len(u) != 2 || u[0].GPUID != 0 || u[1].GPUID != 2 || u[0].MemoryMB != 16384 || u[1].GPUBusID != "0000:C9:00.0" {
+		t.Fatalf("unexpected usage for 3250: %+v", u)
+	}
+	if u := usage[4100]; len(u) != 1 || u[0].MemoryMB != 16384 || u[0].GPUModel != "AMD Instinct MI210" {
+		t.Fatalf("unexpected usage for 4100: %+v", u)
+	}
+	if _, ok := usage[4200]; ok {
+		t.Fatalf("process without gpu list should be skipped")
+	}
+	if driver, runtime, err := c.Versions(context.Background()); err != nil || driver != "6.7.0" || runtime != "" {
+		t.Fatalf("driver=%q runtime=%q err=%v", driver, runtime, err)
+	}
+}
+
 func TestSplitCSVLine(t *testing.T) {
 	parts := splitCSVLine("123, NVIDIA A100, 00000000:3B:00.0, 4096")
 	if len(parts) != 4 {
@@ -13,3 +135,67 @@ func TestSplitCSVLine(t *testing.T) {
 		t.Fatalf("unexpected parts=%v", parts)
 	}
 }
+
+func TestParseGPUDeviceLine(t *testing.T) {
+	d, ok := parseGPUDeviceLine("1, 00000000:3B:00.0, NVIDIA A100-SXM4-80GB, 0, 20480, 81920")
+	if !ok || d.Index != 1 || d.Name != "NVIDIA A100-SXM4-80GB" || d.UtilizationPercent != 0 || d.MemoryUsedMB != 20480 || d.MemoryTotalMB != 81920 {
+		t.Fatalf("unexpected device=%+v ok=%v", d, ok)
+	}
+	d, ok = parseGPUDeviceLine("0, 00000000:18:00.0, NVIDIA A100, [N/A], 100, 81920")
+	if !ok || d.UtilizationPercent != -1 {
+		t.Fatalf("N/A utilization should be -1, got %+v", d)
+	}
+	if _, ok := parseGPUDeviceLine("x, y"); ok {
+		t.Fatalf("short line should be rejected")
+	}
+}
+
+func TestParseGPUHealthLine(t *testing.T) {
+	g, ok := parseGPUHealthLine("0, 00000000:3B:00.0, 12, 2, 5, 3, 1, Yes")
+	if !ok || g.Index != 0 || g.ECCCorrectedVolatile != 12 || g.ECCUncorrectedVolatile != 2 || g.ECCUncorrectedAggregate != 5 ||
+		g.RetiredPagesSBE != 3 || g.RetiredPagesDBE != 1 || !g.RetiredPagesPending {
+		t.Fatalf("unexpected health=%+v ok=%v", g, ok)
+	}
+	g, ok = parseGPUHealthLine("1, 00000000:5E:00.0, [N/A], [N/A], [N/A], [N/A], [N/A], [N/A]")
+	if !ok || g.ECCUncorrectedVolatile != -1 || g.RetiredPagesDBE != -1 || g.RetiredPagesPending {
+		t.Fatalf("N/A counters should be -1, got %+v", g)
+	}
+}
+
+func TestCollectHealthROCm(t *testing.T) {
+	// rocm-smi 节点不调用 nvidia-smi，也不报“未检测到”错误；卡数照常上报用于掉卡判定
+	a := &NodeAgent{gpu: rocmCollector{run: fixtureRunner(t, nil)}, expectedGPUCount: 4}
+	h := a.collectHealth(context.Background(), 3)
+	if h == nil || len(h.Errors) != 0 || h.ExpectedGPUCount != 4 || h.DetectedGPUCount != 3 {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+}
+
+func TestParseXidAndLostGPUs(t *testing.T) {
+	ev, ok := parseXidLine("1710000000.123456 gpu01 kernel: NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, GPU has fallen off the bus.")
+	if !ok || ev.Code != 79 || ev.BusID != "0000:3b:00" || ev.GPUIndex != -1 || !strings.Contains(ev.Message, "fallen off") {
+		t.Fatalf("unexpected xid=%+v ok=%v", ev, ok)
+	}
+	if _, ok := parseXidLine("[ 12.3] NVRM: loading NVIDIA UNIX x86_64 Kernel Module"); ok {
+		t.Fatalf("non-xid line should be rejected")
+	}
+	if pciBusKey("00000000:3B:00.0") != pciBusKey(ev.BusID) {
+		t.Fatalf("bus key mismatch: %s vs %s", pciBusKey("00000000:3B:00.0"), pciBusKey(ev.BusID))
+	}
+	lost := parseLostGPUs("Unable to determine the device handle for GPU0000:3B:00.0: GPU is lost.  Reboot the system to recover this GPU")
+	if len(lost) != 1 || lost[0] != "0000:3B:00.0" {
+		t.Fatalf("lost=%v", lost)
+	}
+}
+
+func TestParseInventory(t *testing.T) {
+	header := "| NVIDIA-SMI 535.129.03             Driver Version: 535.129.03   CUDA Version: 12.2     |"
+	driver, cuda := parseSMIVersions(header)
+	if driver != "535.129.03" || cuda != "12.2" {
+		t.Fatalf("driver=%q cuda=%q", driver, cuda)
+	}
+	osRelease := parseOSRelease(bufio.NewScanner(strings.NewReader("NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 22.04.4 LTS\"\nID=ubuntu\n")))
+	if osRelease != "Ubuntu 22.04.4 LTS" {
+		t.Fatalf("os_release=%q", osRelease)
+	}
+}
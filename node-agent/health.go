@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 硬件健康信号：ECC 计数与退役页（nvidia-smi）、内核日志中的 Xid、掉卡（GPU is lost / 卡数少于 EXPECTED_GPU_COUNT）。
+// 只采集与上报，是否判定异常、是否停止分配由控制器决定。
+
+var (
+	xidLineRe = regexp.MustCompile(`NVRM: Xid \(PCI:([0-9A-Fa-f:.]+)\): (\d+),\s*(.*)$`)
+	lostGPURe = regexp.MustCompile(`(?i)GPU\s*([0-9A-Fa-f]+:[0-9A-Fa-f]+:[0-9A-Fa-f]+(?:\.[0-9A-Fa-f])?):\s*GPU is lost`)
+	dmesgTSRe = regexp.MustCompile(`^\[\s*(\d+\.\d+)\]`)
+)
+
+const xidMessage = 200
+
+const healthQueryFields = "index,pci.bus_id,ecc.errors.corrected.volatile.total,ecc.errors.uncorrected.volatile.total," +
+	"ecc.errors.uncorrected.aggregate.total,retired_pages.single_bit_ecc.count,retired_pages.double_bit.count,retired_pages.pending"
+
+// collectHealth 采集健康信号；没有 GPU 采集工具且未配置 EXPECTED_GPU_COUNT 时返回 nil（非 GPU 节点）。
+// ECC / 退役页 / Xid 为 NVIDIA 专有信号，rocm-smi 节点只上报卡数，用于掉卡判定。
+func (a *NodeAgent) collectHealth(ctx context.Context, detected int) *NodeHealth {
+	h := &NodeHealth{ExpectedGPUCount: a.expectedGPUCount, DetectedGPUCount: detected}
+	c := a.gpuBackend()
+	if c == nil {
+		if a.expectedGPUCount <= 0 {
+			return nil
+		}
+		h.Errors = append(h.Errors, errNoGPUTool.Error())
+		return h
+	}
+	if _, ok := c.(nvidiaCollector); !ok {
+		return h
+	}
+	stdout, stderr, err := a.runNvidiaSMIRaw(ctx, "--query-gpu="+healthQueryFields, "--format=csv,noheader,nounits")
+	// 掉卡时 nvidia-smi 通常整体失败，但仍会输出其余卡与 GPU is lost 提示
+	h.LostGPUs = parseLostGPUs(stdout + "\n" + stderr)
+	if err != nil && len(h.LostGPUs) == 0 {
+		h.Errors = append(h.Errors, truncateString(err.Error()+" "+strings.TrimSpace(stderr), 300))
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if g, ok := parseGPUHealthLine(line); ok {
+			h.GPUs = append(h.GPUs, g)
+		}
+	}
+
+	events, err := a.collectXidEvents(ctx)
+	if err != nil {
+		h.Errors = append(h.Errors, err.Error())
+	}
+	byBus := make(map[string]int32, len(h.GPUs))
+	for _, g := range h.GPUs {
+		byBus[pciBusKey(g.BusID)] = g.Index
+	}
+	for i := range events {
+		if idx, ok := byBus[pciBusKey(events[i].BusID)]; ok {
+			events[i].GPUIndex = idx
+		}
+	}
+	h.XidEvents = events
+	return h
+}
+
+// parseGPUHealthLine 解析健康查询的一行；不支持的字段（[N/A]，如 Ampere 之后的退役页）记为 -1。
+func parseGPUHealthLine(line string) (GPUHealth, bool) {
+	parts := splitCSVLine(strings.TrimSpace(line))
+	if len(parts) < 8 {
+		return GPUHealth{}, false
+	}
+	idx, err := parseInt32(parts[0])
+	if err != nil {
+		return GPUHealth{}, false
+	}
+	counter := func(v string) int64 {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	return GPUHealth{
+		Index:                   idx,
+		BusID:                   parts[1],
+		ECCCorrectedVolatile:    counter(parts[2]),
+		ECCUncorrectedVolatile:  counter(parts[3]),
+		ECCUncorrectedAggregate: counter(parts[4]),
+		RetiredPagesSBE:         counter(parts[5]),
+		RetiredPagesDBE:         counter(parts[6]),
+		RetiredPagesPending:     strings.EqualFold(parts[7], "yes"),
+	}, true
+}
+
+func parseLostGPUs(text string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, m := range lostGPURe.FindAllStringSubmatch(text, -1) {
+		if bus := normalizeBusID(m[1]); !seen[bus] {
+			seen[bus] = true
+			out = append(out, bus)
+		}
+	}
+	return out
+}
+
+// parseXidLine 解析内核日志中的 Xid 行，例如 "NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, GPU has fallen off the bus."
+func parseXidLine(line string) (XidEvent, bool) {
+	m := xidLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return XidEvent{}, false
+	}
+	code, err := strconv.Atoi(m[2])
+	if err != nil {
+		return XidEvent{}, false
+	}
+	return XidEvent{GPUIndex: -1, BusID: m[1], Code: code, Message: truncateString(strings.TrimSpace(m[3]), xidMessage)}, true
+}
+
+// pciBusKey 把 nvidia-smi（00000000:3B:00.0）与内核日志（0000:3b:00）的 PCI 地址统一为 "3B:00"。
+func pciBusKey(bus string) string {
+	bus = strings.ToUpper(strings.TrimSpace(bus))
+	if i := strings.LastIndex(bus, "."); i >= 0 {
+		bus = bus[:i]
+	}
+	parts := strings.Split(bus, ":")
+	if len(parts) >= 2 {
+		return parts[len(parts)-2] + ":" + parts[len(parts)-1]
+	}
+	return bus
+}
+
+// collectXidEvents 读取上次成功上报以来内核日志中的 Xid：优先 journalctl -k，没有 journald 时回退 dmesg。
+// 游标在上报成功后才前移（见 commitHealthCursor），上报失败时下次重新读取，由控制器去重。
+func (a *NodeAgent) collectXidEvents(ctx context.Context) ([]XidEvent, error) {
+	now := time.Now()
+	since := a.xidSince
+	if since.IsZero() {
+		since = now.Add(-2 * a.interval)
+	}
+	a.xidNext = now
+
+	var events []XidEvent
+	out, err := exec.CommandContext(ctx, "journalctl", "-k", "-q", "--no-pager", "-o", "short-unix",
+		"--since", fmt.Sprintf("@%d", since.Unix())).Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if ev, ok := parseXidLine(line); ok {
+				if f := strings.Fields(line); len(f) > 0 {
+					if sec, err := strconv.ParseFloat(f[0], 64); err == nil {
+						ev.Time = time.Unix(int64(sec), 0).UTC().Format(time.RFC3339)
+					}
+				}
+				events = append(events, ev)
+			}
+		}
+		return events, nil
+	}
+	var ee *exec.Error
+	if !errors.As(err, &ee) {
+		return nil, fmt.Errorf("读取内核日志失败：%w", err)
+	}
+
+	out, err = exec.CommandContext(ctx, "dmesg").Output()
+	if err != nil {
+		return nil, fmt.Errorf("读取 dmesg 失败：%w", err)
+	}
+	// dmesg 的时间戳为开机以来秒数：首次读取只建立游标，避免 Agent 重启后重复上报开机以来的全部 Xid
+	first := a.xidSince.IsZero()
+	last := a.xidDmesgLast
+	for _, line := range strings.Split(string(out), "\n") {
+		m := dmesgTSRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ts, _ := strconv.ParseFloat(m[1], 64)
+		if ts <= a.xidDmesgLast {
+			continue
+		}
+		last = max(last, ts)
+		if ev, ok := parseXidLine(line); ok && !first {
+			events = append(events, ev)
+		}
+	}
+	a.xidDmesgNext = last
+	return events, nil
+}
+
+// commitHealthCursor 在上报成功后前移 Xid 读取游标。
+func (a *NodeAgent) commitHealthCursor() {
+	if !a.xidNext.IsZero() {
+		a.xidSince = a.xidNext
+	}
+	a.xidDmesgLast = max(a.xidDmesgLast, a.xidDmesgNext)
+}
+
+func (a *NodeAgent) runNvidiaSMIRaw(ctx context.Context, args ...string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "nvidia-smi", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("nvidia-smi 执行失败：%w", err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+func truncateString(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
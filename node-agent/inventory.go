@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// 软硬件清单（驱动 / CUDA / 内核 / 系统版本、内存与磁盘容量）变化很少，按 INVENTORY_INTERVAL_SECONDS（默认 1 小时）采集，
+// 其余上报不携带 inventory；上报失败时下次继续携带。
+
+var (
+	smiDriverRe = regexp.MustCompile(`Driver Version:\s*([0-9.]+)`)
+	smiCUDARe   = regexp.MustCompile(`CUDA Version:\s*([0-9.]+)`)
+)
+
+const defaultInventoryInterval = time.Hour
+
+// inventoryDue 判断本次上报是否需要携带软硬件清单。
+func (a *NodeAgent) inventoryDue(now time.Time) bool {
+	return a.inventoryAt.IsZero() || now.Sub(a.inventoryAt) >= a.inventoryInterval
+}
+
+func (a *NodeAgent) collectInventory(ctx context.Context) *NodeInventory {
+	inv := &NodeInventory{}
+	if c := a.gpuBackend(); c != nil {
+		driver, runtime, err := c.Versions(ctx)
+		if err != nil {
+			inv.Errors = append(inv.Errors, err.Error())
+		}
+		inv.DriverVersion, inv.CUDAVersion = driver, runtime
+	}
+	if v, err := host.KernelVersionWithContext(ctx); err == nil {
+		inv.KernelVersion = strings.TrimSpace(v)
+	}
+	inv.OSRelease = readOSRelease("/etc/os-release")
+	if inv.OSRelease == "" {
+		if platform, _, version, err := host.PlatformInformationWithContext(ctx); err == nil {
+			inv.OSRelease = strings.TrimSpace(platform + " " + version)
+		}
+	}
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		inv.MemoryTotalMB = int64(vm.Total / 1024 / 1024)
+	}
+	if du, err := disk.UsageWithContext(ctx, "/"); err == nil {
+		inv.DiskTotalGB = math.Round(float64(du.Total)/1024/1024/1024*10) / 10
+	}
+	return inv
+}
+
+// commitInventory 在上报成功后记录清单采集时间。
+func (a *NodeAgent) commitInventory(metrics *MetricsData) {
+	if metrics.Inventory != nil {
+		a.inventoryAt = time.Now()
+	}
+}
+
+// parseSMIVersions 从 nvidia-smi 默认输出的表头解析驱动与 CUDA 版本。
+func parseSMIVersions(out string) (string, string) {
+	var driver, cuda string
+	if m := smiDriverRe.FindStringSubmatch(out); m != nil {
+		driver = m[1]
+	}
+	if m := smiCUDARe.FindStringSubmatch(out); m != nil {
+		cuda = m[1]
+	}
+	return driver, cuda
+}
+
+// readOSRelease 读取 os-release 的 PRETTY_NAME（如 "Ubuntu 22.04.4 LTS"）。
+func readOSRelease(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parseOSRelease(bufio.NewScanner(f))
+}
+
+func parseOSRelease(sc *bufio.Scanner) string {
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if ok && k == "PRETTY_NAME" {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// defaultKillLadder 为控制器未下发信号阶梯时的兜底（兼容旧版控制器）。
+var defaultKillLadder = []KillStep{
+	{Signal: "SIGTERM", WaitSeconds: 5},
+	{Signal: "SIGKILL", WaitSeconds: 0},
+}
+
+// killSignals 需与 controller/config.go 中的 killLadderSignals 保持一致。
+var killSignals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// normalizeKillLadder 校验信号阶梯；为空时使用默认阶梯，最后一步不是 SIGKILL 时自动补上，保证进程最终被终止。
+func normalizeKillLadder(ladder []KillStep) ([]KillStep, error) {
+	if len(ladder) == 0 {
+		return defaultKillLadder, nil
+	}
+	out := make([]KillStep, 0, len(ladder)+1)
+	for _, step := range ladder {
+		step.Signal = strings.ToUpper(strings.TrimSpace(step.Signal))
+		if !strings.HasPrefix(step.Signal, "SIG") {
+			step.Signal = "SIG" + step.Signal
+		}
+		if _, ok := killSignals[step.Signal]; !ok {
+			return nil, fmt.Errorf("不支持的信号：%s", step.Signal)
+		}
+		if step.WaitSeconds < 0 {
+			step.WaitSeconds = 0
+		}
+		out = append(out, step)
+	}
+	if out[len(out)-1].Signal != "SIGKILL" {
+		out = append(out, KillStep{Signal: "SIGKILL"})
+	}
+	return out, nil
+}
+
+func killLadderDuration(ladder []KillStep) time.Duration {
+	total := 0
+	for _, step := range ladder {
+		total += step.WaitSeconds
+	}
+	return time.Duration(total) * time.Second
+}
+
+// describeKillLadder 生成给用户看的信号顺序，例如 "SIGUSR1 → 等待 120 秒 → SIGTERM → 等待 30 秒 → SIGKILL"。
+func describeKillLadder(ladder []KillStep) string {
+	parts := make([]string, 0, len(ladder)*2)
+	for i, step := range ladder {
+		parts = append(parts, step.Signal)
+		if step.WaitSeconds > 0 && i < len(ladder)-1 {
+			parts = append(parts, fmt.Sprintf("等待 %d 秒", step.WaitSeconds))
+		}
+	}
+	return strings.Join(parts, " → ")
+}
+
+type killTarget struct {
+	pid        int32
+	createTime int64  // 用于识别 PID 复用
+	owner      string // 纳入时的属主；容器内进程可能不是目标用户
+}
+
+func (a *NodeAgent) killProcesses(ctx context.Context, username string, pids []int32, reason string, ladder []KillStep) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username 不能为空")
+	}
+	ladder, err := normalizeKillLadder(ladder)
+	if err != nil {
+		return err
+	}
+	// 欠费 kill 每个上报周期都会重复下发，正在执行阶梯的 PID 不再重复处理
+	pids = a.claimKillPIDs(pids)
+	if len(pids) == 0 {
+		return nil
+	}
+	defer a.releaseKillPIDs(pids)
+
+	report := KillReport{
+		NodeID:        a.nodeID,
+		LocalUsername: username,
+		Reason:        strings.TrimSpace(reason),
+		RequestedPIDs: pids,
+		Ladder:        ladder,
+		StartedAt:     time.Now(),
+	}
+
+	var targets []killTarget
+	for _, pid := range pids {
+		proc, err := process.NewProcess(pid)
+		if err != nil {
+			report.SkippedPIDs = append(report.SkippedPIDs, pid)
+			continue
+		}
+		procUser, uid, err := processOwner(proc)
+		if err != nil || procUser == "" {
+			report.SkippedPIDs = append(report.SkippedPIDs, pid)
+			continue
+		}
+		if procUser != username {
+			// root 容器等进程按归属结果计费，同样按归属结果校验
+			if !a.needsAttribution(procUser) {
+				report.SkippedPIDs = append(report.SkippedPIDs, pid)
+				continue
+			}
+			if attributed, _ := a.attributeProcess(ctx, pid, uid); attributed != username {
+				report.SkippedPIDs = append(report.SkippedPIDs, pid)
+				continue
+			}
+		}
+		ct, _ := proc.CreateTime()
+		targets = append(targets, killTarget{pid: pid, createTime: ct, owner: procUser})
+	}
+
+	var cgroupDirs []string
+	if len(targets) > 0 {
+		// 属主校验只针对控制器指定的 PID；通过校验后再把同一工作单元的进程一并纳入
+		extra, units, dirs := expandKillTargets(procFSRoot, cgroupFSRoot, username, targets)
+		for _, t := range extra {
+			report.TreePIDs = append(report.TreePIDs, t.pid)
+		}
+		report.Cgroups = units
+		cgroupDirs = dirs
+		targets = append(targets, extra...)
+	}
+
+	if len(targets) > 0 {
+		targetPIDs := make([]int32, 0, len(targets))
+		for _, t := range targets {
+			targetPIDs = append(targetPIDs, t.pid)
+		}
+		notice := fmt.Sprintf("%s\n以下进程将被终止：%v\n信号顺序：%s（如需保存 checkpoint，请在收到 %s 时处理）",
+			report.Reason, targetPIDs, describeKillLadder(ladder), ladder[0].Signal)
+		if err := a.writeNotice(username, strings.TrimSpace(notice)); err != nil {
+			log.Printf("写入 kill 预告失败 user=%s err=%v", username, err)
+		}
+		log.Printf("执行 kill_process：user=%s pids=%v ladder=%s reason=%s", username, targetPIDs, describeKillLadder(ladder), report.Reason)
+
+		for _, step := range ladder {
+			alive := aliveKillTargets(targets)
+			if len(alive) == 0 {
+				break
+			}
+			sig := killSignals[step.Signal]
+			for _, t := range alive {
+				if err := syscall.Kill(int(t.pid), sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+					log.Printf("%s 失败 pid=%d err=%v", step.Signal, t.pid, err)
+				}
+			}
+			wait := time.Duration(step.WaitSeconds) * time.Second
+			if step.Signal == "SIGKILL" && wait < 2*time.Second {
+				// 给内核回收留一点时间，避免把刚收到 SIGKILL 的进程误报为存活
+				wait = 2 * time.Second
+			}
+			if err := waitKillTargetsExit(ctx, alive, wait); err != nil {
+				break
+			}
+		}
+		// 容器内可能在信号间隙 fork 出新进程：cgroup v2 支持 cgroup.kill 时整体兜底
+		if len(aliveKillTargets(targets)) > 0 {
+			for _, dir := range cgroupDirs {
+				if err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644); err == nil {
+					_ = waitKillTargetsExit(ctx, targets, 2*time.Second)
+				}
+			}
+		}
+
+		for _, t := range targets {
+			if killTargetAlive(t) {
+				report.SurvivedPIDs = append(report.SurvivedPIDs, t.pid)
+			} else {
+				report.KilledPIDs = append(report.KilledPIDs, t.pid)
+			}
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	// 执行上下文可能已超时，回报使用独立的超时
+	postCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.postKillReport(postCtx, report); err != nil {
+		log.Printf("回报 kill 结果失败 user=%s err=%v", username, err)
+	}
+	if len(report.SurvivedPIDs) > 0 {
+		return fmt.Errorf("部分进程未退出：%v", report.SurvivedPIDs)
+	}
+	return nil
+}
+
+func (a *NodeAgent) claimKillPIDs(pids []int32) []int32 {
+	a.killMu.Lock()
+	defer a.killMu.Unlock()
+	if a.killing == nil {
+		a.killing = make(map[int32]struct{})
+	}
+	out := make([]int32, 0, len(pids))
+	for _, pid := range pids {
+		if _, ok := a.killing[pid]; ok {
+			continue
+		}
+		a.killing[pid] = struct{}{}
+		out = append(out, pid)
+	}
+	return out
+}
+
+func (a *NodeAgent) releaseKillPIDs(pids []int32) {
+	a.killMu.Lock()
+	defer a.killMu.Unlock()
+	for _, pid := range pids {
+		delete(a.killing, pid)
+	}
+}
+
+// killTargetAlive 判断目标是否仍存活；PID 已被复用、属主变化或已成僵尸进程都视为已退出。
+func killTargetAlive(t killTarget) bool {
+	proc, err := process.NewProcess(t.pid)
+	if err != nil {
+		return false
+	}
+	if ct, err := proc.CreateTime(); err == nil && t.createTime != 0 && ct != t.createTime {
+		return false
+	}
+	if procUser, _, err := processOwner(proc); err != nil || procUser != t.owner {
+		return false
+	}
+	if st, err := proc.Status(); err == nil && len(st) > 0 && st[0] == process.Zombie {
+		return false
+	}
+	return true
+}
+
+func aliveKillTargets(targets []killTarget) []killTarget {
+	out := make([]killTarget, 0, len(targets))
+	for _, t := range targets {
+		if killTargetAlive(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// waitKillTargetsExit 最多等待 d，全部退出则提前返回。
+func waitKillTargetsExit(ctx context.Context, targets []killTarget, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		if len(aliveKillTargets(targets)) == 0 || !time.Now().Before(deadline) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+const (
+	procFSRoot   = "/proc"
+	cgroupFSRoot = "/sys/fs/cgroup"
+)
+
+// expandableOwner 判断进程组 / 子孙进程能否随种子进程一并终止：只认该本地账号自己的进程。
+// 种子进程即便是归属到该用户的 root / 服务账号进程，也不据此扩展到同 pgid / sid 的其他 root 或服务账号进程。
+func expandableOwner(owner string, uid uint32, username string) bool {
+	return uid != 0 && owner != "root" && owner == username
+}
+
+// expandKillTargets 从已通过属主校验的种子进程出发，把同一工作单元的进程一并纳入：
+//  1. 子孙进程（dataloader worker 等），仅限该本地账号自己的进程；
+//  2. 同进程组的进程（脚本 / tmux 拉起的作业），仅限该本地账号自己的进程；
+//  3. 种子进程所在的容器 cgroup（docker / podman / containerd / k8s）内的全部进程，容器内可能以其他 UID 运行。
+//
+// 返回新增的目标、容器 cgroup 路径（用于回报）以及对应的 cgroup 目录（用于 cgroup.kill 兜底）。
+func expandKillTargets(procRoot string, cgroupRoot string, username string, seeds []killTarget) ([]killTarget, []string, []string) {
+	seen := make(map[int32]struct{}, len(seeds))
+	seedPIDs := make([]int32, 0, len(seeds))
+	for _, t := range seeds {
+		seen[t.pid] = struct{}{}
+		seedPIDs = append(seedPIDs, t.pid)
+	}
+	var extra []killTarget
+	add := func(pid int32, sameUserOnly bool) {
+		if _, ok := seen[pid]; ok {
+			return
+		}
+		proc, err := process.NewProcess(pid)
+		if err != nil {
+			return
+		}
+		owner, uid, err := processOwner(proc)
+		if err != nil || owner == "" {
+			return
+		}
+		if sameUserOnly && !expandableOwner(owner, uid, username) {
+			return
+		}
+		ct, _ := proc.CreateTime()
+		seen[pid] = struct{}{}
+		extra = append(extra, killTarget{pid: pid, createTime: ct, owner: owner})
+	}
+
+	if stats, err := listProcStats(procRoot); err == nil {
+		var group []int32
+		for _, pid := range seedPIDs {
+			group = append(group, jobGroupPIDs(stats, pid)...)
+		}
+		for _, pid := range group {
+			add(pid, true)
+		}
+		for _, pid := range descendantPIDs(stats, append(seedPIDs, group...)) {
+			add(pid, true)
+		}
+	} else {
+		log.Printf("读取进程树失败，仅处理指定 PID：%v", err)
+	}
+
+	var units, dirs []string
+	seenUnit := make(map[string]struct{})
+	for _, pid := range seedPIDs {
+		path, controller, err := readProcCgroupPath(procRoot, pid)
+		if err != nil || !isContainerCgroup(path) {
+			continue
+		}
+		unit := containerCgroupUnit(path)
+		if _, ok := seenUnit[unit]; ok {
+			continue
+		}
+		seenUnit[unit] = struct{}{}
+		dir, err := cgroupDir(cgroupRoot, controller, unit)
+		if err != nil {
+			log.Printf("定位容器 cgroup 失败 pid=%d cgroup=%s err=%v", pid, unit, err)
+			continue
+		}
+		pids, err := cgroupTreePIDs(dir)
+		if err != nil {
+			log.Printf("读取容器 cgroup 进程失败 cgroup=%s err=%v", unit, err)
+			continue
+		}
+		for _, p := range pids {
+			add(p, false)
+		}
+		units = append(units, unit)
+		if controller == "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return extra, units, dirs
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeKillLadder(t *testing.T) {
+	got, err := normalizeKillLadder(nil)
+	if err != nil || len(got) != 2 || got[0].Signal != "SIGTERM" || got[1].Signal != "SIGKILL" {
+		t.Fatalf("default ladder=%v err=%v", got, err)
+	}
+
+	got, err = normalizeKillLadder([]KillStep{{Signal: "usr1", WaitSeconds: 120}, {Signal: "SIGTERM", WaitSeconds: 30}})
+	if err != nil {
+		t.Fatalf("err=%v", err)
+	}
+	if len(got) != 3 || got[0].Signal != "SIGUSR1" || got[2].Signal != "SIGKILL" {
+		t.Fatalf("unexpected ladder=%v", got)
+	}
+	if d := killLadderDuration(got); d != 150*time.Second {
+		t.Fatalf("duration=%s", d)
+	}
+	if s := describeKillLadder(got); s != "SIGUSR1 → 等待 120 秒 → SIGTERM → 等待 30 秒 → SIGKILL" {
+		t.Fatalf("describe=%q", s)
+	}
+
+	if _, err := normalizeKillLadder([]KillStep{{Signal: "SIGSTOP"}}); err == nil {
+		t.Fatalf("expected error for unsupported signal")
+	}
+}
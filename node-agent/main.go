@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -21,6 +22,7 @@ type NodeAgent struct {
 	interval      time.Duration
 	actionPoll    time.Duration
 	stateDir      string
+	querySocket   string
 
 	client *http.Client
 	logger *log.Logger
@@ -28,6 +30,46 @@ type NodeAgent struct {
 	cpuMinPercent float64
 	numCPU        int
 	lastCPUSample map[int32]cpuSample
+
+	// 正在执行 kill 信号阶梯的 PID，避免重复下发时并发处理
+	killMu  sync.Mutex
+	killing map[int32]struct{}
+
+	// GPU 设备封禁：关闭后只写 .gpu_blocked 标记（仅 Hook 生效）
+	gpuDeviceBlock  bool
+	gpuDeviceAllow  []string
+	gpuBlockMu      sync.Mutex
+	gpuBlockSystemd map[string]struct{}
+
+	// 限制状态校正：enforceState 为 Agent 最后一次成功施加的限制（enforcement_state.json）
+	enforceInterval time.Duration
+	enforceMu       sync.Mutex
+	enforceState    map[string]NodeEnforcement
+
+	// 进程归属：attributeUsers 为需要再归属的共享服务账号（root 总是需要）
+	attributeUsers    map[string]struct{}
+	attributionLabels []string
+	// attributionEnvUsers 为允许用 GPUOPS_USER 指定归属的进程属主（ATTRIBUTION_ENV_USERS，默认为空）
+	attributionEnvUsers map[string]struct{}
+	attrMu              sync.Mutex
+	containerOwners     map[string]containerOwner
+
+	// 进程标签：上报白名单内的环境变量（为空表示关闭）
+	envTags []string
+
+	// 硬件健康：期望卡数（EXPECTED_GPU_COUNT，0 表示不检查）与 Xid 读取游标（上报成功后前移）
+	expectedGPUCount int
+	xidSince         time.Time
+	xidNext          time.Time
+	xidDmesgLast     float64
+	xidDmesgNext     float64
+
+	// GPU 采集后端（nvidia-smi / rocm-smi），首次检测到后固定
+	gpu gpuCollector
+
+	// 软硬件清单：采集周期与最近一次成功上报的时间
+	inventoryInterval time.Duration
+	inventoryAt       time.Time
 }
 
 func main() {
@@ -38,10 +80,23 @@ func main() {
 		interval:      60 * time.Second,
 		actionPoll:    1 * time.Second,
 		stateDir:      strings.TrimSpace(os.Getenv("STATE_DIR")),
+		querySocket:   strings.TrimSpace(os.Getenv("QUERY_SOCKET")),
 		logger:        log.New(os.Stdout, "[node-agent] ", log.LstdFlags|log.Lmicroseconds),
 		cpuMinPercent: 1.0,
 		numCPU:        runtime.NumCPU(),
 		lastCPUSample: map[int32]cpuSample{},
+
+		gpuDeviceBlock:  true,
+		gpuDeviceAllow:  defaultGPUBlockDeviceAllow,
+		gpuBlockSystemd: map[string]struct{}{},
+		enforceInterval: 5 * time.Minute,
+
+		inventoryInterval: defaultInventoryInterval,
+
+		attributeUsers:      map[string]struct{}{},
+		attributionEnvUsers: map[string]struct{}{},
+		attributionLabels:   defaultAttributionLabels,
+		containerOwners:     map[string]containerOwner{},
 	}
 
 	if sec := strings.TrimSpace(os.Getenv("INTERVAL_SECONDS")); sec != "" {
@@ -60,6 +115,47 @@ func main() {
 		}
 	}
 
+	if sec := strings.ToLower(strings.TrimSpace(os.Getenv("ENFORCE_INTERVAL_SECONDS"))); sec != "" {
+		if sec == "off" {
+			agent.enforceInterval = 0
+		} else if v, err := strconv.Atoi(sec); err == nil && v >= 0 {
+			agent.enforceInterval = time.Duration(v) * time.Second
+		}
+	}
+
+	for _, u := range strings.Split(os.Getenv("ATTRIBUTE_SERVICE_USERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			agent.attributeUsers[u] = struct{}{}
+		}
+	}
+	for _, u := range strings.Split(os.Getenv("ATTRIBUTION_ENV_USERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			agent.attributionEnvUsers[u] = struct{}{}
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("ATTRIBUTION_LABELS")); v != "" {
+		agent.attributionLabels = strings.Split(v, ",")
+	}
+	agent.envTags = parseEnvTagList(os.Getenv("PROCESS_ENV_TAGS"))
+	if sec := strings.TrimSpace(os.Getenv("INVENTORY_INTERVAL_SECONDS")); sec != "" {
+		if v, err := strconv.Atoi(sec); err == nil && v > 0 {
+			agent.inventoryInterval = time.Duration(v) * time.Second
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("EXPECTED_GPU_COUNT")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			agent.expectedGPUCount = n
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("GPU_DEVICE_BLOCK"))) {
+	case "0", "off", "false", "no":
+		agent.gpuDeviceBlock = false
+	}
+	if v := strings.TrimSpace(os.Getenv("GPU_BLOCK_DEVICE_ALLOW")); v != "" {
+		agent.gpuDeviceAllow = strings.Split(v, ",")
+	}
+
 	if agent.nodeID == "" {
 		hn, _ := os.Hostname()
 		agent.nodeID = hn
@@ -67,6 +163,9 @@ func main() {
 	if agent.stateDir == "" {
 		agent.stateDir = filepath.FromSlash("/var/lib/gpu-node-agent")
 	}
+	if agent.querySocket == "" {
+		agent.querySocket = defaultQuerySocket
+	}
 	agent.client = agent.defaultClient()
 
 	if err := agent.validateConfig(); err != nil {
@@ -86,6 +185,19 @@ func (a *NodeAgent) Run(ctx context.Context) {
 	defer reportTicker.Stop()
 	defer actionTicker.Stop()
 
+	go a.ServeQuerySocket(ctx)
+
+	// 校正与动作执行在同一循环中串行，避免与 block/unblock 动作交错；关闭时 enforceC 为 nil 永不触发
+	var enforceC <-chan time.Time
+	if a.enforceInterval > 0 {
+		enforceTicker := time.NewTicker(a.enforceInterval)
+		defer enforceTicker.Stop()
+		enforceC = enforceTicker.C
+		a.reconcileEnforcement(ctx)
+	} else {
+		a.reconcileGPUBlocks(ctx)
+	}
+
 	if err := a.tick(ctx); err != nil {
 		a.logger.Printf("tick 异常：%v", err)
 	}
@@ -105,11 +217,17 @@ func (a *NodeAgent) Run(ctx context.Context) {
 			if err := a.actionTick(ctx); err != nil {
 				a.logger.Printf("action tick 异常：%v", err)
 			}
+		case <-enforceC:
+			a.reconcileEnforcement(ctx)
 		}
 	}
 }
 
 func (a *NodeAgent) tick(ctx context.Context) error {
+	if a.enforceInterval <= 0 {
+		a.reconcileGPUBlocks(ctx)
+	}
+
 	collectCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
@@ -127,6 +245,8 @@ func (a *NodeAgent) tick(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	a.commitHealthCursor()
+	a.commitInventory(metrics)
 
 	a.executeActions(ctx, resp.Actions)
 
@@ -151,6 +271,11 @@ func (a *NodeAgent) actionTick(ctx context.Context) error {
 
 func (a *NodeAgent) executeActions(ctx context.Context, actions []Action) {
 	for _, act := range actions {
+		if act.Type == "kill_process" {
+			// 信号阶梯可能持续数分钟，放到后台执行，避免阻塞上报与其他动作
+			go a.executeKill(ctx, act)
+			continue
+		}
 		actCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		if err := a.ExecuteAction(actCtx, act); err != nil {
 			a.logger.Printf("执行 action 失败：type=%s user=%s err=%v", act.Type, act.Username, err)
@@ -158,3 +283,17 @@ func (a *NodeAgent) executeActions(ctx context.Context, actions []Action) {
 		cancel()
 	}
 }
+
+func (a *NodeAgent) executeKill(ctx context.Context, act Action) {
+	ladder, err := normalizeKillLadder(act.KillLadder)
+	if err != nil {
+		a.logger.Printf("执行 action 失败：type=%s user=%s err=%v", act.Type, act.Username, err)
+		return
+	}
+	act.KillLadder = ladder
+	actCtx, cancel := context.WithTimeout(ctx, killLadderDuration(ladder)+30*time.Second)
+	defer cancel()
+	if err := a.ExecuteAction(actCtx, act); err != nil {
+		a.logger.Printf("执行 action 失败：type=%s user=%s err=%v", act.Type, act.Username, err)
+	}
+}
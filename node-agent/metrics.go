@@ -32,9 +32,16 @@ func (a *NodeAgent) CollectMetrics(ctx context.Context) (*MetricsData, error) {
 	if err != nil {
 		return nil, err
 	}
-	if model, count, err := a.getGPUInventory(ctx); err == nil {
-		metrics.GPUModel = model
-		metrics.GPUCount = count
+	if devices, err := a.getGPUDevices(ctx); err == nil {
+		metrics.GPUs = devices
+		metrics.GPUCount = len(devices)
+		if len(devices) > 0 {
+			metrics.GPUModel = devices[0].Name
+		}
+	}
+	metrics.Health = a.collectHealth(ctx, len(metrics.GPUs))
+	if a.inventoryDue(time.Now()) {
+		metrics.Inventory = a.collectInventory(ctx)
 	}
 	if ioStats, err := gonet.IOCountersWithContext(ctx, false); err == nil && len(ioStats) > 0 {
 		metrics.NetRxBytes = ioStats[0].BytesRecv
@@ -58,10 +65,12 @@ func (a *NodeAgent) CollectMetrics(ctx context.Context) (*MetricsData, error) {
 		}
 		seen[pid] = struct{}{}
 
-		username, err := proc.Username()
-		if err != nil || username == "" || username == "root" {
+		owner, uid, err := processOwner(proc)
+		if err != nil || owner == "" {
 			continue
 		}
+		// root / 服务账号的系统进程大多不占 GPU，也不应按 CPU 计费；只有 GPU 进程才做归属
+		attribute := a.needsAttribution(owner)
 
 		// 计算 CPU 百分比（自维护采样差分，避免依赖 gopsutil 的内部缓存行为）
 		cpuPercent := a.computeCPUPercent(ctx, proc, now)
@@ -70,6 +79,16 @@ func (a *NodeAgent) CollectMetrics(ctx context.Context) (*MetricsData, error) {
 		if len(gpuUsage) == 0 && cpuPercent < a.cpuMinPercent {
 			continue
 		}
+		username, processUser, attribution := owner, "", ""
+		if attribute {
+			if len(gpuUsage) == 0 {
+				continue
+			}
+			if username, attribution = a.attributeProcess(ctx, pid, uid); username == "" {
+				continue
+			}
+			processUser = owner
+		}
 
 		memInfo, _ := proc.MemoryInfo()
 		memoryMB := 0.0
@@ -82,6 +101,15 @@ func (a *NodeAgent) CollectMetrics(ctx context.Context) (*MetricsData, error) {
 			cmdline = cmdline[:256]
 		}
 
+		var pgid int32
+		if st, err := readProcStat(procFSRoot, pid); err == nil {
+			pgid = st.pgid
+		}
+		var tags map[string]string
+		if len(a.envTags) > 0 {
+			tags = processEnvTags(readProcEnviron(procFSRoot, pid), a.envTags)
+		}
+
 		metrics.Users = append(metrics.Users, UserProcess{
 			Username:   username,
 			PID:        pid,
@@ -89,6 +117,11 @@ func (a *NodeAgent) CollectMetrics(ctx context.Context) (*MetricsData, error) {
 			MemoryMB:   memoryMB,
 			GPUUsage:   gpuUsage,
 			Command:    cmdline,
+
+			ProcessUser: processUser,
+			Attribution: attribution,
+			PGID:        pgid,
+			Tags:        tags,
 		})
 	}
 
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func peerUID(conn net.Conn) (uint32, error) {
+	return 0, errors.New("当前平台不支持 SO_PEERCRED")
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procStat 为 /proc/<pid>/stat 中与进程树相关的字段。
+type procStat struct {
+	pid  int32
+	ppid int32
+	pgid int32
+	sid  int32
+}
+
+// readProcStat 解析 /proc/<pid>/stat；comm 字段可能包含空格和括号，因此从最后一个 ')' 之后开始切分。
+func readProcStat(procRoot string, pid int32) (procStat, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	s := string(b)
+	idx := strings.LastIndexByte(s, ')')
+	if idx < 0 {
+		return procStat{}, fmt.Errorf("stat 格式异常 pid=%d", pid)
+	}
+	// 依次为：state ppid pgrp session ...
+	fields := strings.Fields(s[idx+1:])
+	if len(fields) < 4 {
+		return procStat{}, fmt.Errorf("stat 字段不足 pid=%d", pid)
+	}
+	st := procStat{pid: pid}
+	for i, dst := range []*int32{&st.ppid, &st.pgid, &st.sid} {
+		v, err := strconv.ParseInt(fields[i+1], 10, 32)
+		if err != nil {
+			return procStat{}, fmt.Errorf("stat 字段解析失败 pid=%d：%w", pid, err)
+		}
+		*dst = int32(v)
+	}
+	return st, nil
+}
+
+// listProcStats 读取 procRoot 下所有进程的 stat；读取过程中退出的进程直接忽略。
+func listProcStats(procRoot string) (map[int32]procStat, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int32]procStat, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.ParseInt(e.Name(), 10, 32)
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		st, err := readProcStat(procRoot, int32(pid))
+		if err != nil {
+			continue
+		}
+		out[int32(pid)] = st
+	}
+	return out, nil
+}
+
+// descendantPIDs 返回 seeds 的全部子孙进程（不含 seeds 自身）。
+func descendantPIDs(stats map[int32]procStat, seeds []int32) []int32 {
+	children := make(map[int32][]int32)
+	for _, st := range stats {
+		children[st.ppid] = append(children[st.ppid], st.pid)
+	}
+	seen := make(map[int32]struct{}, len(seeds))
+	for _, pid := range seeds {
+		seen[pid] = struct{}{}
+	}
+	var out []int32
+	queue := append([]int32(nil), seeds...)
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, c := range children[pid] {
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			out = append(out, c)
+			queue = append(queue, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// jobGroupPIDs 返回与 pid 同一进程组的进程（脚本/tmux 拉起的作业通常共享进程组）。
+// 进程组即会话本身时（例如直接在登录 shell 里前台运行）不扩展，避免误杀登录 shell。
+func jobGroupPIDs(stats map[int32]procStat, pid int32) []int32 {
+	st, ok := stats[pid]
+	if !ok || st.pgid <= 1 || st.pgid == st.sid {
+		return nil
+	}
+	var out []int32
+	for _, other := range stats {
+		if other.pgid == st.pgid && other.pid != pid {
+			out = append(out, other.pid)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// readProcCgroupPath 返回进程所在的 cgroup 路径：优先 v2（"0::/path"），否则取 v1 的 pids/memory 控制器。
+func readProcCgroupPath(procRoot string, pid int32) (path string, controller string, err error) {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	v1 := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 格式：hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(strings.TrimSpace(sc.Text()), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2], "", nil
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			v1[c] = parts[2]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", "", err
+	}
+	for _, c := range []string{"pids", "memory"} {
+		if p, ok := v1[c]; ok {
+			return p, c, nil
+		}
+	}
+	return "", "", errors.New("未找到可用的 cgroup 路径")
+}
+
+// containerCgroupPattern 匹配常见容器运行时创建的 cgroup（docker / podman / containerd / cri-o / kubernetes）。
+var containerCgroupPattern = regexp.MustCompile(`(docker-[0-9a-f]{12,}\.scope|/docker/[0-9a-f]{12,}|libpod-[0-9a-f]{12,}\.scope|/libpod_parent/|cri-containerd-[0-9a-f]{12,}\.scope|crio-[0-9a-f]{12,}\.scope|/kubepods)`)
+
+func isContainerCgroup(path string) bool {
+	return containerCgroupPattern.MatchString(path)
+}
+
+// containerCgroupUnit 把容器内的嵌套 cgroup 收敛到容器自身（例如 podman 的 libpod-<id>.scope/container）。
+// kubernetes 的 cgroup 本身已经是容器级别，原样返回。
+func containerCgroupUnit(path string) string {
+	if strings.Contains(path, "/kubepods") {
+		return path
+	}
+	loc := containerCgroupPattern.FindStringIndex(path)
+	if loc == nil {
+		return path
+	}
+	// 补齐到匹配所在路径段的结尾
+	end := loc[1]
+	if i := strings.IndexByte(path[end:], '/'); i >= 0 {
+		end += i
+	} else {
+		end = len(path)
+	}
+	return path[:end]
+}
+
+// cgroupTreePIDs 递归读取 cgroup 目录（含子 cgroup）下 cgroup.procs 中的全部进程。
+func cgroupTreePIDs(dir string) ([]int32, error) {
+	var out []int32
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "cgroup.procs" {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		for _, ln := range strings.Split(string(b), "\n") {
+			if v, err := strconv.ParseInt(strings.TrimSpace(ln), 10, 32); err == nil && v > 0 {
+				out = append(out, int32(v))
+			}
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, err
+}
+
+// cgroupDir 把 /proc/<pid>/cgroup 中的路径映射到文件系统目录。
+func cgroupDir(cgroupRoot string, controller string, path string) (string, error) {
+	if controller == "" {
+		return filepath.Join(cgroupRoot, filepath.FromSlash(path)), nil
+	}
+	mount, err := findCgroupV1MountPoint(controller)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(mount, filepath.FromSlash(path)), nil
+}
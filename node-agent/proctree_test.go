@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFakeProc(t *testing.T, root string, pid string, stat string, cgroup string) {
+	t.Helper()
+	dir := filepath.Join(root, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cgroup != "" {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcTreeExpansion(t *testing.T) {
+	root := t.TempDir()
+	// 登录 shell 100（会话首进程）→ 脚本 200（独立进程组）→ python 300 → worker 400/401
+	writeFakeProc(t, root, "100", "100 (bash) S 1 100 100 0", "")
+	writeFakeProc(t, root, "200", "200 (run.sh) S 100 200 100 0", "")
+	writeFakeProc(t, root, "300", "300 (python (train)) S 200 200 100 0", "")
+	writeFakeProc(t, root, "400", "400 (pt_data_worker) S 300 200 100 0", "")
+	writeFakeProc(t, root, "401", "401 (pt_data_worker) S 300 200 100 0", "")
+	writeFakeProc(t, root, "500", "500 (vim) S 100 500 100 0", "")
+
+	stats, err := listProcStats(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := stats[300]; st.ppid != 200 || st.pgid != 200 || st.sid != 100 {
+		t.Fatalf("unexpected stat for comm with spaces: %+v", st)
+	}
+	if got := descendantPIDs(stats, []int32{300}); !reflect.DeepEqual(got, []int32{400, 401}) {
+		t.Fatalf("descendants=%v", got)
+	}
+	if got := jobGroupPIDs(stats, 300); !reflect.DeepEqual(got, []int32{200, 400, 401}) {
+		t.Fatalf("job group=%v", got)
+	}
+	// 登录 shell 自身所在进程组不扩展
+	if got := jobGroupPIDs(stats, 100); got != nil {
+		t.Fatalf("session group should not expand, got %v", got)
+	}
+}
+
+func TestExpandableOwner(t *testing.T) {
+	cases := []struct {
+		owner string
+		uid   uint32
+		want  bool
+	}{
+		{"alice", 1001, true},
+		{"bob", 1002, false},
+		{"root", 0, false},
+		{"svc-runner", 998, false},
+		{"uid:1003", 1003, false},
+	}
+	for _, c := range cases {
+		if got := expandableOwner(c.owner, c.uid, "alice"); got != c.want {
+			t.Fatalf("expandableOwner(%q)=%v want %v", c.owner, got, c.want)
+		}
+	}
+	// 即便请求的账号就是 root，也不据此扩展
+	if expandableOwner("root", 0, "root") {
+		t.Fatal("uid 0 must never be expanded")
+	}
+}
+
+func TestContainerCgroup(t *testing.T) {
+	root := t.TempDir()
+	id := "0123456789abcdef0123"
+	writeFakeProc(t, root, "700", "700 (python) S 1 700 700 0", "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-"+id+".scope/container\n")
+	writeFakeProc(t, root, "800", "800 (python) S 1 800 800 0", "12:pids:/docker/"+id+"\n4:memory:/docker/"+id+"\n")
+
+	path, controller, err := readProcCgroupPath(root, 700)
+	if err != nil || controller != "" || !isContainerCgroup(path) {
+		t.Fatalf("path=%s controller=%s err=%v", path, controller, err)
+	}
+	if unit := containerCgroupUnit(path); unit != "/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-"+id+".scope" {
+		t.Fatalf("unit=%s", unit)
+	}
+	path, controller, err = readProcCgroupPath(root, 800)
+	if err != nil || controller != "pids" || path != "/docker/"+id {
+		t.Fatalf("v1 path=%s controller=%s err=%v", path, controller, err)
+	}
+	if isContainerCgroup("/user.slice/user-1000.slice/session-3.scope") {
+		t.Fatalf("session scope must not be treated as container")
+	}
+
+	cg := t.TempDir()
+	unitDir := filepath.Join(cg, "system.slice", "docker-"+id+".scope")
+	if err := os.MkdirAll(filepath.Join(unitDir, "init"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(unitDir, "cgroup.procs"), []byte("900\n901\n"), 0644)
+	_ = os.WriteFile(filepath.Join(unitDir, "init", "cgroup.procs"), []byte("902\n"), 0644)
+	dir, err := cgroupDir(cg, "", "/system.slice/docker-"+id+".scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pids, err := cgroupTreePIDs(dir)
+	if err != nil || !reflect.DeepEqual(pids, []int32{900, 901, 902}) {
+		t.Fatalf("pids=%v err=%v", pids, err)
+	}
+}
@@ -89,6 +89,33 @@ func (a *NodeAgent) FetchActions(ctx context.Context) (*ControllerResponse, erro
 	return &cr, nil
 }
 
+// postKillReport 回报 kill_process 的执行结果（哪些 PID 真正退出）。
+func (a *NodeAgent) postKillReport(ctx context.Context, report KillReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	u := strings.TrimRight(a.controllerURL, "/") + "/api/node/kill-reports"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent-Token", a.agentToken)
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 16*1024))
+		return fmt.Errorf("kill 结果回报返回非 2xx：code=%d body=%s", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
 func (a *NodeAgent) appendPending(metrics *MetricsData) error {
 	if err := os.MkdirAll(a.stateDir, 0755); err != nil {
 		return err
@@ -162,3 +189,62 @@ func (a *NodeAgent) flushPending(ctx context.Context) error {
 func (a *NodeAgent) defaultClient() *http.Client {
 	return &http.Client{Timeout: 8 * time.Second}
 }
+
+// fetchEnforcement 上送本机账号列表，获取其中应受限账号的期望状态（未返回的账号视为不限制）。
+func (a *NodeAgent) fetchEnforcement(ctx context.Context, localUsernames []string) ([]NodeEnforcement, error) {
+	body, err := json.Marshal(map[string]any{"node_id": a.nodeID, "local_usernames": localUsernames})
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimRight(a.controllerURL, "/") + "/api/node/enforcement"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent-Token", a.agentToken)
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 16*1024))
+		return nil, fmt.Errorf("获取期望限制状态返回非 2xx：code=%d body=%s", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var out struct {
+		Users []NodeEnforcement `json:"users"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Users, nil
+}
+
+func (a *NodeAgent) postEnforcementDrift(ctx context.Context, items []EnforcementDrift) error {
+	body, err := json.Marshal(map[string]any{"node_id": a.nodeID, "items": items})
+	if err != nil {
+		return err
+	}
+	u := strings.TrimRight(a.controllerURL, "/") + "/api/node/enforcement/drift"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent-Token", a.agentToken)
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 16*1024))
+		return fmt.Errorf("限制偏差回报返回非 2xx：code=%d body=%s", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 内存（MemoryHigh/MemoryMax）与进程数（TasksMax）限制，兜底顺序与 CPU 限流一致：
+// systemd set-property → cgroup v2（memory.high/memory.max/pids.max）→ cgroup v1（gpuops/user-<uid>）。
+// 所有数值 0 表示不限制。
+
+const mb = int64(1024 * 1024)
+
+func (a *NodeAgent) setUserMemoryLimit(ctx context.Context, username string, highMB int64, maxMB int64, reason string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username 不能为空")
+	}
+	if highMB < 0 || maxMB < 0 {
+		return fmt.Errorf("memory_high_mb/memory_max_mb 不能为负数（high=%d max=%d）", highMB, maxMB)
+	}
+	uid, err := lookupUID(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if isSystemd() && hasCommand("systemctl") {
+		err := runSystemctl(ctx, systemdMemoryArgs(uid, highMB, maxMB))
+		if err == nil {
+			return nil
+		}
+		a.logger.Printf("systemd MemoryMax 设置失败，将尝试 cgroup v2：user=%s uid=%d err=%v", username, uid, err)
+	}
+	if err := setMemoryLimitCgroupV2(cgroupFSRoot, uid, highMB, maxMB); err == nil {
+		_ = moveUserProcsToCgroupV2(uid, username)
+		return nil
+	}
+	if mount, err := findCgroupV1MountPoint("memory"); err == nil {
+		if err := setMemoryLimitCgroupV1(mount, uid, highMB, maxMB); err == nil {
+			return moveUserProcsToTasks(username, filepath.Join(mount, "gpuops", fmt.Sprintf("user-%d", uid), "tasks"))
+		}
+	}
+	return fmt.Errorf("内存限制失败：需要 systemd 或 cgroup v2/cgroup v1 memory 控制器（uid=%d reason=%s）", uid, strings.TrimSpace(reason))
+}
+
+func (a *NodeAgent) setUserTasksLimit(ctx context.Context, username string, tasksMax int64, reason string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username 不能为空")
+	}
+	if tasksMax < 0 {
+		return fmt.Errorf("tasks_max 不能为负数（实际=%d）", tasksMax)
+	}
+	uid, err := lookupUID(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if isSystemd() && hasCommand("systemctl") {
+		err := runSystemctl(ctx, systemdTasksArgs(uid, tasksMax))
+		if err == nil {
+			return nil
+		}
+		a.logger.Printf("systemd TasksMax 设置失败，将尝试 cgroup v2：user=%s uid=%d err=%v", username, uid, err)
+	}
+	if err := setTasksLimitCgroupV2(cgroupFSRoot, uid, tasksMax); err == nil {
+		_ = moveUserProcsToCgroupV2(uid, username)
+		return nil
+	}
+	if mount, err := findCgroupV1MountPoint("pids"); err == nil {
+		if err := setTasksLimitCgroupV1(mount, uid, tasksMax); err == nil {
+			return moveUserProcsToTasks(username, filepath.Join(mount, "gpuops", fmt.Sprintf("user-%d", uid), "tasks"))
+		}
+	}
+	return fmt.Errorf("进程数限制失败：需要 systemd 或 cgroup v2/cgroup v1 pids 控制器（uid=%d reason=%s）", uid, strings.TrimSpace(reason))
+}
+
+func runSystemctl(ctx context.Context, args []string) error {
+	out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s 失败：%w（out=%s）", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func systemdLimitValue(v int64, unit string) string {
+	if v <= 0 {
+		return "infinity"
+	}
+	return strconv.FormatInt(v, 10) + unit
+}
+
+func systemdMemoryArgs(uid int, highMB int64, maxMB int64) []string {
+	return []string{
+		"set-property", "--runtime", fmt.Sprintf("user-%d.slice", uid),
+		"MemoryHigh=" + systemdLimitValue(highMB, "M"),
+		"MemoryMax=" + systemdLimitValue(maxMB, "M"),
+	}
+}
+
+func systemdTasksArgs(uid int, tasksMax int64) []string {
+	return []string{"set-property", "--runtime", fmt.Sprintf("user-%d.slice", uid), "TasksMax=" + systemdLimitValue(tasksMax, "")}
+}
+
+// userSliceDirV2 返回 cgroup v2 下用户 slice 目录（要求 file 存在，即对应控制器已启用）。
+func userSliceDirV2(cgroupRoot string, uid int, file string) (string, error) {
+	for _, dir := range []string{
+		filepath.Join(cgroupRoot, "user.slice", fmt.Sprintf("user-%d.slice", uid)),
+		filepath.Join(cgroupRoot, fmt.Sprintf("user-%d.slice", uid)),
+	} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("未找到 %s（uid=%d），请确认系统启用 cgroup v2 且 Agent 以 root 运行", file, uid)
+}
+
+func cgroupV2LimitValue(v int64, scale int64) string {
+	if v <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v*scale, 10)
+}
+
+func setMemoryLimitCgroupV2(cgroupRoot string, uid int, highMB int64, maxMB int64) error {
+	dir, err := userSliceDirV2(cgroupRoot, uid, "memory.max")
+	if err != nil {
+		return err
+	}
+	// 先写 memory.max 再写 memory.high：收紧时 high 会先触发回收，放宽时 max 先放开
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(cgroupV2LimitValue(maxMB, mb)), 0644); err != nil {
+		return fmt.Errorf("写 memory.max 失败：%w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.high"), []byte(cgroupV2LimitValue(highMB, mb)), 0644); err != nil {
+		return fmt.Errorf("写 memory.high 失败：%w", err)
+	}
+	return nil
+}
+
+func setTasksLimitCgroupV2(cgroupRoot string, uid int, tasksMax int64) error {
+	dir, err := userSliceDirV2(cgroupRoot, uid, "pids.max")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte(cgroupV2LimitValue(tasksMax, 1)), 0644); err != nil {
+		return fmt.Errorf("写 pids.max 失败：%w", err)
+	}
+	return nil
+}
+
+// setMemoryLimitCgroupV1 写 memory.limit_in_bytes（对应 MemoryMax）与 memory.soft_limit_in_bytes（近似 MemoryHigh），-1 表示不限制。
+func setMemoryLimitCgroupV1(mount string, uid int, highMB int64, maxMB int64) error {
+	groupDir := filepath.Join(mount, "gpuops", fmt.Sprintf("user-%d", uid))
+	if err := os.MkdirAll(groupDir, 0755); err != nil {
+		return fmt.Errorf("创建 cgroup v1 目录失败：%w", err)
+	}
+	v1 := func(v int64) string {
+		if v <= 0 {
+			return "-1"
+		}
+		return strconv.FormatInt(v*mb, 10)
+	}
+	if err := os.WriteFile(filepath.Join(groupDir, "memory.limit_in_bytes"), []byte(v1(maxMB)), 0644); err != nil {
+		return fmt.Errorf("写 memory.limit_in_bytes 失败：%w", err)
+	}
+	if err := os.WriteFile(filepath.Join(groupDir, "memory.soft_limit_in_bytes"), []byte(v1(highMB)), 0644); err != nil {
+		return fmt.Errorf("写 memory.soft_limit_in_bytes 失败：%w", err)
+	}
+	return nil
+}
+
+func setTasksLimitCgroupV1(mount string, uid int, tasksMax int64) error {
+	groupDir := filepath.Join(mount, "gpuops", fmt.Sprintf("user-%d", uid))
+	if err := os.MkdirAll(groupDir, 0755); err != nil {
+		return fmt.Errorf("创建 cgroup v1 目录失败：%w", err)
+	}
+	if err := os.WriteFile(filepath.Join(groupDir, "pids.max"), []byte(cgroupV2LimitValue(tasksMax, 1)), 0644); err != nil {
+		return fmt.Errorf("写 pids.max 失败：%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSystemdResourceLimitArgs(t *testing.T) {
+	got := strings.Join(systemdMemoryArgs(1000, 4096, 0), " ")
+	if got != "set-property --runtime user-1000.slice MemoryHigh=4096M MemoryMax=infinity" {
+		t.Fatalf("memory args=%s", got)
+	}
+	got = strings.Join(systemdTasksArgs(1000, 512), " ")
+	if got != "set-property --runtime user-1000.slice TasksMax=512" {
+		t.Fatalf("tasks args=%s", got)
+	}
+}
+
+func TestResourceLimitsCgroupV2_FakeRoot(t *testing.T) {
+	root := t.TempDir()
+	slice := filepath.Join(root, "user.slice", "user-1000.slice")
+	if err := os.MkdirAll(slice, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"memory.max", "memory.high", "pids.max"} {
+		if err := os.WriteFile(filepath.Join(slice, f), []byte("max\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(f string) string {
+		b, _ := os.ReadFile(filepath.Join(slice, f))
+		return string(b)
+	}
+
+	if err := setMemoryLimitCgroupV2(root, 1000, 1024, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if read("memory.max") != "2147483648" || read("memory.high") != "1073741824" {
+		t.Fatalf("memory.max=%s memory.high=%s", read("memory.max"), read("memory.high"))
+	}
+	if err := setTasksLimitCgroupV2(root, 1000, 256); err != nil || read("pids.max") != "256" {
+		t.Fatalf("pids.max=%s err=%v", read("pids.max"), err)
+	}
+
+	// 0 表示解除限制
+	if err := setMemoryLimitCgroupV2(root, 1000, 0, 0); err != nil || read("memory.max") != "max" || read("memory.high") != "max" {
+		t.Fatalf("unlimit memory: max=%s high=%s err=%v", read("memory.max"), read("memory.high"), err)
+	}
+	if err := setTasksLimitCgroupV2(root, 1001, 256); err == nil {
+		t.Fatalf("expected error when user slice is missing")
+	}
+}
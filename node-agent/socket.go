@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本地查询 socket：节点上的用户通过 curl --unix-socket / gpuops 查询自己的余额、用量、排队与通知。
+// 调用者身份取自 SO_PEERCRED（内核提供的对端 UID），而不是请求参数，因此只能查到自己的数据；
+// Agent 再以 X-Agent-Token 调用控制器的 /api/node/user/*，由控制器把本地账号映射到计费账号。
+
+const defaultQuerySocket = "/run/gpu-node-agent/agent.sock"
+
+type peerConnKey struct{}
+
+// ServeQuerySocket 在 a.querySocket 上提供本地查询服务，ctx 结束时关闭。
+func (a *NodeAgent) ServeQuerySocket(ctx context.Context) {
+	path := strings.TrimSpace(a.querySocket)
+	if path == "" || path == "off" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		a.logger.Printf("本地查询 socket 创建目录失败：%v", err)
+		return
+	}
+	// 清理上次异常退出遗留的 socket 文件
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		a.logger.Printf("本地查询 socket 清理旧文件失败：%v", err)
+		return
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		a.logger.Printf("本地查询 socket 监听失败：%v", err)
+		return
+	}
+	// 所有用户都可以连接；身份由 SO_PEERCRED 决定
+	if err := os.Chmod(path, 0666); err != nil {
+		a.logger.Printf("本地查询 socket 设置权限失败：%v", err)
+	}
+
+	srv := &http.Server{
+		Handler:           a.querySocketHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, peerConnKey{}, c)
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	a.logger.Printf("本地查询 socket 已启动：%s", path)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		a.logger.Printf("本地查询 socket 异常退出：%v", err)
+	}
+}
+
+func (a *NodeAgent) querySocketHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, name := range []string{"whoami", "balance", "usage", "queue", "preemptions"} {
+		name := name
+		mux.HandleFunc("/"+name, a.withPeerUser(http.MethodGet, func(w http.ResponseWriter, r *http.Request, username string) {
+			a.proxyNodeUser(w, r, http.MethodGet, "/api/node/user/"+name, username)
+		}))
+	}
+	mux.HandleFunc("/request", a.withPeerUser(http.MethodPost, func(w http.ResponseWriter, r *http.Request, username string) {
+		a.proxyNodeUser(w, r, http.MethodPost, "/api/node/user/gpu/request", username)
+	}))
+	mux.HandleFunc("/cancel", a.withPeerUser(http.MethodPost, func(w http.ResponseWriter, r *http.Request, username string) {
+		id := strings.TrimSpace(r.URL.Query().Get("id"))
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			writeSocketJSON(w, http.StatusBadRequest, map[string]any{"error": "id 不合法"})
+			return
+		}
+		a.proxyNodeUser(w, r, http.MethodDelete, "/api/node/user/gpu/queue/"+id, username)
+	}))
+	mux.HandleFunc("/bind", a.withPeerUser(http.MethodPost, func(w http.ResponseWriter, r *http.Request, username string) {
+		a.proxyNodeUser(w, r, http.MethodPost, "/api/node/user/bind", username)
+	}))
+	mux.HandleFunc("/notice", a.withPeerUser(http.MethodGet, a.handleLocalNotice))
+	return mux
+}
+
+// withPeerUser 解析调用者的本地账号；root 可通过 ?user= 代查其他用户（便于排障）。
+func (a *NodeAgent) withPeerUser(method string, next func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeSocketJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "仅支持 " + method})
+			return
+		}
+		conn, _ := r.Context().Value(peerConnKey{}).(net.Conn)
+		if conn == nil {
+			writeSocketJSON(w, http.StatusForbidden, map[string]any{"error": "无法识别调用者"})
+			return
+		}
+		uid, err := peerUID(conn)
+		if err != nil {
+			writeSocketJSON(w, http.StatusForbidden, map[string]any{"error": "无法识别调用者：" + err.Error()})
+			return
+		}
+		username, err := usernameForUID(uid)
+		if err != nil {
+			writeSocketJSON(w, http.StatusForbidden, map[string]any{"error": err.Error()})
+			return
+		}
+		if uid == 0 {
+			if u := strings.TrimSpace(r.URL.Query().Get("user")); u != "" {
+				username = u
+			}
+		}
+		next(w, r, username)
+	}
+}
+
+func usernameForUID(uid uint32) (string, error) {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return "", fmt.Errorf("uid=%d 未找到对应账号：%w", uid, err)
+	}
+	return u.Username, nil
+}
+
+// proxyNodeUser 以 Agent 身份调用控制器的 /api/node/user/*，原样转发请求体、状态码与响应体。
+func (a *NodeAgent) proxyNodeUser(w http.ResponseWriter, r *http.Request, method string, path string, username string) {
+	q := url.Values{}
+	q.Set("node_id", a.nodeID)
+	q.Set("local_username", username)
+	if v := strings.TrimSpace(r.URL.Query().Get("limit")); v != "" {
+		q.Set("limit", v)
+	}
+	var body io.Reader
+	if method == http.MethodPost {
+		body = io.LimitReader(r.Body, 64*1024)
+	}
+	status, resp, err := a.callController(r.Context(), method, path+"?"+q.Encode(), body, false)
+	if err != nil {
+		writeSocketJSON(w, http.StatusBadGateway, map[string]any{"error": "控制器不可达：" + err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(resp)
+}
+
+// handleLocalNotice 返回本机给该用户写入的通知/限制标记，以及控制器上的公告（不可达时忽略）。
+func (a *NodeAgent) handleLocalNotice(w http.ResponseWriter, r *http.Request, username string) {
+	home := filepath.Join("/home", username)
+	out := map[string]any{"username": username}
+	if lines, err := readHeadLines(filepath.Join(home, ".gpu_notice"), 20); err == nil {
+		out["notice"] = lines
+	}
+	if lines, err := readHeadLines(filepath.Join(home, ".gpu_blocked"), 5); err == nil {
+		out["blocked"] = true
+		out["blocked_reason"] = strings.Join(lines, "\n")
+	} else {
+		out["blocked"] = false
+	}
+	if status, body, err := a.callController(r.Context(), http.MethodGet, "/api/announcements", nil, true); err == nil && status == http.StatusOK {
+		var resp struct {
+			Announcements json.RawMessage `json:"announcements"`
+		}
+		if json.Unmarshal(body, &resp) == nil && len(resp.Announcements) > 0 {
+			out["announcements"] = resp.Announcements
+		}
+	}
+	writeSocketJSON(w, http.StatusOK, out)
+}
+
+func (a *NodeAgent) callController(ctx context.Context, method string, pathAndQuery string, body io.Reader, public bool) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	u := strings.TrimRight(a.controllerURL, "/") + pathAndQuery
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if !public {
+		req.Header.Set("X-Agent-Token", a.agentToken)
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 4*1024*1024))
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, b, nil
+}
+
+func readHeadLines(path string, max int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() && len(lines) < max {
+		if ln := strings.TrimSpace(sc.Text()); ln != "" {
+			lines = append(lines, ln)
+		}
+	}
+	return lines, sc.Err()
+}
+
+func writeSocketJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuerySocket_UsesPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED 仅 Linux 支持")
+	}
+	me, err := user.Current()
+	if err != nil {
+		t.Skipf("无法获取当前账号：%v", err)
+	}
+
+	var gotQuery string
+	ctrl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Agent-Token") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		gotQuery = r.URL.Path + "?" + r.URL.RawQuery
+		_, _ = io.WriteString(w, `{"username":"x","balance":1}`)
+	}))
+	defer ctrl.Close()
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	a := &NodeAgent{
+		nodeID:        "node-1",
+		controllerURL: ctrl.URL,
+		agentToken:    "tok",
+		querySocket:   sock,
+		client:        ctrl.Client(),
+		logger:        log.New(io.Discard, "", 0),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ServeQuerySocket(ctx)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(sock); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	// 非 root 调用者传入的 user 参数必须被忽略
+	res, err := client.Get("http://agent/balance?user=someone-else")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	want := "local_username=" + me.Username
+	if me.Uid == "0" {
+		want = "local_username=someone-else"
+	}
+	if !strings.HasPrefix(gotQuery, "/api/node/user/balance?") || !strings.Contains(gotQuery, want) || !strings.Contains(gotQuery, "node_id=node-1") {
+		t.Fatalf("controller query=%q", gotQuery)
+	}
+}
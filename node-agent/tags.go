@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 进程标签：从 /proc/<pid>/environ 读取白名单中的环境变量（Slurm 作业号、项目号等），随进程上报，
+// 控制器写入 usage_records.tags，便于按作业 / 项目汇总费用。只读取白名单中的变量，避免把密钥等敏感信息上报。
+
+const maxTagValueLen = 128
+
+// defaultProcessEnvTags 为默认白名单：常见批处理调度器的作业号与平台约定的 GPUOPS_* 变量。
+var defaultProcessEnvTags = []string{
+	"SLURM_JOB_ID", "SLURM_ARRAY_JOB_ID", "SLURM_ARRAY_TASK_ID",
+	"PBS_JOBID", "LSB_JOBID",
+	"GPUOPS_PROJECT", "GPUOPS_JOB", "GPUOPS_TIER",
+}
+
+// parseEnvTagList 解析 PROCESS_ENV_TAGS：逗号分隔；off/none 关闭，空串使用默认白名单。
+func parseEnvTagList(v string) []string {
+	v = strings.TrimSpace(v)
+	switch strings.ToLower(v) {
+	case "":
+		return defaultProcessEnvTags
+	case "off", "none", "0":
+		return nil
+	}
+	var out []string
+	for _, k := range strings.Split(v, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// processEnvTags 从进程环境变量中取出白名单内的非空值，值超长时截断。
+func processEnvTags(env map[string]string, allow []string) map[string]string {
+	var tags map[string]string
+	for _, k := range allow {
+		v := strings.TrimSpace(env[k])
+		if v == "" {
+			continue
+		}
+		if len(v) > maxTagValueLen {
+			v = v[:maxTagValueLen]
+			for !utf8.ValidString(v) {
+				v = v[:len(v)-1]
+			}
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = v
+	}
+	return tags
+}
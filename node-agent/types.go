@@ -1,20 +1,25 @@
 package main
 
+import "time"
+
 // 注意：这些结构体与 controller/models.go 的 JSON 字段保持一致，便于直接通信。
 
 type MetricsData struct {
-	NodeID          string        `json:"node_id"`
-	Timestamp       string        `json:"timestamp"` // RFC3339
-	ReportID        string        `json:"report_id"`
-	IntervalSeconds int           `json:"interval_seconds,omitempty"`
-	CPUModel        string        `json:"cpu_model,omitempty"`
-	CPUCount        int           `json:"cpu_count,omitempty"`
-	GPUModel        string        `json:"gpu_model,omitempty"`
-	GPUCount        int           `json:"gpu_count,omitempty"`
-	NetRxBytes      uint64        `json:"net_rx_bytes,omitempty"`
-	NetTxBytes      uint64        `json:"net_tx_bytes,omitempty"`
-	SSHUsers        []string      `json:"ssh_users,omitempty"`
-	Users           []UserProcess `json:"users"`
+	NodeID          string         `json:"node_id"`
+	Timestamp       string         `json:"timestamp"` // RFC3339
+	ReportID        string         `json:"report_id"`
+	IntervalSeconds int            `json:"interval_seconds,omitempty"`
+	CPUModel        string         `json:"cpu_model,omitempty"`
+	CPUCount        int            `json:"cpu_count,omitempty"`
+	GPUModel        string         `json:"gpu_model,omitempty"`
+	GPUCount        int            `json:"gpu_count,omitempty"`
+	NetRxBytes      uint64         `json:"net_rx_bytes,omitempty"`
+	NetTxBytes      uint64         `json:"net_tx_bytes,omitempty"`
+	SSHUsers        []string       `json:"ssh_users,omitempty"`
+	GPUs            []GPUDevice    `json:"gpus,omitempty"`
+	Health          *NodeHealth    `json:"health,omitempty"`
+	Inventory       *NodeInventory `json:"inventory,omitempty"` // 按 INVENTORY_INTERVAL_SECONDS 携带
+	Users           []UserProcess  `json:"users"`
 }
 
 type UserProcess struct {
@@ -24,13 +29,76 @@ type UserProcess struct {
 	MemoryMB   float64    `json:"memory_mb"`
 	GPUUsage   []GPUUsage `json:"gpu_usage"`
 	Command    string     `json:"command,omitempty"`
+	// 进程被归属到 Username 时，ProcessUser 为进程实际属主（root / 服务账号 / uid:<n>），
+	// Attribution 为归属依据：container_label / cgroup / userns / env。
+	ProcessUser string `json:"process_user,omitempty"`
+	Attribution string `json:"attribution,omitempty"`
+	// PGID 为进程组 ID，控制器据此把同一作业的多个进程聚合为一个作业
+	PGID int32 `json:"pgid,omitempty"`
+	// Tags 为白名单内的进程环境变量（SLURM_JOB_ID、GPUOPS_PROJECT 等，见 PROCESS_ENV_TAGS）
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
+// GPUUsage 为进程在一张卡上的占用；运行在 MIG 实例上时带实例规格（如 1g.10gb）与 UUID，GPUID 仍为父卡编号。
 type GPUUsage struct {
-	GPUID    int32   `json:"gpu_id"`
-	GPUModel string  `json:"gpu_model"`
-	GPUBusID string  `json:"gpu_bus_id"`
-	MemoryMB float64 `json:"memory_mb"`
+	GPUID      int32   `json:"gpu_id"`
+	GPUModel   string  `json:"gpu_model"`
+	GPUBusID   string  `json:"gpu_bus_id"`
+	MemoryMB   float64 `json:"memory_mb"`
+	MIGProfile string  `json:"mig_profile,omitempty"`
+	MIGUUID    string  `json:"mig_uuid,omitempty"`
+}
+
+// GPUDevice 为单张卡的瞬时状态；UtilizationPercent 为 -1 表示驱动未提供利用率。
+type GPUDevice struct {
+	Index              int32   `json:"index"`
+	BusID              string  `json:"bus_id"`
+	Name               string  `json:"name"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+	MemoryUsedMB       float64 `json:"memory_used_mb"`
+	MemoryTotalMB      float64 `json:"memory_total_mb"`
+}
+
+// NodeInventory 为节点软硬件清单；取不到的字段为空（非 GPU 节点没有驱动与 CUDA 版本）。
+type NodeInventory struct {
+	DriverVersion string   `json:"driver_version,omitempty"`
+	CUDAVersion   string   `json:"cuda_version,omitempty"`
+	KernelVersion string   `json:"kernel_version,omitempty"`
+	OSRelease     string   `json:"os_release,omitempty"`
+	MemoryTotalMB int64    `json:"memory_total_mb,omitempty"`
+	DiskTotalGB   float64  `json:"disk_total_gb,omitempty"` // 根分区容量
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// NodeHealth 为节点硬件健康信号；ExpectedGPUCount 为 0 表示未配置期望卡数。
+type NodeHealth struct {
+	ExpectedGPUCount int         `json:"expected_gpu_count,omitempty"`
+	DetectedGPUCount int         `json:"detected_gpu_count"`
+	LostGPUs         []string    `json:"lost_gpus,omitempty"` // nvidia-smi 报告 GPU is lost 的 PCI 地址
+	GPUs             []GPUHealth `json:"gpus,omitempty"`
+	XidEvents        []XidEvent  `json:"xid_events,omitempty"`
+	Errors           []string    `json:"errors,omitempty"` // 采集失败原因（不代表硬件异常）
+}
+
+// GPUHealth 为单卡 ECC 与退役页计数；-1 表示驱动 / 架构不支持该计数。
+type GPUHealth struct {
+	Index                   int32  `json:"index"`
+	BusID                   string `json:"bus_id"`
+	ECCCorrectedVolatile    int64  `json:"ecc_corrected_volatile"`
+	ECCUncorrectedVolatile  int64  `json:"ecc_uncorrected_volatile"`
+	ECCUncorrectedAggregate int64  `json:"ecc_uncorrected_aggregate"`
+	RetiredPagesSBE         int64  `json:"retired_pages_sbe"`
+	RetiredPagesDBE         int64  `json:"retired_pages_dbe"`
+	RetiredPagesPending     bool   `json:"retired_pages_pending"`
+}
+
+// XidEvent 为内核日志中的一条 NVIDIA Xid；GPUIndex 为 -1 表示无法对应到卡号。
+type XidEvent struct {
+	GPUIndex int32  `json:"gpu_index"`
+	BusID    string `json:"bus_id"`
+	Code     int    `json:"code"`
+	Message  string `json:"message,omitempty"`
+	Time     string `json:"time,omitempty"` // RFC3339，dmesg 回退时为空
 }
 
 type ControllerResponse struct {
@@ -38,10 +106,57 @@ type ControllerResponse struct {
 }
 
 type Action struct {
-	Type            string  `json:"type"`
-	Username        string  `json:"username"`
-	PIDs            []int32 `json:"pids,omitempty"`
+	Type            string     `json:"type"`
+	Username        string     `json:"username"`
+	PIDs            []int32    `json:"pids,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+	Message         string     `json:"message,omitempty"`
+	CPUQuotaPercent float64    `json:"cpu_quota_percent,omitempty"`
+	KillLadder      []KillStep `json:"kill_ladder,omitempty"`
+	MemoryHighMB    int64      `json:"memory_high_mb,omitempty"`
+	MemoryMaxMB     int64      `json:"memory_max_mb,omitempty"`
+	TasksMax        int64      `json:"tasks_max,omitempty"`
+}
+
+type KillStep struct {
+	Signal      string `json:"signal"`
+	WaitSeconds int    `json:"wait_seconds"`
+}
+
+type KillReport struct {
+	NodeID        string     `json:"node_id"`
+	LocalUsername string     `json:"local_username"`
+	Reason        string     `json:"reason"`
+	RequestedPIDs []int32    `json:"requested_pids"`
+	KilledPIDs    []int32    `json:"killed_pids"`
+	SurvivedPIDs  []int32    `json:"survived_pids"`
+	SkippedPIDs   []int32    `json:"skipped_pids"`
+	TreePIDs      []int32    `json:"tree_pids"` // 随进程树 / 进程组 / 容器 cgroup 一并处理的 PID
+	Cgroups       []string   `json:"cgroups"`   // 整体处理的容器 cgroup
+	Ladder        []KillStep `json:"ladder"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    time.Time  `json:"finished_at"`
+}
+
+// NodeEnforcement 为控制器下发的本地账号期望限制状态（数值 0 表示不限制）。
+type NodeEnforcement struct {
+	LocalUsername   string  `json:"local_username"`
+	BillingUsername string  `json:"billing_username,omitempty"`
+	Status          string  `json:"status,omitempty"`
+	GPUBlocked      bool    `json:"gpu_blocked"`
+	CPUQuotaPercent float64 `json:"cpu_quota_percent"`
+	MemoryHighMB    int64   `json:"memory_high_mb"`
+	MemoryMaxMB     int64   `json:"memory_max_mb"`
+	TasksMax        int64   `json:"tasks_max"`
 	Reason          string  `json:"reason,omitempty"`
-	Message         string  `json:"message,omitempty"`
-	CPUQuotaPercent float64 `json:"cpu_quota_percent,omitempty"`
+}
+
+type EnforcementDrift struct {
+	LocalUsername string    `json:"local_username"`
+	Item          string    `json:"item"` // gpu_block / cpu_quota / memory / tasks
+	Expected      string    `json:"expected"`
+	Actual        string    `json:"actual"`
+	Repaired      bool      `json:"repaired"`
+	Error         string    `json:"error,omitempty"`
+	DetectedAt    time.Time `json:"detected_at"`
 }
@@ -17,5 +17,8 @@ echo "==> 构建 controller (${GOOS}/${GOARCH})"
 echo "==> 构建 node-agent (${GOOS}/${GOARCH})"
 (cd "${ROOT_DIR}/node-agent" && GOOS="${GOOS}" GOARCH="${GOARCH}" go build -o "${OUT_DIR}/node-agent" .)
 
+echo "==> 构建 gpuops (${GOOS}/${GOARCH})"
+(cd "${ROOT_DIR}/gpuops" && GOOS="${GOOS}" GOARCH="${GOARCH}" go build -o "${OUT_DIR}/gpuops" .)
+
 echo "输出目录：${OUT_DIR}"
 
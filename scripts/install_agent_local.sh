@@ -250,6 +250,10 @@ if [[ -n "${CONTROLLER_URL}" ]]; then
     log "registry_allow_realtime"
     exit 0
   fi
+  if echo "${resp}" | grep -q '"maintenance":true'; then
+    log "maintenance_deny_realtime"
+    exit 1
+  fi
   if [[ -n "${resp}" ]]; then
     log "registry_deny_realtime"
     exit 1
@@ -12,6 +12,8 @@ set -euo pipefail
 
 CONTROLLER_URL="${CONTROLLER_URL:-http://controller:8000}"
 GPUOPS_CURL_TIMEOUT="${GPUOPS_CURL_TIMEOUT:-2}"
+# 节点 Agent 本地查询 socket：按调用者 UID 识别身份，控制器锁定公开查询接口后仍可使用
+GPUOPS_AGENT_SOCKET="${GPUOPS_AGENT_SOCKET:-/run/gpu-node-agent/agent.sock}"
 
 _gpuops_username() {
   whoami
@@ -24,6 +26,14 @@ _gpuops_block_flag_path() {
 
 _gpuops_fetch_balance_json() {
   local user="$1"
+  if command -v gpuops >/dev/null 2>&1; then
+    GPUOPS_AGENT_SOCKET="${GPUOPS_AGENT_SOCKET}" timeout "${GPUOPS_CURL_TIMEOUT}" \
+      gpuops balance -o json 2>/dev/null && return 0
+  fi
+  if [[ -S "${GPUOPS_AGENT_SOCKET}" ]]; then
+    curl -fsS --max-time "${GPUOPS_CURL_TIMEOUT}" --unix-socket "${GPUOPS_AGENT_SOCKET}" \
+      "http://agent/balance" 2>/dev/null && return 0
+  fi
   curl -fsS --max-time "${GPUOPS_CURL_TIMEOUT}" \
     "${CONTROLLER_URL}/api/users/${user}/balance" 2>/dev/null || return 1
 }